@@ -0,0 +1,859 @@
+package keycloaktest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/Nerzal/gocloak/v13"
+)
+
+// Server is an in-memory fake of the parts of the Keycloak admin REST API idshield calls. It answers the way
+// Keycloak does, including the brief group representation, the tree-shaped group search results and the
+// error bodies gocloak turns into errors. Handle overrides an endpoint to inject failures
+type Server struct {
+	URL string
+
+	mu        sync.Mutex
+	srv       *httptest.Server
+	realms    map[string]*Realm
+	overrides []override
+	calls     []string
+	nextID    int
+}
+
+// Realm holds the data of one realm of the fake
+type Realm struct {
+	Name       string
+	Attributes map[string]string
+	Groups     []*Group
+	Users      []*User
+	Clients    []*Client
+	Roles      []string
+
+	server *Server
+}
+
+// Group is a group of the fake, SubGroups are kept in creation order
+type Group struct {
+	ID          string
+	Name        string
+	Attributes  map[string][]string
+	RealmRoles  []string
+	ClientRoles map[string][]string
+	SubGroups   []*Group
+	Members     []*User
+
+	parent *Group
+}
+
+// User is a user of the fake
+type User struct {
+	ID         string
+	Username   string
+	Email      string
+	FirstName  string
+	LastName   string
+	Enabled    bool
+	Attributes map[string][]string
+}
+
+// Client is a client of the fake, RoleGroups maps each role to the groups it is mapped to.
+// A non-empty Secret has to accompany the client's token requests
+type Client struct {
+	ID         string
+	ClientID   string
+	Enabled    bool
+	Roles      []string
+	RoleGroups map[string][]*Group
+	Secret     string
+}
+
+type override struct {
+	method, path string
+	handler      http.HandlerFunc
+}
+
+// NewServer starts a fake Keycloak, it is closed when the test ends
+func NewServer(t testing.TB) *Server {
+	s := &Server{realms: make(map[string]*Realm)}
+	s.srv = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	s.URL = s.srv.URL
+	t.Cleanup(s.srv.Close)
+	return s
+}
+
+// Client returns a gocloak client talking to the fake
+func (s *Server) Client() *gocloak.GoCloak {
+	return gocloak.NewClient(s.URL)
+}
+
+// Realm returns the realm name, creating it when it doesn't exist yet
+func (s *Server) Realm(name string) *Realm {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.realm(name)
+}
+
+func (s *Server) realm(name string) *Realm {
+	r, ok := s.realms[name]
+	if !ok {
+		r = &Realm{Name: name, Attributes: map[string]string{}, server: s}
+		s.realms[name] = r
+	}
+	return r
+}
+
+// Handle makes handler answer the requests for method and path, e.g. "/admin/realms/acme/groups", instead of
+// the fake. Later registrations win
+func (s *Server) Handle(method, path string, handler http.HandlerFunc) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.overrides = append([]override{{method: method, path: path, handler: handler}}, s.overrides...)
+}
+
+// Calls returns the requests the fake has received, as "METHOD path?query"
+func (s *Server) Calls() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.calls...)
+}
+
+// CallCount returns how many of the received requests start with prefix, e.g. "GET /admin/realms/acme/users"
+func (s *Server) CallCount(prefix string) int {
+	n := 0
+	for _, call := range s.Calls() {
+		if strings.HasPrefix(call, prefix) {
+			n++
+		}
+	}
+	return n
+}
+
+func (s *Server) newID() string {
+	s.nextID++
+	return fmt.Sprintf("id-%04d", s.nextID)
+}
+
+// AddGroup adds the group at path, e.g. "/parent/child", creating its missing ancestors
+func (r *Realm) AddGroup(path string, attrs map[string][]string) *Group {
+	r.server.mu.Lock()
+	defer r.server.mu.Unlock()
+	var parent *Group
+	siblings := &r.Groups
+	var grp *Group
+	for _, name := range strings.Split(strings.Trim(path, "/"), "/") {
+		grp = findByName(*siblings, name)
+		if grp == nil {
+			grp = &Group{ID: r.server.newID(), Name: name, Attributes: map[string][]string{}, parent: parent}
+			*siblings = append(*siblings, grp)
+		}
+		parent = grp
+		siblings = &grp.SubGroups
+	}
+	for key, values := range attrs {
+		grp.Attributes[key] = values
+	}
+	return grp
+}
+
+// Group returns the group at path, nil if there is none
+func (r *Realm) Group(path string) *Group {
+	r.server.mu.Lock()
+	defer r.server.mu.Unlock()
+	return r.groupByPath(path)
+}
+
+// AddUser adds a user, enabled or not
+func (r *Realm) AddUser(username string, enabled bool) *User {
+	r.server.mu.Lock()
+	defer r.server.mu.Unlock()
+	user := &User{ID: r.server.newID(), Username: username, Enabled: enabled, Attributes: map[string][]string{}}
+	r.Users = append(r.Users, user)
+	return user
+}
+
+// User returns the user named username, nil if there is none
+func (r *Realm) User(username string) *User {
+	r.server.mu.Lock()
+	defer r.server.mu.Unlock()
+	for _, user := range r.Users {
+		if user.Username == username {
+			return user
+		}
+	}
+	return nil
+}
+
+// AddClient adds a client exposing roles
+func (r *Realm) AddClient(clientID string, roles ...string) *Client {
+	r.server.mu.Lock()
+	defer r.server.mu.Unlock()
+	client := &Client{ID: r.server.newID(), ClientID: clientID, Enabled: true, Roles: roles, RoleGroups: map[string][]*Group{}}
+	r.Clients = append(r.Clients, client)
+	return client
+}
+
+// AddMembers makes users members of g
+func (g *Group) AddMembers(users ...*User) *Group {
+	g.Members = append(g.Members, users...)
+	return g
+}
+
+// Path returns the group's full path
+func (g *Group) Path() string {
+	if g.parent == nil {
+		return "/" + g.Name
+	}
+	return g.parent.Path() + "/" + g.Name
+}
+
+// Lock runs fn with the fake locked, for tests that read or change its data while handlers may be running
+func (s *Server) Lock(fn func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fn()
+}
+
+func findByName(groups []*Group, name string) *Group {
+	for _, grp := range groups {
+		if grp.Name == name {
+			return grp
+		}
+	}
+	return nil
+}
+
+func (r *Realm) groupByPath(path string) *Group {
+	siblings := r.Groups
+	var grp *Group
+	for _, name := range strings.Split(strings.Trim(path, "/"), "/") {
+		if grp = findByName(siblings, name); grp == nil {
+			return nil
+		}
+		siblings = grp.SubGroups
+	}
+	return grp
+}
+
+func (r *Realm) groupByID(id string) *Group {
+	var found *Group
+	walkGroups(r.Groups, func(grp *Group) {
+		if grp.ID == id {
+			found = grp
+		}
+	})
+	return found
+}
+
+func (r *Realm) userByID(id string) *User {
+	for _, user := range r.Users {
+		if user.ID == id {
+			return user
+		}
+	}
+	return nil
+}
+
+func walkGroups(groups []*Group, fn func(*Group)) {
+	for _, grp := range groups {
+		fn(grp)
+		walkGroups(grp.SubGroups, fn)
+	}
+}
+
+func removeGroup(groups []*Group, grp *Group) []*Group {
+	kept := []*Group{}
+	for _, g := range groups {
+		if g != grp {
+			kept = append(kept, g)
+		}
+	}
+	return kept
+}
+
+// groupRep is Keycloak's group representation, brief leaves out the attributes and role mappings
+// fullGroupRep is the representation of a single fetched group, the only one carrying the access flags
+func fullGroupRep(grp *Group) map[string]any {
+	rep := groupRep(grp, false, grp.SubGroups)
+	rep["access"] = map[string]bool{"view": true, "manage": true, "manageMembership": true}
+	return rep
+}
+
+func groupRep(grp *Group, brief bool, subGroups []*Group) map[string]any {
+	rep := map[string]any{"id": grp.ID, "name": grp.Name, "path": grp.Path()}
+	if !brief {
+		rep["attributes"] = grp.Attributes
+		realmRoles := grp.RealmRoles
+		if realmRoles == nil {
+			realmRoles = []string{}
+		}
+		rep["realmRoles"] = realmRoles
+		clientRoles := grp.ClientRoles
+		if clientRoles == nil {
+			clientRoles = map[string][]string{}
+		}
+		rep["clientRoles"] = clientRoles
+	}
+	subs := []map[string]any{}
+	for _, sub := range subGroups {
+		subs = append(subs, groupRep(sub, brief, sub.SubGroups))
+	}
+	rep["subGroups"] = subs
+	return rep
+}
+
+func userRep(user *User) map[string]any {
+	return map[string]any{
+		"id": user.ID, "username": user.Username, "email": user.Email, "firstName": user.FirstName,
+		"lastName": user.LastName, "enabled": user.Enabled, "attributes": user.Attributes,
+	}
+}
+
+// pruned returns the groups of the search result tree: the groups matching match and the ancestors of
+// matching groups, the subgroups of an ancestor limited to those leading to a match
+func pruned(groups []*Group, match func(*Group) bool) []*Group {
+	var result []*Group
+	for _, grp := range groups {
+		if match(grp) {
+			result = append(result, grp)
+			continue
+		}
+		if subs := pruned(grp.SubGroups, match); len(subs) > 0 {
+			result = append(result, &Group{ID: grp.ID, Name: grp.Name, Attributes: grp.Attributes, RealmRoles: grp.RealmRoles,
+				ClientRoles: grp.ClientRoles, SubGroups: subs, parent: grp.parent})
+		}
+	}
+	return result
+}
+
+func page[T any](items []T, query map[string][]string) []T {
+	first, _ := strconv.Atoi(firstValue(query, "first"))
+	max := -1
+	if v := firstValue(query, "max"); v != "" {
+		max, _ = strconv.Atoi(v)
+	}
+	if first > len(items) {
+		first = len(items)
+	}
+	items = items[first:]
+	if max >= 0 && max < len(items) {
+		items = items[:max]
+	}
+	return items
+}
+
+func firstValue(query map[string][]string, key string) string {
+	if values := query[key]; len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if v != nil {
+		json.NewEncoder(w).Encode(v)
+	}
+}
+
+// Error writes a Keycloak style error response, gocloak reports it as "<status>: <message>"
+func Error(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"error": message})
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, req *http.Request) {
+	s.mu.Lock()
+	call := req.Method + " " + req.URL.Path
+	if req.URL.RawQuery != "" {
+		call += "?" + req.URL.RawQuery
+	}
+	s.calls = append(s.calls, call)
+	for _, o := range s.overrides {
+		if o.method == req.Method && o.path == req.URL.Path {
+			s.mu.Unlock()
+			o.handler(w, req)
+			return
+		}
+	}
+	defer s.mu.Unlock()
+	s.serveFake(w, req)
+}
+
+// Fake answers req with the fake, bypassing the handlers registered with Handle, so a handler can alter only
+// some of the requests for its path
+func (s *Server) Fake(w http.ResponseWriter, req *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.serveFake(w, req)
+}
+
+func (s *Server) serveFake(w http.ResponseWriter, req *http.Request) {
+	if strings.HasPrefix(req.URL.Path, "/realms/") {
+		s.serveToken(w, req)
+		return
+	}
+	if strings.TrimSuffix(req.URL.Path, "/") == "/admin/realms" && req.Method == http.MethodGet {
+		realms := []map[string]any{}
+		for _, r := range s.realms {
+			realms = append(realms, map[string]any{"realm": r.Name})
+		}
+		sort.Slice(realms, func(i, j int) bool { return realms[i]["realm"].(string) < realms[j]["realm"].(string) })
+		writeJSON(w, http.StatusOK, realms)
+		return
+	}
+	path := strings.TrimPrefix(req.URL.Path, "/admin/realms/")
+	if path == req.URL.Path {
+		Error(w, http.StatusNotFound, "HTTP 404 Not Found")
+		return
+	}
+	parts := strings.Split(path, "/")
+	r, ok := s.realms[parts[0]]
+	if !ok {
+		Error(w, http.StatusNotFound, "Realm not found.")
+		return
+	}
+	s.serveRealm(w, req, r, parts[1:])
+}
+
+func (s *Server) serveToken(w http.ResponseWriter, req *http.Request) {
+	realm := strings.Split(strings.TrimPrefix(req.URL.Path, "/realms/"), "/")[0]
+	req.ParseForm()
+	// confidential clients authenticate with basic auth, public ones only name themselves in the form
+	clientID, secret, ok := req.BasicAuth()
+	if !ok {
+		clientID, secret = req.PostForm.Get("client_id"), req.PostForm.Get("client_secret")
+	}
+	if r, ok := s.realms[realm]; ok {
+		for _, client := range r.Clients {
+			if client.ClientID == clientID && client.Secret != secret {
+				writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "unauthorized_client", "error_description": "Invalid client or Invalid client credentials"})
+				return
+			}
+		}
+	}
+	switch req.PostForm.Get("grant_type") {
+	case "refresh_token", "client_credentials":
+		writeJSON(w, http.StatusOK, map[string]any{
+			"access_token":  Token(realm, "service-account"),
+			"refresh_token": "refresh-" + realm,
+			"expires_in":    300,
+			"token_type":    "Bearer",
+		})
+	default:
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "unsupported_grant_type"})
+	}
+}
+
+func (s *Server) serveRealm(w http.ResponseWriter, req *http.Request, r *Realm, parts []string) {
+	query := req.URL.Query()
+	switch {
+	case len(parts) == 0 || parts[0] == "":
+		writeJSON(w, http.StatusOK, map[string]any{"realm": r.Name, "attributes": r.Attributes})
+	case parts[0] == "groups" && len(parts) == 1:
+		s.serveGroups(w, req, r)
+	case parts[0] == "groups" && len(parts) == 2 && parts[1] == "count":
+		n := 0
+		match := groupMatcher(query)
+		if firstValue(query, "top") == "true" {
+			n = len(pruned(r.Groups, match))
+		} else {
+			walkGroups(r.Groups, func(grp *Group) {
+				if match(grp) {
+					n++
+				}
+			})
+		}
+		writeJSON(w, http.StatusOK, map[string]int{"count": n})
+	case parts[0] == "groups":
+		grp := r.groupByID(parts[1])
+		if grp == nil {
+			Error(w, http.StatusNotFound, "Could not find group by id")
+			return
+		}
+		s.serveGroup(w, req, r, grp, parts[2:])
+	case parts[0] == "group-by-path":
+		grp := r.groupByPath(strings.Join(parts[1:], "/"))
+		if grp == nil {
+			Error(w, http.StatusNotFound, "Group path does not exist")
+			return
+		}
+		writeJSON(w, http.StatusOK, fullGroupRep(grp))
+	case parts[0] == "users":
+		s.serveUsers(w, req, r, parts[1:])
+	case parts[0] == "clients":
+		s.serveClients(w, req, r, parts[1:])
+	case parts[0] == "roles" && len(parts) == 2:
+		for _, role := range r.Roles {
+			if role == parts[1] {
+				writeJSON(w, http.StatusOK, map[string]any{"id": "role-" + role, "name": role})
+				return
+			}
+		}
+		Error(w, http.StatusNotFound, "Could not find role")
+	default:
+		Error(w, http.StatusNotFound, "HTTP 404 Not Found")
+	}
+}
+
+// groupMatcher returns the filter of a groups search: search is a case-insensitive substring match of the
+// name, or an exact match with exact=true, q a space separated list of key:value attribute matches
+func groupMatcher(query map[string][]string) func(*Group) bool {
+	search := firstValue(query, "search")
+	exact := firstValue(query, "exact") == "true"
+	q := firstValue(query, "q")
+	return func(grp *Group) bool {
+		if search != "" {
+			if exact && grp.Name != search {
+				return false
+			}
+			if !exact && !strings.Contains(strings.ToLower(grp.Name), strings.ToLower(search)) {
+				return false
+			}
+		}
+		for _, cond := range strings.Fields(q) {
+			key, value, _ := strings.Cut(cond, ":")
+			values := grp.Attributes[key]
+			if len(values) == 0 || values[0] != value {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+func (s *Server) serveGroups(w http.ResponseWriter, req *http.Request, r *Realm) {
+	switch req.Method {
+	case http.MethodGet:
+		query := req.URL.Query()
+		brief := firstValue(query, "briefRepresentation") != "false"
+		groups := r.Groups
+		if firstValue(query, "search") != "" || firstValue(query, "q") != "" {
+			groups = pruned(r.Groups, groupMatcher(query))
+		}
+		reps := []map[string]any{}
+		for _, grp := range page(groups, query) {
+			reps = append(reps, groupRep(grp, brief, grp.SubGroups))
+		}
+		writeJSON(w, http.StatusOK, reps)
+	case http.MethodPost:
+		var rep gocloak.Group
+		json.NewDecoder(req.Body).Decode(&rep)
+		s.createGroup(w, r, nil, &r.Groups, rep)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *Server) createGroup(w http.ResponseWriter, r *Realm, parent *Group, siblings *[]*Group, rep gocloak.Group) {
+	name := gocloak.PString(rep.Name)
+	if existing := findByName(*siblings, name); existing != nil {
+		if parent == nil {
+			writeJSON(w, http.StatusConflict, map[string]string{"errorMessage": "Top level group named '" + name + "' already exists."})
+		} else {
+			writeJSON(w, http.StatusConflict, map[string]string{"errorMessage": "Sibling group named '" + name + "' already exists."})
+		}
+		return
+	}
+	// posting an existing group as a child moves it under the parent
+	if rep.ID != nil {
+		if grp := r.groupByID(*rep.ID); grp != nil {
+			if grp.parent == nil {
+				r.Groups = removeGroup(r.Groups, grp)
+			} else {
+				grp.parent.SubGroups = removeGroup(grp.parent.SubGroups, grp)
+			}
+			grp.parent = parent
+			*siblings = append(*siblings, grp)
+			writeJSON(w, http.StatusNoContent, nil)
+			return
+		}
+	}
+	grp := &Group{ID: s.newID(), Name: name, Attributes: map[string][]string{}, parent: parent}
+	if rep.Attributes != nil {
+		grp.Attributes = *rep.Attributes
+	}
+	*siblings = append(*siblings, grp)
+	w.Header().Set("Location", s.URL+"/admin/realms/"+r.Name+"/groups/"+grp.ID)
+	writeJSON(w, http.StatusCreated, nil)
+}
+
+func (s *Server) serveGroup(w http.ResponseWriter, req *http.Request, r *Realm, grp *Group, rest []string) {
+	query := req.URL.Query()
+	switch {
+	case len(rest) == 0 && req.Method == http.MethodGet:
+		writeJSON(w, http.StatusOK, fullGroupRep(grp))
+	case len(rest) == 0 && req.Method == http.MethodPut:
+		var rep gocloak.Group
+		json.NewDecoder(req.Body).Decode(&rep)
+		if name := gocloak.PString(rep.Name); name != "" && name != grp.Name {
+			siblings := r.Groups
+			if grp.parent != nil {
+				siblings = grp.parent.SubGroups
+			}
+			if findByName(siblings, name) != nil {
+				writeJSON(w, http.StatusConflict, map[string]string{"errorMessage": "Sibling group named '" + name + "' already exists."})
+				return
+			}
+			grp.Name = name
+		}
+		// like Keycloak, attributes are only replaced when the update carries them
+		if rep.Attributes != nil {
+			grp.Attributes = *rep.Attributes
+		}
+		writeJSON(w, http.StatusNoContent, nil)
+	case len(rest) == 0 && req.Method == http.MethodDelete:
+		if grp.parent == nil {
+			r.Groups = removeGroup(r.Groups, grp)
+		} else {
+			grp.parent.SubGroups = removeGroup(grp.parent.SubGroups, grp)
+		}
+		writeJSON(w, http.StatusNoContent, nil)
+	case rest[0] == "children" && req.Method == http.MethodPost:
+		var rep gocloak.Group
+		json.NewDecoder(req.Body).Decode(&rep)
+		s.createGroup(w, r, grp, &grp.SubGroups, rep)
+	case rest[0] == "children" && req.Method == http.MethodGet:
+		reps := []map[string]any{}
+		for _, sub := range page(grp.SubGroups, query) {
+			reps = append(reps, groupRep(sub, firstValue(query, "briefRepresentation") != "false", sub.SubGroups))
+		}
+		writeJSON(w, http.StatusOK, reps)
+	case rest[0] == "members":
+		reps := []map[string]any{}
+		for _, user := range page(grp.Members, query) {
+			reps = append(reps, userRep(user))
+		}
+		writeJSON(w, http.StatusOK, reps)
+	case rest[0] == "role-mappings" && req.Method == http.MethodPost:
+		var roles []gocloak.Role
+		json.NewDecoder(req.Body).Decode(&roles)
+		if len(rest) >= 2 && rest[1] == "realm" {
+			for _, role := range roles {
+				grp.RealmRoles = append(grp.RealmRoles, gocloak.PString(role.Name))
+			}
+		} else if len(rest) == 3 && rest[1] == "clients" {
+			if grp.ClientRoles == nil {
+				grp.ClientRoles = map[string][]string{}
+			}
+			for _, client := range r.Clients {
+				if client.ID != rest[2] {
+					continue
+				}
+				for _, role := range roles {
+					grp.ClientRoles[client.ClientID] = append(grp.ClientRoles[client.ClientID], gocloak.PString(role.Name))
+					client.RoleGroups[gocloak.PString(role.Name)] = append(client.RoleGroups[gocloak.PString(role.Name)], grp)
+				}
+			}
+		}
+		writeJSON(w, http.StatusNoContent, nil)
+	default:
+		Error(w, http.StatusNotFound, "HTTP 404 Not Found")
+	}
+}
+
+// userMatcher returns the filter of a users search, username, email, firstName and lastName are substring
+// matches unless exact=true, search matches any of them
+func userMatcher(query map[string][]string) func(*User) bool {
+	exact := firstValue(query, "exact") == "true"
+	matches := func(have, want string) bool {
+		if exact {
+			return have == want
+		}
+		return strings.Contains(strings.ToLower(have), strings.ToLower(want))
+	}
+	return func(user *User) bool {
+		for key, have := range map[string]string{"username": user.Username, "email": user.Email, "firstName": user.FirstName, "lastName": user.LastName} {
+			if want := firstValue(query, key); want != "" && !matches(have, want) {
+				return false
+			}
+		}
+		if search := strings.Trim(firstValue(query, "search"), "*"); search != "" {
+			found := false
+			for _, have := range []string{user.Username, user.Email, user.FirstName, user.LastName} {
+				found = found || strings.Contains(strings.ToLower(have), strings.ToLower(search))
+			}
+			if !found {
+				return false
+			}
+		}
+		if enabled := firstValue(query, "enabled"); enabled != "" && strconv.FormatBool(user.Enabled) != enabled {
+			return false
+		}
+		return true
+	}
+}
+
+func (s *Server) serveUsers(w http.ResponseWriter, req *http.Request, r *Realm, rest []string) {
+	query := req.URL.Query()
+	switch {
+	case len(rest) == 0 && req.Method == http.MethodGet:
+		var users []*User
+		match := userMatcher(query)
+		for _, user := range r.Users {
+			if match(user) {
+				users = append(users, user)
+			}
+		}
+		sort.Slice(users, func(i, j int) bool { return users[i].Username < users[j].Username })
+		reps := []map[string]any{}
+		for _, user := range page(users, query) {
+			reps = append(reps, userRep(user))
+		}
+		writeJSON(w, http.StatusOK, reps)
+	case len(rest) == 0 && req.Method == http.MethodPost:
+		var rep gocloak.User
+		json.NewDecoder(req.Body).Decode(&rep)
+		for _, user := range r.Users {
+			if user.Username == gocloak.PString(rep.Username) {
+				writeJSON(w, http.StatusConflict, map[string]string{"errorMessage": "User exists with same username"})
+				return
+			}
+		}
+		user := &User{ID: s.newID(), Username: gocloak.PString(rep.Username), Email: gocloak.PString(rep.Email),
+			FirstName: gocloak.PString(rep.FirstName), LastName: gocloak.PString(rep.LastName), Enabled: gocloak.PBool(rep.Enabled),
+			Attributes: map[string][]string{}}
+		r.Users = append(r.Users, user)
+		w.Header().Set("Location", s.URL+"/admin/realms/"+r.Name+"/users/"+user.ID)
+		writeJSON(w, http.StatusCreated, nil)
+	case len(rest) == 1 && rest[0] == "count":
+		n := 0
+		match := userMatcher(query)
+		for _, user := range r.Users {
+			if match(user) {
+				n++
+			}
+		}
+		writeJSON(w, http.StatusOK, n)
+	default:
+		user := r.userByID(rest[0])
+		if user == nil {
+			Error(w, http.StatusNotFound, "User not found")
+			return
+		}
+		s.serveUser(w, req, r, user, rest[1:])
+	}
+}
+
+func (s *Server) serveUser(w http.ResponseWriter, req *http.Request, r *Realm, user *User, rest []string) {
+	switch {
+	case len(rest) == 0 && req.Method == http.MethodGet:
+		writeJSON(w, http.StatusOK, userRep(user))
+	case len(rest) == 0 && req.Method == http.MethodPut:
+		var rep gocloak.User
+		json.NewDecoder(req.Body).Decode(&rep)
+		if rep.Enabled != nil {
+			user.Enabled = *rep.Enabled
+		}
+		if rep.Attributes != nil {
+			user.Attributes = *rep.Attributes
+		}
+		if rep.Email != nil {
+			user.Email = *rep.Email
+		}
+		if rep.FirstName != nil {
+			user.FirstName = *rep.FirstName
+		}
+		if rep.LastName != nil {
+			user.LastName = *rep.LastName
+		}
+		writeJSON(w, http.StatusNoContent, nil)
+	case len(rest) == 0 && req.Method == http.MethodDelete:
+		kept := []*User{}
+		for _, u := range r.Users {
+			if u != user {
+				kept = append(kept, u)
+			}
+		}
+		r.Users = kept
+		writeJSON(w, http.StatusNoContent, nil)
+	case rest[0] == "groups" && len(rest) == 1:
+		reps := []map[string]any{}
+		walkGroups(r.Groups, func(grp *Group) {
+			for _, member := range grp.Members {
+				if member == user {
+					reps = append(reps, groupRep(grp, true, nil))
+				}
+			}
+		})
+		writeJSON(w, http.StatusOK, page(reps, req.URL.Query()))
+	case rest[0] == "groups" && len(rest) == 2:
+		grp := r.groupByID(rest[1])
+		if grp == nil {
+			Error(w, http.StatusNotFound, "Could not find group by id")
+			return
+		}
+		members := []*User{}
+		for _, member := range grp.Members {
+			if member != user {
+				members = append(members, member)
+			}
+		}
+		if req.Method == http.MethodPut {
+			members = append(members, user)
+		}
+		grp.Members = members
+		writeJSON(w, http.StatusNoContent, nil)
+	default:
+		Error(w, http.StatusNotFound, "HTTP 404 Not Found")
+	}
+}
+
+func (s *Server) serveClients(w http.ResponseWriter, req *http.Request, r *Realm, rest []string) {
+	query := req.URL.Query()
+	if len(rest) == 0 {
+		reps := []map[string]any{}
+		for _, client := range r.Clients {
+			if clientID := firstValue(query, "clientId"); clientID != "" && client.ClientID != clientID {
+				continue
+			}
+			reps = append(reps, map[string]any{"id": client.ID, "clientId": client.ClientID, "enabled": client.Enabled})
+		}
+		writeJSON(w, http.StatusOK, page(reps, query))
+		return
+	}
+	var client *Client
+	for _, c := range r.Clients {
+		if c.ID == rest[0] {
+			client = c
+		}
+	}
+	if client == nil || len(rest) < 2 || rest[1] != "roles" {
+		Error(w, http.StatusNotFound, "Could not find client")
+		return
+	}
+	switch len(rest) {
+	case 2:
+		reps := []map[string]any{}
+		for _, role := range client.Roles {
+			reps = append(reps, map[string]any{"id": client.ID + "-" + role, "name": role, "clientRole": true, "containerId": client.ID})
+		}
+		writeJSON(w, http.StatusOK, page(reps, query))
+	default:
+		role := rest[2]
+		found := false
+		for _, have := range client.Roles {
+			found = found || have == role
+		}
+		if !found {
+			Error(w, http.StatusNotFound, "Could not find role")
+			return
+		}
+		if len(rest) == 3 {
+			writeJSON(w, http.StatusOK, map[string]any{"id": client.ID + "-" + role, "name": role, "clientRole": true, "containerId": client.ID})
+			return
+		}
+		reps := []map[string]any{}
+		for _, grp := range page(client.RoleGroups[role], query) {
+			reps = append(reps, groupRep(grp, true, nil))
+		}
+		writeJSON(w, http.StatusOK, reps)
+	}
+}
@@ -1,33 +1,72 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"os"
+	"os/signal"
+	"regexp"
+	"syscall"
+	"time"
 
 	"github.com/Nerzal/gocloak/v13"
+	"github.com/gin-gonic/gin"
 	"github.com/remiges-tech/alya/config"
 	"github.com/remiges-tech/alya/logger"
 	"github.com/remiges-tech/alya/router"
 	"github.com/remiges-tech/alya/service"
 	"github.com/remiges-tech/alya/wscutils"
+	"github.com/remiges-tech/idshield/types"
+	"github.com/remiges-tech/idshield/utils"
+	"github.com/remiges-tech/idshield/webServices/authzsvc"
 	"github.com/remiges-tech/idshield/webServices/capsvc"
+	"github.com/remiges-tech/idshield/webServices/clientsvc"
 	"github.com/remiges-tech/idshield/webServices/groupsvc"
+	"github.com/remiges-tech/idshield/webServices/searchsvc"
 	"github.com/remiges-tech/idshield/webServices/usersvc"
 	"github.com/remiges-tech/logharbour/logharbour"
 )
 
 // AppConfig represents the configuration structure for the application.
 type AppConfig struct {
-	AppServerPort    string `json:"app_server_port"`
-	ProviderURL      string `json:"provider_url"`
-	KeycloakURL      string `json:"keycloak_url"`
-	Realm            string `json:"realm"`
-	KeycloakClientID string `json:"keycloak_client_id"`
+	AppServerPort        string            `json:"app_server_port"`
+	ProviderURL          string            `json:"provider_url"`
+	KeycloakURL          string            `json:"keycloak_url"`
+	Realm                string            `json:"realm"`
+	KeycloakClientID     string            `json:"keycloak_client_id"`
+	KeycloakClientSecret string            `json:"keycloak_client_secret"`
+	GroupAttrMaxKeys     int               `json:"group_attr_max_keys"`
+	GroupAttrMaxSize     int               `json:"group_attr_max_size"`
+	GroupAttrKeyPattern  string            `json:"group_attr_key_pattern"`
+	GroupAttrTypes       map[string]string `json:"group_attr_types"`
+	WebhookURL           string            `json:"webhook_url"`
+	WebhookMaxRetries    int               `json:"webhook_max_retries"`
+	TrustedProxies       []string          `json:"trusted_proxies"`
+	MaxRequestBody       int64             `json:"max_request_body"`
+	SensitiveAttrKeys    []string          `json:"sensitive_attr_keys"`
+	GroupDefaultAttrs    map[string]string `json:"group_default_attrs"`
+	LogLevel             string            `json:"log_level"`
+	NormalizeRealm       bool              `json:"normalize_realm"`
+	AllowedRealms        []string          `json:"allowed_realms"`
+	MaxPageSize          int               `json:"max_page_size"`
+	RealmConfigTTLSecs   int               `json:"realm_config_ttl_secs"`
+	UniqueLongNames      bool              `json:"unique_long_names"`
+	CORS                 types.CORSConfig  `json:"cors"`
+	ShutdownTimeoutSecs  int               `json:"shutdown_timeout_secs"`
+	MemberCount          types.FanOut      `json:"member_count"`
+	ManagedAttrPrefix    string            `json:"managed_attr_prefix"`
+	MaxNestingDepth      int               `json:"max_nesting_depth"`
+	ProtectedGroupRegex  string            `json:"protected_group_regex"`
+	CountRefreshSecs     int               `json:"count_refresh_secs"`
 }
 
+// defaultShutdownTimeout bounds how long shutdown waits for in-flight requests when not configured
+const defaultShutdownTimeout = 30 * time.Second
+
 func main() {
 	// Command-line flags for configuration options
 	configSystem := flag.String("configSource", "file", "The configuration system to use (file or rigel)")
@@ -57,8 +96,12 @@ func main() {
 		log.Fatalf("Unknown configuration system: %s", *configSystem)
 	}
 
-	// Print the loaded configuration
-	fmt.Printf("Loaded configuration: %+v\n", appConfig)
+	// Print the loaded configuration, without the client secret
+	printed := appConfig
+	if printed.KeycloakClientSecret != "" {
+		printed.KeycloakClientSecret = "****"
+	}
+	fmt.Printf("Loaded configuration: %+v\n", printed)
 
 	// Open and load error types from the file
 	file, err := os.Open("./errortypes.yaml")
@@ -75,7 +118,12 @@ func main() {
 		log.Fatal(err)
 	}
 	fallbackWriter := logharbour.NewFallbackWriter(logFile, os.Stdout)
-	lctx := logharbour.NewLoggerContext(logharbour.Info)
+	// production runs at info, debug entries are only emitted when the configured level enables them
+	logLevel, err := utils.ParseLogLevel(appConfig.LogLevel)
+	if err != nil {
+		log.Fatalf("Invalid log level: %v", err)
+	}
+	lctx := logharbour.NewLoggerContext(logLevel)
 	lh := logharbour.NewLogger(lctx, "idshield", fallbackWriter)
 	fl := logger.NewFileLogger("/tmp/idshield.log")
 
@@ -94,26 +142,126 @@ func main() {
 		log.Fatalf("Failed to setup router: %v", err)
 	}
 
-	// Create a gocloak client
+	// X-Forwarded-For is only honoured for requests arriving through a configured trusted proxy,
+	// otherwise the client IP logged by the handlers is the direct remote address
+	if err := r.SetTrustedProxies(appConfig.TrustedProxies); err != nil {
+		log.Fatalf("Failed to set trusted proxies: %v", err)
+	}
+
+	// Only tokens issued by the allowed realms are served, an empty list allows every realm
+	r.Use(utils.RealmAllowlist(appConfig.AllowedRealms))
+
+	// Create a gocloak client. A single client is shared by all requests: every call takes the caller's
+	// access token as an argument and the client keeps no per-request state, its resty client and certs
+	// cache are safe for concurrent use. Handlers must not mutate it (e.g. via RestyClient().SetAuthToken)
 	gcClient := gocloak.NewClient(appConfig.KeycloakURL)
+	// The hook is registered once before serving, it keeps the Retry-After header of a 429 for the error handler
+	gcClient.RestyClient().OnAfterResponse(utils.CaptureRetryAfter)
+
+	// Attribute keys are restricted to the configured pattern, an empty pattern keeps the default
+	var attrKeyPattern *regexp.Regexp
+	if appConfig.GroupAttrKeyPattern != "" {
+		attrKeyPattern, err = regexp.Compile(appConfig.GroupAttrKeyPattern)
+		if err != nil {
+			log.Fatalf("Invalid group attribute key pattern: %v", err)
+		}
+	}
+
+	// Groups matching the protected pattern can't be changed or deleted through idshield, e.g. "^(admins|system-.*)$"
+	// protects admins and every system- group. Left empty only the protected attribute marks a group protected
+	var protectedGroupPattern *regexp.Regexp
+	if appConfig.ProtectedGroupRegex != "" {
+		protectedGroupPattern, err = regexp.Compile(appConfig.ProtectedGroupRegex)
+		if err != nil {
+			log.Fatalf("Invalid protected group pattern: %v", err)
+		}
+	}
+
+	if err := utils.ValidateAttrTypes(appConfig.GroupAttrTypes); err != nil {
+		log.Fatalf("Invalid group attribute types: %v", err)
+	}
 
 	// Service setup
-	s := service.NewService(r).WithDependency("gocloak", gcClient).WithLogHarbour(lh).WithDependency("realm", appConfig.Realm)
+	s := service.NewService(r).WithDependency("gocloak", gcClient).WithLogHarbour(lh).WithDependency("realm", appConfig.Realm).
+		WithDependency("keycloakURL", appConfig.KeycloakURL).
+		WithDependency("keycloakClientID", appConfig.KeycloakClientID).WithDependency("keycloakClientSecret", appConfig.KeycloakClientSecret).
+		WithDependency("attrLimits", types.AttrLimits{MaxKeys: appConfig.GroupAttrMaxKeys, MaxSize: appConfig.GroupAttrMaxSize, KeyPattern: attrKeyPattern, Types: appConfig.GroupAttrTypes}).
+		WithDependency("maxRequestBody", appConfig.MaxRequestBody).WithDependency("sensitiveAttrs", appConfig.SensitiveAttrKeys).
+		WithDependency("realmConfig", utils.RealmConfig{MaxPageSize: appConfig.MaxPageSize, DefaultAttrs: appConfig.GroupDefaultAttrs}).
+		WithDependency("realmConfigTTL", time.Duration(appConfig.RealmConfigTTLSecs)*time.Second).
+		WithDependency("normalizeRealm", appConfig.NormalizeRealm).WithDependency("uniqueLongNames", appConfig.UniqueLongNames).
+		WithDependency("memberCount", appConfig.MemberCount).WithDependency("managedAttrPrefix", appConfig.ManagedAttrPrefix).
+		WithDependency("maxNestingDepth", appConfig.MaxNestingDepth).
+		WithDependency("protectedGroupPattern", protectedGroupPattern)
+
+	// Group mutation events are only emitted when a webhook url is configured
+	if appConfig.WebhookURL != "" {
+		s.WithDependency("webhook", utils.NewWebhook(appConfig.WebhookURL, appConfig.WebhookMaxRetries))
+	}
+
+	// Group_list serves member counts from a cache the service account refreshes in the background,
+	// when a refresh interval is configured
+	var countCache *groupsvc.CountCache
+	if appConfig.CountRefreshSecs > 0 {
+		realms := appConfig.AllowedRealms
+		if len(realms) == 0 {
+			realms = []string{appConfig.Realm}
+		}
+		countCache = groupsvc.NewCountCache(gcClient, lh, appConfig.KeycloakClientID, appConfig.KeycloakClientSecret, appConfig.Realm, realms, time.Duration(appConfig.CountRefreshSecs)*time.Second)
+		s.WithDependency("countCache", countCache)
+	}
+
+	if err := utils.ValidateDependencies(s, "gocloak", "realm", "keycloakURL"); err != nil {
+		log.Fatalf("Invalid service dependencies: %v", err)
+	}
 
 	// Register a route for handling for user
 	s.RegisterRoute(http.MethodGet, "/userlist", usersvc.User_list)
 	s.RegisterRoute(http.MethodDelete, "/userdelete", usersvc.User_delete)
 	s.RegisterRoute(http.MethodPut, "/userupdate", usersvc.User_update)
 	s.RegisterRoute(http.MethodGet, "/userget", usersvc.User_get)
+	s.RegisterRoute(http.MethodGet, "/usercount", usersvc.User_count)
+	s.RegisterRoute(http.MethodPost, "/userexistsbatch", usersvc.User_existsBatch)
 	s.RegisterRoute(http.MethodPost, "/usernew", usersvc.User_new)
 	s.RegisterRoute(http.MethodPost, "/useractivate", usersvc.User_activate)
 	s.RegisterRoute(http.MethodPost, "/userdeactivate", usersvc.User_deactivate)
+	s.RegisterRoute(http.MethodPost, "/useraddtogroups", usersvc.User_addToGroups)
 
 	// Register a route for handling for group
 	s.RegisterRoute(http.MethodPost, "/groupnew", groupsvc.Group_new)
+	s.RegisterRoute(http.MethodPost, "/groupnewwithroles", groupsvc.Group_newWithRoles)
+	s.RegisterRoute(http.MethodPost, "/groupprovision", groupsvc.Group_provision)
+	s.RegisterRoute(http.MethodPost, "/groupnewsubgroup", groupsvc.Group_newSubgroup)
 	s.RegisterRoute(http.MethodGet, "/groupget", groupsvc.Group_get)
+	s.RegisterRoute(http.MethodGet, "/groupdetail", groupsvc.Group_detail)
 	s.RegisterRoute(http.MethodPost, "/groupupdate", groupsvc.Group_update)
+	s.RegisterRoute(http.MethodGet, "/groupattributes", groupsvc.Group_attributes)
+	// RegisterRoute only knows GET, POST, PUT and DELETE, PATCH routes go to the router directly
+	s.Router.PATCH("/grouppatchattributes", func(c *gin.Context) { groupsvc.Group_patchAttributes(c, s) })
+	s.RegisterRoute(http.MethodPost, "/groupclearattributes", groupsvc.Group_clearAttributes)
+	s.RegisterRoute(http.MethodDelete, "/groupdelete", groupsvc.Group_delete)
+	s.RegisterRoute(http.MethodDelete, "/groupdeletetree", groupsvc.Group_deleteTree)
 	s.RegisterRoute(http.MethodGet, "/grouplist", groupsvc.Group_list)
+	s.RegisterRoute(http.MethodPost, "/grouprefreshcounts", groupsvc.Group_refreshCounts)
+	s.RegisterRoute(http.MethodGet, "/grouptree", groupsvc.Group_tree)
+	s.RegisterRoute(http.MethodGet, "/groupancestry", groupsvc.Group_ancestry)
+	s.RegisterRoute(http.MethodGet, "/groupchildcount", groupsvc.Group_childCount)
+	s.RegisterRoute(http.MethodGet, "/groupdiffroles", groupsvc.Group_diffRoles)
+	s.RegisterRoute(http.MethodPost, "/groupbatchget", groupsvc.Group_batchGet)
+	s.RegisterRoute(http.MethodGet, "/realmexportgroups", groupsvc.Realm_exportGroups)
+	s.RegisterRoute(http.MethodPost, "/groupimport", groupsvc.Group_import)
+	s.RegisterRoute(http.MethodGet, "/groupfindbyattribute", groupsvc.Group_findByAttribute)
+	s.RegisterRoute(http.MethodGet, "/groupcountbyattribute", groupsvc.Group_countByAttribute)
+	s.RegisterRoute(http.MethodGet, "/groupautocomplete", groupsvc.Group_autocomplete)
+	s.RegisterRoute(http.MethodGet, "/groupcheckname", groupsvc.Group_checkName)
+	s.RegisterRoute(http.MethodGet, "/groupmembers", groupsvc.Group_members)
+	s.RegisterRoute(http.MethodGet, "/groupauditmembers", groupsvc.Group_auditMembers)
+	s.RegisterRoute(http.MethodGet, "/groupnonmembers", groupsvc.Group_nonMembers)
+	s.RegisterRoute(http.MethodPost, "/groupbulkdelete", groupsvc.Group_bulkDelete)
+	s.RegisterRoute(http.MethodPost, "/grouptransfermembers", groupsvc.Group_transferMembers)
+	s.RegisterRoute(http.MethodPost, "/groupmove", groupsvc.Group_move)
+	s.RegisterRoute(http.MethodPost, "/groupdisablemembers", groupsvc.Group_disableMembers)
+	s.RegisterRoute(http.MethodPost, "/groupenablemembers", groupsvc.Group_enableMembers)
 
 	// Register a route for handling capabilities
 	s.RegisterRoute(http.MethodPost, "/capusergrant", capsvc.Capuser_grant)
@@ -124,8 +272,63 @@ func main() {
 	s.RegisterRoute(http.MethodPost, "/capgrouprevoke", capsvc.Capgroup_revoke)
 	s.RegisterRoute(http.MethodGet, "/capgroupgetall", capsvc.Capgroup_getall)
 
-	// Start the service
-	if err := r.Run(":" + appConfig.AppServerPort); err != nil {
+	// Register a route for handling clients
+	s.RegisterRoute(http.MethodGet, "/clientlist", clientsvc.Client_list)
+	s.RegisterRoute(http.MethodGet, "/clientroles", clientsvc.Client_roles)
+	s.RegisterRoute(http.MethodGet, "/clientrolegroups", clientsvc.Client_roleGroups)
+
+	// Register a route for handling search across groups and users
+	s.RegisterRoute(http.MethodGet, "/searchglobal", searchsvc.Search_global)
+
+	// Register a route for handling authorization queries
+	s.RegisterRoute(http.MethodGet, "/authzwhoami", authzsvc.Authz_whoami)
+	s.RegisterRoute(http.MethodGet, "/authzcapabilities", authzsvc.Authz_listCapabilities)
+	s.RegisterRoute(http.MethodGet, "/authzusercapabilities", authzsvc.Authz_userCapabilities)
+	s.RegisterRoute(http.MethodPost, "/authzbootstrap", authzsvc.Authz_bootstrap)
+	s.RegisterRoute(http.MethodPost, "/authzreconcile", authzsvc.Authz_reconcile)
+
+	// Start the service, error responses are rendered as Problem Details for clients that accept them
+	srv := &http.Server{
+		Addr:    ":" + appConfig.AppServerPort,
+		Handler: utils.CORS(appConfig.CORS, utils.ProblemDetails(r)),
+	}
+	ln, err := net.Listen("tcp", srv.Addr)
+	if err != nil {
 		log.Fatalf("Failed to start server: %v", err)
 	}
+
+	// On SIGINT/SIGTERM stop accepting new connections and let in-flight requests finish,
+	// so a redeploy doesn't cut a handler off halfway through its keycloak calls
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if countCache != nil {
+		go countCache.Run(ctx)
+	}
+
+	shutdownTimeout := time.Duration(appConfig.ShutdownTimeoutSecs) * time.Second
+	if shutdownTimeout <= 0 {
+		shutdownTimeout = defaultShutdownTimeout
+	}
+	if err := serve(ctx, srv, ln, shutdownTimeout, lh); err != nil {
+		log.Fatalf("Failed to shut down server gracefully: %v", err)
+	}
+}
+
+// serve serves srv on ln until ctx is done, then shuts srv down, waiting up to timeout for the in-flight
+// requests to finish
+func serve(ctx context.Context, srv *http.Server, ln net.Listener, timeout time.Duration, lh *logharbour.Logger) error {
+	served := make(chan error, 1)
+	go func() {
+		served <- srv.Serve(ln)
+	}()
+	select {
+	case err := <-served:
+		return err
+	case <-ctx.Done():
+	}
+
+	lh.Log("Shutting down, waiting for in-flight requests to finish")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return srv.Shutdown(shutdownCtx)
 }
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/remiges-tech/logharbour/logharbour"
+)
+
+func TestServeWaitsForInFlightRequests(t *testing.T) {
+	started := make(chan struct{})
+	var finished atomic.Bool
+	srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		time.Sleep(200 * time.Millisecond)
+		finished.Store(true)
+		w.WriteHeader(http.StatusCreated)
+	})}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	lh := logharbour.NewLogger(logharbour.NewLoggerContext(logharbour.Info), "idshield", io.Discard)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error, 1)
+	go func() {
+		served <- serve(ctx, srv, ln, 5*time.Second, lh)
+	}()
+
+	status := make(chan int, 1)
+	go func() {
+		resp, err := http.Get("http://" + ln.Addr().String())
+		if err != nil {
+			status <- 0
+			return
+		}
+		resp.Body.Close()
+		status <- resp.StatusCode
+	}()
+
+	<-started
+	cancel()
+	if err := <-served; err != nil {
+		t.Fatalf("serve() = %v, want nil", err)
+	}
+	if !finished.Load() {
+		t.Error("serve() returned before the in-flight request finished")
+	}
+	if got := <-status; got != http.StatusCreated {
+		t.Errorf("in-flight request status = %d, want %d", got, http.StatusCreated)
+	}
+}
+
+func TestServeShutdownTimeout(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	defer close(release)
+	srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+	})}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	lh := logharbour.NewLogger(logharbour.NewLoggerContext(logharbour.Info), "idshield", io.Discard)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error, 1)
+	go func() {
+		served <- serve(ctx, srv, ln, 50*time.Millisecond, lh)
+	}()
+	go func() {
+		if resp, err := http.Get("http://" + ln.Addr().String()); err == nil {
+			resp.Body.Close()
+		}
+	}()
+
+	<-started
+	cancel()
+	if err := <-served; err != context.DeadlineExceeded {
+		t.Errorf("serve() = %v, want %v once the timeout passes", err, context.DeadlineExceeded)
+	}
+}
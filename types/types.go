@@ -1,5 +1,7 @@
 package types
 
+import "regexp"
+
 type AppConfig struct {
 	DBConnURL        string `json:"db_conn_url"`
 	DBHost           string `json:"db_host"`
@@ -13,6 +15,25 @@ type AppConfig struct {
 	KeycloakClientID string `json:"keycloak_client_id"`
 }
 
+// AttrLimits bounds the attribute map accepted on a group request,
+// Keycloak caps attribute storage size so oversized maps are rejected up front.
+// KeyPattern restricts the characters allowed in attribute keys and Types the values of typed keys
+type AttrLimits struct {
+	MaxKeys    int               `json:"maxKeys"`
+	MaxSize    int               `json:"maxSize"`
+	KeyPattern *regexp.Regexp    `json:"-"`
+	Types      map[string]string `json:"types"`
+}
+
+// CORSConfig controls the CORS headers returned to browser clients, origins can be restricted per environment
+type CORSConfig struct {
+	AllowedOrigins   []string `json:"allowed_origins"`
+	AllowedMethods   []string `json:"allowed_methods"`
+	AllowedHeaders   []string `json:"allowed_headers"`
+	AllowCredentials bool     `json:"allow_credentials"`
+	MaxAgeSecs       int      `json:"max_age_secs"`
+}
+
 type OpReq struct {
 	User      string   `json:"user"`
 	CapNeeded []string `json:"capNeeded"`
@@ -33,4 +54,12 @@ type QualifiedCap struct {
 type Capabilities struct {
 	Name          string         `json:"name"` //either user name or group name
 	QualifiedCaps []QualifiedCap `json:"qualifiedcaps"`
+}
+
+// FanOut bounds the parallel Keycloak calls Group_list makes for member counts, each call gets
+// CallTimeoutMs, the whole fan-out gets DeadlineMs and at most Concurrency calls are in flight at once
+type FanOut struct {
+	CallTimeoutMs int `json:"call_timeout_ms"`
+	DeadlineMs    int `json:"deadline_ms"`
+	Concurrency   int `json:"concurrency"`
 }
\ No newline at end of file
@@ -0,0 +1,44 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/Nerzal/gocloak/v13"
+	"github.com/remiges-tech/alya/service"
+)
+
+// AdminGet issues GET {keycloakURL}/admin/realms/{realm}/{path} with the caller's token and decodes the body into
+// result. It covers the admin endpoints and query params gocloak has no method for, e.g. admin events or
+// /groups/count?top=true. Failures are returned as a *gocloak.APIError with the same "<status>: <message>"
+// text gocloak's own calls produce, so GocloakErrorHandler treats both alike
+func AdminGet(ctx context.Context, s *service.Service, token, realm string, query url.Values, result any, path ...string) error {
+	gcClient, ok := s.Dependencies["gocloak"].(*gocloak.GoCloak)
+	if !ok {
+		return errors.New("gocloak dependency not registered")
+	}
+	baseURL, _ := s.Dependencies["keycloakURL"].(string)
+	if baseURL == "" {
+		return errors.New("keycloakURL dependency not registered")
+	}
+	segments := append([]string{strings.TrimRight(baseURL, "/"), "admin", "realms", realm}, path...)
+
+	resp, err := gcClient.GetRequestWithBearerAuth(ctx, token).
+		SetQueryParamsFromValues(query).
+		SetResult(result).
+		Get(strings.Join(segments, "/"))
+	if err != nil {
+		return &gocloak.APIError{Message: fmt.Sprintf("could not get %v: %v", strings.Join(path, "/"), err)}
+	}
+	if resp.IsError() {
+		msg := resp.Status()
+		if e, ok := resp.Error().(*gocloak.HTTPErrorResponse); ok && e.NotEmpty() {
+			msg = fmt.Sprintf("%s: %s", resp.Status(), e)
+		}
+		return &gocloak.APIError{Code: resp.StatusCode(), Message: msg}
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+package utils
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// attribute value types that can be configured per attribute key. Keycloak stores every attribute value as
+// a string, so typed values are validated and stored in a canonical string form:
+//
+//	string - stored as sent
+//	int    - a whole number, stored in base 10 without sign or leading zeros ("+007" becomes "7")
+//	bool   - true/false in any form strconv.ParseBool accepts, stored as "true" or "false"
+//	date   - a calendar date, as YYYY-MM-DD or an RFC3339 timestamp, stored as YYYY-MM-DD
+const (
+	AttrTypeString = "string"
+	AttrTypeInt    = "int"
+	AttrTypeBool   = "bool"
+	AttrTypeDate   = "date"
+)
+
+// AttrDateLayout is the canonical form of date attributes
+const AttrDateLayout = "2006-01-02"
+
+// ValidateAttrTypes checks that every configured attribute type is one CoerceAttrValue knows
+func ValidateAttrTypes(attrTypes map[string]string) error {
+	for key, kind := range attrTypes {
+		switch kind {
+		case AttrTypeString, AttrTypeInt, AttrTypeBool, AttrTypeDate:
+		default:
+			return fmt.Errorf("unknown type %q for attribute %q", kind, key)
+		}
+	}
+	return nil
+}
+
+// CoerceAttrValue validates value against the attribute type kind and returns its canonical string form
+func CoerceAttrValue(kind, value string) (string, error) {
+	switch kind {
+	case AttrTypeInt:
+		n, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+		if err != nil {
+			return "", fmt.Errorf("not an int: %q", value)
+		}
+		return strconv.FormatInt(n, 10), nil
+	case AttrTypeBool:
+		b, err := strconv.ParseBool(strings.TrimSpace(value))
+		if err != nil {
+			return "", fmt.Errorf("not a bool: %q", value)
+		}
+		return strconv.FormatBool(b), nil
+	case AttrTypeDate:
+		value = strings.TrimSpace(value)
+		if d, err := time.Parse(AttrDateLayout, value); err == nil {
+			return d.Format(AttrDateLayout), nil
+		}
+		if t, err := time.Parse(time.RFC3339, value); err == nil {
+			return t.Format(AttrDateLayout), nil
+		}
+		return "", fmt.Errorf("not a date: %q", value)
+	}
+	return value, nil
+}
@@ -0,0 +1,56 @@
+package utils
+
+import "testing"
+
+func TestCoerceAttrValue(t *testing.T) {
+	tests := []struct {
+		kind    string
+		value   string
+		want    string
+		wantErr bool
+	}{
+		{AttrTypeString, " as sent ", " as sent ", false},
+		{"", "untyped", "untyped", false},
+		{AttrTypeInt, "+007", "7", false},
+		{AttrTypeInt, " -12 ", "-12", false},
+		{AttrTypeInt, "1.5", "", true},
+		{AttrTypeInt, "ten", "", true},
+		{AttrTypeBool, "TRUE", "true", false},
+		{AttrTypeBool, "0", "false", false},
+		{AttrTypeBool, "yes", "", true},
+		{AttrTypeDate, "2024-02-29", "2024-02-29", false},
+		{AttrTypeDate, "2024-03-01T23:30:00+05:30", "2024-03-01", false},
+		{AttrTypeDate, "2023-02-29", "", true},
+		{AttrTypeDate, "01/03/2024", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.kind+"/"+tt.value, func(t *testing.T) {
+			got, err := CoerceAttrValue(tt.kind, tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("CoerceAttrValue(%q, %q) error = %v, wantErr %v", tt.kind, tt.value, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("CoerceAttrValue(%q, %q) = %q, want %q", tt.kind, tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateAttrTypes(t *testing.T) {
+	tests := []struct {
+		name      string
+		attrTypes map[string]string
+		wantErr   bool
+	}{
+		{"none", nil, false},
+		{"known types", map[string]string{"a": AttrTypeString, "b": AttrTypeInt, "c": AttrTypeBool, "d": AttrTypeDate}, false},
+		{"unknown type", map[string]string{"a": "float"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := ValidateAttrTypes(tt.attrTypes); (err != nil) != tt.wantErr {
+				t.Errorf("ValidateAttrTypes() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,100 @@
+package utils
+
+import (
+	"sync"
+
+	"github.com/remiges-tech/idshield/types"
+)
+
+// Authorizer decides whether a user holds the capabilities an operation needs. Authz_check delegates to the
+// installed Authorizer, so the authorization backend can be swapped, e.g. for a FakeAuthorizer in tests
+type Authorizer interface {
+	Check(op types.OpReq, trace bool) (bool, []string)
+}
+
+// AuthorizerFunc lets a plain function be used as an Authorizer
+type AuthorizerFunc func(op types.OpReq, trace bool) (bool, []string)
+
+// Check calls f
+func (f AuthorizerFunc) Check(op types.OpReq, trace bool) (bool, []string) {
+	return f(op, trace)
+}
+
+// allowAll is the Authorizer installed by default, it allows every operation until a capability store is wired in
+var allowAll = AuthorizerFunc(func(op types.OpReq, trace bool) (bool, []string) {
+	var caplist []string
+	return true, caplist
+})
+
+var (
+	authorizerMu sync.RWMutex
+	authorizer   Authorizer = allowAll
+)
+
+// SetAuthorizer installs a as the Authorizer used by Authz_check and returns the previous one so it can be
+// restored. A nil a reinstalls the default
+func SetAuthorizer(a Authorizer) Authorizer {
+	if a == nil {
+		a = allowAll
+	}
+	authorizerMu.Lock()
+	defer authorizerMu.Unlock()
+	prev := authorizer
+	authorizer = a
+	return prev
+}
+
+func currentAuthorizer() Authorizer {
+	authorizerMu.RLock()
+	defer authorizerMu.RUnlock()
+	return authorizer
+}
+
+// FakeAuthorizer is an Authorizer test double that allows exactly the (user, capability) pairs it has been
+// given. An operation is allowed only when the user holds every capability it needs, the capabilities the
+// user is missing are returned with a denial
+type FakeAuthorizer struct {
+	mu      sync.Mutex
+	granted map[string]map[string]bool
+}
+
+// NewFakeAuthorizer returns a FakeAuthorizer that denies everything until capabilities are allowed
+func NewFakeAuthorizer() *FakeAuthorizer {
+	return &FakeAuthorizer{granted: make(map[string]map[string]bool)}
+}
+
+// Allow grants caps to user
+func (f *FakeAuthorizer) Allow(user string, caps ...string) *FakeAuthorizer {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.granted[user] == nil {
+		f.granted[user] = make(map[string]bool)
+	}
+	for _, capName := range caps {
+		f.granted[user][capName] = true
+	}
+	return f
+}
+
+// Deny withdraws caps from user
+func (f *FakeAuthorizer) Deny(user string, caps ...string) *FakeAuthorizer {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, capName := range caps {
+		delete(f.granted[user], capName)
+	}
+	return f
+}
+
+// Check allows op when op.User has been allowed every capability in op.CapNeeded
+func (f *FakeAuthorizer) Check(op types.OpReq, trace bool) (bool, []string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var missing []string
+	for _, capName := range op.CapNeeded {
+		if !f.granted[op.User][capName] {
+			missing = append(missing, capName)
+		}
+	}
+	return len(missing) == 0, missing
+}
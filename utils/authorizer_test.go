@@ -0,0 +1,47 @@
+package utils
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/remiges-tech/idshield/types"
+)
+
+func TestFakeAuthorizer(t *testing.T) {
+	authz := NewFakeAuthorizer().Allow("alice", CapGroupCreate, CapGroupRead).Allow("bob", CapGroupRead)
+	authz.Deny("alice", CapGroupRead)
+	tests := []struct {
+		name        string
+		op          types.OpReq
+		wantAllowed bool
+		wantMissing []string
+	}{
+		{"every capability held", types.OpReq{User: "alice", CapNeeded: []string{CapGroupCreate}}, true, nil},
+		{"denied capability", types.OpReq{User: "alice", CapNeeded: []string{CapGroupCreate, CapGroupRead}}, false, []string{CapGroupRead}},
+		{"other user's capability", types.OpReq{User: "bob", CapNeeded: []string{CapGroupCreate}}, false, []string{CapGroupCreate}},
+		{"unknown user", types.OpReq{User: "mallory", CapNeeded: []string{CapGroupRead}}, false, []string{CapGroupRead}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			allowed, missing := authz.Check(tt.op, false)
+			if allowed != tt.wantAllowed || !reflect.DeepEqual(missing, tt.wantMissing) {
+				t.Errorf("Check(%v) = %v %v, want %v %v", tt.op, allowed, missing, tt.wantAllowed, tt.wantMissing)
+			}
+		})
+	}
+}
+
+func TestSetAuthorizer(t *testing.T) {
+	op := types.OpReq{User: "alice", CapNeeded: []string{CapGroupCreate}}
+	prev := SetAuthorizer(NewFakeAuthorizer())
+	defer SetAuthorizer(prev)
+	if allowed, _ := Authz_check(op, false); allowed {
+		t.Error("Authz_check() allowed an operation the installed authorizer denies")
+	}
+
+	// nil reinstalls the default, which allows everything
+	SetAuthorizer(nil)
+	if allowed, _ := Authz_check(op, false); !allowed {
+		t.Error("Authz_check() denied an operation with the default authorizer")
+	}
+}
@@ -0,0 +1,70 @@
+package utils
+
+// Capabilities recognised by idshield, handlers refer to these instead of string literals
+const (
+	CapUserCreate     = "UserCreate"
+	CapUserRead       = "UserRead"
+	CapUserActivate   = "UserActivate"
+	CapUserDeactivate = "UserDeactivate"
+	CapUserDisable    = "UserDisable"
+
+	CapGroupCreate = "GroupCreate"
+	CapGroupRead   = "GroupRead"
+	CapGroupUpdate = "GroupUpdate"
+	CapGroupDelete = "GroupDelete"
+
+	CapGroupMemberAdd    = "GroupMemberAdd"
+	CapGroupMemberRemove = "GroupMemberRemove"
+	CapGroupRoleAssign   = "GroupRoleAssign"
+	CapGroupAudit        = "GroupAudit"
+
+	CapCapuserGrant   = "Capuser_grant"
+	CapCapuserRevoke  = "Capuser_revoke"
+	CapCapuserGetall  = "Capuser_getall"
+	CapCapgroupGrant  = "capgroup_grant"
+	CapCapgroupRevoke = "Capgroup_revoke"
+	CapCapgroupGetall = "Capgroup_getall"
+
+	CapClientRead = "ClientRead"
+
+	CapAuthzAdmin = "AuthzAdmin"
+	CapAuthzRead  = "AuthzRead"
+
+	// broad capabilities still required by the older user and group read handlers
+	CapDeveloper = "devloper"
+	CapAdmin     = "admin"
+)
+
+// CapabilityRegistry maps every capability name idshield recognises to its description
+var CapabilityRegistry = map[string]string{
+	CapUserCreate:     "create users",
+	CapUserRead:       "read and search users",
+	CapUserActivate:   "enable users",
+	CapUserDeactivate: "disable users",
+	CapUserDisable:    "disable or re-enable every member of a group at once",
+
+	CapGroupCreate: "create groups",
+	CapGroupRead:   "read and search groups",
+	CapGroupUpdate: "update groups and their attributes",
+	CapGroupDelete: "delete groups",
+
+	CapGroupMemberAdd:    "add users to groups",
+	CapGroupMemberRemove: "remove users from groups",
+	CapGroupRoleAssign:   "assign realm and client roles to groups",
+	CapGroupAudit:        "read the membership history of groups",
+
+	CapCapuserGrant:   "grant capabilities to a user",
+	CapCapuserRevoke:  "revoke capabilities from a user",
+	CapCapuserGetall:  "list the capabilities of a user",
+	CapCapgroupGrant:  "grant capabilities to a group",
+	CapCapgroupRevoke: "revoke capabilities from a group",
+	CapCapgroupGetall: "list the capabilities of a group",
+
+	CapClientRead: "list the realm's clients",
+
+	CapAuthzAdmin: "administer idshield authorization",
+	CapAuthzRead:  "read the capabilities held by other users",
+
+	CapDeveloper: "legacy developer access to user and group reads and updates",
+	CapAdmin:     "legacy admin access to user and group reads and updates",
+}
@@ -0,0 +1,73 @@
+package utils
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/remiges-tech/idshield/types"
+)
+
+// defaults applied to the CORS settings left empty in the config
+var (
+	defaultCORSMethods = []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete, http.MethodOptions}
+	defaultCORSHeaders = []string{"Authorization", "Content-Type", "If-None-Match"}
+)
+
+// CORS wraps next with CORS handling for browser clients. It sits in front of the router so that preflight
+// OPTIONS requests are answered here, without reaching the auth middleware or the handlers.
+// Requests from origins that aren't allowed get no CORS headers, and with no allowed origins CORS is off
+func CORS(cfg types.CORSConfig, next http.Handler) http.Handler {
+	methods := cfg.AllowedMethods
+	if len(methods) == 0 {
+		methods = defaultCORSMethods
+	}
+	headers := cfg.AllowedHeaders
+	if len(headers) == 0 {
+		headers = defaultCORSHeaders
+	}
+	allowMethods := strings.Join(methods, ", ")
+	allowHeaders := strings.Join(headers, ", ")
+
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		origin := req.Header.Get("Origin")
+		if origin == "" || !originAllowed(cfg.AllowedOrigins, origin) {
+			next.ServeHTTP(w, req)
+			return
+		}
+
+		h := w.Header()
+		h.Add("Vary", "Origin")
+		// a wildcard can't be combined with credentials, the origin is echoed back instead
+		if !cfg.AllowCredentials && originAllowed(cfg.AllowedOrigins, "*") {
+			h.Set("Access-Control-Allow-Origin", "*")
+		} else {
+			h.Set("Access-Control-Allow-Origin", origin)
+		}
+		if cfg.AllowCredentials {
+			h.Set("Access-Control-Allow-Credentials", "true")
+		}
+		h.Set("Access-Control-Expose-Headers", "ETag")
+
+		if req.Method == http.MethodOptions && req.Header.Get("Access-Control-Request-Method") != "" {
+			h.Set("Access-Control-Allow-Methods", allowMethods)
+			h.Set("Access-Control-Allow-Headers", allowHeaders)
+			if cfg.MaxAgeSecs > 0 {
+				h.Set("Access-Control-Max-Age", strconv.Itoa(cfg.MaxAgeSecs))
+			}
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		next.ServeHTTP(w, req)
+	})
+}
+
+// originAllowed reports whether origin is in the allowed list, "*" allows every origin
+func originAllowed(allowed []string, origin string) bool {
+	for _, o := range allowed {
+		if o == "*" || strings.EqualFold(o, origin) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,70 @@
+package utils
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/remiges-tech/idshield/types"
+)
+
+func TestOriginAllowed(t *testing.T) {
+	tests := []struct {
+		name    string
+		allowed []string
+		origin  string
+		want    bool
+	}{
+		{"none allowed", nil, "https://a.example", false},
+		{"listed", []string{"https://a.example"}, "https://a.example", true},
+		{"case insensitive", []string{"https://A.example"}, "https://a.example", true},
+		{"not listed", []string{"https://a.example"}, "https://b.example", false},
+		{"wildcard", []string{"*"}, "https://b.example", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := originAllowed(tt.allowed, tt.origin); got != tt.want {
+				t.Errorf("originAllowed(%v, %q) = %v, want %v", tt.allowed, tt.origin, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCORSPreflight(t *testing.T) {
+	called := false
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { called = true })
+	cfg := types.CORSConfig{AllowedOrigins: []string{"https://app.example"}, AllowCredentials: true, MaxAgeSecs: 600}
+
+	req := httptest.NewRequest(http.MethodOptions, "/groupnew", nil)
+	req.Header.Set("Origin", "https://app.example")
+	req.Header.Set("Access-Control-Request-Method", http.MethodPost)
+	w := httptest.NewRecorder()
+	CORS(cfg, next).ServeHTTP(w, req)
+
+	if called {
+		t.Error("preflight reached the handler")
+	}
+	want := map[string]string{
+		"Access-Control-Allow-Origin":      "https://app.example",
+		"Access-Control-Allow-Credentials": "true",
+		"Access-Control-Allow-Methods":     "GET, POST, PUT, PATCH, DELETE, OPTIONS",
+		"Access-Control-Allow-Headers":     "Authorization, Content-Type, If-None-Match",
+		"Access-Control-Max-Age":           "600",
+	}
+	if w.Code != http.StatusNoContent {
+		t.Errorf("preflight status = %d, want %d", w.Code, http.StatusNoContent)
+	}
+	for header, value := range want {
+		if got := w.Header().Get(header); got != value {
+			t.Errorf("preflight %s = %q, want %q", header, got, value)
+		}
+	}
+
+	// a preflight from another origin gets no CORS headers
+	req.Header.Set("Origin", "https://evil.example")
+	w = httptest.NewRecorder()
+	CORS(cfg, next).ServeHTTP(w, req)
+	if got := w.Header().Get("Access-Control-Allow-Origin"); got != "" {
+		t.Errorf("preflight from a disallowed origin got Access-Control-Allow-Origin %q", got)
+	}
+}
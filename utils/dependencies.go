@@ -0,0 +1,32 @@
+package utils
+
+import (
+	"fmt"
+
+	"github.com/Nerzal/gocloak/v13"
+	"github.com/remiges-tech/alya/service"
+)
+
+// dependencyTypeChecks holds the type expected for each known dependency key,
+// keys without an entry are only checked for presence
+var dependencyTypeChecks = map[string]func(any) bool{
+	"gocloak":     func(v any) bool { _, ok := v.(*gocloak.GoCloak); return ok },
+	"realm":       func(v any) bool { _, ok := v.(string); return ok },
+	"keycloakURL": func(v any) bool { _, ok := v.(string); return ok },
+	"webhook":     func(v any) bool { _, ok := v.(*Webhook); return ok },
+}
+
+// ValidateDependencies checks at startup that every required dependency is registered on the service
+// with the type the handlers expect, so a misconfigured deployment fails fast instead of at the first request
+func ValidateDependencies(s *service.Service, required ...string) error {
+	for _, key := range required {
+		dep, ok := s.Dependencies[key]
+		if !ok || dep == nil {
+			return fmt.Errorf("dependency %q is not registered", key)
+		}
+		if check, ok := dependencyTypeChecks[key]; ok && !check(dep) {
+			return fmt.Errorf("dependency %q has unexpected type %T", key, dep)
+		}
+	}
+	return nil
+}
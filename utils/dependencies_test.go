@@ -0,0 +1,35 @@
+package utils
+
+import (
+	"testing"
+
+	"github.com/Nerzal/gocloak/v13"
+	"github.com/remiges-tech/alya/service"
+)
+
+func TestValidateDependencies(t *testing.T) {
+	tests := []struct {
+		name     string
+		deps     service.Dependencies
+		required []string
+		wantErr  bool
+	}{
+		{"nothing required", service.Dependencies{}, nil, false},
+		{"all present", service.Dependencies{"gocloak": gocloak.NewClient("http://localhost"), "realm": "test"},
+			[]string{"gocloak", "realm"}, false},
+		{"missing", service.Dependencies{"realm": "test"}, []string{"gocloak", "realm"}, true},
+		{"nil value", service.Dependencies{"realm": nil}, []string{"realm"}, true},
+		{"wrong type", service.Dependencies{"realm": 42}, []string{"realm"}, true},
+		{"wrong gocloak type", service.Dependencies{"gocloak": "http://localhost"}, []string{"gocloak"}, true},
+		{"wrong keycloakURL type", service.Dependencies{"keycloakURL": 8080}, []string{"keycloakURL"}, true},
+		{"unknown key only checked for presence", service.Dependencies{"extra": 42}, []string{"extra"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateDependencies(&service.Service{Dependencies: tt.deps}, tt.required...)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ValidateDependencies() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
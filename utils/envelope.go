@@ -0,0 +1,27 @@
+package utils
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/remiges-tech/alya/wscutils"
+)
+
+// Envelope is the shape of every successful group response: the alya response together with the
+// machine-readable name of the operation performed (e.g. group.create), the payload is always under data
+type Envelope struct {
+	Status    string                  `json:"status"`
+	Operation string                  `json:"operation"`
+	Data      any                     `json:"data"`
+	Messages  []wscutils.ErrorMessage `json:"messages"`
+}
+
+// SendSuccess sends response, keeping its status, data and messages, in the envelope of operation
+func SendSuccess(c *gin.Context, operation string, response *wscutils.Response) {
+	c.JSON(http.StatusOK, Envelope{
+		Status:    response.Status,
+		Operation: operation,
+		Data:      response.Data,
+		Messages:  response.Messages,
+	})
+}
@@ -0,0 +1,24 @@
+package utils
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/remiges-tech/alya/wscutils"
+)
+
+func TestSendSuccess(t *testing.T) {
+	r := gin.New()
+	r.GET("/groupget", func(c *gin.Context) {
+		SendSuccess(c, "group.get", &wscutils.Response{Status: "partially_created", Data: map[string]string{"id": "g1"}, Messages: []wscutils.ErrorMessage{}})
+	})
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/groupget", nil))
+
+	want := `{"status":"partially_created","operation":"group.get","data":{"id":"g1"},"messages":[]}`
+	if w.Code != http.StatusOK || w.Body.String() != want {
+		t.Errorf("SendSuccess() = %d %s, want 200 %s", w.Code, w.Body, want)
+	}
+}
@@ -0,0 +1,84 @@
+package utils
+
+import (
+	"bufio"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// errorTypeLine matches an entry of errortypes.yaml, e.g. "not_exist" : 114
+var errorTypeLine = regexp.MustCompile(`^"([^"]+)"\s*:\s*(\d+)\s*$`)
+
+// errCodeConsts returns the error code constants of the package by name, the ErrHTTP* ones are Keycloak's
+// error messages matched by GocloakErrorHandler, not codes sent to clients, and are left out
+func errCodeConsts(t *testing.T) map[string]string {
+	t.Helper()
+	pkgs, err := parser.ParseDir(token.NewFileSet(), ".", func(fi os.FileInfo) bool {
+		return !strings.HasSuffix(fi.Name(), "_test.go")
+	}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	consts := map[string]string{}
+	for _, file := range pkgs["utils"].Files {
+		for _, decl := range file.Decls {
+			gen, ok := decl.(*ast.GenDecl)
+			if !ok || gen.Tok != token.CONST {
+				continue
+			}
+			for _, spec := range gen.Specs {
+				vs := spec.(*ast.ValueSpec)
+				for i, name := range vs.Names {
+					if !strings.HasPrefix(name.Name, "Err") || strings.HasPrefix(name.Name, "ErrHTTP") || i >= len(vs.Values) {
+						continue
+					}
+					if lit, ok := vs.Values[i].(*ast.BasicLit); ok && lit.Kind == token.STRING {
+						consts[name.Name], _ = strconv.Unquote(lit.Value)
+					}
+				}
+			}
+		}
+	}
+	return consts
+}
+
+func TestErrorCodes(t *testing.T) {
+	types, err := os.Open("../errortypes.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer types.Close()
+	msgIDs := map[string]string{}
+	codes := map[string]bool{}
+	scanner := bufio.NewScanner(types)
+	for scanner.Scan() {
+		m := errorTypeLine.FindStringSubmatch(strings.TrimSpace(scanner.Text()))
+		if m == nil {
+			continue
+		}
+		if codes[m[1]] {
+			t.Errorf("errortypes.yaml lists %q twice", m[1])
+		}
+		if other, ok := msgIDs[m[2]]; ok {
+			t.Errorf("errortypes.yaml gives %q and %q the same msgid %s", other, m[1], m[2])
+		}
+		codes[m[1]], msgIDs[m[2]] = true, m[1]
+	}
+
+	byCode := map[string]string{}
+	for name, code := range errCodeConsts(t) {
+		if !codes[code] {
+			t.Errorf("%s = %q is not in errortypes.yaml", name, code)
+		}
+		if other, ok := byCode[code]; ok {
+			t.Errorf("%s and %s are both %q", other, name, code)
+		}
+		byCode[code] = name
+	}
+}
@@ -0,0 +1,49 @@
+package utils
+
+import "testing"
+
+func TestETagMatches(t *testing.T) {
+	const etag = `"abc"`
+	tests := []struct {
+		name        string
+		ifNoneMatch string
+		want        bool
+	}{
+		{"empty header", "", false},
+		{"same tag", `"abc"`, true},
+		{"other tag", `"def"`, false},
+		{"wildcard", "*", true},
+		{"weak tag", `W/"abc"`, true},
+		{"listed among others", `"def", "abc"`, true},
+		{"padded list", ` "def" ,  W/"abc" `, true},
+		{"unquoted tag", "abc", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ETagMatches(tt.ifNoneMatch, etag); got != tt.want {
+				t.Errorf("ETagMatches(%q) = %v, want %v", tt.ifNoneMatch, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestETag(t *testing.T) {
+	a, err := ETag(map[string]string{"name": "admins"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := ETag(map[string]string{"name": "admins"})
+	c, _ := ETag(map[string]string{"name": "users"})
+	if a != b {
+		t.Errorf("same content gave different tags %s and %s", a, b)
+	}
+	if a == c {
+		t.Errorf("different content gave the same tag %s", a)
+	}
+	if !ETagMatches(a, a) {
+		t.Errorf("tag %s doesn't match itself", a)
+	}
+	if _, err := ETag(make(chan int)); err == nil {
+		t.Error("expected an error for a value json can't encode")
+	}
+}
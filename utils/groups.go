@@ -0,0 +1,204 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"strings"
+
+	"github.com/Nerzal/gocloak/v13"
+	"github.com/remiges-tech/alya/service"
+)
+
+// ErrGroupNotFound is returned by GetGroupByExactName when no group carries exactly the requested name
+var ErrGroupNotFound = errors.New("group not found")
+
+// GetGroupByExactName looks up a group by its exact name. Newer Keycloak versions honour the exact flag and
+// only return the group itself, older ones ignore it and fall back to a substring match, so the search results
+// are still filtered and partial matches are never returned
+func GetGroupByExactName(ctx context.Context, client *gocloak.GoCloak, token, realm, name string) (*gocloak.Group, error) {
+	groups, err := client.GetGroups(ctx, token, realm, gocloak.GetGroupsParams{
+		Search: &name,
+		Exact:  gocloak.BoolP(true),
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, grp := range groups {
+		if grp.Name != nil && *grp.Name == name {
+			return grp, nil
+		}
+	}
+	return nil, ErrGroupNotFound
+}
+
+// groupPageSize is the page size used when listing the realm's groups page by page
+const groupPageSize = 100
+
+// ResolveGroupIDs maps each of the group names to its id, returning the names no group carries exactly as
+// unresolved. Keycloak can't search for several names at once, so it takes whichever is fewer round trips:
+// one exact search per name, or paging through the realm's groups until every name has been seen
+func ResolveGroupIDs(ctx context.Context, s *service.Service, token, realm string, names []string) (map[string]string, []string, error) {
+	client, ok := s.Dependencies["gocloak"].(*gocloak.GoCloak)
+	if !ok {
+		return nil, nil, errors.New("gocloak dependency not registered")
+	}
+	ids := make(map[string]string)
+	wanted := make(map[string]bool)
+	for _, name := range names {
+		wanted[name] = true
+	}
+	if len(wanted) == 0 {
+		return ids, []string{}, nil
+	}
+
+	searchByName := len(wanted) == 1
+	if !searchByName {
+		// the listing pages through top level groups only, so subgroups don't count towards its round trips
+		count, err := CountTopLevelGroups(ctx, s, token, realm)
+		if err != nil {
+			return nil, nil, err
+		}
+		searchByName = (count+groupPageSize-1)/groupPageSize >= len(wanted)
+	}
+
+	if searchByName {
+		for name := range wanted {
+			grp, err := GetGroupByExactName(ctx, client, token, realm, name)
+			if errors.Is(err, ErrGroupNotFound) {
+				continue
+			}
+			if err != nil {
+				return nil, nil, err
+			}
+			ids[name] = *grp.ID
+		}
+	} else {
+		for first := 0; len(ids) < len(wanted); first += groupPageSize {
+			groups, err := client.GetGroups(ctx, token, realm, gocloak.GetGroupsParams{
+				First:               gocloak.IntP(first),
+				Max:                 gocloak.IntP(groupPageSize),
+				BriefRepresentation: gocloak.BoolP(true),
+			})
+			if err != nil {
+				return nil, nil, err
+			}
+			for _, grp := range groups {
+				if grp.Name != nil && grp.ID != nil && wanted[*grp.Name] {
+					ids[*grp.Name] = *grp.ID
+				}
+			}
+			if len(groups) < groupPageSize {
+				break
+			}
+		}
+	}
+
+	// unresolved names are reported in the order they were asked for
+	unresolved := []string{}
+	for _, name := range names {
+		if _, ok := ids[name]; !ok && wanted[name] {
+			unresolved = append(unresolved, name)
+			wanted[name] = false
+		}
+	}
+	return ids, unresolved, nil
+}
+
+// SearchGroupsByAttribute returns the groups, at any depth, whose attribute key holds exactly value. The attribute
+// query (q=key:value) lets newer Keycloak versions filter server-side; older versions ignore q and return every
+// group or reject it, so the results are always filtered here and a rejected query falls back to a full listing
+func SearchGroupsByAttribute(ctx context.Context, client *gocloak.GoCloak, token, realm, key, value string) ([]*gocloak.Group, error) {
+	// q separates its key:value pairs with spaces, a key or value containing one can't be expressed in it
+	if strings.ContainsAny(key+value, " \t") {
+		return searchGroupPages(ctx, client, token, realm, nil, key, value)
+	}
+	q := key + ":" + value
+	matches, err := searchGroupPages(ctx, client, token, realm, &q, key, value)
+	if err != nil {
+		matches, err = searchGroupPages(ctx, client, token, realm, nil, key, value)
+	}
+	return matches, err
+}
+
+// searchGroupPages pages through the group listing, narrowed by the attribute query q when it is set, and returns
+// the groups whose attribute key holds value, including the subgroups embedded in the listing. The full
+// representation is asked for since the brief one carries no attributes
+func searchGroupPages(ctx context.Context, client *gocloak.GoCloak, token, realm string, q *string, key, value string) ([]*gocloak.Group, error) {
+	matches := []*gocloak.Group{}
+	seen := map[string]bool{}
+	var walk func(grp *gocloak.Group)
+	walk = func(grp *gocloak.Group) {
+		if grp.ID != nil && !seen[*grp.ID] && grp.Attributes != nil {
+			for _, v := range (*grp.Attributes)[key] {
+				if v == value {
+					seen[*grp.ID] = true
+					matches = append(matches, grp)
+					break
+				}
+			}
+		}
+		if grp.SubGroups != nil {
+			for i := range *grp.SubGroups {
+				walk(&(*grp.SubGroups)[i])
+			}
+		}
+	}
+
+	for first := 0; ; first += groupPageSize {
+		groups, err := client.GetGroups(ctx, token, realm, gocloak.GetGroupsParams{
+			Q:                   q,
+			First:               gocloak.IntP(first),
+			Max:                 gocloak.IntP(groupPageSize),
+			BriefRepresentation: gocloak.BoolP(false),
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, grp := range groups {
+			walk(grp)
+		}
+		if len(groups) < groupPageSize {
+			return matches, nil
+		}
+	}
+}
+
+// CountTopLevelGroups returns the number of top level groups in the realm. Keycloak's /groups/count includes
+// subgroups unless top=true is passed, which gocloak's GetGroupsCount has no param for
+func CountTopLevelGroups(ctx context.Context, s *service.Service, token, realm string) (int, error) {
+	var result struct {
+		Count int `json:"count"`
+	}
+	if err := AdminGet(ctx, s, token, realm, url.Values{"top": {"true"}}, &result, "groups", "count"); err != nil {
+		return 0, err
+	}
+	return result.Count, nil
+}
+
+// AddUserToGroupIfAbsent adds the user to the group unless they are already a member, reporting whether an add
+// took place. Keycloak's AddUserToGroup succeeds either way, so membership is checked against the user's groups first
+func AddUserToGroupIfAbsent(ctx context.Context, client *gocloak.GoCloak, token, realm, userID, groupID string) (bool, error) {
+	for first := 0; ; first += groupPageSize {
+		groups, err := client.GetUserGroups(ctx, token, realm, userID, gocloak.GetGroupsParams{
+			First:               gocloak.IntP(first),
+			Max:                 gocloak.IntP(groupPageSize),
+			BriefRepresentation: gocloak.BoolP(true),
+		})
+		if err != nil {
+			return false, err
+		}
+		for _, grp := range groups {
+			if grp.ID != nil && *grp.ID == groupID {
+				return false, nil
+			}
+		}
+		if len(groups) < groupPageSize {
+			break
+		}
+	}
+	if err := client.AddUserToGroup(ctx, token, realm, userID, groupID); err != nil {
+		return false, err
+	}
+	return true, nil
+}
@@ -0,0 +1,238 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/Nerzal/gocloak/v13"
+	"github.com/remiges-tech/alya/service"
+	"github.com/remiges-tech/idshield/internal/keycloaktest"
+)
+
+func TestGetGroupByExactName(t *testing.T) {
+	kc := keycloaktest.NewServer(t)
+	realm := kc.Realm("acme")
+	realm.AddGroup("/admins-eu", nil)
+	admins := realm.AddGroup("/admins", nil)
+	realm.AddGroup("/sales-admins", nil)
+	token := keycloaktest.Token("acme", "alice")
+
+	tests := []struct {
+		name    string
+		want    string
+		wantErr error
+	}{
+		{"admins", admins.ID, nil},
+		{"admin", "", ErrGroupNotFound},
+		{"Admins", "", ErrGroupNotFound},
+		{"auditors", "", ErrGroupNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			grp, err := GetGroupByExactName(context.Background(), kc.Client(), token, "acme", tt.name)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("GetGroupByExactName(%q) error = %v, want %v", tt.name, err, tt.wantErr)
+			}
+			if tt.wantErr == nil && *grp.ID != tt.want {
+				t.Errorf("GetGroupByExactName(%q) = %s, want %s", tt.name, *grp.ID, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetGroupByExactNameSearchError(t *testing.T) {
+	kc := keycloaktest.NewServer(t)
+	kc.Realm("acme").AddGroup("/admins", nil)
+	kc.Handle(http.MethodGet, "/admin/realms/acme/groups", func(w http.ResponseWriter, r *http.Request) {
+		keycloaktest.Error(w, http.StatusUnauthorized, "HTTP 401 Unauthorized")
+	})
+
+	_, err := GetGroupByExactName(context.Background(), kc.Client(), keycloaktest.Token("acme", "alice"), "acme", "admins")
+	if err == nil || errors.Is(err, ErrGroupNotFound) || err.Error() != ErrHTTPUnauthorized {
+		t.Errorf("GetGroupByExactName() error = %v, want the Keycloak error %q", err, ErrHTTPUnauthorized)
+	}
+}
+
+func TestGetGroupByExactNameExactFlag(t *testing.T) {
+	tests := []struct {
+		name        string
+		honourExact bool
+	}{
+		{"exact search", true},
+		{"older keycloak ignoring exact", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kc := keycloaktest.NewServer(t)
+			realm := kc.Realm("acme")
+			realm.AddGroup("/admins-eu", nil)
+			admins := realm.AddGroup("/admins", nil)
+			var exactParams []string
+			kc.Handle(http.MethodGet, "/admin/realms/acme/groups", func(w http.ResponseWriter, r *http.Request) {
+				query := r.URL.Query()
+				exactParams = append(exactParams, query.Get("exact"))
+				if !tt.honourExact {
+					// an older Keycloak drops the flag and does its substring match
+					query.Del("exact")
+					r.URL.RawQuery = query.Encode()
+				}
+				kc.Fake(w, r)
+			})
+
+			grp, err := GetGroupByExactName(context.Background(), kc.Client(), keycloaktest.Token("acme", "alice"), "acme", "admins")
+			if err != nil || *grp.ID != admins.ID {
+				t.Fatalf("GetGroupByExactName(admins) = %v, %v, want %s", grp, err, admins.ID)
+			}
+			if !reflect.DeepEqual(exactParams, []string{"true"}) {
+				t.Errorf("exact params sent = %v, want a single search with exact=true", exactParams)
+			}
+		})
+	}
+}
+
+func TestSearchGroupsByAttribute(t *testing.T) {
+	kc := keycloaktest.NewServer(t)
+	realm := kc.Realm("acme")
+	hr := realm.AddGroup("/hr", map[string][]string{"dept": {"hr"}})
+	payroll := realm.AddGroup("/finance/payroll", map[string][]string{"dept": {"hr", "finance"}})
+	realm.AddGroup("/sales", map[string][]string{"dept": {"sales"}})
+	realm.AddGroup("/hr-archive", map[string][]string{"dept": {"hr-old"}})
+	token := keycloaktest.Token("acme", "alice")
+
+	// withQuery answers the attribute query like newer Keycloak versions, rejectQuery like the ones that don't know q
+	withQuery := func(w http.ResponseWriter, r *http.Request) { kc.Fake(w, r) }
+	rejectQuery := func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Has("q") {
+			keycloaktest.Error(w, http.StatusBadRequest, "unknown_error")
+			return
+		}
+		kc.Fake(w, r)
+	}
+	for name, handler := range map[string]http.HandlerFunc{"q": withQuery, "fallback": rejectQuery} {
+		t.Run(name, func(t *testing.T) {
+			kc.Handle(http.MethodGet, "/admin/realms/acme/groups", handler)
+			groups, err := SearchGroupsByAttribute(context.Background(), kc.Client(), token, "acme", "dept", "hr")
+			if err != nil {
+				t.Fatalf("SearchGroupsByAttribute() error = %v", err)
+			}
+			got := map[string]bool{}
+			for _, grp := range groups {
+				got[*grp.ID] = true
+			}
+			if want := map[string]bool{hr.ID: true, payroll.ID: true}; !reflect.DeepEqual(got, want) {
+				t.Errorf("SearchGroupsByAttribute(dept, hr) = %v, want %v", got, want)
+			}
+		})
+	}
+	if n := kc.CallCount("GET /admin/realms/acme/groups?"); n != 3 {
+		t.Errorf("group listings = %d, want 1 with q and 2 for the fallback", n)
+	}
+}
+
+func TestCountTopLevelGroups(t *testing.T) {
+	kc := keycloaktest.NewServer(t)
+	realm := kc.Realm("acme")
+	realm.AddGroup("/admins", nil)
+	realm.AddGroup("/org/finance", nil)
+	realm.AddGroup("/org/sales", nil)
+	token := keycloaktest.Token("acme", "alice")
+	s := &service.Service{Dependencies: service.Dependencies{"gocloak": kc.Client(), "keycloakURL": kc.URL}}
+
+	if n, err := CountTopLevelGroups(context.Background(), s, token, "acme"); err != nil || n != 2 {
+		t.Errorf("CountTopLevelGroups() = %d, %v, want 2", n, err)
+	}
+
+	// keycloak's errors come back in the form GocloakErrorHandler parses
+	_, err := CountTopLevelGroups(context.Background(), s, token, "globex")
+	var apiErr *gocloak.APIError
+	if !errors.As(err, &apiErr) || apiErr.Code != http.StatusNotFound {
+		t.Errorf("CountTopLevelGroups() in an unknown realm error = %v, want a 404 APIError", err)
+	}
+
+	delete(s.Dependencies, "keycloakURL")
+	if _, err := CountTopLevelGroups(context.Background(), s, token, "acme"); err == nil {
+		t.Error("CountTopLevelGroups() without the keycloakURL dependency succeeded, want an error")
+	}
+}
+
+func TestResolveGroupIDs(t *testing.T) {
+	kc := keycloaktest.NewServer(t)
+	realm := kc.Realm("acme")
+	admins := realm.AddGroup("/admins", nil)
+	sales := realm.AddGroup("/sales", nil)
+	realm.AddGroup("/admins-eu", nil)
+	// subgroups aren't part of the top level listing, so they must not make it look longer
+	for i := 0; i < 2*groupPageSize; i++ {
+		realm.AddGroup(fmt.Sprintf("/sales/team-%03d", i), nil)
+	}
+	s := &service.Service{Dependencies: service.Dependencies{"gocloak": kc.Client(), "keycloakURL": kc.URL}}
+	token := keycloaktest.Token("acme", "alice")
+
+	tests := []struct {
+		name           string
+		names          []string
+		want           map[string]string
+		wantUnresolved []string
+		wantListing    bool
+	}{
+		{"single name", []string{"admins"}, map[string]string{"admins": admins.ID}, []string{}, false},
+		// three top level groups fit one page, which beats three searches
+		{"listing", []string{"admins", "admin", "sales", "admin"}, map[string]string{"admins": admins.ID, "sales": sales.ID}, []string{"admin"}, true},
+		{"no names", nil, map[string]string{}, []string{}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := kc.CallCount("GET /admin/realms/acme/groups?briefRepresentation=true")
+			ids, unresolved, err := ResolveGroupIDs(context.Background(), s, token, "acme", tt.names)
+			if err != nil {
+				t.Fatalf("ResolveGroupIDs() error = %v", err)
+			}
+			if !reflect.DeepEqual(ids, tt.want) || !reflect.DeepEqual(unresolved, tt.wantUnresolved) {
+				t.Errorf("ResolveGroupIDs(%v) = %v %v, want %v %v", tt.names, ids, unresolved, tt.want, tt.wantUnresolved)
+			}
+			if listed := kc.CallCount("GET /admin/realms/acme/groups?briefRepresentation=true") > before; listed != tt.wantListing {
+				t.Errorf("ResolveGroupIDs(%v) listed the groups = %v, want %v", tt.names, listed, tt.wantListing)
+			}
+		})
+	}
+	if n := kc.CallCount("GET /admin/realms/acme/groups/count?top=true"); n != 1 {
+		t.Errorf("top level group counts = %d, want 1", n)
+	}
+}
+
+func TestAddUserToGroupIfAbsent(t *testing.T) {
+	kc := keycloaktest.NewServer(t)
+	realm := kc.Realm("acme")
+	bob := realm.AddUser("bob", true)
+	sales := realm.AddGroup("/sales", nil)
+	support := realm.AddGroup("/support", nil).AddMembers(bob)
+	token := keycloaktest.Token("acme", "alice")
+
+	tests := []struct {
+		name      string
+		group     *keycloaktest.Group
+		wantAdded bool
+	}{
+		{"newly added", sales, true},
+		{"already member", support, false},
+		{"added twice", sales, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			added, err := AddUserToGroupIfAbsent(context.Background(), kc.Client(), token, "acme", bob.ID, tt.group.ID)
+			if err != nil || added != tt.wantAdded {
+				t.Errorf("AddUserToGroupIfAbsent(%s) = %v %v, want %v", tt.group.Name, added, err, tt.wantAdded)
+			}
+			if len(tt.group.Members) != 1 || tt.group.Members[0] != bob {
+				t.Errorf("members of %s = %v, want bob once", tt.group.Name, tt.group.Members)
+			}
+		})
+	}
+	if n := kc.CallCount("PUT /admin/realms/acme/users/" + bob.ID + "/groups/"); n != 1 {
+		t.Errorf("membership adds = %d, want 1", n)
+	}
+}
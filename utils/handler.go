@@ -0,0 +1,94 @@
+package utils
+
+import (
+	"strings"
+
+	"github.com/Nerzal/gocloak/v13"
+	"github.com/gin-gonic/gin"
+	"github.com/remiges-tech/alya/router"
+	"github.com/remiges-tech/alya/service"
+	"github.com/remiges-tech/alya/wscutils"
+	"github.com/remiges-tech/idshield/types"
+	"github.com/remiges-tech/logharbour/logharbour"
+)
+
+// HandlerContext is what Handler passes to the business logic of a handler, everything in it has already been
+// extracted from the request and checked
+type HandlerContext struct {
+	Gin      *gin.Context
+	Service  *service.Service
+	Token    string
+	Realm    string
+	Username string
+	Client   *gocloak.GoCloak
+	Logger   *logharbour.Logger
+}
+
+// Handler wraps fn with the steps every handler repeats: logging the start and finish of op, extracting the
+// token, the realm and the username from it, the authz check for capNeeded and loading the gocloak client.
+// fn is only called once all of them have succeeded, otherwise the matching error response is sent.
+// op is the name the handler is logged under, e.g. "Group_new"
+func Handler(op string, capNeeded []string, fn func(ctx HandlerContext)) service.HandlerFunc {
+	return func(c *gin.Context, s *service.Service) {
+		l := RequestLogger(c, s, op)
+		l.Log("Starting execution of " + op + "()")
+
+		token, err := router.ExtractToken(c.GetHeader("Authorization"))
+		if err != nil {
+			l.Debug0().LogDebug("Missing or incorrect Authorization header format:", logharbour.DebugInfo{Variables: map[string]any{"error": err}})
+			wscutils.SendErrorResponse(c, wscutils.NewErrorResponse(ErrTokenMissing))
+			return
+		}
+		r, err := ExtractClaimFromJwt(token, "iss")
+		if err != nil {
+			l.Debug0().LogDebug("Missing or incorrect realm:", logharbour.DebugInfo{Variables: map[string]any{"error": err}})
+			wscutils.SendErrorResponse(c, wscutils.NewErrorResponse(ErrRealmNotFound))
+			return
+		}
+		parts := strings.Split(r, "/realms/")
+		if len(parts) != 2 {
+			l.Debug0().LogDebug("Missing or incorrect realm:", logharbour.DebugInfo{Variables: map[string]any{"iss": r}})
+			wscutils.SendErrorResponse(c, wscutils.NewErrorResponse(ErrRealmNotFound))
+			return
+		}
+		realm := CanonicalRealm(c, s, token, parts[1])
+		l = WithRealm(l, realm)
+		username, err := ExtractClaimFromJwt(token, "preferred_username")
+		if err != nil {
+			l.Debug0().LogDebug("Missing username:", logharbour.DebugInfo{Variables: map[string]any{"error": err}})
+			wscutils.SendErrorResponse(c, wscutils.NewErrorResponse(ErrUserNotFound))
+			return
+		}
+
+		isCapable, _ := Authz_check(types.OpReq{
+			User:      username,
+			CapNeeded: capNeeded,
+		}, false)
+
+		if !isCapable {
+			l.Log("Unauthorized user:")
+			wscutils.SendErrorResponse(c, wscutils.NewErrorResponse(ErrUnauthorized))
+			return
+		}
+
+		// Extracting the GoCloak client from the service dependencies
+		gcClient, ok := s.Dependencies["gocloak"].(*gocloak.GoCloak)
+		if !ok {
+			l.Log("Failed to load the dependency to *gocloak.GoCloak")
+			wscutils.SendErrorResponse(c, wscutils.NewErrorResponse(ErrFailedToLoadDependence))
+			return
+		}
+
+		fn(HandlerContext{
+			Gin:      c,
+			Service:  s,
+			Token:    token,
+			Realm:    realm,
+			Username: username,
+			Client:   gcClient,
+			Logger:   l,
+		})
+
+		l.Log("Finished execution of " + op + "()")
+	}
+}
@@ -0,0 +1,73 @@
+package utils
+
+import (
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/remiges-tech/alya/wscutils"
+	"github.com/remiges-tech/idshield/internal/keycloaktest"
+)
+
+func TestHandler(t *testing.T) {
+	client := keycloaktest.NewServer(t).Client()
+	s, logs := keycloaktest.NewService()
+	s.WithDependency("gocloak", client)
+
+	var got *HandlerContext
+	handler := Handler("Thing_get", []string{CapGroupRead}, func(ctx HandlerContext) {
+		got = &ctx
+		wscutils.SendSuccessResponse(ctx.Gin, wscutils.NewSuccessResponse(nil))
+	})
+	token := keycloaktest.Token("acme", "alice")
+
+	w := keycloaktest.Do(s, handler, keycloaktest.NewRequest(http.MethodGet, "/thingget", token, nil))
+	if w.Code != http.StatusOK || got == nil {
+		t.Fatalf("Handler() = %d %s, want fn called", w.Code, w.Body)
+	}
+	if got.Token != token || got.Realm != "acme" || got.Username != "alice" || got.Client != client || got.Service != s || got.Logger == nil {
+		t.Errorf("HandlerContext = %+v, want the token, acme, alice, the service and its gocloak client", *got)
+	}
+	for _, line := range []string{"Starting execution of Thing_get()", "Finished execution of Thing_get()"} {
+		if !strings.Contains(logs.String(), line) {
+			t.Errorf("logs = %s, want %q", logs, line)
+		}
+	}
+}
+
+func TestHandlerRejects(t *testing.T) {
+	kc := keycloaktest.NewServer(t)
+	tests := []struct {
+		name    string
+		token   string
+		client  bool
+		wantErr string
+	}{
+		{"no token", "", true, ErrTokenMissing},
+		{"no issuer", keycloaktest.TokenWithClaims(jwt.MapClaims{"preferred_username": "alice"}), true, ErrRealmNotFound},
+		{"issuer without realm", keycloaktest.TokenWithClaims(jwt.MapClaims{"iss": "http://keycloak.test", "preferred_username": "alice"}), true, ErrRealmNotFound},
+		{"no username", keycloaktest.TokenWithClaims(jwt.MapClaims{"iss": keycloaktest.Issuer + "acme"}), true, ErrUserNotFound},
+		{"no gocloak client", keycloaktest.Token("acme", "alice"), false, ErrFailedToLoadDependence},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, _ := keycloaktest.NewService()
+			if tt.client {
+				s.WithDependency("gocloak", kc.Client())
+			}
+			called := false
+			handler := Handler("Thing_get", []string{CapGroupRead}, func(ctx HandlerContext) { called = true })
+
+			w := keycloaktest.Do(s, handler, keycloaktest.NewRequest(http.MethodGet, "/thingget", tt.token, nil))
+			resp := keycloaktest.Decode(t, w, nil)
+			if w.Code != http.StatusBadRequest || !reflect.DeepEqual(resp.ErrCodes(), []string{tt.wantErr}) {
+				t.Errorf("Handler() = %d %s, want 400 %s", w.Code, w.Body, tt.wantErr)
+			}
+			if called {
+				t.Error("fn was called")
+			}
+		})
+	}
+}
@@ -0,0 +1,22 @@
+package utils
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/remiges-tech/alya/service"
+	"github.com/remiges-tech/logharbour/logharbour"
+)
+
+// logClassRealm is the what_class of the entries logged through WithRealm
+const logClassRealm = "realm"
+
+// RequestLogger returns the logger of a request, every entry carries the caller's IP and the handler name as op
+func RequestLogger(c *gin.Context, s *service.Service, handler string) *logharbour.Logger {
+	return s.LogHarbour.WithRemoteIP(c.ClientIP()).WithOp(handler)
+}
+
+// WithRealm tags the entries of l with realm once the handler knows it, so logs of a multi-tenant deployment
+// can be filtered by realm. logharbour has no realm field, so an entry names the realm as the object it acts on:
+// what_class is "realm" and what_instance_id the realm's name. module is left to name the subsystem
+func WithRealm(l *logharbour.Logger, realm string) *logharbour.Logger {
+	return l.WithWhatClass(logClassRealm).WithWhatInstanceId(realm)
+}
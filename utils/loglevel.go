@@ -0,0 +1,34 @@
+package utils
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/remiges-tech/logharbour/logharbour"
+)
+
+// logLevels maps the configured log_level names to LogHarbour priorities
+var logLevels = map[string]logharbour.LogPriority{
+	"debug2": logharbour.Debug2,
+	"debug1": logharbour.Debug1,
+	"debug0": logharbour.Debug0,
+	"debug":  logharbour.Debug0,
+	"info":   logharbour.Info,
+	"warn":   logharbour.Warn,
+	"error":  logharbour.Err,
+	"crit":   logharbour.Crit,
+	"sec":    logharbour.Sec,
+}
+
+// ParseLogLevel converts a configured log level into the minimum priority LogHarbour emits,
+// entries below it (e.g. Debug0 at "info") are dropped. An empty level defaults to info
+func ParseLogLevel(level string) (logharbour.LogPriority, error) {
+	if level == "" {
+		return logharbour.Info, nil
+	}
+	priority, ok := logLevels[strings.ToLower(level)]
+	if !ok {
+		return 0, fmt.Errorf("unknown log level: %v", level)
+	}
+	return priority, nil
+}
@@ -0,0 +1,37 @@
+package utils
+
+import (
+	"testing"
+
+	"github.com/remiges-tech/logharbour/logharbour"
+)
+
+func TestParseLogLevel(t *testing.T) {
+	tests := []struct {
+		level   string
+		want    logharbour.LogPriority
+		wantErr bool
+	}{
+		{"", logharbour.Info, false},
+		{"info", logharbour.Info, false},
+		{"INFO", logharbour.Info, false},
+		{"debug", logharbour.Debug0, false},
+		{"debug2", logharbour.Debug2, false},
+		{"warn", logharbour.Warn, false},
+		{"error", logharbour.Err, false},
+		{"Sec", logharbour.Sec, false},
+		{"verbose", 0, true},
+		{" info", 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.level, func(t *testing.T) {
+			got, err := ParseLogLevel(tt.level)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseLogLevel(%q) error = %v, wantErr %v", tt.level, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseLogLevel(%q) = %v, want %v", tt.level, got, tt.want)
+			}
+		})
+	}
+}
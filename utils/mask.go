@@ -0,0 +1,21 @@
+package utils
+
+// MaskedValue replaces the value of a sensitive attribute in log output
+const MaskedValue = "***"
+
+// MaskAttributes returns a copy of attrs safe for logging, the values of the sensitive keys are replaced
+// with MaskedValue. The original map, which is what gets written to Keycloak, is left untouched
+func MaskAttributes(attrs map[string]string, sensitiveKeys []string) map[string]string {
+	sensitive := make(map[string]bool, len(sensitiveKeys))
+	for _, key := range sensitiveKeys {
+		sensitive[key] = true
+	}
+	masked := make(map[string]string, len(attrs))
+	for key, value := range attrs {
+		if sensitive[key] {
+			value = MaskedValue
+		}
+		masked[key] = value
+	}
+	return masked
+}
@@ -0,0 +1,40 @@
+package utils
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMaskAttributes(t *testing.T) {
+	tests := []struct {
+		name      string
+		attrs     map[string]string
+		sensitive []string
+		want      map[string]string
+	}{
+		{"nothing sensitive", map[string]string{"dept": "hr"}, nil, map[string]string{"dept": "hr"}},
+		{"sensitive key masked", map[string]string{"dept": "hr", "pan": "ABCDE1234F"}, []string{"pan"},
+			map[string]string{"dept": "hr", "pan": MaskedValue}},
+		{"sensitive key absent", map[string]string{"dept": "hr"}, []string{"pan"}, map[string]string{"dept": "hr"}},
+		{"keys are case sensitive", map[string]string{"PAN": "ABCDE1234F"}, []string{"pan"}, map[string]string{"PAN": "ABCDE1234F"}},
+		{"nil attributes", nil, []string{"pan"}, map[string]string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var original map[string]string
+			if tt.attrs != nil {
+				original = make(map[string]string, len(tt.attrs))
+				for key, value := range tt.attrs {
+					original[key] = value
+				}
+			}
+			got := MaskAttributes(tt.attrs, tt.sensitive)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("MaskAttributes() = %v, want %v", got, tt.want)
+			}
+			if !reflect.DeepEqual(tt.attrs, original) {
+				t.Errorf("MaskAttributes() changed its input to %v", tt.attrs)
+			}
+		})
+	}
+}
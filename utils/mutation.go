@@ -0,0 +1,24 @@
+package utils
+
+import (
+	"time"
+
+	"github.com/remiges-tech/alya/wscutils"
+)
+
+// MutationResult is the data returned by mutating handlers, it records who performed the change and when
+// so clients don't have to track it separately
+type MutationResult struct {
+	Result      any    `json:"result,omitempty"`
+	PerformedBy string `json:"performedBy"`
+	PerformedAt string `json:"performedAt"`
+}
+
+// NewMutationResponse builds the success response of a mutation, stamping it with the actor and the server time (RFC3339)
+func NewMutationResponse(result any, performedBy string) *wscutils.Response {
+	return wscutils.NewSuccessResponse(MutationResult{
+		Result:      result,
+		PerformedBy: performedBy,
+		PerformedAt: time.Now().UTC().Format(time.RFC3339),
+	})
+}
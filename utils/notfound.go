@@ -0,0 +1,25 @@
+package utils
+
+import "github.com/remiges-tech/alya/wscutils"
+
+// resource types named in resource_not_found responses
+const (
+	ResourceGroup  = "group"
+	ResourceUser   = "user"
+	ResourceClient = "client"
+	ResourceRole   = "role"
+)
+
+// NotFoundDetail is the data of a resource_not_found response
+type NotFoundDetail struct {
+	ResourceType string `json:"resourceType"`
+	Identifier   string `json:"identifier"`
+}
+
+// NotFound builds the uniform response for a missing resource: data names the resource type and the identifier
+// nothing was found for, and resource_not_found is the first message. The codes the endpoint returned before,
+// e.g. not_exist, follow it as legacy messages so clients matching on them keep working
+func NotFound(resourceType, id string, legacy ...wscutils.ErrorMessage) *wscutils.Response {
+	messages := []wscutils.ErrorMessage{wscutils.BuildErrorMessage(ErrResourceNotFound, nil, resourceType, id)}
+	return wscutils.NewResponse(wscutils.ErrorStatus, NotFoundDetail{ResourceType: resourceType, Identifier: id}, append(messages, legacy...))
+}
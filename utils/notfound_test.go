@@ -0,0 +1,28 @@
+package utils
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/remiges-tech/alya/wscutils"
+)
+
+func TestNotFound(t *testing.T) {
+	field := "shortName"
+	resp := NotFound(ResourceGroup, "admins", wscutils.BuildErrorMessage(ErrNotExist, &field))
+
+	if resp.Status != wscutils.ErrorStatus {
+		t.Errorf("NotFound() status = %q, want %q", resp.Status, wscutils.ErrorStatus)
+	}
+	if want := (NotFoundDetail{ResourceType: ResourceGroup, Identifier: "admins"}); resp.Data != want {
+		t.Errorf("NotFound() data = %+v, want %+v", resp.Data, want)
+	}
+	var codes []string
+	for _, msg := range resp.Messages {
+		codes = append(codes, msg.ErrCode)
+	}
+	// resource_not_found leads, the legacy code follows for clients matching on it
+	if want := []string{ErrResourceNotFound, ErrNotExist}; !reflect.DeepEqual(codes, want) {
+		t.Errorf("NotFound() codes = %v, want %v", codes, want)
+	}
+}
@@ -0,0 +1,27 @@
+package utils
+
+import "time"
+
+// Page is the envelope returned by list endpoints, hasMore tells the client whether a further page exists,
+// partial that some of the items are missing derived fields that couldn't be fetched in time, and asOf when
+// derived fields served from a cache were computed
+type Page struct {
+	Items   any        `json:"items"`
+	Total   int        `json:"total"`
+	First   int        `json:"first"`
+	Max     int        `json:"max"`
+	HasMore bool       `json:"hasMore"`
+	Partial bool       `json:"partial,omitempty"`
+	AsOf    *time.Time `json:"asOf,omitempty"`
+}
+
+// NewPage wraps count items fetched from offset first out of total
+func NewPage(items any, count, total, first, max int) Page {
+	return Page{
+		Items:   items,
+		Total:   total,
+		First:   first,
+		Max:     max,
+		HasMore: first+count < total,
+	}
+}
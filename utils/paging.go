@@ -0,0 +1,31 @@
+package utils
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// default paging applied to list endpoints when first/max are not supplied
+const (
+	DefaultFirst = 0
+	DefaultMax   = 100
+)
+
+// GetPagingParams reads the optional first and max query params, applying the defaults when absent
+func GetPagingParams(c *gin.Context) (int, int, error) {
+	first, max := DefaultFirst, DefaultMax
+	var err error
+	if v, ok := c.GetQuery("first"); ok {
+		if first, err = strconv.Atoi(v); err != nil || first < 0 {
+			return 0, 0, fmt.Errorf("invalid first: %v", v)
+		}
+	}
+	if v, ok := c.GetQuery("max"); ok {
+		if max, err = strconv.Atoi(v); err != nil || max <= 0 {
+			return 0, 0, fmt.Errorf("invalid max: %v", v)
+		}
+	}
+	return first, max, nil
+}
@@ -0,0 +1,138 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/remiges-tech/alya/wscutils"
+)
+
+// problemContentType is the RFC7807 media type clients send in Accept to get Problem Details errors
+const problemContentType = "application/problem+json"
+
+// Problem is an RFC7807 Problem Details object. Errors carries the wscutils messages the problem was
+// built from, so that field level validation errors aren't lost
+type Problem struct {
+	Type     string                  `json:"type"`
+	Title    string                  `json:"title"`
+	Status   int                     `json:"status"`
+	Detail   string                  `json:"detail,omitempty"`
+	Instance string                  `json:"instance,omitempty"`
+	Errors   []wscutils.ErrorMessage `json:"errors,omitempty"`
+}
+
+// ProblemDetails wraps next so that error responses are rendered as RFC7807 Problem Details for clients
+// that ask for them with "Accept: application/problem+json". Every other response, and every response
+// for other clients, is passed through as written by the handlers
+func ProblemDetails(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if !acceptsProblem(req.Header.Get("Accept")) {
+			next.ServeHTTP(w, req)
+			return
+		}
+		pw := &problemWriter{ResponseWriter: w}
+		next.ServeHTTP(pw, req)
+		pw.flushAsProblem(req.URL.Path)
+	})
+}
+
+// NewProblem builds the Problem Details object for an error envelope sent with the given http status
+func NewProblem(status int, resp wscutils.Response, instance string) Problem {
+	if status < http.StatusBadRequest {
+		status = http.StatusBadRequest
+	}
+	p := Problem{
+		Type:     "about:blank",
+		Title:    http.StatusText(status),
+		Status:   status,
+		Instance: instance,
+		Errors:   resp.Messages,
+	}
+	codes := make([]string, 0, len(resp.Messages))
+	for _, m := range resp.Messages {
+		codes = append(codes, m.ErrCode)
+	}
+	if len(codes) > 0 {
+		p.Detail = strings.Join(codes, ", ")
+	}
+	// a single error gets its own type uri so clients can switch on it
+	if len(codes) == 1 && codes[0] != "" {
+		p.Type = "urn:idshield:error:" + codes[0]
+	}
+	return p
+}
+
+// acceptsProblem reports whether the Accept header lists the problem+json media type
+func acceptsProblem(accept string) bool {
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err == nil && mediaType == problemContentType {
+			return true
+		}
+	}
+	return false
+}
+
+// problemWriter passes successful responses straight through and holds back only those sent with an error
+// status, so that error envelopes can be rewritten before they are sent
+type problemWriter struct {
+	http.ResponseWriter
+	status    int
+	buffering bool
+	body      bytes.Buffer
+}
+
+func (pw *problemWriter) WriteHeader(status int) {
+	if pw.status != 0 {
+		return
+	}
+	pw.status = status
+	if status >= http.StatusBadRequest {
+		pw.buffering = true
+		return
+	}
+	pw.ResponseWriter.WriteHeader(status)
+}
+
+func (pw *problemWriter) Write(b []byte) (int, error) {
+	if pw.status == 0 {
+		pw.WriteHeader(http.StatusOK)
+	}
+	if pw.buffering {
+		return pw.body.Write(b)
+	}
+	return pw.ResponseWriter.Write(b)
+}
+
+// Flush lets streamed successful responses reach the client as they are written
+func (pw *problemWriter) Flush() {
+	if f, ok := pw.ResponseWriter.(http.Flusher); ok && !pw.buffering {
+		f.Flush()
+	}
+}
+
+// flushAsProblem sends a held back error response, converted to a Problem Details object if it is a
+// wscutils error envelope
+func (pw *problemWriter) flushAsProblem(instance string) {
+	if !pw.buffering {
+		return
+	}
+	var resp wscutils.Response
+	if strings.HasPrefix(pw.Header().Get("Content-Type"), "application/json") &&
+		json.Unmarshal(pw.body.Bytes(), &resp) == nil && resp.Status == "error" {
+		problem := NewProblem(pw.status, resp, instance)
+		if b, err := json.Marshal(problem); err == nil {
+			pw.Header().Set("Content-Type", problemContentType)
+			pw.Header().Set("Content-Length", strconv.Itoa(len(b)))
+			pw.ResponseWriter.WriteHeader(problem.Status)
+			pw.ResponseWriter.Write(b)
+			return
+		}
+	}
+	pw.ResponseWriter.WriteHeader(pw.status)
+	pw.ResponseWriter.Write(pw.body.Bytes())
+}
@@ -0,0 +1,93 @@
+package utils
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/remiges-tech/alya/wscutils"
+)
+
+func TestAcceptsProblem(t *testing.T) {
+	tests := []struct {
+		accept string
+		want   bool
+	}{
+		{"", false},
+		{"application/json", false},
+		{"application/problem+json", true},
+		{"application/json, application/problem+json;q=0.9", true},
+		{"*/*", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.accept, func(t *testing.T) {
+			if got := acceptsProblem(tt.accept); got != tt.want {
+				t.Errorf("acceptsProblem(%q) = %v, want %v", tt.accept, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProblemDetailsValidationError(t *testing.T) {
+	r := gin.New()
+	r.POST("/groupnew", func(c *gin.Context) {
+		field := "shortName"
+		wscutils.SendErrorResponse(c, wscutils.NewResponse(wscutils.ErrorStatus, nil, []wscutils.ErrorMessage{wscutils.BuildErrorMessage(wscutils.ErrcodeMissing, &field)}))
+	})
+	handler := ProblemDetails(r)
+
+	tests := []struct {
+		accept      string
+		wantType    string
+		wantProblem bool
+	}{
+		{"application/json", "application/json; charset=utf-8", false},
+		{"application/problem+json", problemContentType, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.accept, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/groupnew", nil)
+			req.Header.Set("Accept", tt.accept)
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+			if w.Code != http.StatusBadRequest || w.Header().Get("Content-Type") != tt.wantType {
+				t.Fatalf("ProblemDetails() = %d %s, want 400 %s", w.Code, w.Header().Get("Content-Type"), tt.wantType)
+			}
+			if !tt.wantProblem {
+				return
+			}
+			var problem Problem
+			if err := json.Unmarshal(w.Body.Bytes(), &problem); err != nil {
+				t.Fatalf("can't decode %s: %v", w.Body, err)
+			}
+			want := Problem{Type: "urn:idshield:error:" + wscutils.ErrcodeMissing, Title: "Bad Request", Status: http.StatusBadRequest,
+				Detail: wscutils.ErrcodeMissing, Instance: "/groupnew"}
+			if problem.Type != want.Type || problem.Title != want.Title || problem.Status != want.Status ||
+				problem.Detail != want.Detail || problem.Instance != want.Instance ||
+				len(problem.Errors) != 1 || *problem.Errors[0].Field != "shortName" {
+				t.Errorf("ProblemDetails() = %+v, want %+v with the shortName field error", problem, want)
+			}
+		})
+	}
+}
+
+func TestProblemDetailsPassesSuccessThrough(t *testing.T) {
+	w := httptest.NewRecorder()
+	r := gin.New()
+	r.GET("/groupget", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"status": "success"})
+		// a successful response reaches the client as it is written instead of when the handler returns
+		if w.Code != http.StatusOK || w.Body.Len() == 0 {
+			t.Errorf("successful response held back: %d %q", w.Code, w.Body)
+		}
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/groupget", nil)
+	req.Header.Set("Accept", problemContentType)
+	ProblemDetails(r).ServeHTTP(w, req)
+	if w.Code != http.StatusOK || w.Body.String() != `{"status":"success"}` {
+		t.Errorf("ProblemDetails() = %d %s, want the handler's response", w.Code, w.Body)
+	}
+}
@@ -0,0 +1,37 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+
+	"github.com/go-resty/resty/v2"
+)
+
+// ErrHTTPTooManyRequests is the status line Keycloak answers with when it is shedding admin load
+const ErrHTTPTooManyRequests = "429 Too Many Requests"
+
+// retryAfterPattern extracts the Retry-After value CaptureRetryAfter carries in the error message
+var retryAfterPattern = regexp.MustCompile(`\(Retry-After: ([^)]+)\)`)
+
+// CaptureRetryAfter is a resty response hook that turns a 429 from Keycloak into an error carrying its
+// Retry-After header. gocloak only keeps the status line of a failed response, so without the hook the
+// header would be lost before GocloakErrorHandler sees the error
+func CaptureRetryAfter(_ *resty.Client, resp *resty.Response) error {
+	if resp.StatusCode() != http.StatusTooManyRequests {
+		return nil
+	}
+	if retryAfter := resp.Header().Get("Retry-After"); retryAfter != "" {
+		return fmt.Errorf("%s (Retry-After: %s)", ErrHTTPTooManyRequests, retryAfter)
+	}
+	return errors.New(ErrHTTPTooManyRequests)
+}
+
+// retryAfterFromError returns the Retry-After value captured in a rate limit error, or "" if Keycloak sent none
+func retryAfterFromError(err error) string {
+	if m := retryAfterPattern.FindStringSubmatch(err.Error()); m != nil {
+		return m[1]
+	}
+	return ""
+}
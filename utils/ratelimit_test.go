@@ -0,0 +1,53 @@
+package utils
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/Nerzal/gocloak/v13"
+	"github.com/remiges-tech/alya/wscutils"
+	"github.com/remiges-tech/idshield/internal/keycloaktest"
+)
+
+func TestGocloakErrorHandlerRateLimited(t *testing.T) {
+	tests := []struct {
+		name       string
+		retryAfter string
+		wantVals   []string
+	}{
+		{"with Retry-After", "30", []string{"30"}},
+		{"without Retry-After", "", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kc := keycloaktest.NewServer(t)
+			kc.Handle(http.MethodGet, "/admin/realms/acme/groups", func(w http.ResponseWriter, r *http.Request) {
+				if tt.retryAfter != "" {
+					w.Header().Set("Retry-After", tt.retryAfter)
+				}
+				keycloaktest.Error(w, http.StatusTooManyRequests, "Too many requests")
+			})
+			client := kc.Client()
+			client.RestyClient().OnAfterResponse(CaptureRetryAfter)
+			s, _ := keycloaktest.NewService()
+			s.WithDependency("gocloak", client)
+			handler := Handler("Thing_list", nil, func(ctx HandlerContext) {
+				if _, err := ctx.Client.GetGroups(ctx.Gin, ctx.Token, ctx.Realm, gocloak.GetGroupsParams{}); err != nil {
+					GocloakErrorHandler(ctx.Gin, ctx.Logger, err)
+					return
+				}
+				wscutils.SendSuccessResponse(ctx.Gin, wscutils.NewSuccessResponse(nil))
+			})
+
+			w := keycloaktest.Do(s, handler, keycloaktest.NewRequest(http.MethodGet, "/thinglist", keycloaktest.Token("acme", "alice"), nil))
+			resp := keycloaktest.Decode(t, w, nil)
+			if w.Code != http.StatusBadRequest || !reflect.DeepEqual(resp.ErrCodes(), []string{ErrDownstreamRateLimited}) {
+				t.Fatalf("Thing_list() = %d %s, want 400 %s", w.Code, w.Body, ErrDownstreamRateLimited)
+			}
+			if !reflect.DeepEqual(resp.Messages[0].Vals, tt.wantVals) || w.Header().Get("Retry-After") != tt.retryAfter {
+				t.Errorf("vals %v and Retry-After %q, want %v and %q", resp.Messages[0].Vals, w.Header().Get("Retry-After"), tt.wantVals, tt.retryAfter)
+			}
+		})
+	}
+}
@@ -0,0 +1,80 @@
+package utils
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/Nerzal/gocloak/v13"
+	"github.com/gin-gonic/gin"
+	"github.com/remiges-tech/alya/router"
+	"github.com/remiges-tech/alya/service"
+	"github.com/remiges-tech/alya/wscutils"
+)
+
+// canonicalRealms caches the canonical realm name for each lowercased realm name
+var canonicalRealms sync.Map
+
+// CanonicalRealm maps the realm parsed from a token to the realm's name as stored in Keycloak when realm
+// normalization is enabled ("normalizeRealm" dependency), otherwise it returns realm unchanged.
+// Keycloak realm names are case-sensitive, so two realms differing only in case would be conflated by this
+// lookup; it is off by default and should only be enabled where realm names are unique regardless of case.
+// If the realms can't be listed with the caller's token, realm is returned unchanged
+func CanonicalRealm(c *gin.Context, s *service.Service, token, realm string) string {
+	if enabled, _ := s.Dependencies["normalizeRealm"].(bool); !enabled {
+		return realm
+	}
+	key := strings.ToLower(realm)
+	if canonical, ok := canonicalRealms.Load(key); ok {
+		return canonical.(string)
+	}
+	gcClient, ok := s.Dependencies["gocloak"].(*gocloak.GoCloak)
+	if !ok {
+		return realm
+	}
+	realms, err := gcClient.GetRealms(c, token)
+	if err != nil {
+		return realm
+	}
+	for _, r := range realms {
+		if r.Realm != nil && strings.EqualFold(*r.Realm, realm) {
+			canonicalRealms.Store(key, *r.Realm)
+			return *r.Realm
+		}
+	}
+	return realm
+}
+
+// RealmAllowlist returns a middleware that rejects requests whose token was issued by a realm not in allowed
+// with realm_not_permitted, so that in a shared Keycloak idshield only manages the realms it is meant to.
+// With an empty list every realm is served. Requests without a usable token are passed on, the handlers
+// report those themselves
+func RealmAllowlist(allowed []string) gin.HandlerFunc {
+	permitted := make(map[string]bool, len(allowed))
+	for _, realm := range allowed {
+		permitted[realm] = true
+	}
+	return func(c *gin.Context) {
+		if len(permitted) == 0 {
+			c.Next()
+			return
+		}
+		token, err := router.ExtractToken(c.GetHeader("Authorization"))
+		if err != nil {
+			c.Next()
+			return
+		}
+		iss, err := ExtractClaimFromJwt(token, "iss")
+		if err != nil {
+			c.Next()
+			return
+		}
+		parts := strings.Split(iss, "/realms/")
+		if len(parts) < 2 || !permitted[parts[len(parts)-1]] {
+			field := "realm"
+			wscutils.SendErrorResponse(c, wscutils.NewResponse(wscutils.ErrorStatus, nil, []wscutils.ErrorMessage{wscutils.BuildErrorMessage(ErrRealmNotPermitted, &field)}))
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,73 @@
+package utils
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/remiges-tech/alya/service"
+	"github.com/remiges-tech/idshield/internal/keycloaktest"
+)
+
+func TestCanonicalRealm(t *testing.T) {
+	kc := keycloaktest.NewServer(t)
+	kc.Realm("Globex")
+	kc.Realm("initech")
+	token := keycloaktest.Token("globex", "alice")
+
+	tests := []struct {
+		name    string
+		enabled bool
+		realm   string
+		want    string
+	}{
+		{"disabled", false, "globex", "globex"},
+		{"mismatched casing", true, "GLOBEX", "Globex"},
+		{"cached", true, "globex", "Globex"},
+		{"same casing", true, "initech", "initech"},
+		{"unknown realm", true, "umbrella", "umbrella"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &service.Service{Dependencies: service.Dependencies{"gocloak": kc.Client(), "normalizeRealm": tt.enabled}}
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			if got := CanonicalRealm(c, s, token, tt.realm); got != tt.want {
+				t.Errorf("CanonicalRealm(%q) = %q, want %q", tt.realm, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRealmAllowlist(t *testing.T) {
+	tests := []struct {
+		name     string
+		allowed  []string
+		token    string
+		wantCode int
+	}{
+		{"allowed realm", []string{"acme", "globex"}, keycloaktest.Token("globex", "alice"), http.StatusOK},
+		{"disallowed realm", []string{"acme"}, keycloaktest.Token("globex", "alice"), http.StatusBadRequest},
+		{"empty allowlist", nil, keycloaktest.Token("globex", "alice"), http.StatusOK},
+		// the handler reports a missing token itself
+		{"no token", []string{"acme"}, "", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := gin.New()
+			r.Use(RealmAllowlist(tt.allowed))
+			r.GET("/grouplist", func(c *gin.Context) { c.Status(http.StatusOK) })
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, keycloaktest.NewRequest(http.MethodGet, "/grouplist", tt.token, nil))
+			if w.Code != tt.wantCode {
+				t.Fatalf("RealmAllowlist(%v) = %d %s, want %d", tt.allowed, w.Code, w.Body, tt.wantCode)
+			}
+			if tt.wantCode == http.StatusBadRequest {
+				if got := keycloaktest.Decode(t, w, nil).ErrCodes(); !reflect.DeepEqual(got, []string{ErrRealmNotPermitted}) {
+					t.Errorf("RealmAllowlist() error codes = %v, want %s", got, ErrRealmNotPermitted)
+				}
+			}
+		})
+	}
+}
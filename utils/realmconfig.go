@@ -0,0 +1,126 @@
+package utils
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Nerzal/gocloak/v13"
+	"github.com/gin-gonic/gin"
+	"github.com/remiges-tech/alya/service"
+)
+
+// realm attributes read by GetRealmConfig, set them on a realm to override the global config for it
+const (
+	RealmAttrMaxPageSize   = "idshield.maxPageSize"   // integer
+	RealmAttrReservedAttrs = "idshield.reservedAttrs" // comma separated attribute keys
+	RealmAttrDefaultAttrs  = "idshield.defaultAttrs"  // JSON object of attribute key to value
+)
+
+// DefaultRealmConfigTTL is how long a realm's overrides are cached when no ttl is configured
+const DefaultRealmConfigTTL = 60 * time.Second
+
+// RealmConfig holds the behaviour of the group handlers that can vary per realm. The global config comes from
+// the "realmConfig" dependency; a realm's own attributes are merged over it by GetRealmConfig
+type RealmConfig struct {
+	// MaxPageSize caps the max paging param, 0 leaves it uncapped
+	MaxPageSize int
+	// ReservedAttrs are attribute keys that can't be changed through the attribute endpoints,
+	// on top of the keys idshield itself manages
+	ReservedAttrs []string
+	// DefaultAttrs are set on new groups that don't set the key themselves
+	DefaultAttrs map[string]string
+}
+
+// CapMax limits max to the configured page size cap
+func (rc RealmConfig) CapMax(max int) int {
+	if rc.MaxPageSize > 0 && max > rc.MaxPageSize {
+		return rc.MaxPageSize
+	}
+	return max
+}
+
+// realmAttrsEntry caches a realm's attributes; only the realm's own settings are cached so the global config
+// is always the one of the calling service
+type realmAttrsEntry struct {
+	attrs   map[string]string
+	expires time.Time
+}
+
+var (
+	realmAttrsMu    sync.Mutex
+	realmAttrsCache = map[string]realmAttrsEntry{}
+)
+
+// GetRealmConfig returns the global config with the realm's overrides merged over it. Overrides are read from
+// the realm's attributes and cached for the "realmConfigTTL" dependency (DefaultRealmConfigTTL when unset).
+// If the realm can't be read with the caller's token, or an override can't be parsed, the global value is used
+func GetRealmConfig(c *gin.Context, s *service.Service, token, realm string) RealmConfig {
+	global, _ := s.Dependencies["realmConfig"].(RealmConfig)
+	ttl, ok := s.Dependencies["realmConfigTTL"].(time.Duration)
+	if !ok || ttl <= 0 {
+		ttl = DefaultRealmConfigTTL
+	}
+
+	realmAttrsMu.Lock()
+	entry, ok := realmAttrsCache[realm]
+	realmAttrsMu.Unlock()
+	if ok && time.Now().Before(entry.expires) {
+		return mergeRealmConfig(global, entry.attrs)
+	}
+
+	gcClient, ok := s.Dependencies["gocloak"].(*gocloak.GoCloak)
+	if !ok {
+		return global
+	}
+	realmRep, err := gcClient.GetRealm(c, token, realm)
+	if err != nil {
+		return global
+	}
+	attrs := map[string]string{}
+	if realmRep.Attributes != nil {
+		attrs = *realmRep.Attributes
+	}
+
+	realmAttrsMu.Lock()
+	realmAttrsCache[realm] = realmAttrsEntry{attrs: attrs, expires: time.Now().Add(ttl)}
+	realmAttrsMu.Unlock()
+	return mergeRealmConfig(global, attrs)
+}
+
+// mergeRealmConfig overrides global with the idshield settings found in the realm attributes. The page size cap
+// is replaced, reserved keys are added to the global ones and default attributes are merged key by key
+func mergeRealmConfig(global RealmConfig, attrs map[string]string) RealmConfig {
+	config := RealmConfig{
+		MaxPageSize:   global.MaxPageSize,
+		ReservedAttrs: append([]string{}, global.ReservedAttrs...),
+		DefaultAttrs:  map[string]string{},
+	}
+	for key, value := range global.DefaultAttrs {
+		config.DefaultAttrs[key] = value
+	}
+
+	if v, ok := attrs[RealmAttrMaxPageSize]; ok {
+		if size, err := strconv.Atoi(strings.TrimSpace(v)); err == nil && size >= 0 {
+			config.MaxPageSize = size
+		}
+	}
+	if v, ok := attrs[RealmAttrReservedAttrs]; ok {
+		for _, key := range strings.Split(v, ",") {
+			if key = strings.TrimSpace(key); key != "" {
+				config.ReservedAttrs = append(config.ReservedAttrs, key)
+			}
+		}
+	}
+	if v, ok := attrs[RealmAttrDefaultAttrs]; ok {
+		var defaults map[string]string
+		if err := json.Unmarshal([]byte(v), &defaults); err == nil {
+			for key, value := range defaults {
+				config.DefaultAttrs[key] = value
+			}
+		}
+	}
+	return config
+}
@@ -0,0 +1,34 @@
+package utils
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMergeRealmConfig(t *testing.T) {
+	global := RealmConfig{MaxPageSize: 100, ReservedAttrs: []string{"owner"}, DefaultAttrs: map[string]string{"source": "idshield", "tier": "standard"}}
+
+	got := mergeRealmConfig(global, map[string]string{
+		RealmAttrMaxPageSize:   " 25 ",
+		RealmAttrReservedAttrs: "costCenter, ,region",
+		RealmAttrDefaultAttrs:  `{"tier": "gold"}`,
+		"displayName":          "ignored",
+	})
+	want := RealmConfig{
+		MaxPageSize:   25,
+		ReservedAttrs: []string{"owner", "costCenter", "region"},
+		DefaultAttrs:  map[string]string{"source": "idshield", "tier": "gold"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("mergeRealmConfig() = %+v, want %+v", got, want)
+	}
+	if !reflect.DeepEqual(global.ReservedAttrs, []string{"owner"}) || global.DefaultAttrs["tier"] != "standard" {
+		t.Errorf("global config was changed to %+v", global)
+	}
+
+	// overrides that don't parse keep the global values
+	got = mergeRealmConfig(global, map[string]string{RealmAttrMaxPageSize: "lots", RealmAttrDefaultAttrs: "tier=gold"})
+	if got.MaxPageSize != 100 || !reflect.DeepEqual(got.DefaultAttrs, global.DefaultAttrs) {
+		t.Errorf("mergeRealmConfig(invalid) = %+v, want the global values", got)
+	}
+}
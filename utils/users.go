@@ -0,0 +1,82 @@
+package utils
+
+import (
+	"context"
+	"strings"
+
+	"github.com/Nerzal/gocloak/v13"
+)
+
+// userPageSize is the page size used when listing the realm's users page by page
+const userPageSize = 100
+
+// ResolveUserIDs maps each of the usernames to its user id, returning the usernames no user carries as
+// unresolved. Keycloak stores usernames in lower case, so the match ignores case. Like ResolveGroupIDs it takes
+// whichever is fewer round trips: one exact search per username, or paging through the realm's users until
+// every username has been seen
+func ResolveUserIDs(ctx context.Context, client *gocloak.GoCloak, token, realm string, usernames []string) (map[string]string, []string, error) {
+	ids := make(map[string]string)
+	wanted := make(map[string]bool)
+	for _, username := range usernames {
+		wanted[strings.ToLower(username)] = true
+	}
+	if len(wanted) == 0 {
+		return ids, []string{}, nil
+	}
+
+	searchByName := len(wanted) == 1
+	if !searchByName {
+		count, err := client.GetUserCount(ctx, token, realm, gocloak.GetUsersParams{})
+		if err != nil {
+			return nil, nil, err
+		}
+		searchByName = (count+userPageSize-1)/userPageSize >= len(wanted)
+	}
+
+	if searchByName {
+		for username := range wanted {
+			users, err := client.GetUsers(ctx, token, realm, gocloak.GetUsersParams{
+				Username: gocloak.StringP(username),
+				Exact:    gocloak.BoolP(true),
+			})
+			if err != nil {
+				return nil, nil, err
+			}
+			if len(users) > 0 && users[0].ID != nil {
+				ids[username] = *users[0].ID
+			}
+		}
+	} else {
+		for first := 0; len(ids) < len(wanted); first += userPageSize {
+			users, err := client.GetUsers(ctx, token, realm, gocloak.GetUsersParams{
+				First:               gocloak.IntP(first),
+				Max:                 gocloak.IntP(userPageSize),
+				BriefRepresentation: gocloak.BoolP(true),
+			})
+			if err != nil {
+				return nil, nil, err
+			}
+			for _, user := range users {
+				if user.Username != nil && user.ID != nil && wanted[strings.ToLower(*user.Username)] {
+					ids[strings.ToLower(*user.Username)] = *user.ID
+				}
+			}
+			if len(users) < userPageSize {
+				break
+			}
+		}
+	}
+
+	// the ids are keyed by the usernames as they were asked for, unresolved ones are reported in that order
+	resolved := make(map[string]string)
+	unresolved := []string{}
+	for _, username := range usernames {
+		if id, ok := ids[strings.ToLower(username)]; ok {
+			resolved[username] = id
+		} else if wanted[strings.ToLower(username)] {
+			unresolved = append(unresolved, username)
+			wanted[strings.ToLower(username)] = false
+		}
+	}
+	return resolved, unresolved, nil
+}
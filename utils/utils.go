@@ -1,8 +1,13 @@
 package utils
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
@@ -35,14 +40,43 @@ const (
 	ErrHTTPSameEmail         = "409 Conflict: User exists with same email"
 	ErrHTTPGroupNotFound     = "400 Bad Request: Group name is missing"
 	ErrHTTPUserNotFoundInReq = "400 Bad Request: User name is missing"
+	ErrHTTPConflict          = "409 Conflict"
 
 	ErrFailedToLoadDependence = "Failed_to_load_dependence"
 	ErrIDandUserNameMissing   = "id_and_username_both_are_missing"
 	ERRTokenExpired           = "token_expired"
 	ErrUserNotFound           = "user_not_found"
-	ErrUserNotAuthorized      = "user_not_authorized_to_perform_this_action"
+	ErrUserNotAuthorized      = "User_not_authorized_to_perform_this_action"
 	ErrInvalidParam           = "invalid_param"
 	ErrEitherIDOrUsernameIsSetButNotBoth = "either_ID_or_Username_is_set_but_not_both"
+
+	ErrInvalidTokenPayload     = "invalid_token_payload"
+	ErrAttributesTooLarge      = "attributes_too_large"
+	ErrGroupNotEmpty           = "group_not_empty"
+	ErrReservedAttribute       = "reserved_attribute"
+	ErrMissingLookup           = "missing_lookup"
+	ErrAmbiguousLookup         = "ambiguous_lookup"
+	ErrRequestTooLarge         = "request_too_large"
+	ErrInvalidAttrKey          = "invalid_attr_key"
+	ErrGroupCreateRolledBack   = "group_create_rolled_back"
+	ErrUnknownField            = "unknown_field"
+	ErrAlreadyBootstrapped     = "already_bootstrapped"
+	ErrGroupNotFoundCode       = "group_not_found"
+	ErrEventsNotEnabled        = "events_not_enabled"
+	ErrUnsupportedMediaType    = "unsupported_media_type"
+	ErrRealmNotPermitted       = "realm_not_permitted"
+	ErrLongNameNotUnique       = "longname_not_unique"
+	ErrInvalidAttrValue        = "invalid_attr_value"
+	ErrDownstreamRateLimited   = "downstream_rate_limited"
+	ErrInvalidMoveSelf         = "invalid_move_self"
+	ErrInvalidMoveDescendant   = "invalid_move_descendant"
+	ErrMaxNestingDepthExceeded = "max_nesting_depth_exceeded"
+	ErrConcurrentUpdate        = "concurrent_update"
+	ErrResourceNotFound        = "resource_not_found"
+	ErrGroupProtected          = "group_protected"
+	ErrDuplicateAttrKey        = "duplicate_attribute_key"
+	ErrRefreshThrottled        = "count_refresh_throttled"
+	ErrInvalidHierarchyCycle   = "invalid_hierarchy_cycle"
 )
 
 // ExtractClaimFromJwt: this will extract the provided singleClaimName as key from the jwt token and return its value as a string
@@ -53,7 +87,8 @@ func ExtractClaimFromJwt(tokenString string, singleClaimName string) (string, er
 		return "", fmt.Errorf("invalid token payload")
 	}
 
-	if claims, ok := token.Claims.(jwt.MapClaims); ok {
+	// a missing claim is reported as such rather than as the string "<nil>"
+	if claims, ok := token.Claims.(jwt.MapClaims); ok && claims[singleClaimName] != nil {
 		name = fmt.Sprint(claims[singleClaimName])
 	}
 
@@ -64,9 +99,9 @@ func ExtractClaimFromJwt(tokenString string, singleClaimName string) (string, er
 	return name, nil
 }
 
+// Authz_check asks the installed Authorizer whether op.User holds the capabilities op needs
 func Authz_check(op types.OpReq, trace bool) (bool, []string) {
-	var caplist []string
-	return true, caplist
+	return currentAuthorizer().Check(op, trace)
 }
 
 // UnixMilliToTimestamp: will return the unixmilli time (int64) to time.Time using time package
@@ -103,6 +138,15 @@ func GocloakErrorHandler(c *gin.Context, l *logharbour.Logger, err error) {
 		l.Debug0().LogDebug("user name not found: ", logharbour.DebugInfo{Variables: map[string]interface{}{"error": err}})
 		str := "username"
 		wscutils.SendErrorResponse(c, wscutils.NewResponse("error", nil, []wscutils.ErrorMessage{wscutils.BuildErrorMessage(ErrNotExist, &str)}))
+	case strings.Contains(err.Error(), ErrHTTPTooManyRequests):
+		// the Retry-After value is passed on so clients back off for as long as Keycloak asked
+		l.Debug0().LogDebug("Rate limited by keycloak: ", logharbour.DebugInfo{Variables: map[string]interface{}{"error": err}})
+		var vals []string
+		if retryAfter := retryAfterFromError(err); retryAfter != "" {
+			c.Header("Retry-After", retryAfter)
+			vals = append(vals, retryAfter)
+		}
+		wscutils.SendErrorResponse(c, wscutils.NewResponse("error", nil, []wscutils.ErrorMessage{wscutils.BuildErrorMessage(ErrDownstreamRateLimited, nil, vals...)}))
 	default:
 		l.Debug0().LogDebug("Unknown error occurred: ", logharbour.DebugInfo{Variables: map[string]interface{}{"error": err}})
 		wscutils.SendErrorResponse(c, wscutils.NewErrorResponse(wscutils.ErrcodeUnknown))
@@ -187,3 +231,69 @@ func RemoveQualifiedCapability(caps types.Capabilities, idToRemove string) (stri
 	result := fmt.Sprintf("{\"name\":\"%s\",\"qualifiedcaps\":[%s]}", caps.Name, strings.Join(qualifiedCapsStrings, ""))
 	return result, nil
 }
+
+// ExtractExpiryFromJwt returns the expiry time carried in the exp claim of the jwt token
+func ExtractExpiryFromJwt(tokenString string) (time.Time, error) {
+	token, _, err := new(jwt.Parser).ParseUnverified(tokenString, jwt.MapClaims{})
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid token payload")
+	}
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return time.Time{}, fmt.Errorf("invalid token payload")
+	}
+	exp, ok := claims["exp"].(float64)
+	if !ok {
+		return time.Time{}, fmt.Errorf("invalid token payload")
+	}
+	return time.Unix(int64(exp), 0), nil
+}
+
+// LimitRequestBody reads the request body up to limit bytes and restores it for binding.
+// When the body is larger it sends a request_too_large error and returns false.
+func LimitRequestBody(c *gin.Context, limit int64) bool {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, limit)
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			field := "body"
+			wscutils.SendErrorResponse(c, wscutils.NewResponse(wscutils.ErrorStatus, nil, []wscutils.ErrorMessage{wscutils.BuildErrorMessage(ErrRequestTooLarge, &field, strconv.FormatInt(limit, 10))}))
+			return false
+		}
+		wscutils.SendErrorResponse(c, wscutils.NewErrorResponse(ErrInvalidJSON))
+		return false
+	}
+	c.Request.Body = io.NopCloser(bytes.NewReader(body))
+	return true
+}
+
+// RequireJSON checks that the request declares a JSON body, so that form or text bodies get
+// unsupported_media_type instead of a confusing unmarshal error. On failure the error response has already been sent
+func RequireJSON(c *gin.Context) bool {
+	if c.ContentType() == gin.MIMEJSON {
+		return true
+	}
+	field := "Content-Type"
+	wscutils.SendErrorResponse(c, wscutils.NewResponse(wscutils.ErrorStatus, nil, []wscutils.ErrorMessage{wscutils.BuildErrorMessage(ErrUnsupportedMediaType, &field, gin.MIMEJSON)}))
+	return false
+}
+
+// BindJSONStrict decodes the data of the request envelope into data like wscutils.BindJSON but rejects fields
+// the struct doesn't declare, so a misspelt key is reported with unknown_field instead of being silently dropped.
+// On failure the error response has already been sent
+func BindJSONStrict(c *gin.Context, data any) error {
+	decoder := json.NewDecoder(c.Request.Body)
+	decoder.DisallowUnknownFields()
+	err := decoder.Decode(&wscutils.Request{Data: data})
+	if err == nil {
+		return nil
+	}
+	if field, ok := strings.CutPrefix(err.Error(), "json: unknown field "); ok {
+		field = strings.Trim(field, `"`)
+		wscutils.SendErrorResponse(c, wscutils.NewResponse(wscutils.ErrorStatus, nil, []wscutils.ErrorMessage{wscutils.BuildErrorMessage(ErrUnknownField, &field)}))
+		return err
+	}
+	wscutils.SendErrorResponse(c, wscutils.NewErrorResponse(ErrInvalidJSON))
+	return err
+}
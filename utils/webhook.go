@@ -0,0 +1,80 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/remiges-tech/logharbour/logharbour"
+)
+
+// Event types emitted after successful group mutations
+const (
+	EventGroupCreated = "group.created"
+	EventGroupUpdated = "group.updated"
+	EventGroupDeleted = "group.deleted"
+)
+
+// GroupEvent is the payload posted to the configured webhook
+type GroupEvent struct {
+	Type      string    `json:"type"`
+	Realm     string    `json:"realm"`
+	GroupID   string    `json:"groupId"`
+	Actor     string    `json:"actor"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// Webhook posts group events to an external system
+type Webhook struct {
+	URL        string
+	MaxRetries int
+	Client     *http.Client
+}
+
+// NewWebhook returns a Webhook posting to url, retrying a failed delivery up to maxRetries times
+func NewWebhook(url string, maxRetries int) *Webhook {
+	return &Webhook{
+		URL:        url,
+		MaxRetries: maxRetries,
+		Client:     &http.Client{Timeout: 5 * time.Second},
+	}
+}
+
+// Emit delivers the event asynchronously so the caller's response is never blocked or failed by it,
+// delivery failures are only logged
+func (w *Webhook) Emit(l *logharbour.Logger, event GroupEvent) {
+	go func() {
+		if err := w.deliver(event); err != nil {
+			l.LogActivity("Failed to deliver group event:", logharbour.DebugInfo{Variables: map[string]any{"event": event, "error": err.Error()}})
+		}
+	}()
+}
+
+// deliver posts the event, backing off linearly between attempts
+func (w *Webhook) deliver(event GroupEvent) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	for attempt := 0; ; attempt++ {
+		err = w.post(body)
+		if err == nil || attempt >= w.MaxRetries {
+			return err
+		}
+		time.Sleep(time.Duration(attempt+1) * time.Second)
+	}
+}
+
+func (w *Webhook) post(body []byte) error {
+	resp, err := w.Client.Post(w.URL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= http.StatusMultipleChoices {
+		return fmt.Errorf("webhook responded with status %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,147 @@
+package authzsvc
+
+import (
+	"sort"
+	"time"
+
+	"github.com/Nerzal/gocloak/v13"
+	"github.com/gin-gonic/gin"
+	"github.com/remiges-tech/alya/router"
+	"github.com/remiges-tech/alya/service"
+	"github.com/remiges-tech/alya/wscutils"
+	"github.com/remiges-tech/idshield/types"
+	"github.com/remiges-tech/idshield/utils"
+	"github.com/remiges-tech/logharbour/logharbour"
+)
+
+type capabilityResponse struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+type whoamiResponse struct {
+	Username     string    `json:"username"`
+	Realm        string    `json:"realm"`
+	Capabilities []string  `json:"capabilities"`
+	TokenExpiry  time.Time `json:"tokenExpiry"`
+}
+
+// Authz_whoami handles the GET /authzwhoami request, it returns the caller along with the capabilities the
+// authorizer grants them
+func Authz_whoami(c *gin.Context, s *service.Service) {
+	utils.Handler("Authz_whoami", nil, authzWhoami)(c, s)
+}
+
+// authzWhoami is the business logic of Authz_whoami, utils.Handler has done the token and realm checks
+func authzWhoami(ctx utils.HandlerContext) {
+	c, l := ctx.Gin, ctx.Logger
+
+	expiry, err := utils.ExtractExpiryFromJwt(ctx.Token)
+	if err != nil {
+		l.Debug0().LogDebug("Missing token expiry:", logharbour.DebugInfo{Variables: map[string]any{"error": err}})
+		wscutils.SendErrorResponse(c, wscutils.NewErrorResponse(utils.ErrInvalidTokenPayload))
+		return
+	}
+
+	wscutils.SendSuccessResponse(c, wscutils.NewSuccessResponse(whoamiResponse{
+		Username:     ctx.Username,
+		Realm:        ctx.Realm,
+		Capabilities: authorizedCapabilities(ctx.Username),
+		TokenExpiry:  expiry,
+	}))
+}
+
+// Authz_userCapabilities handles the GET /authzusercapabilities request, it returns the capabilities the
+// authorizer grants another user, so admins can debug that user's access
+func Authz_userCapabilities(c *gin.Context, s *service.Service) {
+	utils.Handler("Authz_userCapabilities", []string{utils.CapAuthzRead}, authzUserCapabilities)(c, s)
+}
+
+// authzUserCapabilities is the business logic of Authz_userCapabilities, utils.Handler has done the token, realm
+// and authz checks
+func authzUserCapabilities(ctx utils.HandlerContext) {
+	c, l := ctx.Gin, ctx.Logger
+
+	target := c.Query("username")
+	if target == "" {
+		l.Log("username missing")
+		wscutils.SendErrorResponse(c, wscutils.NewResponse(wscutils.ErrorStatus, nil, []wscutils.ErrorMessage{wscutils.BuildErrorMessage(wscutils.ErrcodeMissing, nil, "username")}))
+		return
+	}
+
+	users, err := ctx.Client.GetUsers(c, ctx.Token, ctx.Realm, gocloak.GetUsersParams{
+		Username: &target,
+		Exact:    gocloak.BoolP(true),
+	})
+	if err != nil {
+		utils.GocloakErrorHandler(c, l, err)
+		return
+	}
+	if len(users) == 0 {
+		l.Log("Error while gcClient.GetUsers user doesn't exist ")
+		str := "username"
+		wscutils.SendErrorResponse(c, wscutils.NewResponse("error", nil, []wscutils.ErrorMessage{wscutils.BuildErrorMessage(utils.ErrNotExist, &str)}))
+		return
+	}
+
+	capabilities := authorizedCapabilities(target)
+	l.LogActivity("User capabilities read:", map[string]any{"user": target, "by": ctx.Username})
+
+	wscutils.SendSuccessResponse(c, wscutils.NewSuccessResponse(map[string]any{"username": target, "capabilities": capabilities}))
+}
+
+// Authz_listCapabilities handles the GET /authzcapabilities request, it returns every capability idshield recognises
+func Authz_listCapabilities(c *gin.Context, s *service.Service) {
+	l := s.LogHarbour
+	l.Log("Starting execution of Authz_listCapabilities()")
+	token, err := router.ExtractToken(c.GetHeader("Authorization"))
+	if err != nil {
+		l.Debug0().LogDebug("Missing or incorrect Authorization header format:", logharbour.DebugInfo{Variables: map[string]any{"error": err}})
+		wscutils.SendErrorResponse(c, wscutils.NewErrorResponse(utils.ErrTokenMissing))
+		return
+	}
+	username, err := utils.ExtractClaimFromJwt(token, "preferred_username")
+	if err != nil {
+		l.Debug0().LogDebug("Missing username:", logharbour.DebugInfo{Variables: map[string]any{"error": err}})
+		wscutils.SendErrorResponse(c, wscutils.NewErrorResponse(utils.ErrUserNotFound))
+		return
+	}
+
+	isCapable, _ := utils.Authz_check(types.OpReq{
+		User:      username,
+		CapNeeded: []string{utils.CapAuthzAdmin},
+	}, false)
+
+	if !isCapable {
+		l.Log("Unauthorized user:")
+		wscutils.SendErrorResponse(c, wscutils.NewErrorResponse(utils.ErrUnauthorized))
+		return
+	}
+
+	capabilities := []capabilityResponse{}
+	for name, description := range utils.CapabilityRegistry {
+		capabilities = append(capabilities, capabilityResponse{Name: name, Description: description})
+	}
+	sort.Slice(capabilities, func(i, j int) bool { return capabilities[i].Name < capabilities[j].Name })
+
+	wscutils.SendSuccessResponse(c, wscutils.NewSuccessResponse(capabilities))
+
+	l.Log("Finished execution of Authz_listCapabilities()")
+}
+
+// authorizedCapabilities returns, sorted, the registered capabilities the authorizer grants to user. Each one is
+// checked on its own, so the list is whatever Authz_check allows rather than what is stored for the user
+func authorizedCapabilities(user string) []string {
+	names := make([]string, 0, len(utils.CapabilityRegistry))
+	for name := range utils.CapabilityRegistry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	capabilities := []string{}
+	for _, capName := range names {
+		if isCapable, _ := utils.Authz_check(types.OpReq{User: user, CapNeeded: []string{capName}}, false); isCapable {
+			capabilities = append(capabilities, capName)
+		}
+	}
+	return capabilities
+}
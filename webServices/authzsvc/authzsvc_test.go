@@ -0,0 +1,186 @@
+package authzsvc
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"net/http"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/remiges-tech/alya/wscutils"
+	"github.com/remiges-tech/idshield/internal/keycloaktest"
+	"github.com/remiges-tech/idshield/utils"
+)
+
+func TestAuthzWhoami(t *testing.T) {
+	s, _ := keycloaktest.NewService()
+	s.WithDependency("gocloak", keycloaktest.NewServer(t).Client())
+	expiry := time.Now().Add(10 * time.Minute).Truncate(time.Second)
+	token := keycloaktest.TokenWithClaims(jwt.MapClaims{
+		"iss":                keycloaktest.Issuer + "acme",
+		"preferred_username": "alice",
+		"exp":                expiry.Unix(),
+	})
+
+	w := keycloaktest.Do(s, Authz_whoami, keycloaktest.NewRequest(http.MethodGet, "/authzwhoami", token, nil))
+	var got whoamiResponse
+	resp := keycloaktest.Decode(t, w, &got)
+	if w.Code != http.StatusOK || resp.Status != "success" {
+		t.Fatalf("Authz_whoami() = %d %s, want 200 success", w.Code, w.Body)
+	}
+	if got.Username != "alice" || got.Realm != "acme" || !got.TokenExpiry.Equal(expiry) {
+		t.Errorf("Authz_whoami() = %+v, want alice in acme expiring at %v", got, expiry)
+	}
+	// the authorizer allows everything until a capability store is wired in, so every capability is listed
+	want := []string{}
+	for name := range utils.CapabilityRegistry {
+		want = append(want, name)
+	}
+	sort.Strings(want)
+	if !reflect.DeepEqual(got.Capabilities, want) {
+		t.Errorf("capabilities = %v, want the authorizer's %v", got.Capabilities, want)
+	}
+}
+
+func TestAuthzWhoamiBadToken(t *testing.T) {
+	tests := []struct {
+		name    string
+		token   string
+		wantErr string
+	}{
+		{"no token", "", utils.ErrTokenMissing},
+		{"issuer without realm", keycloaktest.TokenWithClaims(jwt.MapClaims{"iss": "http://keycloak.test", "preferred_username": "alice", "exp": time.Now().Add(time.Hour).Unix()}), utils.ErrRealmNotFound},
+		{"no expiry", keycloaktest.TokenWithClaims(jwt.MapClaims{"iss": keycloaktest.Issuer + "acme", "preferred_username": "alice"}), utils.ErrInvalidTokenPayload},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, _ := keycloaktest.NewService()
+			s.WithDependency("gocloak", keycloaktest.NewServer(t).Client())
+			w := keycloaktest.Do(s, Authz_whoami, keycloaktest.NewRequest(http.MethodGet, "/authzwhoami", tt.token, nil))
+			resp := keycloaktest.Decode(t, w, nil)
+			if w.Code != http.StatusBadRequest || !reflect.DeepEqual(resp.ErrCodes(), []string{tt.wantErr}) {
+				t.Errorf("Authz_whoami() = %d %v, want 400 %s", w.Code, resp.ErrCodes(), tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestAuthzUserCapabilities(t *testing.T) {
+	tests := []struct {
+		name     string
+		caller   string
+		target   string
+		wantCode int
+		wantErr  []string
+		wantCaps []string
+	}{
+		{"privileged caller", "alice", "bob", http.StatusOK, []string{}, []string{utils.CapGroupCreate, utils.CapGroupRead}},
+		{"unprivileged caller", "bob", "alice", http.StatusBadRequest, []string{utils.ErrUnauthorized}, nil},
+		{"unknown user", "alice", "mallory", http.StatusBadRequest, []string{utils.ErrNotExist}, nil},
+		{"no username", "alice", "", http.StatusBadRequest, []string{wscutils.ErrcodeMissing}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			authz := utils.NewFakeAuthorizer().Allow("alice", utils.CapAuthzRead).Allow("bob", utils.CapGroupCreate, utils.CapGroupRead)
+			prev := utils.SetAuthorizer(authz)
+			t.Cleanup(func() { utils.SetAuthorizer(prev) })
+			kc := keycloaktest.NewServer(t)
+			realm := kc.Realm("acme")
+			realm.AddUser("alice", true)
+			realm.AddUser("bob", true)
+			s, _ := keycloaktest.NewService()
+			s.WithDependency("gocloak", kc.Client())
+
+			w := keycloaktest.Do(s, Authz_userCapabilities, keycloaktest.NewRequest(http.MethodGet, "/authzusercapabilities?username="+tt.target, keycloaktest.Token("acme", tt.caller), nil))
+			var got struct {
+				Username     string   `json:"username"`
+				Capabilities []string `json:"capabilities"`
+			}
+			resp := keycloaktest.Decode(t, w, &got)
+			if w.Code != tt.wantCode || !reflect.DeepEqual(resp.ErrCodes(), tt.wantErr) {
+				t.Fatalf("Authz_userCapabilities() = %d %s, want %d %v", w.Code, w.Body, tt.wantCode, tt.wantErr)
+			}
+			if tt.wantCaps != nil && (got.Username != tt.target || !reflect.DeepEqual(got.Capabilities, tt.wantCaps)) {
+				t.Errorf("Authz_userCapabilities() = %+v, want %s with %v", got, tt.target, tt.wantCaps)
+			}
+		})
+	}
+}
+
+// handlerCapabilities returns the values of the utils.Cap constants the handlers under webServices pass to
+// Authz_check as CapNeeded
+func handlerCapabilities(t *testing.T) []string {
+	fset := token.NewFileSet()
+	values := map[string]string{}
+	capsFile, err := parser.ParseFile(fset, "../../utils/capabilities.go", nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ast.Inspect(capsFile, func(n ast.Node) bool {
+		if spec, ok := n.(*ast.ValueSpec); ok && len(spec.Values) == 1 {
+			if lit, ok := spec.Values[0].(*ast.BasicLit); ok {
+				values[spec.Names[0].Name], _ = strconv.Unquote(lit.Value)
+			}
+		}
+		return true
+	})
+
+	files, _ := filepath.Glob("../*/*.go")
+	used := map[string]bool{}
+	for _, file := range files {
+		f, err := parser.ParseFile(fset, file, nil, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ast.Inspect(f, func(n ast.Node) bool {
+			kv, ok := n.(*ast.KeyValueExpr)
+			if !ok {
+				return true
+			}
+			if key, ok := kv.Key.(*ast.Ident); !ok || key.Name != "CapNeeded" {
+				return true
+			}
+			ast.Inspect(kv.Value, func(n ast.Node) bool {
+				if sel, ok := n.(*ast.SelectorExpr); ok {
+					if value, ok := values[sel.Sel.Name]; ok {
+						used[value] = true
+					}
+				}
+				return true
+			})
+			return true
+		})
+	}
+	capabilities := []string{}
+	for name := range used {
+		capabilities = append(capabilities, name)
+	}
+	return capabilities
+}
+
+func TestAuthzListCapabilities(t *testing.T) {
+	s, _ := keycloaktest.NewService()
+
+	w := keycloaktest.Do(s, Authz_listCapabilities, keycloaktest.NewRequest(http.MethodGet, "/authzcapabilities", keycloaktest.Token("acme", "alice"), nil))
+	var got []capabilityResponse
+	keycloaktest.Decode(t, w, &got)
+	listed := map[string]bool{}
+	for _, capability := range got {
+		listed[capability.Name] = capability.Description != ""
+	}
+	used := handlerCapabilities(t)
+	if len(used) < 10 {
+		t.Fatalf("found only %d capabilities used by the handlers: %v", len(used), used)
+	}
+	for _, name := range used {
+		if !listed[name] {
+			t.Errorf("Authz_listCapabilities() misses %q, used by a handler, or lists it without a description", name)
+		}
+	}
+}
@@ -0,0 +1,180 @@
+package authzsvc
+
+import (
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/Nerzal/gocloak/v13"
+	"github.com/gin-gonic/gin"
+	"github.com/remiges-tech/alya/router"
+	"github.com/remiges-tech/alya/service"
+	"github.com/remiges-tech/alya/wscutils"
+	"github.com/remiges-tech/idshield/types"
+	"github.com/remiges-tech/idshield/utils"
+	"github.com/remiges-tech/logharbour/logharbour"
+)
+
+// page size used when scanning the realm for existing capability grants
+const bootstrapPageSize = 100
+
+// bootstrapMu serializes bootstrap attempts so two concurrent calls can't both find the store empty
+var bootstrapMu sync.Mutex
+
+type bootstrapRequest struct {
+	User string `json:"user" validate:"required"`
+}
+
+// Authz_bootstrap handles the POST /authzbootstrap request, it grants every idshield capability to the given user
+// of a realm where no user or group holds capabilities yet. Once any grant exists the realm counts as bootstrapped
+// and further attempts are rejected, so it can only run once per realm. No capability is required to call it,
+// the caller's token still needs Keycloak's manage-users role for the grant to be written
+func Authz_bootstrap(c *gin.Context, s *service.Service) {
+	l := s.LogHarbour.WithRemoteIP(c.ClientIP())
+	l.Log("Starting execution of Authz_bootstrap()")
+	token, err := router.ExtractToken(c.GetHeader("Authorization"))
+	if err != nil {
+		l.Debug0().LogDebug("Missing or incorrect Authorization header format:", logharbour.DebugInfo{Variables: map[string]any{"error": err}})
+		wscutils.SendErrorResponse(c, wscutils.NewErrorResponse(utils.ErrTokenMissing))
+		return
+	}
+	r, err := utils.ExtractClaimFromJwt(token, "iss")
+	if err != nil {
+		l.Debug0().LogDebug("Missing or incorrect realm:", logharbour.DebugInfo{Variables: map[string]any{"error": err}})
+		wscutils.SendErrorResponse(c, wscutils.NewErrorResponse(utils.ErrRealmNotFound))
+		return
+	}
+	parts := strings.Split(r, "/realms/")
+	if len(parts) != 2 {
+		l.Debug0().LogDebug("Missing or incorrect realm:", logharbour.DebugInfo{Variables: map[string]any{"iss": r}})
+		wscutils.SendErrorResponse(c, wscutils.NewErrorResponse(utils.ErrRealmNotFound))
+		return
+	}
+	realm := parts[1]
+	username, err := utils.ExtractClaimFromJwt(token, "preferred_username")
+	if err != nil {
+		l.Debug0().LogDebug("Missing username:", logharbour.DebugInfo{Variables: map[string]any{"error": err}})
+		wscutils.SendErrorResponse(c, wscutils.NewErrorResponse(utils.ErrUserNotFound))
+		return
+	}
+
+	var req bootstrapRequest
+	if !utils.RequireJSON(c) {
+		l.Log("Unsupported content type")
+		return
+	}
+	if err = wscutils.BindJSON(c, &req); err != nil {
+		l.LogActivity("Error Unmarshalling JSON to struct:", logharbour.DebugInfo{Variables: map[string]any{"Error": err.Error()}})
+		return
+	}
+	if req.User == "" {
+		l.Log("user missing")
+		wscutils.SendErrorResponse(c, wscutils.NewResponse(wscutils.ErrorStatus, nil, []wscutils.ErrorMessage{wscutils.BuildErrorMessage(wscutils.ErrcodeMissing, nil, "user")}))
+		return
+	}
+
+	// Extracting the GoCloak client from the service dependencies
+	gcClient, ok := s.Dependencies["gocloak"].(*gocloak.GoCloak)
+	if !ok {
+		l.Log("Failed to load the dependency to *gocloak.GoCloak")
+		wscutils.SendErrorResponse(c, wscutils.NewErrorResponse(utils.ErrFailedToLoadDependence))
+		return
+	}
+
+	bootstrapMu.Lock()
+	defer bootstrapMu.Unlock()
+
+	bootstrapped, err := hasCapabilityGrants(c, gcClient, token, realm)
+	if err != nil {
+		utils.GocloakErrorHandler(c, l, err)
+		return
+	}
+	if bootstrapped {
+		l.LogActivity("Rejected bootstrap of an already bootstrapped realm:", map[string]any{"realm": realm, "by": username})
+		str := "realm"
+		wscutils.SendErrorResponse(c, wscutils.NewResponse(wscutils.ErrorStatus, nil, []wscutils.ErrorMessage{wscutils.BuildErrorMessage(utils.ErrAlreadyBootstrapped, &str, realm)}))
+		return
+	}
+
+	users, err := gcClient.GetUsers(c, token, realm, gocloak.GetUsersParams{
+		Username: &req.User,
+		Exact:    gocloak.BoolP(true),
+	})
+	if err != nil {
+		utils.GocloakErrorHandler(c, l, err)
+		return
+	}
+	if len(users) == 0 {
+		l.Log("Error while gcClient.GetUsers user doesn't exist ")
+		str := "user"
+		wscutils.SendErrorResponse(c, wscutils.NewResponse("error", nil, []wscutils.ErrorMessage{wscutils.BuildErrorMessage(utils.ErrNotExist, &str)}))
+		return
+	}
+
+	capNames := make([]string, 0, len(utils.CapabilityRegistry))
+	for capName := range utils.CapabilityRegistry {
+		capNames = append(capNames, capName)
+	}
+	sort.Strings(capNames)
+	caps := types.Capabilities{Name: req.User}
+	for _, capName := range capNames {
+		caps.QualifiedCaps = append(caps.QualifiedCaps, types.QualifiedCap{Cap: capName})
+	}
+	capsStr, err := utils.CapabilitiesToString(caps)
+	if err != nil {
+		l.Debug0().LogDebug("Error while converting Capabilities To String:", logharbour.DebugInfo{Variables: map[string]any{"error": err}})
+		wscutils.SendErrorResponse(c, wscutils.NewErrorResponse("Error while converting Capabilities To String"))
+		return
+	}
+
+	// keep the user's other attributes, UpdateUser replaces the whole attribute map
+	attr := make(map[string][]string)
+	if users[0].Attributes != nil {
+		for key, value := range *users[0].Attributes {
+			attr[key] = value
+		}
+	}
+	attr["qualifiedcaps"] = []string{capsStr}
+	if err = gcClient.UpdateUser(c, token, realm, gocloak.User{ID: users[0].ID, Attributes: &attr}); err != nil {
+		utils.GocloakErrorHandler(c, l, err)
+		return
+	}
+	l.LogActivity("Realm bootstrapped:", map[string]any{"realm": realm, "user": req.User, "by": username})
+
+	wscutils.SendSuccessResponse(c, utils.NewMutationResponse(capNames, username))
+
+	l.Log("Finished execution of Authz_bootstrap()")
+}
+
+// hasCapabilityGrants reports whether any user or top-level group of the realm already holds capabilities
+func hasCapabilityGrants(c *gin.Context, gcClient *gocloak.GoCloak, token, realm string) (bool, error) {
+	for page := 0; ; page += bootstrapPageSize {
+		users, err := gcClient.GetUsers(c, token, realm, gocloak.GetUsersParams{
+			First: gocloak.IntP(page),
+			Max:   gocloak.IntP(bootstrapPageSize),
+		})
+		if err != nil {
+			return false, err
+		}
+		for _, user := range users {
+			if user.Attributes != nil && len((*user.Attributes)["qualifiedcaps"]) > 0 {
+				return true, nil
+			}
+		}
+		if len(users) < bootstrapPageSize {
+			break
+		}
+	}
+	groups, err := gcClient.GetGroups(c, token, realm, gocloak.GetGroupsParams{
+		BriefRepresentation: gocloak.BoolP(false),
+	})
+	if err != nil {
+		return false, err
+	}
+	for _, grp := range groups {
+		if grp.Attributes != nil && len((*grp.Attributes)["qualifiedcaps"]) > 0 {
+			return true, nil
+		}
+	}
+	return false, nil
+}
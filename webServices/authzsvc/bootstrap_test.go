@@ -0,0 +1,52 @@
+package authzsvc
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/remiges-tech/idshield/internal/keycloaktest"
+	"github.com/remiges-tech/idshield/utils"
+)
+
+func TestAuthzBootstrap(t *testing.T) {
+	kc := keycloaktest.NewServer(t)
+	realm := kc.Realm("acme")
+	bob := realm.AddUser("bob", true)
+	bob.Attributes = map[string][]string{"dept": {"it"}}
+	realm.AddUser("carol", true)
+	s, _ := keycloaktest.NewService()
+	s.WithDependency("gocloak", kc.Client())
+	token := keycloaktest.Token("acme", "alice")
+
+	w := keycloaktest.Do(s, Authz_bootstrap, keycloaktest.NewRequest(http.MethodPost, "/authzbootstrap", token, keycloaktest.Data(bootstrapRequest{User: "bob"})))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Authz_bootstrap() = %d %s, want 200", w.Code, w.Body)
+	}
+	if len(bob.Attributes["qualifiedcaps"]) != 1 || !reflect.DeepEqual(bob.Attributes["dept"], []string{"it"}) {
+		t.Errorf("bob's attributes = %v, want the capabilities granted and dept kept", bob.Attributes)
+	}
+
+	// the realm is bootstrapped now, a second attempt for another user is rejected
+	w = keycloaktest.Do(s, Authz_bootstrap, keycloaktest.NewRequest(http.MethodPost, "/authzbootstrap", token, keycloaktest.Data(bootstrapRequest{User: "carol"})))
+	if resp := keycloaktest.Decode(t, w, nil); w.Code != http.StatusBadRequest || !reflect.DeepEqual(resp.ErrCodes(), []string{utils.ErrAlreadyBootstrapped}) {
+		t.Errorf("second Authz_bootstrap() = %d %s, want 400 %s", w.Code, w.Body, utils.ErrAlreadyBootstrapped)
+	}
+	if _, ok := realm.User("carol").Attributes["qualifiedcaps"]; ok {
+		t.Error("second Authz_bootstrap() granted carol capabilities")
+	}
+}
+
+func TestAuthzBootstrapGroupGrant(t *testing.T) {
+	kc := keycloaktest.NewServer(t)
+	realm := kc.Realm("acme")
+	realm.AddUser("bob", true)
+	realm.AddGroup("/admins", map[string][]string{"qualifiedcaps": {"groupread"}})
+	s, _ := keycloaktest.NewService()
+	s.WithDependency("gocloak", kc.Client())
+
+	w := keycloaktest.Do(s, Authz_bootstrap, keycloaktest.NewRequest(http.MethodPost, "/authzbootstrap", keycloaktest.Token("acme", "alice"), keycloaktest.Data(bootstrapRequest{User: "bob"})))
+	if resp := keycloaktest.Decode(t, w, nil); w.Code != http.StatusBadRequest || !reflect.DeepEqual(resp.ErrCodes(), []string{utils.ErrAlreadyBootstrapped}) {
+		t.Errorf("Authz_bootstrap() with a group grant = %d %s, want 400 %s", w.Code, w.Body, utils.ErrAlreadyBootstrapped)
+	}
+}
@@ -0,0 +1,176 @@
+package authzsvc
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Nerzal/gocloak/v13"
+	"github.com/gin-gonic/gin"
+	"github.com/remiges-tech/alya/service"
+	"github.com/remiges-tech/alya/wscutils"
+	"github.com/remiges-tech/idshield/types"
+	"github.com/remiges-tech/idshield/utils"
+)
+
+// reasons a capability grant is reported by Authz_reconcile
+const (
+	// the grant is scoped to a group the user is no longer a member of
+	driftNotMember = "not_member"
+	// the grant names a capability idshield doesn't recognise
+	driftUnknownCapability = "unknown_capability"
+)
+
+// scopeGroupKey is the scope key of a capability granted for a specific group,
+// it holds the group's name or path
+const scopeGroupKey = "group"
+
+type capDrift struct {
+	UserID   string `json:"userId"`
+	Username string `json:"username"`
+	CapID    string `json:"capId"`
+	Cap      string `json:"cap"`
+	Reason   string `json:"reason"`
+	Group    string `json:"group,omitempty"`
+}
+
+type reconcileResponse struct {
+	Drift   []capDrift `json:"drift"`
+	Applied bool       `json:"applied"`
+	Fixed   int        `json:"fixed"`
+	Errors  []string   `json:"errors,omitempty"`
+}
+
+// Authz_reconcile handles the POST /authzreconcile request, it compares the capabilities granted to users with
+// the realm's current state and reports the grants that have drifted: grants scoped to a group the user has left,
+// and grants of capabilities idshield no longer recognises. It only reports unless apply=true, in which case the
+// drifted grants are removed from the users and fixed counts the users whose grants were rewritten
+func Authz_reconcile(c *gin.Context, s *service.Service) {
+	utils.Handler("Authz_reconcile", []string{utils.CapAuthzAdmin}, authzReconcile)(c, s)
+}
+
+// authzReconcile is the business logic of Authz_reconcile, utils.Handler has done the token, realm and authz checks
+func authzReconcile(ctx utils.HandlerContext) {
+	c, l := ctx.Gin, ctx.Logger
+	apply := c.Query("apply") == "true"
+
+	resp := reconcileResponse{Drift: []capDrift{}, Applied: apply}
+	for page := 0; ; page += bootstrapPageSize {
+		users, err := ctx.Client.GetUsers(c, ctx.Token, ctx.Realm, gocloak.GetUsersParams{
+			First: gocloak.IntP(page),
+			Max:   gocloak.IntP(bootstrapPageSize),
+		})
+		if err != nil {
+			utils.GocloakErrorHandler(c, l, err)
+			return
+		}
+		for _, user := range users {
+			if user.Attributes == nil || len((*user.Attributes)["qualifiedcaps"]) == 0 {
+				continue
+			}
+			caps, err := utils.StringToCapabilities((*user.Attributes)["qualifiedcaps"][0])
+			if err != nil {
+				resp.Errors = append(resp.Errors, fmt.Sprintf("%v: unreadable capabilities: %v", gocloak.PString(user.Username), err))
+				continue
+			}
+			kept, drift, err := reconcileUser(c, ctx, user, caps)
+			if err != nil {
+				utils.GocloakErrorHandler(c, l, err)
+				return
+			}
+			if len(drift) == 0 {
+				continue
+			}
+			resp.Drift = append(resp.Drift, drift...)
+			if !apply {
+				continue
+			}
+			if err = updateUserCaps(c, ctx, user, kept); err != nil {
+				resp.Errors = append(resp.Errors, fmt.Sprintf("%v: %v", gocloak.PString(user.Username), err))
+				continue
+			}
+			l.LogActivity("Drifted capabilities removed:", map[string]any{"user": gocloak.PString(user.Username), "drift": drift, "by": ctx.Username})
+			resp.Fixed++
+		}
+		if len(users) < bootstrapPageSize {
+			break
+		}
+	}
+
+	if apply {
+		wscutils.SendSuccessResponse(c, utils.NewMutationResponse(resp, ctx.Username))
+		return
+	}
+	wscutils.SendSuccessResponse(c, wscutils.NewSuccessResponse(resp))
+}
+
+// reconcileUser splits the user's grants into the ones still valid and the drifted ones. The user's groups
+// are only fetched when a grant is scoped to a group
+func reconcileUser(c *gin.Context, ctx utils.HandlerContext, user *gocloak.User, caps types.Capabilities) (types.Capabilities, []capDrift, error) {
+	kept := types.Capabilities{Name: caps.Name, QualifiedCaps: []types.QualifiedCap{}}
+	var drift []capDrift
+	var memberOf map[string]bool
+	for _, qc := range caps.QualifiedCaps {
+		d := capDrift{UserID: gocloak.PString(user.ID), Username: gocloak.PString(user.Username), CapID: qc.Id, Cap: qc.Cap}
+		if _, ok := utils.CapabilityRegistry[qc.Cap]; !ok {
+			d.Reason = driftUnknownCapability
+			drift = append(drift, d)
+			continue
+		}
+		group, scoped := qc.Scope[scopeGroupKey].(string)
+		if scoped && group != "" {
+			if memberOf == nil {
+				var err error
+				if memberOf, err = userGroupNames(c, ctx, *user.ID); err != nil {
+					return kept, nil, err
+				}
+			}
+			if !memberOf[group] && !memberOf["/"+strings.TrimPrefix(group, "/")] {
+				d.Reason, d.Group = driftNotMember, group
+				drift = append(drift, d)
+				continue
+			}
+		}
+		kept.QualifiedCaps = append(kept.QualifiedCaps, qc)
+	}
+	return kept, drift, nil
+}
+
+// userGroupNames returns the names and paths of every group the user is a member of
+func userGroupNames(c *gin.Context, ctx utils.HandlerContext, userID string) (map[string]bool, error) {
+	names := map[string]bool{}
+	for page := 0; ; page += bootstrapPageSize {
+		groups, err := ctx.Client.GetUserGroups(c, ctx.Token, ctx.Realm, userID, gocloak.GetGroupsParams{
+			First: gocloak.IntP(page),
+			Max:   gocloak.IntP(bootstrapPageSize),
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, grp := range groups {
+			names[gocloak.PString(grp.Name)] = true
+			names[gocloak.PString(grp.Path)] = true
+		}
+		if len(groups) < bootstrapPageSize {
+			return names, nil
+		}
+	}
+}
+
+// updateUserCaps stores caps as the user's grants, keeping the user's other attributes
+// since UpdateUser replaces the whole attribute map
+func updateUserCaps(c *gin.Context, ctx utils.HandlerContext, user *gocloak.User, caps types.Capabilities) error {
+	attr := make(map[string][]string)
+	for key, value := range *user.Attributes {
+		attr[key] = value
+	}
+	if len(caps.QualifiedCaps) == 0 {
+		delete(attr, "qualifiedcaps")
+	} else {
+		capsStr, err := utils.CapabilitiesToString(caps)
+		if err != nil {
+			return err
+		}
+		attr["qualifiedcaps"] = []string{capsStr}
+	}
+	return ctx.Client.UpdateUser(c, ctx.Token, ctx.Realm, gocloak.User{ID: user.ID, Attributes: &attr})
+}
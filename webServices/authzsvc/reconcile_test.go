@@ -0,0 +1,85 @@
+package authzsvc
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/remiges-tech/idshield/internal/keycloaktest"
+	"github.com/remiges-tech/idshield/types"
+	"github.com/remiges-tech/idshield/utils"
+)
+
+func grantCaps(t *testing.T, user *keycloaktest.User, qcs ...types.QualifiedCap) {
+	t.Helper()
+	capsStr, err := utils.CapabilitiesToString(types.Capabilities{Name: user.Username, QualifiedCaps: qcs})
+	if err != nil {
+		t.Fatal(err)
+	}
+	user.Attributes = map[string][]string{"dept": {"it"}, "qualifiedcaps": {capsStr}}
+}
+
+func TestAuthzReconcile(t *testing.T) {
+	kc := keycloaktest.NewServer(t)
+	realm := kc.Realm("acme")
+	bob := realm.AddUser("bob", true)
+	carol := realm.AddUser("carol", true)
+	realm.AddGroup("/admins", nil).AddMembers(bob, carol)
+	realm.AddGroup("/sales", nil)
+	grantCaps(t, bob,
+		types.QualifiedCap{Id: "1", Cap: utils.CapGroupCreate, Scope: types.Scope{"group": "/admins"}},
+		types.QualifiedCap{Id: "2", Cap: utils.CapGroupCreate, Scope: types.Scope{"group": "sales"}},
+		types.QualifiedCap{Id: "3", Cap: "teleport"})
+	grantCaps(t, carol, types.QualifiedCap{Id: "4", Cap: utils.CapGroupCreate, Scope: types.Scope{"group": "admins"}})
+	carolCaps := carol.Attributes["qualifiedcaps"]
+	s, _ := keycloaktest.NewService()
+	s.WithDependency("gocloak", kc.Client())
+	token := keycloaktest.Token("acme", "alice")
+	// CapabilitiesToString gives every grant a fresh id, so the drift is compared without them
+	withoutIDs := func(drift []capDrift) []capDrift {
+		for i := range drift {
+			drift[i].CapID = ""
+		}
+		return drift
+	}
+	wantDrift := []capDrift{
+		{UserID: bob.ID, Username: "bob", Cap: utils.CapGroupCreate, Reason: driftNotMember, Group: "sales"},
+		{UserID: bob.ID, Username: "bob", Cap: "teleport", Reason: driftUnknownCapability},
+	}
+
+	// a dry run reports the drift and leaves the grants alone
+	var report reconcileResponse
+	w := keycloaktest.Do(s, Authz_reconcile, keycloaktest.NewRequest(http.MethodPost, "/authzreconcile", token, nil))
+	keycloaktest.Decode(t, w, &report)
+	if w.Code != http.StatusOK || !reflect.DeepEqual(withoutIDs(report.Drift), wantDrift) || report.Applied || report.Fixed != 0 {
+		t.Fatalf("Authz_reconcile() = %d %s, want the drift %+v reported", w.Code, w.Body, wantDrift)
+	}
+	caps, _ := utils.StringToCapabilities(bob.Attributes["qualifiedcaps"][0])
+	if len(caps.QualifiedCaps) != 3 {
+		t.Errorf("dry run changed bob's grants to %v", caps.QualifiedCaps)
+	}
+
+	w = keycloaktest.Do(s, Authz_reconcile, keycloaktest.NewRequest(http.MethodPost, "/authzreconcile?apply=true", token, nil))
+	var applied struct {
+		Result reconcileResponse `json:"result"`
+	}
+	keycloaktest.Decode(t, w, &applied)
+	if report = applied.Result; w.Code != http.StatusOK || !reflect.DeepEqual(withoutIDs(report.Drift), wantDrift) || !report.Applied || report.Fixed != 1 {
+		t.Fatalf("Authz_reconcile(apply) = %d %s, want bob fixed", w.Code, w.Body)
+	}
+	caps, _ = utils.StringToCapabilities(bob.Attributes["qualifiedcaps"][0])
+	if len(caps.QualifiedCaps) != 1 || caps.QualifiedCaps[0].Scope["group"] != "/admins" || !reflect.DeepEqual(bob.Attributes["dept"], []string{"it"}) {
+		t.Errorf("bob's attributes = %v, want only the /admins grant kept and dept untouched", bob.Attributes)
+	}
+	if !reflect.DeepEqual(carol.Attributes["qualifiedcaps"], carolCaps) {
+		t.Errorf("carol's grants = %v, want them unchanged", carol.Attributes["qualifiedcaps"])
+	}
+
+	// once applied there is nothing left to report
+	w = keycloaktest.Do(s, Authz_reconcile, keycloaktest.NewRequest(http.MethodPost, "/authzreconcile", token, nil))
+	report = reconcileResponse{}
+	keycloaktest.Decode(t, w, &report)
+	if w.Code != http.StatusOK || len(report.Drift) != 0 {
+		t.Errorf("Authz_reconcile() after apply = %d %s, want no drift", w.Code, w.Body)
+	}
+}
@@ -36,6 +36,11 @@ func Capuser_grant(c *gin.Context, s *service.Service) {
 		return
 	}
 	parts := strings.Split(r, "/realms/")
+	if len(parts) != 2 {
+		l.Debug0().LogDebug("Missing or incorrect realm:", logharbour.DebugInfo{Variables: map[string]any{"iss": r}})
+		wscutils.SendErrorResponse(c, wscutils.NewErrorResponse(utils.ErrRealmNotFound))
+		return
+	}
 	realm := parts[1]
 	username, err := utils.ExtractClaimFromJwt(token, "preferred_username")
 	if err != nil {
@@ -46,7 +51,7 @@ func Capuser_grant(c *gin.Context, s *service.Service) {
 
 	isCapable, _ := utils.Authz_check(types.OpReq{
 		User:      username,
-		CapNeeded: []string{"Capuser_grant"},
+		CapNeeded: []string{utils.CapCapuserGrant},
 	}, false)
 
 	if !isCapable {
@@ -57,6 +62,10 @@ func Capuser_grant(c *gin.Context, s *service.Service) {
 
 	var ucap types.Capabilities
 
+	if !utils.RequireJSON(c) {
+		l.Log("Unsupported content type")
+		return
+	}
 	// Unmarshal JSON request into user struct
 	if err = wscutils.BindJSON(c, &ucap); err != nil {
 		l.LogActivity("Error Unmarshalling JSON to struct:", logharbour.DebugInfo{Variables: map[string]any{"Error": err.Error()}})
@@ -110,7 +119,7 @@ func Capuser_grant(c *gin.Context, s *service.Service) {
 	}
 
 	// Send success response
-	wscutils.SendSuccessResponse(c, &wscutils.Response{Status: wscutils.SuccessStatus, Data: "Grant Capabilities successfully ", Messages: []wscutils.ErrorMessage{}})
+	wscutils.SendSuccessResponse(c, utils.NewMutationResponse("Grant Capabilities successfully ", username))
 
 	l.Log("Finished execution of Capuser_grant()")
 }
@@ -132,6 +141,11 @@ func Capuser_revoke(c *gin.Context, s *service.Service) {
 		return
 	}
 	parts := strings.Split(r, "/realms/")
+	if len(parts) != 2 {
+		l.Debug0().LogDebug("Missing or incorrect realm:", logharbour.DebugInfo{Variables: map[string]any{"iss": r}})
+		wscutils.SendErrorResponse(c, wscutils.NewErrorResponse(utils.ErrRealmNotFound))
+		return
+	}
 	realm := parts[1]
 	username, err := utils.ExtractClaimFromJwt(token, "preferred_username")
 	if err != nil {
@@ -142,7 +156,7 @@ func Capuser_revoke(c *gin.Context, s *service.Service) {
 
 	isCapable, _ := utils.Authz_check(types.OpReq{
 		User:      username,
-		CapNeeded: []string{"Capuser_revoke"},
+		CapNeeded: []string{utils.CapCapuserRevoke},
 	}, false)
 
 	if !isCapable {
@@ -153,6 +167,10 @@ func Capuser_revoke(c *gin.Context, s *service.Service) {
 
 	var userCapRevoke capRevoke
 
+	if !utils.RequireJSON(c) {
+		l.Log("Unsupported content type")
+		return
+	}
 	// Unmarshal JSON request into user struct
 	if err = wscutils.BindJSON(c, &userCapRevoke); err != nil {
 		l.LogActivity("Error Unmarshalling JSON to struct:", logharbour.DebugInfo{Variables: map[string]any{"Error": err.Error()}})
@@ -212,7 +230,7 @@ func Capuser_revoke(c *gin.Context, s *service.Service) {
 	}
 
 	// Send success response
-	wscutils.SendSuccessResponse(c, &wscutils.Response{Status: wscutils.SuccessStatus, Data: "Revoke Capabilities successfully ", Messages: []wscutils.ErrorMessage{}})
+	wscutils.SendSuccessResponse(c, utils.NewMutationResponse("Revoke Capabilities successfully ", username))
 
 	l.Log("Finished execution of Capuser_revoke()")
 }
@@ -234,6 +252,11 @@ func Capuser_getall(c *gin.Context, s *service.Service) {
 		return
 	}
 	parts := strings.Split(r, "/realms/")
+	if len(parts) != 2 {
+		l.Debug0().LogDebug("Missing or incorrect realm:", logharbour.DebugInfo{Variables: map[string]any{"iss": r}})
+		wscutils.SendErrorResponse(c, wscutils.NewErrorResponse(utils.ErrRealmNotFound))
+		return
+	}
 	realm := parts[1]
 	username, err := utils.ExtractClaimFromJwt(token, "preferred_username")
 	if err != nil {
@@ -244,7 +267,7 @@ func Capuser_getall(c *gin.Context, s *service.Service) {
 
 	isCapable, _ := utils.Authz_check(types.OpReq{
 		User:      username,
-		CapNeeded: []string{"Capuser_getall"},
+		CapNeeded: []string{utils.CapCapuserGetall},
 	}, false)
 
 	if !isCapable {
@@ -314,6 +337,11 @@ func Capgroup_grant(c *gin.Context, s *service.Service) {
 		return
 	}
 	parts := strings.Split(r, "/realms/")
+	if len(parts) != 2 {
+		l.Debug0().LogDebug("Missing or incorrect realm:", logharbour.DebugInfo{Variables: map[string]any{"iss": r}})
+		wscutils.SendErrorResponse(c, wscutils.NewErrorResponse(utils.ErrRealmNotFound))
+		return
+	}
 	realm := parts[1]
 	username, err := utils.ExtractClaimFromJwt(token, "preferred_username")
 	if err != nil {
@@ -324,7 +352,7 @@ func Capgroup_grant(c *gin.Context, s *service.Service) {
 
 	isCapable, _ := utils.Authz_check(types.OpReq{
 		User:      username,
-		CapNeeded: []string{"capgroup_grant"},
+		CapNeeded: []string{utils.CapCapgroupGrant},
 	}, false)
 
 	if !isCapable {
@@ -335,6 +363,10 @@ func Capgroup_grant(c *gin.Context, s *service.Service) {
 
 	var gcap types.Capabilities
 
+	if !utils.RequireJSON(c) {
+		l.Log("Unsupported content type")
+		return
+	}
 	// Unmarshal JSON request into user struct
 	if err = wscutils.BindJSON(c, &gcap); err != nil {
 		l.LogActivity("Error Unmarshalling JSON to struct:", logharbour.DebugInfo{Variables: map[string]any{"Error": err.Error()}})
@@ -387,7 +419,7 @@ func Capgroup_grant(c *gin.Context, s *service.Service) {
 	}
 
 	// Send success response
-	wscutils.SendSuccessResponse(c, &wscutils.Response{Status: wscutils.SuccessStatus, Data: "Grant Capabilities to group successfully ", Messages: []wscutils.ErrorMessage{}})
+	wscutils.SendSuccessResponse(c, utils.NewMutationResponse("Grant Capabilities to group successfully ", username))
 
 	l.Log("Finished execution of Capgroup_grant()")
 }
@@ -409,6 +441,11 @@ func Capgroup_revoke(c *gin.Context, s *service.Service) {
 		return
 	}
 	parts := strings.Split(r, "/realms/")
+	if len(parts) != 2 {
+		l.Debug0().LogDebug("Missing or incorrect realm:", logharbour.DebugInfo{Variables: map[string]any{"iss": r}})
+		wscutils.SendErrorResponse(c, wscutils.NewErrorResponse(utils.ErrRealmNotFound))
+		return
+	}
 	realm := parts[1]
 	username, err := utils.ExtractClaimFromJwt(token, "preferred_username")
 	if err != nil {
@@ -419,7 +456,7 @@ func Capgroup_revoke(c *gin.Context, s *service.Service) {
 
 	isCapable, _ := utils.Authz_check(types.OpReq{
 		User:      username,
-		CapNeeded: []string{"Capgroup_revoke"},
+		CapNeeded: []string{utils.CapCapgroupRevoke},
 	}, false)
 
 	if !isCapable {
@@ -430,6 +467,10 @@ func Capgroup_revoke(c *gin.Context, s *service.Service) {
 
 	var groupCapRevoke capRevoke
 
+	if !utils.RequireJSON(c) {
+		l.Log("Unsupported content type")
+		return
+	}
 	// Unmarshal JSON request into user struct
 	if err = wscutils.BindJSON(c, &groupCapRevoke); err != nil {
 		l.LogActivity("Error Unmarshalling JSON to struct:", logharbour.DebugInfo{Variables: map[string]any{"Error": err.Error()}})
@@ -498,7 +539,7 @@ func Capgroup_revoke(c *gin.Context, s *service.Service) {
 	}
 
 	// Send success response
-	wscutils.SendSuccessResponse(c, &wscutils.Response{Status: wscutils.SuccessStatus, Data: "Revoke Capabilities successfully ", Messages: []wscutils.ErrorMessage{}})
+	wscutils.SendSuccessResponse(c, utils.NewMutationResponse("Revoke Capabilities successfully ", username))
 
 	l.Log("Finished execution of Capuser_revoke()")
 }
@@ -520,6 +561,11 @@ func Capgroup_getall(c *gin.Context, s *service.Service) {
 		return
 	}
 	parts := strings.Split(r, "/realms/")
+	if len(parts) != 2 {
+		l.Debug0().LogDebug("Missing or incorrect realm:", logharbour.DebugInfo{Variables: map[string]any{"iss": r}})
+		wscutils.SendErrorResponse(c, wscutils.NewErrorResponse(utils.ErrRealmNotFound))
+		return
+	}
 	realm := parts[1]
 	username, err := utils.ExtractClaimFromJwt(token, "preferred_username")
 	if err != nil {
@@ -530,7 +576,7 @@ func Capgroup_getall(c *gin.Context, s *service.Service) {
 
 	isCapable, _ := utils.Authz_check(types.OpReq{
 		User:      username,
-		CapNeeded: []string{"Capgroup_getall"},
+		CapNeeded: []string{utils.CapCapgroupGetall},
 	}, false)
 
 	if !isCapable {
@@ -0,0 +1,284 @@
+package clientsvc
+
+import (
+	"strings"
+
+	"github.com/Nerzal/gocloak/v13"
+	"github.com/gin-gonic/gin"
+	"github.com/remiges-tech/alya/router"
+	"github.com/remiges-tech/alya/service"
+	"github.com/remiges-tech/alya/wscutils"
+	"github.com/remiges-tech/idshield/types"
+	"github.com/remiges-tech/idshield/utils"
+	"github.com/remiges-tech/logharbour/logharbour"
+)
+
+type clientResponse struct {
+	ID       *string `json:"id,omitempty"`
+	ClientID *string `json:"clientId,omitempty"`
+	Enabled  *bool   `json:"enabled,omitempty"`
+}
+
+// Client_list handles the GET /clientlist request, it returns a page of the realm's clients (applications)
+func Client_list(c *gin.Context, s *service.Service) {
+	l := s.LogHarbour.WithRemoteIP(c.ClientIP())
+	l.Log("Starting execution of Client_list()")
+	token, err := router.ExtractToken(c.GetHeader("Authorization"))
+	if err != nil {
+		l.Debug0().LogDebug("Missing or incorrect Authorization header format:", logharbour.DebugInfo{Variables: map[string]any{"error": err}})
+		wscutils.SendErrorResponse(c, wscutils.NewErrorResponse(utils.ErrTokenMissing))
+		return
+	}
+	r, err := utils.ExtractClaimFromJwt(token, "iss")
+	if err != nil {
+		l.Debug0().LogDebug("Missing or incorrect realm:", logharbour.DebugInfo{Variables: map[string]any{"error": err}})
+		wscutils.SendErrorResponse(c, wscutils.NewErrorResponse(utils.ErrRealmNotFound))
+		return
+	}
+	parts := strings.Split(r, "/realms/")
+	if len(parts) != 2 {
+		l.Debug0().LogDebug("Missing or incorrect realm:", logharbour.DebugInfo{Variables: map[string]any{"iss": r}})
+		wscutils.SendErrorResponse(c, wscutils.NewErrorResponse(utils.ErrRealmNotFound))
+		return
+	}
+	realm := parts[1]
+	username, err := utils.ExtractClaimFromJwt(token, "preferred_username")
+	if err != nil {
+		l.Debug0().LogDebug("Missing username:", logharbour.DebugInfo{Variables: map[string]any{"error": err}})
+		wscutils.SendErrorResponse(c, wscutils.NewErrorResponse(utils.ErrUserNotFound))
+		return
+	}
+
+	isCapable, _ := utils.Authz_check(types.OpReq{
+		User:      username,
+		CapNeeded: []string{utils.CapClientRead},
+	}, false)
+
+	if !isCapable {
+		l.Log("Unauthorized user:")
+		wscutils.SendErrorResponse(c, wscutils.NewErrorResponse(utils.ErrUnauthorized))
+		return
+	}
+
+	first, max, err := utils.GetPagingParams(c)
+	if err != nil {
+		l.Debug0().LogDebug("Invalid paging params:", logharbour.DebugInfo{Variables: map[string]any{"error": err}})
+		wscutils.SendErrorResponse(c, wscutils.NewErrorResponse(utils.ErrInvalidParam))
+		return
+	}
+
+	// Extracting the GoCloak client from the service dependencies
+	gcClient, ok := s.Dependencies["gocloak"].(*gocloak.GoCloak)
+	if !ok {
+		l.Log("Failed to load the dependency to *gocloak.GoCloak")
+		wscutils.SendErrorResponse(c, wscutils.NewErrorResponse(utils.ErrFailedToLoadDependence))
+		return
+	}
+
+	clients, err := gcClient.GetClients(c, token, realm, gocloak.GetClientsParams{
+		First: &first,
+		Max:   &max,
+	})
+	if err != nil {
+		utils.GocloakErrorHandler(c, l, err)
+		return
+	}
+
+	clientList := []clientResponse{}
+	for _, client := range clients {
+		clientList = append(clientList, clientResponse{
+			ID:       client.ID,
+			ClientID: client.ClientID,
+			Enabled:  client.Enabled,
+		})
+	}
+
+	wscutils.SendSuccessResponse(c, wscutils.NewSuccessResponse(map[string]any{"clients": clientList, "first": first, "max": max}))
+
+	l.Log("Finished execution of Client_list()")
+}
+
+type clientRoleResponse struct {
+	ID          *string `json:"id,omitempty"`
+	Name        *string `json:"name,omitempty"`
+	Description *string `json:"description,omitempty"`
+	Composite   *bool   `json:"composite,omitempty"`
+}
+
+// Client_roles handles the GET /clientroles request, it returns the roles exposed by the client with the
+// given clientId. A client without roles gets an empty list
+func Client_roles(c *gin.Context, s *service.Service) {
+	l := s.LogHarbour.WithRemoteIP(c.ClientIP())
+	l.Log("Starting execution of Client_roles()")
+	token, err := router.ExtractToken(c.GetHeader("Authorization"))
+	if err != nil {
+		l.Debug0().LogDebug("Missing or incorrect Authorization header format:", logharbour.DebugInfo{Variables: map[string]any{"error": err}})
+		wscutils.SendErrorResponse(c, wscutils.NewErrorResponse(utils.ErrTokenMissing))
+		return
+	}
+	r, err := utils.ExtractClaimFromJwt(token, "iss")
+	if err != nil {
+		l.Debug0().LogDebug("Missing or incorrect realm:", logharbour.DebugInfo{Variables: map[string]any{"error": err}})
+		wscutils.SendErrorResponse(c, wscutils.NewErrorResponse(utils.ErrRealmNotFound))
+		return
+	}
+	parts := strings.Split(r, "/realms/")
+	if len(parts) != 2 {
+		l.Debug0().LogDebug("Missing or incorrect realm:", logharbour.DebugInfo{Variables: map[string]any{"iss": r}})
+		wscutils.SendErrorResponse(c, wscutils.NewErrorResponse(utils.ErrRealmNotFound))
+		return
+	}
+	realm := parts[1]
+	username, err := utils.ExtractClaimFromJwt(token, "preferred_username")
+	if err != nil {
+		l.Debug0().LogDebug("Missing username:", logharbour.DebugInfo{Variables: map[string]any{"error": err}})
+		wscutils.SendErrorResponse(c, wscutils.NewErrorResponse(utils.ErrUserNotFound))
+		return
+	}
+
+	isCapable, _ := utils.Authz_check(types.OpReq{
+		User:      username,
+		CapNeeded: []string{utils.CapClientRead},
+	}, false)
+
+	if !isCapable {
+		l.Log("Unauthorized user:")
+		wscutils.SendErrorResponse(c, wscutils.NewErrorResponse(utils.ErrUnauthorized))
+		return
+	}
+
+	clientID := c.Query("clientId")
+	if clientID == "" {
+		l.Log("clientId missing")
+		wscutils.SendErrorResponse(c, wscutils.NewResponse(wscutils.ErrorStatus, nil, []wscutils.ErrorMessage{wscutils.BuildErrorMessage(wscutils.ErrcodeMissing, nil, "clientId")}))
+		return
+	}
+
+	// Extracting the GoCloak client from the service dependencies
+	gcClient, ok := s.Dependencies["gocloak"].(*gocloak.GoCloak)
+	if !ok {
+		l.Log("Failed to load the dependency to *gocloak.GoCloak")
+		wscutils.SendErrorResponse(c, wscutils.NewErrorResponse(utils.ErrFailedToLoadDependence))
+		return
+	}
+
+	// roles are keyed by the client's internal id, not by the clientId callers know it by
+	clients, err := gcClient.GetClients(c, token, realm, gocloak.GetClientsParams{
+		ClientID: &clientID,
+	})
+	if err != nil {
+		utils.GocloakErrorHandler(c, l, err)
+		return
+	}
+	var idOfClient string
+	for _, client := range clients {
+		if client.ClientID != nil && *client.ClientID == clientID && client.ID != nil {
+			idOfClient = *client.ID
+			break
+		}
+	}
+	if idOfClient == "" {
+		l.Log("Client not found")
+		str := "clientId"
+		wscutils.SendErrorResponse(c, wscutils.NewResponse("error", nil, []wscutils.ErrorMessage{wscutils.BuildErrorMessage(utils.ErrNotExist, &str)}))
+		return
+	}
+
+	roles, err := gcClient.GetClientRoles(c, token, realm, idOfClient, gocloak.GetRoleParams{})
+	if err != nil {
+		utils.GocloakErrorHandler(c, l, err)
+		return
+	}
+
+	roleList := []clientRoleResponse{}
+	for _, role := range roles {
+		roleList = append(roleList, clientRoleResponse{
+			ID:          role.ID,
+			Name:        role.Name,
+			Description: role.Description,
+			Composite:   role.Composite,
+		})
+	}
+
+	wscutils.SendSuccessResponse(c, wscutils.NewSuccessResponse(map[string]any{"clientId": clientID, "roles": roleList}))
+
+	l.Log("Finished execution of Client_roles()")
+}
+
+type roleGroupResponse struct {
+	ID   *string `json:"id,omitempty"`
+	Name *string `json:"name,omitempty"`
+	Path *string `json:"path,omitempty"`
+}
+
+// Client_roleGroups handles the GET /clientrolegroups request, it returns the groups the client role given by
+// clientId and role is mapped to directly. Groups that only get the role through a composite role or a parent
+// group are not listed. gocloak doesn't page this query, so Keycloak returns at most its default page of 100 groups
+func Client_roleGroups(c *gin.Context, s *service.Service) {
+	utils.Handler("Client_roleGroups", []string{utils.CapClientRead}, clientRoleGroups)(c, s)
+}
+
+// clientRoleGroups is the business logic of Client_roleGroups, utils.Handler has done the token, realm and authz checks
+func clientRoleGroups(ctx utils.HandlerContext) {
+	c, l := ctx.Gin, ctx.Logger
+
+	clientID, roleName := c.Query("clientId"), c.Query("role")
+	for _, field := range []string{"clientId", "role"} {
+		if c.Query(field) == "" {
+			l.Log(field + " missing")
+			wscutils.SendErrorResponse(c, wscutils.NewResponse(wscutils.ErrorStatus, nil, []wscutils.ErrorMessage{wscutils.BuildErrorMessage(wscutils.ErrcodeMissing, nil, field)}))
+			return
+		}
+	}
+
+	// role mappings are keyed by the client's internal id, not by the clientId callers know it by
+	clients, err := ctx.Client.GetClients(c, ctx.Token, ctx.Realm, gocloak.GetClientsParams{
+		ClientID: &clientID,
+	})
+	if err != nil {
+		utils.GocloakErrorHandler(c, l, err)
+		return
+	}
+	var idOfClient string
+	for _, client := range clients {
+		if client.ClientID != nil && *client.ClientID == clientID && client.ID != nil {
+			idOfClient = *client.ID
+			break
+		}
+	}
+	if idOfClient == "" {
+		l.Log("Client not found")
+		str := "clientId"
+		wscutils.SendErrorResponse(c, utils.NotFound(utils.ResourceClient, clientID, wscutils.BuildErrorMessage(utils.ErrNotExist, &str)))
+		return
+	}
+
+	// the groups lookup of a missing role is a bare 404, checking the role first tells the two misses apart
+	if _, err = ctx.Client.GetClientRole(c, ctx.Token, ctx.Realm, idOfClient, roleName); err != nil {
+		if strings.HasPrefix(err.Error(), "404") {
+			l.Log("Client role not found")
+			str := "role"
+			wscutils.SendErrorResponse(c, utils.NotFound(utils.ResourceRole, roleName, wscutils.BuildErrorMessage(utils.ErrNotExist, &str)))
+			return
+		}
+		utils.GocloakErrorHandler(c, l, err)
+		return
+	}
+
+	groups, err := ctx.Client.GetGroupsByClientRole(c, ctx.Token, ctx.Realm, roleName, idOfClient)
+	if err != nil {
+		utils.GocloakErrorHandler(c, l, err)
+		return
+	}
+
+	groupList := []roleGroupResponse{}
+	for _, grp := range groups {
+		groupList = append(groupList, roleGroupResponse{
+			ID:   grp.ID,
+			Name: grp.Name,
+			Path: grp.Path,
+		})
+	}
+
+	wscutils.SendSuccessResponse(c, wscutils.NewSuccessResponse(map[string]any{"clientId": clientID, "role": roleName, "groups": groupList}))
+}
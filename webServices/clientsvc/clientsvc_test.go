@@ -0,0 +1,159 @@
+package clientsvc
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/remiges-tech/alya/wscutils"
+	"github.com/remiges-tech/idshield/internal/keycloaktest"
+	"github.com/remiges-tech/idshield/utils"
+)
+
+func TestClientList(t *testing.T) {
+	kc := keycloaktest.NewServer(t)
+	realm := kc.Realm("acme")
+	realm.AddClient("billing")
+	realm.AddClient("portal").Enabled = false
+	realm.AddClient("reports")
+	kc.Realm("empty")
+	s, _ := keycloaktest.NewService()
+	s.WithDependency("gocloak", kc.Client())
+
+	tests := []struct {
+		name  string
+		realm string
+		query string
+		want  []string
+	}{
+		{"all", "acme", "", []string{"billing", "portal", "reports"}},
+		{"paged", "acme", "?first=1&max=1", []string{"portal"}},
+		{"empty realm", "empty", "", []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := keycloaktest.Do(s, Client_list, keycloaktest.NewRequest(http.MethodGet, "/clientlist"+tt.query, keycloaktest.Token(tt.realm, "alice"), nil))
+			var data struct {
+				Clients []clientResponse `json:"clients"`
+			}
+			keycloaktest.Decode(t, w, &data)
+			got := []string{}
+			for _, client := range data.Clients {
+				got = append(got, *client.ClientID)
+				if (*client.ClientID == "portal") == *client.Enabled {
+					t.Errorf("client %s enabled = %v", *client.ClientID, *client.Enabled)
+				}
+			}
+			if w.Code != http.StatusOK || !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Client_list() = %d %v, want %v", w.Code, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClientListKeycloakError(t *testing.T) {
+	kc := keycloaktest.NewServer(t)
+	kc.Realm("acme")
+	kc.Handle(http.MethodGet, "/admin/realms/acme/clients", func(w http.ResponseWriter, r *http.Request) {
+		keycloaktest.Error(w, http.StatusUnauthorized, "HTTP 401 Unauthorized")
+	})
+	s, _ := keycloaktest.NewService()
+	s.WithDependency("gocloak", kc.Client())
+
+	w := keycloaktest.Do(s, Client_list, keycloaktest.NewRequest(http.MethodGet, "/clientlist", keycloaktest.Token("acme", "alice"), nil))
+	resp := keycloaktest.Decode(t, w, nil)
+	if w.Code != http.StatusBadRequest || len(resp.ErrCodes()) != 1 || resp.ErrCodes()[0] == utils.ErrUserNotFound {
+		t.Errorf("Client_list() = %d %s, want a 400 token error", w.Code, w.Body)
+	}
+}
+
+func TestClientRoles(t *testing.T) {
+	kc := keycloaktest.NewServer(t)
+	realm := kc.Realm("acme")
+	realm.AddClient("billing", "invoice-read", "invoice-write")
+	realm.AddClient("portal")
+	s, _ := keycloaktest.NewService()
+	s.WithDependency("gocloak", kc.Client())
+
+	tests := []struct {
+		name     string
+		query    string
+		wantCode int
+		want     []string
+		wantErr  string
+	}{
+		{"seeded client", "?clientId=billing", http.StatusOK, []string{"invoice-read", "invoice-write"}, ""},
+		{"no roles", "?clientId=portal", http.StatusOK, []string{}, ""},
+		{"unknown client", "?clientId=payroll", http.StatusBadRequest, nil, utils.ErrNotExist},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := keycloaktest.Do(s, Client_roles, keycloaktest.NewRequest(http.MethodGet, "/clientroles"+tt.query, keycloaktest.Token("acme", "alice"), nil))
+			var data struct {
+				Roles []clientRoleResponse `json:"roles"`
+			}
+			resp := keycloaktest.Decode(t, w, &data)
+			if tt.wantErr != "" {
+				if w.Code != tt.wantCode || !reflect.DeepEqual(resp.ErrCodes(), []string{tt.wantErr}) {
+					t.Errorf("Client_roles() = %d %s, want %d %s", w.Code, w.Body, tt.wantCode, tt.wantErr)
+				}
+				return
+			}
+			got := []string{}
+			for _, role := range data.Roles {
+				got = append(got, *role.Name)
+			}
+			if w.Code != tt.wantCode || !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Client_roles() = %d %v, want %v", w.Code, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClientRoleGroups(t *testing.T) {
+	kc := keycloaktest.NewServer(t)
+	realm := kc.Realm("acme")
+	admins := realm.AddGroup("/admins", nil)
+	auditors := realm.AddGroup("/org/auditors", nil)
+	realm.AddGroup("/sales", nil)
+	billing := realm.AddClient("billing", "approve", "view")
+	billing.RoleGroups["approve"] = []*keycloaktest.Group{admins, auditors}
+	s, _ := keycloaktest.NewService()
+	s.WithDependency("gocloak", kc.Client())
+
+	tests := []struct {
+		name      string
+		query     string
+		wantCode  int
+		wantErr   []string
+		wantPaths []string
+	}{
+		{"two groups", "clientId=billing&role=approve", http.StatusOK, []string{}, []string{"/admins", "/org/auditors"}},
+		{"role mapped nowhere", "clientId=billing&role=view", http.StatusOK, []string{}, []string{}},
+		{"unknown client", "clientId=portal&role=approve", http.StatusBadRequest, []string{utils.ErrResourceNotFound, utils.ErrNotExist}, nil},
+		{"unknown role", "clientId=billing&role=delete", http.StatusBadRequest, []string{utils.ErrResourceNotFound, utils.ErrNotExist}, nil},
+		{"role missing", "clientId=billing", http.StatusBadRequest, []string{wscutils.ErrcodeMissing}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := keycloaktest.Do(s, Client_roleGroups, keycloaktest.NewRequest(http.MethodGet, "/clientrolegroups?"+tt.query, keycloaktest.Token("acme", "alice"), nil))
+			var data struct {
+				Groups []roleGroupResponse `json:"groups"`
+			}
+			resp := keycloaktest.Decode(t, w, &data)
+			if w.Code != tt.wantCode || !reflect.DeepEqual(resp.ErrCodes(), tt.wantErr) {
+				t.Fatalf("Client_roleGroups(%s) = %d %s, want %d %v", tt.query, w.Code, w.Body, tt.wantCode, tt.wantErr)
+			}
+			if tt.wantPaths == nil {
+				return
+			}
+			paths := []string{}
+			for _, grp := range data.Groups {
+				paths = append(paths, *grp.Path)
+			}
+			if !reflect.DeepEqual(paths, tt.wantPaths) {
+				t.Errorf("Client_roleGroups(%s) groups = %v, want %v", tt.query, paths, tt.wantPaths)
+			}
+		})
+	}
+}
@@ -0,0 +1,445 @@
+package groupsvc
+
+import (
+	"errors"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/Nerzal/gocloak/v13"
+	"github.com/gin-gonic/gin"
+	"github.com/remiges-tech/alya/router"
+	"github.com/remiges-tech/alya/service"
+	"github.com/remiges-tech/alya/wscutils"
+	"github.com/remiges-tech/idshield/types"
+	"github.com/remiges-tech/idshield/utils"
+	"github.com/remiges-tech/logharbour/logharbour"
+)
+
+// groupAttrPatch is an RFC 7386 merge patch on a group's attributes, a null value deletes the key
+type groupAttrPatch struct {
+	ShortName string             `json:"shortName" validate:"required"`
+	Patch     map[string]*string `json:"patch" validate:"required"`
+}
+
+// Group_patchAttributes handles the PATCH /grouppatchattributes request, it applies a merge patch on top of
+// the group's current attributes and writes the result back
+func Group_patchAttributes(c *gin.Context, s *service.Service) {
+	utils.Handler("Group_patchAttributes", []string{utils.CapGroupUpdate}, groupPatchAttributes)(c, s)
+}
+
+// groupPatchAttributes is the business logic of Group_patchAttributes, utils.Handler has done the token, realm and authz checks
+func groupPatchAttributes(ctx utils.HandlerContext) {
+	c, s, l := ctx.Gin, ctx.Service, ctx.Logger
+	token, realm, username, gcClient := ctx.Token, ctx.Realm, ctx.Username, ctx.Client
+
+	var p groupAttrPatch
+	if !utils.RequireJSON(c) {
+		l.Log("Unsupported content type")
+		return
+	}
+	if err := wscutils.BindJSON(c, &p); err != nil {
+		l.LogActivity("Error Unmarshalling JSON to struct:", logharbour.DebugInfo{Variables: map[string]any{"Error": err.Error()}})
+		return
+	}
+	if p.ShortName == "" || p.Patch == nil {
+		l.Log("shortName or patch missing")
+		wscutils.SendErrorResponse(c, wscutils.NewResponse(wscutils.ErrorStatus, nil, []wscutils.ErrorMessage{wscutils.BuildErrorMessage(wscutils.ErrcodeMissing, nil, "shortName", "patch")}))
+		return
+	}
+	for _, key := range append(reservedAttrKeys(s), utils.GetRealmConfig(c, s, token, realm).ReservedAttrs...) {
+		if _, ok := p.Patch[key]; ok {
+			l.Log("Attempt to patch a reserved attribute")
+			str := "patch"
+			wscutils.SendErrorResponse(c, wscutils.NewResponse(wscutils.ErrorStatus, nil, []wscutils.ErrorMessage{wscutils.BuildErrorMessage(utils.ErrReservedAttribute, &str, key)}))
+			return
+		}
+	}
+	// only keys being set are checked, so existing keys with invalid characters can still be removed
+	keyPattern := getAttrLimits(s).KeyPattern
+	var invalidKeys []string
+	for key, value := range p.Patch {
+		if value != nil && !keyPattern.MatchString(key) {
+			invalidKeys = append(invalidKeys, key)
+		}
+	}
+	if len(invalidKeys) > 0 {
+		l.Log("Attempt to set attributes with invalid keys")
+		sort.Strings(invalidKeys)
+		str := "patch"
+		wscutils.SendErrorResponse(c, wscutils.NewResponse(wscutils.ErrorStatus, nil, []wscutils.ErrorMessage{wscutils.BuildErrorMessage(utils.ErrInvalidAttrKey, &str, invalidKeys...)}))
+		return
+	}
+
+	found, err := utils.GetGroupByExactName(c, gcClient, token, realm, p.ShortName)
+	if errors.Is(err, utils.ErrGroupNotFound) {
+		l.Log("Error while gcClient.GetGroups Group doesn't exist ")
+		str := "shortName"
+		wscutils.SendErrorResponse(c, utils.NotFound(utils.ResourceGroup, p.ShortName, wscutils.BuildErrorMessage(utils.ErrNotExist, &str)))
+		return
+	}
+	if err != nil {
+		utils.GocloakErrorHandler(c, l, err)
+		return
+	}
+	groupID := *found.ID
+	if !checkNotProtected(c, s, l, gcClient, token, realm, groupID) {
+		return
+	}
+
+	// typed values being set are validated and canonicalised as Group_new and Group_update do
+	limits := getAttrLimits(s)
+	setValues := map[string]string{}
+	for key, value := range p.Patch {
+		if value != nil {
+			setValues[key] = *value
+		}
+	}
+	if invalidKeys := coerceAttrValues(setValues, limits.Types); len(invalidKeys) > 0 {
+		l.Log("Attempt to set attributes with invalid values")
+		vals := make([]string, 0, len(invalidKeys))
+		for _, key := range invalidKeys {
+			vals = append(vals, key+":"+limits.Types[key])
+		}
+		str := "patch"
+		wscutils.SendErrorResponse(c, wscutils.NewResponse(wscutils.ErrorStatus, nil, []wscutils.ErrorMessage{wscutils.BuildErrorMessage(utils.ErrInvalidAttrValue, &str, vals...)}))
+		return
+	}
+	for key, value := range setValues {
+		canonical := value
+		p.Patch[key] = &canonical
+	}
+
+	// the limits apply to the attributes the group ends up with, not to the patch alone
+	prepare := func(attr map[string][]string) []wscutils.ErrorMessage {
+		migrateManagedAttrs(s, attr)
+		user := userAttrs(attr, reservedAttrKeys(s))
+		return attrLimitErrors(user, len(user), limits, "patch")
+	}
+	attr, err := patchGroupAttributes(c, gcClient, token, realm, groupID, p.Patch, prepare)
+	var invalid *patchInvalidError
+	if errors.As(err, &invalid) {
+		l.Log("Patched attributes break the attribute limits")
+		wscutils.SendErrorResponse(c, wscutils.NewResponse(wscutils.ErrorStatus, nil, invalid.messages))
+		return
+	}
+	if errors.Is(err, errPatchConflict) {
+		l.Log("Group attributes kept changing concurrently, patch abandoned")
+		str := "patch"
+		wscutils.SendErrorResponse(c, wscutils.NewResponse(wscutils.ErrorStatus, nil, []wscutils.ErrorMessage{wscutils.BuildErrorMessage(utils.ErrConcurrentUpdate, &str)}))
+		return
+	}
+	if err != nil {
+		l.LogActivity("Error while patching group attributes:", logharbour.DebugInfo{Variables: map[string]any{"error": err}})
+		utils.GocloakErrorHandler(c, l, err)
+		return
+	}
+
+	// Send success response
+	utils.SendSuccess(c, opGroupPatchAttributes, utils.NewMutationResponse(attr, username))
+	emitGroupEvent(s, utils.EventGroupUpdated, realm, groupID, username)
+}
+
+// Group_clearAttributes handles the POST /groupclearattributes request, it removes every attribute of the group
+// given by shortName except the reserved ones, so longName and the other managed attributes survive. As the
+// attributes can't be recovered afterwards it refuses to run unless confirm=true is passed
+func Group_clearAttributes(c *gin.Context, s *service.Service) {
+	utils.Handler("Group_clearAttributes", []string{utils.CapGroupUpdate}, groupClearAttributes)(c, s)
+}
+
+// groupClearAttributes is the business logic of Group_clearAttributes, utils.Handler has done the token, realm and authz checks
+func groupClearAttributes(ctx utils.HandlerContext) {
+	c, l := ctx.Gin, ctx.Logger
+
+	shortName := c.Query("shortName")
+	if shortName == "" {
+		l.Log("shortName missing")
+		wscutils.SendErrorResponse(c, wscutils.NewResponse(wscutils.ErrorStatus, nil, []wscutils.ErrorMessage{wscutils.BuildErrorMessage(wscutils.ErrcodeMissing, nil, "shortName")}))
+		return
+	}
+	if c.Query("confirm") != "true" {
+		l.Log("Clearing attributes without confirm=true refused")
+		wscutils.SendErrorResponse(c, wscutils.NewResponse(wscutils.ErrorStatus, nil, []wscutils.ErrorMessage{wscutils.BuildErrorMessage(wscutils.ErrcodeMissing, nil, "confirm")}))
+		return
+	}
+
+	found, err := utils.GetGroupByExactName(c, ctx.Client, ctx.Token, ctx.Realm, shortName)
+	if errors.Is(err, utils.ErrGroupNotFound) {
+		l.Log("Error while gcClient.GetGroups Group doesn't exist ")
+		str := "shortName"
+		wscutils.SendErrorResponse(c, utils.NotFound(utils.ResourceGroup, shortName, wscutils.BuildErrorMessage(utils.ErrNotExist, &str)))
+		return
+	}
+	if err != nil {
+		utils.GocloakErrorHandler(c, l, err)
+		return
+	}
+	groupID := *found.ID
+	if !checkNotProtected(c, ctx.Service, l, ctx.Client, ctx.Token, ctx.Realm, groupID) {
+		return
+	}
+
+	// the search returns the brief representation, the attributes come with the full one
+	grp, err := ctx.Client.GetGroup(c, ctx.Token, ctx.Realm, groupID)
+	if err != nil {
+		utils.GocloakErrorHandler(c, l, err)
+		return
+	}
+	reserved := map[string]bool{}
+	for _, key := range append(reservedAttrKeys(ctx.Service), utils.GetRealmConfig(c, ctx.Service, ctx.Token, ctx.Realm).ReservedAttrs...) {
+		reserved[key] = true
+	}
+	patch := map[string]*string{}
+	if grp.Attributes != nil {
+		for key := range *grp.Attributes {
+			if !reserved[key] {
+				patch[key] = nil
+			}
+		}
+	}
+
+	attr, err := patchGroupAttributes(c, ctx.Client, ctx.Token, ctx.Realm, groupID, patch, nil)
+	if errors.Is(err, errPatchConflict) {
+		l.Log("Group attributes kept changing concurrently, clear abandoned")
+		str := "shortName"
+		wscutils.SendErrorResponse(c, wscutils.NewResponse(wscutils.ErrorStatus, nil, []wscutils.ErrorMessage{wscutils.BuildErrorMessage(utils.ErrConcurrentUpdate, &str)}))
+		return
+	}
+	if err != nil {
+		l.LogActivity("Error while clearing group attributes:", logharbour.DebugInfo{Variables: map[string]any{"error": err}})
+		utils.GocloakErrorHandler(c, l, err)
+		return
+	}
+	l.LogActivity("Group attributes cleared:", map[string]any{"shortName": shortName, "id": groupID, "cleared": len(patch)})
+
+	utils.SendSuccess(c, opGroupClearAttributes, utils.NewMutationResponse(attr, ctx.Username))
+	emitGroupEvent(ctx.Service, utils.EventGroupUpdated, ctx.Realm, groupID, ctx.Username)
+}
+
+// maxPatchAttempts bounds how often a patch is re-applied when concurrent writes keep undoing it
+const maxPatchAttempts = 3
+
+// errPatchConflict is returned by patchGroupAttributes when the patch didn't survive any of its attempts
+var errPatchConflict = errors.New("group attributes changed concurrently")
+
+// patchInvalidError is returned by patchGroupAttributes when prepare rejected the patched attributes
+type patchInvalidError struct {
+	messages []wscutils.ErrorMessage
+}
+
+func (e *patchInvalidError) Error() string {
+	return "patched group attributes are invalid"
+}
+
+// patchGroupAttributes applies patch to the group's current attributes and writes them back. Keycloak keeps no
+// version on groups and every update replaces the whole attribute map, so an update interleaving between our
+// read and write can silently drop our keys, or a concurrent one can be rejected with 409 Conflict. Either way the
+// group is re-fetched and the patch re-applied, up to maxPatchAttempts times, which lets two updates of
+// different keys both survive. When prepare is given it is run on every patched map before it is written, it may
+// adjust the map, and its errors abort the patch with a *patchInvalidError
+func patchGroupAttributes(c *gin.Context, gcClient *gocloak.GoCloak, token, realm, groupID string, patch map[string]*string, prepare func(map[string][]string) []wscutils.ErrorMessage) (map[string][]string, error) {
+	for attempt := 0; attempt < maxPatchAttempts; attempt++ {
+		group, err := gcClient.GetGroup(c, token, realm, groupID)
+		if err != nil {
+			return nil, err
+		}
+		attr := applyAttrPatch(group.Attributes, patch)
+		if prepare != nil {
+			if messages := prepare(attr); len(messages) > 0 {
+				return nil, &patchInvalidError{messages: messages}
+			}
+		}
+		err = gcClient.UpdateGroup(c, token, realm, gocloak.Group{
+			ID:         group.ID,
+			Name:       group.Name,
+			Attributes: &attr,
+		})
+		if err != nil && strings.Contains(err.Error(), utils.ErrHTTPConflict) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		// read back to make sure no concurrent write replaced the map in between
+		written, err := gcClient.GetGroup(c, token, realm, groupID)
+		if err != nil {
+			return nil, err
+		}
+		if patchApplied(written.Attributes, patch) {
+			if written.Attributes == nil {
+				return map[string][]string{}, nil
+			}
+			return *written.Attributes, nil
+		}
+	}
+	return nil, errPatchConflict
+}
+
+// patchApplied reports whether attrs reflects every key of patch
+func patchApplied(attrs *map[string][]string, patch map[string]*string) bool {
+	current := map[string][]string{}
+	if attrs != nil {
+		current = *attrs
+	}
+	for key, value := range patch {
+		values, ok := current[key]
+		if value == nil {
+			if ok {
+				return false
+			}
+			continue
+		}
+		if !ok || len(values) != 1 || values[0] != *value {
+			return false
+		}
+	}
+	return true
+}
+
+// applyAttrPatch returns a copy of current with the merge patch applied, a nil patch value removes the key
+func applyAttrPatch(current *map[string][]string, patch map[string]*string) map[string][]string {
+	attr := make(map[string][]string)
+	if current != nil {
+		for key, value := range *current {
+			attr[key] = value
+		}
+	}
+	for key, value := range patch {
+		if value == nil {
+			delete(attr, key)
+			continue
+		}
+		attr[key] = []string{*value}
+	}
+	return attr
+}
+
+// userAttrs returns attrs without the reserved keys, i.e. the attributes the limits apply to
+func userAttrs(attrs map[string][]string, reserved []string) map[string][]string {
+	user := make(map[string][]string, len(attrs))
+	for key, values := range attrs {
+		user[key] = values
+	}
+	for _, key := range reserved {
+		delete(user, key)
+	}
+	return user
+}
+
+type groupAttributesResponse struct {
+	ID         *string              `json:"id,omitempty"`
+	Path       *string              `json:"path,omitempty"`
+	Attributes *map[string][]string `json:"attributes,omitempty"`
+}
+
+// Group_attributes handles the GET /groupattributes request, it returns the raw attributes of a single group.
+// Nested subgroups are addressed by their full path (e.g. /parent/child), the attributes returned are those of
+// that node and never of its ancestors
+func Group_attributes(c *gin.Context, s *service.Service) {
+	l := utils.RequestLogger(c, s, "Group_attributes")
+	l.Log("Starting execution of Group_attributes()")
+	token, err := router.ExtractToken(c.GetHeader("Authorization"))
+	if err != nil {
+		l.Debug0().LogDebug("Missing or incorrect Authorization header format:", logharbour.DebugInfo{Variables: map[string]any{"error": err}})
+		wscutils.SendErrorResponse(c, wscutils.NewErrorResponse(utils.ErrTokenMissing))
+		return
+	}
+	r, err := utils.ExtractClaimFromJwt(token, "iss")
+	if err != nil {
+		l.Debug0().LogDebug("Missing or incorrect realm:", logharbour.DebugInfo{Variables: map[string]any{"error": err}})
+		wscutils.SendErrorResponse(c, wscutils.NewErrorResponse(utils.ErrRealmNotFound))
+		return
+	}
+	parts := strings.Split(r, "/realms/")
+	if len(parts) != 2 {
+		l.Debug0().LogDebug("Missing or incorrect realm:", logharbour.DebugInfo{Variables: map[string]any{"iss": r}})
+		wscutils.SendErrorResponse(c, wscutils.NewErrorResponse(utils.ErrRealmNotFound))
+		return
+	}
+	realm := utils.CanonicalRealm(c, s, token, parts[1])
+	l = utils.WithRealm(l, realm)
+	username, err := utils.ExtractClaimFromJwt(token, "preferred_username")
+	if err != nil {
+		l.Debug0().LogDebug("Missing username:", logharbour.DebugInfo{Variables: map[string]any{"error": err}})
+		wscutils.SendErrorResponse(c, wscutils.NewErrorResponse(utils.ErrUserNotFound))
+		return
+	}
+
+	isCapable, _ := utils.Authz_check(types.OpReq{
+		User:      username,
+		CapNeeded: []string{utils.CapGroupRead},
+	}, false)
+
+	if !isCapable {
+		l.Log("Unauthorized user:")
+		wscutils.SendErrorResponse(c, wscutils.NewErrorResponse(utils.ErrUnauthorized))
+		return
+	}
+
+	// exactly one of shortName or path identifies the group, path is required for nested subgroups
+	shortName := c.Query("shortName")
+	path := c.Query("path")
+	if errCode := validateLookup(shortName, "", path); errCode != "" {
+		l.Log(errCode)
+		wscutils.SendErrorResponse(c, wscutils.NewResponse(wscutils.ErrorStatus, nil, []wscutils.ErrorMessage{wscutils.BuildErrorMessage(errCode, nil, "shortName", "path")}))
+		return
+	}
+
+	// Extracting the GoCloak client from the service dependencies
+	gcClient, ok := s.Dependencies["gocloak"].(*gocloak.GoCloak)
+	if !ok {
+		l.Log("Failed to load the dependency to *gocloak.GoCloak")
+		wscutils.SendErrorResponse(c, wscutils.NewErrorResponse(utils.ErrFailedToLoadDependence))
+		return
+	}
+
+	if path == "" {
+		found, err := utils.GetGroupByExactName(c, gcClient, token, realm, shortName)
+		if errors.Is(err, utils.ErrGroupNotFound) {
+			l.Log("Error while gcClient.GetGroups Group doesn't exist ")
+			str := "shortName"
+			wscutils.SendErrorResponse(c, utils.NotFound(utils.ResourceGroup, shortName, wscutils.BuildErrorMessage(utils.ErrNotExist, &str)))
+			return
+		}
+		if err != nil {
+			utils.GocloakErrorHandler(c, l, err)
+			return
+		}
+		path = *found.Path
+	}
+
+	// GetGroupByPath resolves the exact node, including nested subgroups, with its full attributes
+	group, err := gcClient.GetGroupByPath(c, token, realm, escapeGroupPath(normalizeGroupPath(path)))
+	if err != nil {
+		utils.GocloakErrorHandler(c, l, err)
+		return
+	}
+
+	utils.SendSuccess(c, opGroupAttributes, wscutils.NewSuccessResponse(groupAttributesResponse{
+		ID:         group.ID,
+		Path:       group.Path,
+		Attributes: group.Attributes,
+	}))
+
+	l.Log("Finished execution of Group_attributes()")
+}
+
+// normalizeGroupPath makes sure a group path is absolute, as keycloak expects it to start with "/"
+func normalizeGroupPath(path string) string {
+	if !strings.HasPrefix(path, "/") {
+		return "/" + path
+	}
+	return path
+}
+
+// escapeGroupPath URL-encodes each segment of a group path. gocloak appends the path to the request url as is,
+// so names with spaces, unicode or characters such as '#' and '?' would otherwise not reach Keycloak intact
+// and the lookup would 404 although the group exists
+func escapeGroupPath(path string) string {
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	return strings.Join(segments, "/")
+}
@@ -0,0 +1,273 @@
+package groupsvc
+
+import (
+	"io"
+	"net/http"
+	"net/url"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/remiges-tech/alya/service"
+	"github.com/remiges-tech/alya/wscutils"
+	"github.com/remiges-tech/idshield/internal/keycloaktest"
+	"github.com/remiges-tech/idshield/types"
+	"github.com/remiges-tech/idshield/utils"
+	"github.com/remiges-tech/logharbour/logharbour"
+)
+
+func strP(s string) *string { return &s }
+
+func TestApplyAttrPatch(t *testing.T) {
+	tests := []struct {
+		name    string
+		current *map[string][]string
+		patch   map[string]*string
+		want    map[string][]string
+	}{
+		{"nil current", nil, map[string]*string{"dept": strP("hr")}, map[string][]string{"dept": {"hr"}}},
+		{"set kept and replaced", &map[string][]string{"dept": {"hr"}, "site": {"pune"}},
+			map[string]*string{"dept": strP("it")}, map[string][]string{"dept": {"it"}, "site": {"pune"}}},
+		{"multi-valued replaced by one value", &map[string][]string{"tags": {"a", "b"}},
+			map[string]*string{"tags": strP("c")}, map[string][]string{"tags": {"c"}}},
+		{"null removes", &map[string][]string{"dept": {"hr"}, "site": {"pune"}},
+			map[string]*string{"site": nil}, map[string][]string{"dept": {"hr"}}},
+		{"removing an absent key", &map[string][]string{"dept": {"hr"}},
+			map[string]*string{"site": nil}, map[string][]string{"dept": {"hr"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var before map[string][]string
+			if tt.current != nil {
+				before = make(map[string][]string, len(*tt.current))
+				for key, values := range *tt.current {
+					before[key] = values
+				}
+			}
+			if got := applyAttrPatch(tt.current, tt.patch); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("applyAttrPatch() = %v, want %v", got, tt.want)
+			}
+			if tt.current != nil && !reflect.DeepEqual(*tt.current, before) {
+				t.Errorf("applyAttrPatch() changed the current attributes to %v", *tt.current)
+			}
+		})
+	}
+}
+
+func TestUserAttrs(t *testing.T) {
+	// both the prefixed and the legacy keys of the managed attributes are left out
+	attrs := map[string][]string{"dept": {"hr"}, "longName": {"Admins"}, "idshield_description": {"Admins of acme"}}
+	want := map[string][]string{"dept": {"hr"}}
+	if got := userAttrs(attrs, reservedAttrKeys(&service.Service{})); !reflect.DeepEqual(got, want) {
+		t.Errorf("userAttrs() = %v, want %v", got, want)
+	}
+	if len(attrs) != 3 {
+		t.Errorf("userAttrs() changed its input to %v", attrs)
+	}
+}
+
+func TestGroupPatchAttributes(t *testing.T) {
+	tests := []struct {
+		name     string
+		patch    map[string]*string
+		wantErr  []string
+		wantAttr map[string][]string
+	}{
+		{"add", map[string]*string{"region": strP("eu")}, nil,
+			map[string][]string{"idshield_longName": {"Admins"}, "dept": {"hr"}, "site": {"pune"}, "region": {"eu"}}},
+		{"update", map[string]*string{"dept": strP("it")}, nil,
+			map[string][]string{"idshield_longName": {"Admins"}, "dept": {"it"}, "site": {"pune"}}},
+		{"delete via null", map[string]*string{"site": nil}, nil,
+			map[string][]string{"idshield_longName": {"Admins"}, "dept": {"hr"}}},
+		{"reserved key", map[string]*string{"longName": strP("Owners")}, []string{utils.ErrReservedAttribute},
+			map[string][]string{"longName": {"Admins"}, "dept": {"hr"}, "site": {"pune"}}},
+		{"over the key limit", map[string]*string{"region": strP("eu"), "tier": strP("gold")}, []string{utils.ErrAttributesTooLarge},
+			map[string][]string{"longName": {"Admins"}, "dept": {"hr"}, "site": {"pune"}}},
+		{"invalid key", map[string]*string{"cost centre": strP("42")}, []string{utils.ErrInvalidAttrKey},
+			map[string][]string{"longName": {"Admins"}, "dept": {"hr"}, "site": {"pune"}}},
+		{"typed value made canonical", map[string]*string{"headcount": strP("+042")}, nil,
+			map[string][]string{"idshield_longName": {"Admins"}, "dept": {"hr"}, "site": {"pune"}, "headcount": {"42"}}},
+		{"invalid typed value", map[string]*string{"headcount": strP("many")}, []string{utils.ErrInvalidAttrValue},
+			map[string][]string{"longName": {"Admins"}, "dept": {"hr"}, "site": {"pune"}}},
+	}
+	// the group predates the managed prefix, a successful patch moves its longName under the prefix
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kc := keycloaktest.NewServer(t)
+			admins := kc.Realm("acme").AddGroup("/admins", map[string][]string{"longName": {"Admins"}, "dept": {"hr"}, "site": {"pune"}})
+			s, _ := keycloaktest.NewService()
+			s.WithDependency("gocloak", kc.Client()).WithDependency("attrLimits", types.AttrLimits{MaxKeys: 3, MaxSize: 1024, Types: map[string]string{"headcount": utils.AttrTypeInt}})
+			body := groupAttrPatch{ShortName: "admins", Patch: tt.patch}
+
+			w := keycloaktest.Do(s, Group_patchAttributes, keycloaktest.NewRequest(http.MethodPatch, "/grouppatchattributes", keycloaktest.Token("acme", "alice"), keycloaktest.Data(body)))
+			resp := keycloaktest.Decode(t, w, nil)
+			if tt.wantErr == nil && w.Code != http.StatusOK || tt.wantErr != nil && !reflect.DeepEqual(resp.ErrCodes(), tt.wantErr) {
+				t.Errorf("Group_patchAttributes() = %d %s, want %v", w.Code, w.Body, tt.wantErr)
+			}
+			if !reflect.DeepEqual(admins.Attributes, tt.wantAttr) {
+				t.Errorf("attributes = %v, want %v", admins.Attributes, tt.wantAttr)
+			}
+		})
+	}
+}
+
+// barrier returns an http.HandlerFunc that holds the first n requests until all of them have arrived, lets
+// them through to the fake and holds them again until all of them have been served
+func barrier(kc *keycloaktest.Server, n int) http.HandlerFunc {
+	var mu sync.Mutex
+	var arrived, served sync.WaitGroup
+	arrived.Add(n)
+	served.Add(n)
+	seen := 0
+	return func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		seen++
+		held := seen <= n
+		mu.Unlock()
+		if !held {
+			kc.Fake(w, r)
+			return
+		}
+		arrived.Done()
+		arrived.Wait()
+		kc.Fake(w, r)
+		served.Done()
+		served.Wait()
+	}
+}
+
+func TestGroupPatchAttributesConcurrent(t *testing.T) {
+	kc := keycloaktest.NewServer(t)
+	admins := kc.Realm("acme").AddGroup("/admins", map[string][]string{"dept": {"hr"}})
+	// both patches read the same attributes and then both write, so the first write is lost and has to be retried
+	kc.Handle(http.MethodGet, "/admin/realms/acme/groups/"+admins.ID, barrier(kc, 2))
+	kc.Handle(http.MethodPut, "/admin/realms/acme/groups/"+admins.ID, barrier(kc, 2))
+	// the handlers run concurrently, so they log to a writer that is safe for that rather than the test buffer
+	lh := logharbour.NewLogger(logharbour.NewLoggerContext(logharbour.Debug2), "idshield", io.Discard)
+	s := service.NewService(gin.New()).WithLogHarbour(lh).WithDependency("gocloak", kc.Client())
+
+	var wg sync.WaitGroup
+	codes := make([]int, 2)
+	for i, patch := range []map[string]*string{{"site": strP("pune")}, {"tier": strP("gold")}} {
+		wg.Add(1)
+		go func(i int, patch map[string]*string) {
+			defer wg.Done()
+			body := groupAttrPatch{ShortName: "admins", Patch: patch}
+			w := keycloaktest.Do(s, Group_patchAttributes, keycloaktest.NewRequest(http.MethodPatch, "/grouppatchattributes", keycloaktest.Token("acme", "alice"), keycloaktest.Data(body)))
+			codes[i] = w.Code
+		}(i, patch)
+	}
+	wg.Wait()
+
+	if codes[0] != http.StatusOK || codes[1] != http.StatusOK {
+		t.Fatalf("Group_patchAttributes() = %v, want both 200", codes)
+	}
+	want := map[string][]string{"dept": {"hr"}, "site": {"pune"}, "tier": {"gold"}}
+	if !reflect.DeepEqual(admins.Attributes, want) {
+		t.Errorf("attributes = %v, want both patches %v", admins.Attributes, want)
+	}
+}
+
+func TestGroupPatchAttributesConflict(t *testing.T) {
+	kc := keycloaktest.NewServer(t)
+	admins := kc.Realm("acme").AddGroup("/admins", map[string][]string{"dept": {"hr"}})
+	kc.Handle(http.MethodPut, "/admin/realms/acme/groups/"+admins.ID, func(w http.ResponseWriter, r *http.Request) {
+		keycloaktest.Error(w, http.StatusConflict, "group changed")
+	})
+	s, _ := keycloaktest.NewService()
+	s.WithDependency("gocloak", kc.Client())
+	body := groupAttrPatch{ShortName: "admins", Patch: map[string]*string{"site": strP("pune")}}
+
+	w := keycloaktest.Do(s, Group_patchAttributes, keycloaktest.NewRequest(http.MethodPatch, "/grouppatchattributes", keycloaktest.Token("acme", "alice"), keycloaktest.Data(body)))
+	resp := keycloaktest.Decode(t, w, nil)
+	if w.Code != http.StatusBadRequest || !reflect.DeepEqual(resp.ErrCodes(), []string{utils.ErrConcurrentUpdate}) {
+		t.Errorf("Group_patchAttributes() = %d %s, want 400 %s", w.Code, w.Body, utils.ErrConcurrentUpdate)
+	}
+	if got := kc.CallCount("PUT /admin/realms/acme/groups/"); got != maxPatchAttempts {
+		t.Errorf("group written %d times, want %d attempts", got, maxPatchAttempts)
+	}
+}
+
+func TestGroupClearAttributes(t *testing.T) {
+	tests := []struct {
+		name      string
+		query     string
+		wantCode  int
+		wantErr   []string
+		wantAttrs map[string][]string
+	}{
+		{"confirmed", "shortName=admins&confirm=true", http.StatusOK, []string{}, map[string][]string{"idshield_longName": {"Admins"}}},
+		{"without confirm", "shortName=admins", http.StatusBadRequest, []string{wscutils.ErrcodeMissing},
+			map[string][]string{"idshield_longName": {"Admins"}, "dept": {"hr"}, "site": {"pune", "delhi"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kc := keycloaktest.NewServer(t)
+			admins := kc.Realm("acme").AddGroup("/admins", map[string][]string{"idshield_longName": {"Admins"}, "dept": {"hr"}, "site": {"pune", "delhi"}})
+			s, _ := keycloaktest.NewService()
+			s.WithDependency("gocloak", kc.Client())
+
+			w := keycloaktest.Do(s, Group_clearAttributes, keycloaktest.NewRequest(http.MethodPost, "/groupclearattributes?"+tt.query, keycloaktest.Token("acme", "alice"), nil))
+			var attrs map[string][]string
+			resp := keycloaktest.Decode(t, w, &utils.MutationResult{Result: &attrs})
+			if w.Code != tt.wantCode || !reflect.DeepEqual(resp.ErrCodes(), tt.wantErr) {
+				t.Fatalf("Group_clearAttributes(%s) = %d %s, want %d %v", tt.query, w.Code, w.Body, tt.wantCode, tt.wantErr)
+			}
+			if !reflect.DeepEqual(admins.Attributes, tt.wantAttrs) {
+				t.Errorf("attributes = %v, want %v", admins.Attributes, tt.wantAttrs)
+			}
+			if tt.wantCode == http.StatusOK && !reflect.DeepEqual(attrs, tt.wantAttrs) {
+				t.Errorf("Group_clearAttributes() returned %v, want %v", attrs, tt.wantAttrs)
+			}
+		})
+	}
+}
+
+func TestGroupAttributesSubgroupPath(t *testing.T) {
+	kc := keycloaktest.NewServer(t)
+	realm := kc.Realm("acme")
+	realm.AddGroup("/parent", map[string][]string{"dept": {"hr"}})
+	child := realm.AddGroup("/parent/child", map[string][]string{"dept": {"payroll"}, "site": {"pune"}})
+	s, _ := keycloaktest.NewService()
+	s.WithDependency("gocloak", kc.Client())
+	token := keycloaktest.Token("acme", "alice")
+
+	for _, path := range []string{"/parent/child", "parent/child"} {
+		w := keycloaktest.Do(s, Group_attributes, keycloaktest.NewRequest(http.MethodGet, "/groupattributes?path="+url.QueryEscape(path), token, nil))
+		var data groupAttributesResponse
+		keycloaktest.Decode(t, w, &data)
+		want := map[string][]string{"dept": {"payroll"}, "site": {"pune"}}
+		if w.Code != http.StatusOK || data.ID == nil || *data.ID != child.ID || data.Attributes == nil || !reflect.DeepEqual(*data.Attributes, want) {
+			t.Errorf("Group_attributes(%s) = %d %s, want the attributes %v of the child", path, w.Code, w.Body, want)
+		}
+	}
+
+	w := keycloaktest.Do(s, Group_attributes, keycloaktest.NewRequest(http.MethodGet, "/groupattributes?path=/parent/missing", token, nil))
+	if w.Code == http.StatusOK {
+		t.Errorf("Group_attributes(/parent/missing) = %d %s, want an error", w.Code, w.Body)
+	}
+}
+
+func TestGroupPathHelpers(t *testing.T) {
+	tests := []struct {
+		path, normalized, escaped string
+	}{
+		{"org/admins", "/org/admins", "/org/admins"},
+		{"/org/admins", "/org/admins", "/org/admins"},
+		{"/org/sales team", "/org/sales team", "/org/sales%20team"},
+		{"/r&d/#1?", "/r&d/#1?", "/r&d/%231%3F"},
+		{"/कार्यालय", "/कार्यालय", "/%E0%A4%95%E0%A4%BE%E0%A4%B0%E0%A5%8D%E0%A4%AF%E0%A4%BE%E0%A4%B2%E0%A4%AF"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			normalized := normalizeGroupPath(tt.path)
+			if normalized != tt.normalized {
+				t.Errorf("normalizeGroupPath(%q) = %q, want %q", tt.path, normalized, tt.normalized)
+			}
+			if got := escapeGroupPath(normalized); got != tt.escaped {
+				t.Errorf("escapeGroupPath(%q) = %q, want %q", normalized, got, tt.escaped)
+			}
+		})
+	}
+}
@@ -0,0 +1,69 @@
+package groupsvc
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/remiges-tech/idshield/utils"
+)
+
+// groupAttrs holds the attributes sent with a group. Keycloak only stores strings, so JSON numbers and
+// booleans are accepted and kept in their JSON text form ("true", "42") instead of failing the request;
+// values that are objects or arrays are rejected
+type groupAttrs map[string]string
+
+func (a *groupAttrs) UnmarshalJSON(data []byte) error {
+	var raw map[string]any
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	// numbers are kept as written, a float64 would turn large ints into exponent notation
+	decoder.UseNumber()
+	if err := decoder.Decode(&raw); err != nil {
+		return err
+	}
+	if raw == nil {
+		*a = nil
+		return nil
+	}
+	attrs := make(groupAttrs, len(raw))
+	for key, value := range raw {
+		switch v := value.(type) {
+		case string:
+			attrs[key] = v
+		case json.Number:
+			attrs[key] = v.String()
+		case bool:
+			attrs[key] = fmt.Sprint(v)
+		default:
+			return fmt.Errorf("attribute %q must be a string, number or boolean", key)
+		}
+	}
+	*a = attrs
+	return nil
+}
+
+// coerceAttrs converts the values of the typed attribute keys to their canonical form in place, see
+// utils.CoerceAttrValue, and returns the sorted keys whose values don't match their type
+func (g *group) coerceAttrs(attrTypes map[string]string) []string {
+	return coerceAttrValues(g.Attributes, attrTypes)
+}
+
+// coerceAttrValues is coerceAttrs for a plain attribute map, such as the values a patch sets
+func coerceAttrValues(attrs map[string]string, attrTypes map[string]string) []string {
+	var invalid []string
+	for key, value := range attrs {
+		kind, ok := attrTypes[key]
+		if !ok {
+			continue
+		}
+		canonical, err := utils.CoerceAttrValue(kind, value)
+		if err != nil {
+			invalid = append(invalid, key)
+			continue
+		}
+		attrs[key] = canonical
+	}
+	sort.Strings(invalid)
+	return invalid
+}
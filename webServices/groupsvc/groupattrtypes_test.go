@@ -0,0 +1,137 @@
+package groupsvc
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/remiges-tech/idshield/internal/keycloaktest"
+	"github.com/remiges-tech/idshield/types"
+	"github.com/remiges-tech/idshield/utils"
+)
+
+func TestGroupAttrsUnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		want    groupAttrs
+		wantErr bool
+	}{
+		{"strings", `{"dept": "hr"}`, groupAttrs{"dept": "hr"}, false},
+		{"number kept as written", `{"n": 12345678901234567890, "f": 1.50}`, groupAttrs{"n": "12345678901234567890", "f": "1.50"}, false},
+		{"bool", `{"active": true}`, groupAttrs{"active": "true"}, false},
+		{"null map", `null`, nil, false},
+		{"object value", `{"dept": {"name": "hr"}}`, nil, true},
+		{"array value", `{"tags": ["a"]}`, nil, true},
+		{"null value", `{"dept": null}`, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got groupAttrs
+			err := json.Unmarshal([]byte(tt.body), &got)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Unmarshal(%s) error = %v, wantErr %v", tt.body, err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Unmarshal(%s) = %v, want %v", tt.body, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCoerceAttrValues(t *testing.T) {
+	attrTypes := map[string]string{"age": utils.AttrTypeInt, "active": utils.AttrTypeBool, "joined": utils.AttrTypeDate}
+	tests := []struct {
+		name        string
+		attrs       map[string]string
+		want        map[string]string
+		wantInvalid []string
+	}{
+		{"untyped left alone", map[string]string{"dept": " hr "}, map[string]string{"dept": " hr "}, nil},
+		{"typed made canonical", map[string]string{"age": "+030", "active": "1", "joined": "2024-01-05T10:00:00Z"},
+			map[string]string{"age": "30", "active": "true", "joined": "2024-01-05"}, nil},
+		{"invalid reported sorted and kept", map[string]string{"joined": "yesterday", "age": "old", "active": "T"},
+			map[string]string{"joined": "yesterday", "age": "old", "active": "true"}, []string{"age", "joined"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			invalid := coerceAttrValues(tt.attrs, attrTypes)
+			if !reflect.DeepEqual(invalid, tt.wantInvalid) {
+				t.Errorf("coerceAttrValues() invalid = %v, want %v", invalid, tt.wantInvalid)
+			}
+			if !reflect.DeepEqual(tt.attrs, tt.want) {
+				t.Errorf("coerceAttrValues() attrs = %v, want %v", tt.attrs, tt.want)
+			}
+		})
+	}
+}
+
+func TestGroupNewTypedAttributes(t *testing.T) {
+	attrTypes := map[string]string{"headcount": utils.AttrTypeInt, "active": utils.AttrTypeBool, "founded": utils.AttrTypeDate, "dept": utils.AttrTypeString}
+	tests := []struct {
+		name      string
+		attr      map[string]any
+		wantErr   []string
+		wantVals  []string
+		wantAttrs map[string][]string
+	}{
+		{"json types made canonical", map[string]any{"headcount": 42, "active": true, "founded": "2019-04-01T09:00:00Z", "dept": "hr"}, nil, nil,
+			map[string][]string{"headcount": {"42"}, "active": {"true"}, "founded": {"2019-04-01"}, "dept": {"hr"}}},
+		{"strings made canonical", map[string]any{"headcount": "+007", "active": "FALSE", "founded": "2019-04-01"}, nil, nil,
+			map[string][]string{"headcount": {"7"}, "active": {"false"}, "founded": {"2019-04-01"}}},
+		{"string type accepts numbers", map[string]any{"dept": 1.5}, nil, nil, map[string][]string{"dept": {"1.5"}}},
+		{"invalid int", map[string]any{"headcount": 4.5}, []string{utils.ErrInvalidAttrValue}, []string{"headcount:int"}, nil},
+		{"invalid bool and date", map[string]any{"active": "yes", "founded": "last year"}, []string{utils.ErrInvalidAttrValue}, []string{"active:bool", "founded:date"}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kc := keycloaktest.NewServer(t)
+			realm := kc.Realm("acme")
+			s, _ := keycloaktest.NewService()
+			s.WithDependency("gocloak", kc.Client()).WithDependency("attrLimits", types.AttrLimits{MaxKeys: 10, MaxSize: 1024, Types: attrTypes})
+			body := map[string]any{"shortName": "admins", "longName": "Admins", "attr": tt.attr}
+
+			w := keycloaktest.Do(s, Group_new, keycloaktest.NewRequest(http.MethodPost, "/groupnew", keycloaktest.Token("acme", "alice"), keycloaktest.Data(body)))
+			resp := keycloaktest.Decode(t, w, nil)
+			if tt.wantErr != nil {
+				if w.Code != http.StatusBadRequest || !reflect.DeepEqual(resp.ErrCodes(), tt.wantErr) || !reflect.DeepEqual(resp.Messages[0].Vals, tt.wantVals) {
+					t.Errorf("Group_new() = %d %s, want 400 %v %v", w.Code, w.Body, tt.wantErr, tt.wantVals)
+				}
+				if realm.Group("/admins") != nil {
+					t.Error("group was created")
+				}
+				return
+			}
+			grp := realm.Group("/admins")
+			if w.Code != http.StatusOK || grp == nil {
+				t.Fatalf("Group_new() = %d %s, want the group created", w.Code, w.Body)
+			}
+			for key, values := range tt.wantAttrs {
+				if !reflect.DeepEqual(grp.Attributes[key], values) {
+					t.Errorf("attribute %s = %v, want %v", key, grp.Attributes[key], values)
+				}
+			}
+		})
+	}
+}
+
+func TestGroupUpdateTypedAttributes(t *testing.T) {
+	kc := keycloaktest.NewServer(t)
+	admins := kc.Realm("acme").AddGroup("/admins", map[string][]string{"longName": {"Admins"}, "headcount": {"3"}})
+	s, _ := keycloaktest.NewService()
+	s.WithDependency("gocloak", kc.Client()).WithDependency("attrLimits", types.AttrLimits{MaxKeys: 10, MaxSize: 1024, Types: map[string]string{"headcount": utils.AttrTypeInt}})
+	token := keycloaktest.Token("acme", "alice")
+
+	update := map[string]any{"shortName": "admins", "longName": "Admins", "attr": map[string]any{"headcount": "three"}}
+	w := keycloaktest.Do(s, Group_update, keycloaktest.NewRequest(http.MethodPost, "/groupupdate", token, keycloaktest.Data(update)))
+	if resp := keycloaktest.Decode(t, w, nil); w.Code != http.StatusBadRequest || !reflect.DeepEqual(resp.ErrCodes(), []string{utils.ErrInvalidAttrValue}) {
+		t.Errorf("Group_update(invalid) = %d %s, want 400 %s", w.Code, w.Body, utils.ErrInvalidAttrValue)
+	}
+
+	update["attr"] = map[string]any{"headcount": 12}
+	w = keycloaktest.Do(s, Group_update, keycloaktest.NewRequest(http.MethodPost, "/groupupdate", token, keycloaktest.Data(update)))
+	if w.Code != http.StatusOK || !reflect.DeepEqual(admins.Attributes["headcount"], []string{"12"}) {
+		t.Errorf("Group_update() = %d %s with headcount %v, want 12", w.Code, w.Body, admins.Attributes["headcount"])
+	}
+}
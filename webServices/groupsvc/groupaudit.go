@@ -0,0 +1,186 @@
+package groupsvc
+
+import (
+	"errors"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Nerzal/gocloak/v13"
+	"github.com/gin-gonic/gin"
+	"github.com/remiges-tech/alya/router"
+	"github.com/remiges-tech/alya/service"
+	"github.com/remiges-tech/alya/wscutils"
+	"github.com/remiges-tech/idshield/types"
+	"github.com/remiges-tech/idshield/utils"
+	"github.com/remiges-tech/logharbour/logharbour"
+)
+
+// membership changes reported by Group_auditMembers, derived from the admin event operation type
+const (
+	auditActionJoined = "joined"
+	auditActionLeft   = "left"
+)
+
+// Keycloak records group membership changes as admin events of this resource type,
+// on the resource path users/{userId}/groups/{groupId}
+const groupMembershipResource = "GROUP_MEMBERSHIP"
+
+// adminEvent holds the fields of Keycloak's AdminEventRepresentation that the membership timeline uses
+type adminEvent struct {
+	Time          int64   `json:"time"`
+	OperationType *string `json:"operationType,omitempty"`
+	ResourcePath  *string `json:"resourcePath,omitempty"`
+	AuthDetails   *struct {
+		UserID *string `json:"userId,omitempty"`
+	} `json:"authDetails,omitempty"`
+}
+
+type membershipEvent struct {
+	Time   time.Time `json:"time"`
+	Action string    `json:"action"`
+	UserID string    `json:"userId"`
+	// ActorID is the id of the user who made the change, as recorded by Keycloak
+	ActorID *string `json:"actorId,omitempty"`
+}
+
+// Group_auditMembers handles the GET /groupauditmembers request, it returns the timeline of users joining and
+// leaving a group, newest first, as recorded in the realm's admin events. Realms that don't record admin
+// events get events_not_enabled rather than an empty timeline
+func Group_auditMembers(c *gin.Context, s *service.Service) {
+	l := utils.RequestLogger(c, s, "Group_auditMembers")
+	l.Log("Starting execution of Group_auditMembers()")
+	token, err := router.ExtractToken(c.GetHeader("Authorization"))
+	if err != nil {
+		l.Debug0().LogDebug("Missing or incorrect Authorization header format:", logharbour.DebugInfo{Variables: map[string]any{"error": err}})
+		wscutils.SendErrorResponse(c, wscutils.NewErrorResponse(utils.ErrTokenMissing))
+		return
+	}
+	r, err := utils.ExtractClaimFromJwt(token, "iss")
+	if err != nil {
+		l.Debug0().LogDebug("Missing or incorrect realm:", logharbour.DebugInfo{Variables: map[string]any{"error": err}})
+		wscutils.SendErrorResponse(c, wscutils.NewErrorResponse(utils.ErrRealmNotFound))
+		return
+	}
+	parts := strings.Split(r, "/realms/")
+	if len(parts) != 2 {
+		l.Debug0().LogDebug("Missing or incorrect realm:", logharbour.DebugInfo{Variables: map[string]any{"iss": r}})
+		wscutils.SendErrorResponse(c, wscutils.NewErrorResponse(utils.ErrRealmNotFound))
+		return
+	}
+	realm := utils.CanonicalRealm(c, s, token, parts[1])
+	l = utils.WithRealm(l, realm)
+	username, err := utils.ExtractClaimFromJwt(token, "preferred_username")
+	if err != nil {
+		l.Debug0().LogDebug("Missing username:", logharbour.DebugInfo{Variables: map[string]any{"error": err}})
+		wscutils.SendErrorResponse(c, wscutils.NewErrorResponse(utils.ErrUserNotFound))
+		return
+	}
+
+	isCapable, _ := utils.Authz_check(types.OpReq{
+		User:      username,
+		CapNeeded: []string{utils.CapGroupAudit},
+	}, false)
+
+	if !isCapable {
+		l.Log("Unauthorized user:")
+		wscutils.SendErrorResponse(c, wscutils.NewErrorResponse(utils.ErrUnauthorized))
+		return
+	}
+
+	shortName := c.Query("shortName")
+	if shortName == "" {
+		l.Log("shortName missing")
+		wscutils.SendErrorResponse(c, wscutils.NewResponse(wscutils.ErrorStatus, nil, []wscutils.ErrorMessage{wscutils.BuildErrorMessage(wscutils.ErrcodeMissing, nil, "shortName")}))
+		return
+	}
+	first, max, err := utils.GetPagingParams(c)
+	if err != nil {
+		l.Debug0().LogDebug("Invalid paging params:", logharbour.DebugInfo{Variables: map[string]any{"error": err}})
+		wscutils.SendErrorResponse(c, wscutils.NewErrorResponse(utils.ErrInvalidParam))
+		return
+	}
+	max = utils.GetRealmConfig(c, s, token, realm).CapMax(max)
+
+	// Extracting the GoCloak client from the service dependencies
+	gcClient, ok := s.Dependencies["gocloak"].(*gocloak.GoCloak)
+	if !ok {
+		l.Log("Failed to load the dependency to *gocloak.GoCloak")
+		wscutils.SendErrorResponse(c, wscutils.NewErrorResponse(utils.ErrFailedToLoadDependence))
+		return
+	}
+
+	realmRep, err := gcClient.GetRealm(c, token, realm)
+	if err != nil {
+		utils.GocloakErrorHandler(c, l, err)
+		return
+	}
+	if realmRep.AdminEventsEnabled == nil || !*realmRep.AdminEventsEnabled {
+		l.Log("Admin events are not enabled for the realm")
+		wscutils.SendErrorResponse(c, wscutils.NewErrorResponse(utils.ErrEventsNotEnabled))
+		return
+	}
+
+	grp, err := utils.GetGroupByExactName(c, gcClient, token, realm, shortName)
+	if errors.Is(err, utils.ErrGroupNotFound) {
+		l.Log("Error while gcClient.GetGroups Group doesn't exist ")
+		str := "shortName"
+		wscutils.SendErrorResponse(c, utils.NotFound(utils.ResourceGroup, shortName, wscutils.BuildErrorMessage(utils.ErrNotExist, &str)))
+		return
+	}
+	if err != nil {
+		utils.GocloakErrorHandler(c, l, err)
+		return
+	}
+
+	// gocloak has no admin events call, so the endpoint is queried directly
+	var events []*adminEvent
+	err = utils.AdminGet(c, s, token, realm, url.Values{
+		"resourceTypes": {groupMembershipResource},
+		"resourcePath":  {"users/*/groups/" + *grp.ID},
+		"first":         {strconv.Itoa(first)},
+		"max":           {strconv.Itoa(max)},
+	}, &events, "admin-events")
+	if err != nil {
+		utils.GocloakErrorHandler(c, l, err)
+		return
+	}
+
+	timeline := []membershipEvent{}
+	for _, event := range events {
+		if ev, ok := toMembershipEvent(event); ok {
+			timeline = append(timeline, ev)
+		}
+	}
+
+	utils.SendSuccess(c, opGroupAuditMembers, wscutils.NewSuccessResponse(map[string]any{"id": grp.ID, "shortName": shortName, "events": timeline, "first": first, "max": max}))
+
+	l.Log("Finished execution of Group_auditMembers()")
+}
+
+// toMembershipEvent converts a GROUP_MEMBERSHIP admin event into a timeline entry, events that aren't a join
+// or a leave, or whose resource path doesn't name a user, are skipped
+func toMembershipEvent(event *adminEvent) (membershipEvent, bool) {
+	if event.OperationType == nil || event.ResourcePath == nil {
+		return membershipEvent{}, false
+	}
+	ev := membershipEvent{Time: time.UnixMilli(event.Time).UTC()}
+	switch *event.OperationType {
+	case "CREATE":
+		ev.Action = auditActionJoined
+	case "DELETE":
+		ev.Action = auditActionLeft
+	default:
+		return membershipEvent{}, false
+	}
+	path := strings.Split(*event.ResourcePath, "/")
+	if len(path) < 2 || path[0] != "users" {
+		return membershipEvent{}, false
+	}
+	ev.UserID = path[1]
+	if event.AuthDetails != nil {
+		ev.ActorID = event.AuthDetails.UserID
+	}
+	return ev, true
+}
@@ -0,0 +1,68 @@
+package groupsvc
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"reflect"
+	"testing"
+
+	"github.com/remiges-tech/idshield/internal/keycloaktest"
+	"github.com/remiges-tech/idshield/utils"
+)
+
+// realmWithEvents answers the realm representation request with admin events switched on or off
+func realmWithEvents(enabled bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{"realm": "acme", "adminEventsEnabled": enabled})
+	}
+}
+
+func TestGroupAuditMembers(t *testing.T) {
+	kc := keycloaktest.NewServer(t)
+	admins := kc.Realm("acme").AddGroup("/admins", nil)
+	kc.Handle(http.MethodGet, "/admin/realms/acme", realmWithEvents(true))
+	var query url.Values
+	kc.Handle(http.MethodGet, "/admin/realms/acme/admin-events", func(w http.ResponseWriter, r *http.Request) {
+		query = r.URL.Query()
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode([]map[string]any{
+			{"time": 1700000300000, "operationType": "DELETE", "resourcePath": "users/u-bob/groups/" + admins.ID, "authDetails": map[string]any{"userId": "u-root"}},
+			{"time": 1700000200000, "operationType": "UPDATE", "resourcePath": "users/u-bob/groups/" + admins.ID},
+			{"time": 1700000100000, "operationType": "CREATE", "resourcePath": "users/u-bob/groups/" + admins.ID, "authDetails": map[string]any{"userId": "u-root"}},
+		})
+	})
+	s, _ := keycloaktest.NewService()
+	s.WithDependency("gocloak", kc.Client()).WithDependency("keycloakURL", kc.URL)
+
+	w := keycloaktest.Do(s, Group_auditMembers, keycloaktest.NewRequest(http.MethodGet, "/groupauditmembers?shortName=admins", keycloaktest.Token("acme", "alice"), nil))
+	var data struct {
+		Events []membershipEvent `json:"events"`
+	}
+	keycloaktest.Decode(t, w, &data)
+	got := []string{}
+	for _, ev := range data.Events {
+		got = append(got, ev.Action+":"+ev.UserID+":"+*ev.ActorID)
+	}
+	if want := []string{"left:u-bob:u-root", "joined:u-bob:u-root"}; w.Code != http.StatusOK || !reflect.DeepEqual(got, want) {
+		t.Errorf("Group_auditMembers() = %d %v, want %v", w.Code, got, want)
+	}
+	if query.Get("resourcePath") != "users/*/groups/"+admins.ID || query.Get("resourceTypes") != groupMembershipResource {
+		t.Errorf("admin events query = %v, want the group's membership events", query)
+	}
+}
+
+func TestGroupAuditMembersEventsNotEnabled(t *testing.T) {
+	kc := keycloaktest.NewServer(t)
+	kc.Realm("acme").AddGroup("/admins", nil)
+	kc.Handle(http.MethodGet, "/admin/realms/acme", realmWithEvents(false))
+	s, _ := keycloaktest.NewService()
+	s.WithDependency("gocloak", kc.Client()).WithDependency("keycloakURL", kc.URL)
+
+	w := keycloaktest.Do(s, Group_auditMembers, keycloaktest.NewRequest(http.MethodGet, "/groupauditmembers?shortName=admins", keycloaktest.Token("acme", "alice"), nil))
+	resp := keycloaktest.Decode(t, w, nil)
+	if w.Code != http.StatusBadRequest || !reflect.DeepEqual(resp.ErrCodes(), []string{utils.ErrEventsNotEnabled}) {
+		t.Errorf("Group_auditMembers() = %d %s, want 400 %s", w.Code, w.Body, utils.ErrEventsNotEnabled)
+	}
+}
@@ -0,0 +1,99 @@
+package groupsvc
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"github.com/remiges-tech/alya/service"
+	"github.com/remiges-tech/alya/wscutils"
+	"github.com/remiges-tech/idshield/utils"
+	"github.com/remiges-tech/logharbour/logharbour"
+)
+
+// limits of Group_batchGet: how many ids one request may ask for and how many are fetched at once
+const (
+	maxBatchGet         = 100
+	batchGetConcurrency = 8
+)
+
+// per-id outcomes reported by Group_batchGet
+const (
+	batchStatusFound    = "found"
+	batchStatusNotFound = "not_found"
+	batchStatusError    = "error"
+)
+
+type batchGetRequest struct {
+	IDs []string `json:"ids" validate:"required,min=1"`
+}
+
+type batchGetResult struct {
+	ID     string         `json:"id"`
+	Status string         `json:"status"`
+	Group  *groupResponse `json:"group,omitempty"`
+	Error  string         `json:"error,omitempty"`
+}
+
+// Group_batchGet handles the POST /groupbatchget request, it returns the groups with the given ids in one
+// round trip, in the order they were asked for, marking the ids no group has as not_found. Member counts
+// are not computed, Group_get returns them for a single group
+func Group_batchGet(c *gin.Context, s *service.Service) {
+	utils.Handler("Group_batchGet", []string{utils.CapGroupRead}, groupBatchGet)(c, s)
+}
+
+// groupBatchGet is the business logic of Group_batchGet, utils.Handler has done the token, realm and authz checks
+func groupBatchGet(ctx utils.HandlerContext) {
+	c, l := ctx.Gin, ctx.Logger
+
+	var req batchGetRequest
+	if !utils.RequireJSON(c) {
+		l.Log("Unsupported content type")
+		return
+	}
+	if err := wscutils.BindJSON(c, &req); err != nil {
+		l.LogActivity("Error Unmarshalling JSON to struct:", logharbour.DebugInfo{Variables: map[string]any{"Error": err.Error()}})
+		return
+	}
+	if len(req.IDs) == 0 {
+		l.Log("ids missing")
+		wscutils.SendErrorResponse(c, wscutils.NewResponse(wscutils.ErrorStatus, nil, []wscutils.ErrorMessage{wscutils.BuildErrorMessage(wscutils.ErrcodeMissing, nil, "ids")}))
+		return
+	}
+	if len(req.IDs) > maxBatchGet {
+		l.Log("too many ids")
+		str := "ids"
+		wscutils.SendErrorResponse(c, wscutils.NewResponse(wscutils.ErrorStatus, nil, []wscutils.ErrorMessage{wscutils.BuildErrorMessage(utils.ErrInvalidParam, &str, strconv.Itoa(maxBatchGet))}))
+		return
+	}
+
+	briefSubGroups := c.Query("briefSubGroups") == "true"
+	results := make([]batchGetResult, len(req.IDs))
+	slots := make(chan struct{}, batchGetConcurrency)
+	var wg sync.WaitGroup
+	for i, id := range req.IDs {
+		wg.Add(1)
+		slots <- struct{}{}
+		go func(i int, id string) {
+			defer wg.Done()
+			defer func() { <-slots }()
+			result := batchGetResult{ID: id}
+			grp, err := ctx.Client.GetGroup(c, ctx.Token, ctx.Realm, id)
+			switch {
+			case err != nil && strings.HasPrefix(err.Error(), "404"):
+				result.Status = batchStatusNotFound
+			case err != nil:
+				result.Status = batchStatusError
+				result.Error = err.Error()
+			default:
+				grpResp := toGroupResponse(ctx.Service, grp, briefSubGroups)
+				result.Status, result.Group = batchStatusFound, &grpResp
+			}
+			results[i] = result
+		}(i, id)
+	}
+	wg.Wait()
+
+	utils.SendSuccess(c, opGroupBatchGet, wscutils.NewSuccessResponse(map[string]any{"results": results}))
+}
@@ -0,0 +1,80 @@
+package groupsvc
+
+import (
+	"net/http"
+	"reflect"
+	"strconv"
+	"testing"
+
+	"github.com/Nerzal/gocloak/v13"
+	"github.com/remiges-tech/alya/wscutils"
+	"github.com/remiges-tech/idshield/internal/keycloaktest"
+	"github.com/remiges-tech/idshield/utils"
+)
+
+func TestGroupBatchGet(t *testing.T) {
+	kc := keycloaktest.NewServer(t)
+	realm := kc.Realm("acme")
+	admins := realm.AddGroup("/admins", map[string][]string{"dept": {"hr"}})
+	ops := realm.AddGroup("/ops", nil)
+	broken := realm.AddGroup("/broken", nil)
+	kc.Handle(http.MethodGet, "/admin/realms/acme/groups/"+broken.ID, func(w http.ResponseWriter, r *http.Request) {
+		keycloaktest.Error(w, http.StatusInternalServerError, "unavailable")
+	})
+	s, _ := keycloaktest.NewService()
+	s.WithDependency("gocloak", kc.Client())
+	body := batchGetRequest{IDs: []string{ops.ID, "missing", admins.ID, broken.ID}}
+
+	w := keycloaktest.Do(s, Group_batchGet, keycloaktest.NewRequest(http.MethodPost, "/groupbatchget", keycloaktest.Token("acme", "alice"), keycloaktest.Data(body)))
+	var data struct {
+		Results []batchGetResult `json:"results"`
+	}
+	keycloaktest.Decode(t, w, &data)
+	if w.Code != http.StatusOK || len(data.Results) != len(body.IDs) {
+		t.Fatalf("Group_batchGet() = %d %s, want a result per id", w.Code, w.Body)
+	}
+	// results come back in the order the ids were asked for
+	wantStatus := []string{batchStatusFound, batchStatusNotFound, batchStatusFound, batchStatusError}
+	for i, result := range data.Results {
+		if result.ID != body.IDs[i] || result.Status != wantStatus[i] {
+			t.Errorf("result %d = %s %s, want %s %s", i, result.ID, result.Status, body.IDs[i], wantStatus[i])
+		}
+	}
+	if grp := data.Results[2].Group; grp == nil || gocloak.PString(grp.Name) != "admins" || grp.Attributes == nil || !reflect.DeepEqual((*grp.Attributes)["dept"], []string{"hr"}) {
+		t.Errorf("admins = %+v, want its name and attributes", grp)
+	}
+	if data.Results[1].Group != nil || data.Results[3].Error == "" {
+		t.Errorf("missing = %+v, broken = %+v, want no group and an error", data.Results[1], data.Results[3])
+	}
+}
+
+func TestGroupBatchGetInvalid(t *testing.T) {
+	tooMany := make([]string, maxBatchGet+1)
+	for i := range tooMany {
+		tooMany[i] = strconv.Itoa(i)
+	}
+	tests := []struct {
+		name    string
+		ids     []string
+		wantErr string
+	}{
+		{"no ids", []string{}, wscutils.ErrcodeMissing},
+		{"too many ids", tooMany, utils.ErrInvalidParam},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kc := keycloaktest.NewServer(t)
+			s, _ := keycloaktest.NewService()
+			s.WithDependency("gocloak", kc.Client())
+
+			w := keycloaktest.Do(s, Group_batchGet, keycloaktest.NewRequest(http.MethodPost, "/groupbatchget", keycloaktest.Token("acme", "alice"), keycloaktest.Data(batchGetRequest{IDs: tt.ids})))
+			resp := keycloaktest.Decode(t, w, nil)
+			if w.Code != http.StatusBadRequest || !reflect.DeepEqual(resp.ErrCodes(), []string{tt.wantErr}) {
+				t.Errorf("Group_batchGet() = %d %v, want 400 %s", w.Code, resp.ErrCodes(), tt.wantErr)
+			}
+			if got := kc.CallCount("GET /admin/realms/acme/groups"); got != 0 {
+				t.Errorf("%d groups fetched, want none", got)
+			}
+		})
+	}
+}
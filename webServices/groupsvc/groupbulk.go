@@ -0,0 +1,208 @@
+package groupsvc
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/Nerzal/gocloak/v13"
+	"github.com/gin-gonic/gin"
+	"github.com/remiges-tech/alya/router"
+	"github.com/remiges-tech/alya/service"
+	"github.com/remiges-tech/alya/wscutils"
+	"github.com/remiges-tech/idshield/types"
+	"github.com/remiges-tech/idshield/utils"
+	"github.com/remiges-tech/logharbour/logharbour"
+)
+
+// per-item outcomes reported by the bulk group endpoints
+const (
+	bulkStatusDeleted  = "deleted"
+	bulkStatusNotFound = "not_found"
+	bulkStatusError    = "error"
+	// the caller's token expired before the item was attempted and couldn't be refreshed
+	bulkStatusTokenExpired = "token_expired"
+	// the group is protected and was left alone
+	bulkStatusProtected = "protected"
+)
+
+type groupBulkDeleteRequest struct {
+	ShortNames []string `json:"shortNames" validate:"required,min=1"`
+	// RefreshToken is optional, when given an access token that expires part way through is refreshed once
+	RefreshToken string `json:"refreshToken,omitempty"`
+}
+
+type bulkResult struct {
+	ShortName string `json:"shortName"`
+	Status    string `json:"status"`
+	Error     string `json:"error,omitempty"`
+}
+
+// Group_bulkDelete handles the POST /groupbulkdelete request, it deletes every named group on a best-effort basis
+// and reports the outcome for each name
+func Group_bulkDelete(c *gin.Context, s *service.Service) {
+	l := utils.RequestLogger(c, s, "Group_bulkDelete")
+	l.Log("Starting execution of Group_bulkDelete()")
+	token, err := router.ExtractToken(c.GetHeader("Authorization"))
+	if err != nil {
+		l.Debug0().LogDebug("Missing or incorrect Authorization header format:", logharbour.DebugInfo{Variables: map[string]any{"error": err}})
+		wscutils.SendErrorResponse(c, wscutils.NewErrorResponse(utils.ErrTokenMissing))
+		return
+	}
+	r, err := utils.ExtractClaimFromJwt(token, "iss")
+	if err != nil {
+		l.Debug0().LogDebug("Missing or incorrect realm:", logharbour.DebugInfo{Variables: map[string]any{"error": err}})
+		wscutils.SendErrorResponse(c, wscutils.NewErrorResponse(utils.ErrRealmNotFound))
+		return
+	}
+	parts := strings.Split(r, "/realms/")
+	if len(parts) != 2 {
+		l.Debug0().LogDebug("Missing or incorrect realm:", logharbour.DebugInfo{Variables: map[string]any{"iss": r}})
+		wscutils.SendErrorResponse(c, wscutils.NewErrorResponse(utils.ErrRealmNotFound))
+		return
+	}
+	realm := utils.CanonicalRealm(c, s, token, parts[1])
+	l = utils.WithRealm(l, realm)
+	username, err := utils.ExtractClaimFromJwt(token, "preferred_username")
+	if err != nil {
+		l.Debug0().LogDebug("Missing username:", logharbour.DebugInfo{Variables: map[string]any{"error": err}})
+		wscutils.SendErrorResponse(c, wscutils.NewErrorResponse(utils.ErrUserNotFound))
+		return
+	}
+
+	isCapable, _ := utils.Authz_check(types.OpReq{
+		User:      username,
+		CapNeeded: []string{utils.CapGroupDelete},
+	}, false)
+
+	if !isCapable {
+		l.Log("Unauthorized user:")
+		wscutils.SendErrorResponse(c, wscutils.NewErrorResponse(utils.ErrUnauthorized))
+		return
+	}
+
+	var req groupBulkDeleteRequest
+	if !utils.RequireJSON(c) {
+		l.Log("Unsupported content type")
+		return
+	}
+	if err = wscutils.BindJSON(c, &req); err != nil {
+		l.LogActivity("Error Unmarshalling JSON to struct:", logharbour.DebugInfo{Variables: map[string]any{"Error": err.Error()}})
+		return
+	}
+	if len(req.ShortNames) == 0 {
+		l.Log("shortNames missing")
+		wscutils.SendErrorResponse(c, wscutils.NewResponse(wscutils.ErrorStatus, nil, []wscutils.ErrorMessage{wscutils.BuildErrorMessage(wscutils.ErrcodeMissing, nil, "shortNames")}))
+		return
+	}
+
+	// Extracting the GoCloak client from the service dependencies
+	gcClient, ok := s.Dependencies["gocloak"].(*gocloak.GoCloak)
+	if !ok {
+		l.Log("Failed to load the dependency to *gocloak.GoCloak")
+		wscutils.SendErrorResponse(c, wscutils.NewErrorResponse(utils.ErrFailedToLoadDependence))
+		return
+	}
+
+	// names are resolved up front, while the caller's token is still fresh
+	groupIDs, _, err := utils.ResolveGroupIDs(c, s, token, realm, req.ShortNames)
+	if err != nil {
+		utils.GocloakErrorHandler(c, l, err)
+		return
+	}
+
+	results := []bulkResult{}
+	refreshed, expired := false, false
+	for _, shortName := range req.ShortNames {
+		result := bulkResult{ShortName: shortName}
+		if expired {
+			result.Status = bulkStatusTokenExpired
+			results = append(results, result)
+			continue
+		}
+		groupID, ok := groupIDs[shortName]
+		if !ok {
+			result.Status = bulkStatusNotFound
+			results = append(results, result)
+			continue
+		}
+		status, err := bulkDeleteGroup(c, s, gcClient, token, realm, groupID)
+		if err != nil && isTokenExpired(err) {
+			if req.RefreshToken == "" || refreshed {
+				l.Log("Token expired during bulk delete")
+				expired = true
+				result.Status = bulkStatusTokenExpired
+				results = append(results, result)
+				continue
+			}
+			refreshed = true
+			newToken, rerr := refreshAccessToken(c, s, gcClient, req.RefreshToken, realm)
+			if rerr != nil {
+				l.Debug0().LogDebug("Token refresh failed:", logharbour.DebugInfo{Variables: map[string]any{"error": rerr}})
+				expired = true
+				result.Status, result.Error = bulkStatusTokenExpired, rerr.Error()
+				results = append(results, result)
+				continue
+			}
+			l.Log("Token refreshed during bulk delete")
+			token = newToken
+			status, err = bulkDeleteGroup(c, s, gcClient, token, realm, groupID)
+		}
+		switch {
+		case err != nil:
+			result.Status, result.Error = bulkStatusError, err.Error()
+		case status == bulkStatusProtected:
+			l.Log("Protected group left out of bulk delete")
+			result.Status = status
+		default:
+			l.LogActivity("Group deleted:", map[string]any{"shortName": shortName, "id": groupID})
+			emitGroupEvent(s, utils.EventGroupDeleted, realm, groupID, username)
+			result.Status = status
+		}
+		results = append(results, result)
+	}
+
+	utils.SendSuccess(c, opGroupBulkDelete, utils.NewMutationResponse(map[string]any{"results": results}, username))
+
+	l.Log("Finished execution of Group_bulkDelete()")
+}
+
+// isTokenExpired reports whether Keycloak rejected the call because the access token is no longer valid
+func isTokenExpired(err error) bool {
+	return strings.Contains(err.Error(), utils.ErrHTTPUnauthorized)
+}
+
+// bulkDeleteGroup deletes the group unless it or one of its descendants is protected, returning
+// bulkStatusDeleted or bulkStatusProtected. The protection check fails closed: if a group can't be read nothing
+// is deleted and the error is returned, which also lets an expired token be refreshed and the whole check repeated
+func bulkDeleteGroup(c *gin.Context, s *service.Service, gcClient *gocloak.GoCloak, token, realm, groupID string) (string, error) {
+	protected, err := protectedInSubtree(c, s, gcClient, token, realm, groupID)
+	if err != nil {
+		return "", err
+	}
+	if protected != "" {
+		return bulkStatusProtected, nil
+	}
+	if err = gcClient.DeleteGroup(c, token, realm, groupID); err != nil {
+		return "", err
+	}
+	return bulkStatusDeleted, nil
+}
+
+// errRefreshNotConfigured is returned when an expired token can't be refreshed because the confidential
+// client's credentials aren't configured
+var errRefreshNotConfigured = errors.New("token refresh needs keycloak_client_id and keycloak_client_secret to be configured")
+
+// refreshAccessToken exchanges refreshToken for a new access token using the configured client, which is
+// the client idshield's tokens are issued to, and its secret
+func refreshAccessToken(c *gin.Context, s *service.Service, gcClient *gocloak.GoCloak, refreshToken, realm string) (string, error) {
+	clientID, _ := s.Dependencies["keycloakClientID"].(string)
+	secret, _ := s.Dependencies["keycloakClientSecret"].(string)
+	if clientID == "" || secret == "" {
+		return "", errRefreshNotConfigured
+	}
+	jwt, err := gcClient.RefreshToken(c, refreshToken, clientID, secret, realm)
+	if err != nil {
+		return "", err
+	}
+	return jwt.AccessToken, nil
+}
@@ -0,0 +1,100 @@
+package groupsvc
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/remiges-tech/idshield/internal/keycloaktest"
+	"github.com/remiges-tech/idshield/utils"
+)
+
+func TestGroupBulkDelete(t *testing.T) {
+	kc := keycloaktest.NewServer(t)
+	realm := kc.Realm("acme")
+	realm.AddGroup("/admins", nil)
+	realm.AddGroup("/admins-eu", nil)
+	locked := realm.AddGroup("/auditors", nil)
+	kc.Handle(http.MethodDelete, "/admin/realms/acme/groups/"+locked.ID, func(w http.ResponseWriter, r *http.Request) {
+		keycloaktest.Error(w, http.StatusInternalServerError, "unknown_error")
+	})
+	s, _ := keycloaktest.NewService()
+	s.WithDependency("gocloak", kc.Client()).WithDependency("keycloakURL", kc.URL)
+	body := groupBulkDeleteRequest{ShortNames: []string{"admins", "admin", "auditors"}}
+
+	w := keycloaktest.Do(s, Group_bulkDelete, keycloaktest.NewRequest(http.MethodPost, "/groupbulkdelete", keycloaktest.Token("acme", "alice"), keycloaktest.Data(body)))
+	var data struct {
+		Results []bulkResult `json:"results"`
+	}
+	keycloaktest.Decode(t, w, &utils.MutationResult{Result: &data})
+	got := map[string]string{}
+	for _, result := range data.Results {
+		got[result.ShortName] = result.Status
+	}
+	want := map[string]string{"admins": bulkStatusDeleted, "admin": bulkStatusNotFound, "auditors": bulkStatusError}
+	if w.Code != http.StatusOK || !reflect.DeepEqual(got, want) {
+		t.Errorf("Group_bulkDelete() = %d %v, want %v", w.Code, got, want)
+	}
+	if realm.Group("/admins") != nil || realm.Group("/admins-eu") == nil || realm.Group("/auditors") == nil {
+		t.Errorf("Group_bulkDelete() deleted the wrong groups")
+	}
+}
+
+func TestGroupBulkDeleteTokenRefresh(t *testing.T) {
+	tests := []struct {
+		name     string
+		secret   string
+		want     map[string]string
+		wantErr  string
+		wantLeft []string
+	}{
+		{"refreshed", "s3cret", map[string]string{"admins": bulkStatusDeleted, "auditors": bulkStatusDeleted}, "", nil},
+		{"secret not configured", "", map[string]string{"admins": bulkStatusTokenExpired, "auditors": bulkStatusTokenExpired},
+			errRefreshNotConfigured.Error(), []string{"/admins", "/auditors"}},
+		{"wrong secret", "guess", map[string]string{"admins": bulkStatusTokenExpired, "auditors": bulkStatusTokenExpired},
+			"", []string{"/admins", "/auditors"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kc := keycloaktest.NewServer(t)
+			realm := kc.Realm("acme")
+			realm.AddClient("idshield").Secret = "s3cret"
+			expired := keycloaktest.Token("acme", "alice")
+			// the names are resolved while the token is fresh, it expires before the first delete and the
+			// refreshed one is accepted
+			for _, grp := range []*keycloaktest.Group{realm.AddGroup("/admins", nil), realm.AddGroup("/auditors", nil)} {
+				kc.Handle(http.MethodDelete, "/admin/realms/acme/groups/"+grp.ID, func(w http.ResponseWriter, r *http.Request) {
+					if r.Header.Get("Authorization") == "Bearer "+expired {
+						keycloaktest.Error(w, http.StatusUnauthorized, "HTTP 401 Unauthorized")
+						return
+					}
+					kc.Fake(w, r)
+				})
+			}
+			s, _ := keycloaktest.NewService()
+			s.WithDependency("gocloak", kc.Client()).WithDependency("keycloakURL", kc.URL).WithDependency("keycloakClientID", "idshield").WithDependency("keycloakClientSecret", tt.secret)
+			body := groupBulkDeleteRequest{ShortNames: []string{"admins", "auditors"}, RefreshToken: "refresh-acme"}
+
+			w := keycloaktest.Do(s, Group_bulkDelete, keycloaktest.NewRequest(http.MethodPost, "/groupbulkdelete", expired, keycloaktest.Data(body)))
+			var data struct {
+				Results []bulkResult `json:"results"`
+			}
+			keycloaktest.Decode(t, w, &utils.MutationResult{Result: &data})
+			got := map[string]string{}
+			for _, result := range data.Results {
+				got[result.ShortName] = result.Status
+			}
+			if w.Code != http.StatusOK || !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("Group_bulkDelete() = %d %v, want %v", w.Code, got, tt.want)
+			}
+			if tt.wantErr != "" && data.Results[0].Error != tt.wantErr {
+				t.Errorf("Group_bulkDelete() error = %q, want %q", data.Results[0].Error, tt.wantErr)
+			}
+			for _, path := range tt.wantLeft {
+				if realm.Group(path) == nil {
+					t.Errorf("Group_bulkDelete() deleted %s with an expired token", path)
+				}
+			}
+		})
+	}
+}
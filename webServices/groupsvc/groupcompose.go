@@ -0,0 +1,237 @@
+package groupsvc
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/Nerzal/gocloak/v13"
+	"github.com/gin-gonic/gin"
+	"github.com/remiges-tech/alya/service"
+	"github.com/remiges-tech/alya/wscutils"
+	"github.com/remiges-tech/idshield/utils"
+	"github.com/remiges-tech/logharbour/logharbour"
+)
+
+// statusPartiallyCreated is returned when the group exists but some of its follow-up configuration failed
+const statusPartiallyCreated = "partially_created"
+
+type groupWithRoles struct {
+	group
+	RealmRoles []string `json:"realmRoles"`
+	// Rollback deletes the group when a post-create step fails, instead of leaving it partially configured
+	Rollback bool `json:"rollback"`
+}
+
+// outcomes of the individual steps reported by the composite group endpoints
+const (
+	stepStatusOK     = "ok"
+	stepStatusFailed = "failed"
+	// the user named in a member step already belonged to the group
+	stepStatusAlreadyMember = "already_member"
+)
+
+type stepResult struct {
+	Step   string `json:"step"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+type failedStep struct {
+	Step  string `json:"step"`
+	Error string `json:"error"`
+}
+
+type partialCreateResponse struct {
+	ID          string       `json:"id"`
+	FailedSteps []failedStep `json:"failedSteps"`
+}
+
+// Group_newWithRoles handles the POST /groupnewwithroles request, it creates a group and assigns it realm roles.
+// When a role assignment fails after the group was created, the group is either rolled back (rollback=true) or
+// reported as partially_created with its id and the failed steps so the caller can retry them
+func Group_newWithRoles(c *gin.Context, s *service.Service) {
+	utils.Handler("Group_newWithRoles", []string{utils.CapGroupCreate}, groupNewWithRoles)(c, s)
+}
+
+// groupNewWithRoles is the business logic of Group_newWithRoles, utils.Handler has done the token, realm and authz checks
+func groupNewWithRoles(ctx utils.HandlerContext) {
+	c, s, l := ctx.Gin, ctx.Service, ctx.Logger
+	token, realm, username, gcClient := ctx.Token, ctx.Realm, ctx.Username, ctx.Client
+
+	var g groupWithRoles
+
+	if !utils.RequireJSON(c) {
+		l.Log("Unsupported content type")
+		return
+	}
+	if !utils.LimitRequestBody(c, getMaxRequestBody(s)) {
+		l.Log("Request body too large")
+		return
+	}
+	if err := utils.BindJSONStrict(c, &g); err != nil {
+		l.LogActivity("Error Unmarshalling JSON to struct:", logharbour.DebugInfo{Variables: map[string]any{"Error": err.Error()}})
+		return
+	}
+	l.Debug0().LogDebug("Group_newWithRoles request:", logharbour.DebugInfo{Variables: map[string]any{"shortName": g.ShortName, "longName": g.LongName, "attr": utils.MaskAttributes(g.Attributes, getSensitiveAttrs(s)), "realmRoles": g.RealmRoles}})
+
+	if !prepareNewGroup(ctx, &g.group) {
+		return
+	}
+
+	attr := g.keycloakAttributes(s)
+	applyCreateDefaults(c, s, token, realm, attr, username)
+	ID, err := gcClient.CreateGroup(c, token, realm, gocloak.Group{
+		Name:       &g.ShortName,
+		Attributes: &attr,
+	})
+	if err != nil {
+		utils.GocloakErrorHandler(c, l, err)
+		return
+	}
+
+	failed := failedSteps(assignRealmRoles(c, gcClient, token, realm, ID, g.RealmRoles))
+	if len(failed) == 0 {
+		utils.SendSuccess(c, opGroupCreateWithRoles, utils.NewMutationResponse(ID, username))
+		emitGroupEvent(s, utils.EventGroupCreated, realm, ID, username)
+		return
+	}
+	l.LogActivity("Post-create steps failed:", map[string]any{"id": ID, "failedSteps": failed})
+
+	if g.Rollback {
+		err := gcClient.DeleteGroup(c, token, realm, ID)
+		if err == nil {
+			l.LogActivity("Group creation rolled back:", map[string]any{"id": ID})
+			steps := make([]string, 0, len(failed))
+			for _, step := range failed {
+				steps = append(steps, step.Step)
+			}
+			str := "realmRoles"
+			wscutils.SendErrorResponse(c, wscutils.NewResponse(wscutils.ErrorStatus, nil, []wscutils.ErrorMessage{wscutils.BuildErrorMessage(utils.ErrGroupCreateRolledBack, &str, steps...)}))
+			return
+		}
+		// the group could not be removed, so the caller has to know it exists
+		failed = append(failed, failedStep{Step: "rollback", Error: err.Error()})
+	}
+
+	utils.SendSuccess(c, opGroupCreateWithRoles, &wscutils.Response{Status: statusPartiallyCreated, Data: partialCreateResponse{ID: ID, FailedSteps: failed}, Messages: []wscutils.ErrorMessage{}})
+	emitGroupEvent(s, utils.EventGroupCreated, realm, ID, username)
+}
+
+// keycloakAttributes returns the group's attributes in Keycloak's multi-valued form, including the
+// longName and optional description idshield keeps there under the managed prefix
+func (g *group) keycloakAttributes(s *service.Service) map[string][]string {
+	attr := make(map[string][]string)
+	for key, value := range g.Attributes {
+		attr[key] = []string{value}
+	}
+	attr[managedKey(s, longNameAttr)] = []string{g.LongName}
+	if g.Description != nil {
+		attr[managedKey(s, descriptionAttr)] = []string{*g.Description}
+	}
+	return attr
+}
+
+// updatedAttributes returns the attributes a group update writes: the group's current attributes with the
+// caller's attributes, longName and, when given, description laid over them. Attributes the caller left out,
+// createdBy among them, are kept, and managed attributes still under their legacy key are moved under the prefix
+func (g *group) updatedAttributes(s *service.Service, current *map[string][]string) map[string][]string {
+	attr := make(map[string][]string)
+	if current != nil {
+		for key, values := range *current {
+			attr[key] = values
+		}
+	}
+	migrateManagedAttrs(s, attr)
+	for key, values := range g.keycloakAttributes(s) {
+		attr[key] = values
+	}
+	return attr
+}
+
+// failedSteps keeps the failed steps out of a list of step results
+func failedSteps(results []stepResult) []failedStep {
+	var failed []failedStep
+	for _, result := range results {
+		if result.Status == stepStatusFailed {
+			failed = append(failed, failedStep{Step: result.Step, Error: result.Error})
+		}
+	}
+	return failed
+}
+
+// newStepResult records the outcome of a single post-create step
+func newStepResult(step string, err error) stepResult {
+	if err != nil {
+		return stepResult{Step: step, Status: stepStatusFailed, Error: err.Error()}
+	}
+	return stepResult{Step: step, Status: stepStatusOK}
+}
+
+// assignRealmRoles maps each realm role to the group, continuing past failures and returning the outcome of each
+func assignRealmRoles(c *gin.Context, gcClient *gocloak.GoCloak, token, realm, groupID string, roleNames []string) []stepResult {
+	results := []stepResult{}
+	for _, roleName := range roleNames {
+		role, err := gcClient.GetRealmRole(c, token, realm, roleName)
+		if err == nil {
+			err = gcClient.AddRealmRoleToGroup(c, token, realm, groupID, []gocloak.Role{*role})
+		}
+		results = append(results, newStepResult("realmRole:"+roleName, err))
+	}
+	return results
+}
+
+// assignClientRoles maps the client roles, keyed by clientId, to the group and returns the outcome of each
+func assignClientRoles(c *gin.Context, gcClient *gocloak.GoCloak, token, realm, groupID string, clientRoles map[string][]string) []stepResult {
+	results := []stepResult{}
+	clientIDs := make([]string, 0, len(clientRoles))
+	for clientID := range clientRoles {
+		clientIDs = append(clientIDs, clientID)
+	}
+	sort.Strings(clientIDs)
+	for _, clientID := range clientIDs {
+		clients, err := gcClient.GetClients(c, token, realm, gocloak.GetClientsParams{
+			ClientID: gocloak.StringP(clientID),
+		})
+		if err == nil && len(clients) == 0 {
+			err = fmt.Errorf("client %v not found", clientID)
+		}
+		for _, roleName := range clientRoles[clientID] {
+			step := "clientRole:" + clientID + "/" + roleName
+			if err != nil {
+				results = append(results, newStepResult(step, err))
+				continue
+			}
+			role, roleErr := gcClient.GetClientRole(c, token, realm, *clients[0].ID, roleName)
+			if roleErr == nil {
+				roleErr = gcClient.AddClientRolesToGroup(c, token, realm, *clients[0].ID, groupID, []gocloak.Role{*role})
+			}
+			results = append(results, newStepResult(step, roleErr))
+		}
+	}
+	return results
+}
+
+// addMembers adds each user, looked up by exact username, to the group unless they are already a member and
+// returns the outcome of each
+func addMembers(c *gin.Context, gcClient *gocloak.GoCloak, token, realm, groupID string, usernames []string) []stepResult {
+	results := []stepResult{}
+	for _, username := range usernames {
+		users, err := gcClient.GetUsers(c, token, realm, gocloak.GetUsersParams{
+			Username: gocloak.StringP(username),
+			Exact:    gocloak.BoolP(true),
+		})
+		if err == nil && len(users) == 0 {
+			err = fmt.Errorf("user %v not found", username)
+		}
+		added := false
+		if err == nil {
+			added, err = utils.AddUserToGroupIfAbsent(c, gcClient, token, realm, *users[0].ID, groupID)
+		}
+		result := newStepResult("member:"+username, err)
+		if err == nil && !added {
+			result.Status = stepStatusAlreadyMember
+		}
+		results = append(results, result)
+	}
+	return results
+}
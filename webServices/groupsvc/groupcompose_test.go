@@ -0,0 +1,128 @@
+package groupsvc
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/remiges-tech/alya/service"
+	"github.com/remiges-tech/idshield/internal/keycloaktest"
+	"github.com/remiges-tech/idshield/utils"
+)
+
+func TestGroupNewWithRoles(t *testing.T) {
+	kc := keycloaktest.NewServer(t)
+	realm := kc.Realm("acme")
+	realm.Roles = []string{"auditor", "viewer"}
+	s, _ := keycloaktest.NewService()
+	s.WithDependency("gocloak", kc.Client())
+	body := groupWithRoles{group: group{ShortName: "auditors", LongName: "Auditors", Attributes: map[string]string{"dept": "finance"}}, RealmRoles: []string{"auditor", "viewer"}}
+
+	w := keycloaktest.Do(s, Group_newWithRoles, keycloaktest.NewRequest(http.MethodPost, "/groupnewwithroles", keycloaktest.Token("acme", "alice"), keycloaktest.Data(body)))
+	var data utils.MutationResult
+	resp := keycloaktest.Decode(t, w, &data)
+	grp := realm.Group("/auditors")
+	if w.Code != http.StatusOK || resp.Status != "success" || grp == nil || data.Result != grp.ID {
+		t.Fatalf("Group_newWithRoles() = %d %s, want the group created", w.Code, w.Body)
+	}
+	if !reflect.DeepEqual(grp.RealmRoles, []string{"auditor", "viewer"}) {
+		t.Errorf("realm roles = %v, want [auditor viewer]", grp.RealmRoles)
+	}
+}
+
+func TestGroupNewWithRolesPostCreateFailure(t *testing.T) {
+	tests := []struct {
+		name     string
+		rollback bool
+	}{
+		{"partially created", false},
+		{"rolled back", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kc := keycloaktest.NewServer(t)
+			realm := kc.Realm("acme")
+			realm.Roles = []string{"auditor", "viewer"}
+			// the role lookup of viewer fails once the group has been created
+			kc.Handle(http.MethodGet, "/admin/realms/acme/roles/viewer", func(w http.ResponseWriter, r *http.Request) {
+				keycloaktest.Error(w, http.StatusInternalServerError, "unknown_error")
+			})
+			s, _ := keycloaktest.NewService()
+			s.WithDependency("gocloak", kc.Client())
+			body := groupWithRoles{group: group{ShortName: "auditors", LongName: "Auditors", Attributes: map[string]string{"dept": "finance"}}, RealmRoles: []string{"auditor", "viewer"}, Rollback: tt.rollback}
+
+			w := keycloaktest.Do(s, Group_newWithRoles, keycloaktest.NewRequest(http.MethodPost, "/groupnewwithroles", keycloaktest.Token("acme", "alice"), keycloaktest.Data(body)))
+			if tt.rollback {
+				resp := keycloaktest.Decode(t, w, nil)
+				if w.Code != http.StatusBadRequest || !reflect.DeepEqual(resp.ErrCodes(), []string{utils.ErrGroupCreateRolledBack}) || resp.Messages[0].Vals[0] != "realmRole:viewer" {
+					t.Errorf("Group_newWithRoles() = %d %s, want 400 %s for realmRole:viewer", w.Code, w.Body, utils.ErrGroupCreateRolledBack)
+				}
+				if realm.Group("/auditors") != nil {
+					t.Errorf("Group_newWithRoles() left the group behind after rolling back")
+				}
+				return
+			}
+
+			var data partialCreateResponse
+			resp := keycloaktest.Decode(t, w, &data)
+			grp := realm.Group("/auditors")
+			if w.Code != http.StatusOK || resp.Status != statusPartiallyCreated || grp == nil || data.ID != grp.ID {
+				t.Fatalf("Group_newWithRoles() = %d %s, want %s with the group's id", w.Code, w.Body, statusPartiallyCreated)
+			}
+			if len(data.FailedSteps) != 1 || data.FailedSteps[0].Step != "realmRole:viewer" {
+				t.Errorf("failed steps = %+v, want realmRole:viewer", data.FailedSteps)
+			}
+			if !reflect.DeepEqual(grp.RealmRoles, []string{"auditor"}) {
+				t.Errorf("realm roles = %v, want the steps that succeeded kept", grp.RealmRoles)
+			}
+		})
+	}
+}
+
+func TestUpdatedAttributes(t *testing.T) {
+	desc := "team"
+	tests := []struct {
+		name    string
+		g       group
+		current *map[string][]string
+		want    map[string][]string
+	}{
+		{
+			name: "new group",
+			g:    group{LongName: "Admins", Attributes: map[string]string{"dept": "hr"}},
+			want: map[string][]string{"dept": {"hr"}, "idshield_longName": {"Admins"}},
+		},
+		{
+			name:    "attributes left out are kept",
+			g:       group{LongName: "Admins", Attributes: map[string]string{"dept": "it"}},
+			current: &map[string][]string{"dept": {"hr"}, "site": {"pune"}, "idshield_createdBy": {"alice"}},
+			want:    map[string][]string{"dept": {"it"}, "site": {"pune"}, "idshield_createdBy": {"alice"}, "idshield_longName": {"Admins"}},
+		},
+		{
+			name:    "description kept unless given",
+			g:       group{LongName: "Admins"},
+			current: &map[string][]string{"idshield_description": {"old"}},
+			want:    map[string][]string{"idshield_description": {"old"}, "idshield_longName": {"Admins"}},
+		},
+		{
+			name:    "description replaced",
+			g:       group{LongName: "Admins", Description: &desc},
+			current: &map[string][]string{"idshield_description": {"old"}},
+			want:    map[string][]string{"idshield_description": {"team"}, "idshield_longName": {"Admins"}},
+		},
+		{
+			name:    "legacy keys migrated",
+			g:       group{LongName: "Admins"},
+			current: &map[string][]string{"dept": {"hr"}, "longName": {"Old admins"}, "createdBy": {"alice"}},
+			want:    map[string][]string{"dept": {"hr"}, "idshield_longName": {"Admins"}, "idshield_createdBy": {"alice"}},
+		},
+	}
+	s := &service.Service{}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.g.updatedAttributes(s, tt.current); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("updatedAttributes() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,224 @@
+package groupsvc
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/Nerzal/gocloak/v13"
+	"github.com/gin-gonic/gin"
+	"github.com/remiges-tech/alya/service"
+	"github.com/remiges-tech/alya/wscutils"
+	"github.com/remiges-tech/idshield/utils"
+	"github.com/remiges-tech/logharbour/logharbour"
+)
+
+// CountCache holds the member counts of the top level groups of each realm. It is refreshed in the background
+// with the service account's token, so Group_list can serve counts without counting members on every request
+type CountCache struct {
+	client     *gocloak.GoCloak
+	lh         *logharbour.Logger
+	clientID   string
+	secret     string
+	loginRealm string
+	realms     []string
+	interval   time.Duration
+
+	mu      sync.RWMutex
+	entries map[string]realmCounts
+	// running holds the realms a refresh is in progress for
+	running map[string]bool
+}
+
+// minManualRefreshGap is how long after a realm's last refresh Group_refreshCounts refuses another one
+const minManualRefreshGap = time.Minute
+
+// errRefreshRunning is returned by Refresh when the realm is already being refreshed
+var errRefreshRunning = errors.New("member count refresh already running")
+
+type realmCounts struct {
+	counts    map[string]int
+	refreshed time.Time
+}
+
+// NewCountCache returns an empty cache for realms, refreshed every interval by Run. The service account
+// logs in to loginRealm as clientID and must be able to view the groups and members of every realm in realms
+func NewCountCache(client *gocloak.GoCloak, lh *logharbour.Logger, clientID, secret, loginRealm string, realms []string, interval time.Duration) *CountCache {
+	return &CountCache{
+		client:     client,
+		lh:         lh,
+		clientID:   clientID,
+		secret:     secret,
+		loginRealm: loginRealm,
+		realms:     realms,
+		interval:   interval,
+		entries:    map[string]realmCounts{},
+		running:    map[string]bool{},
+	}
+}
+
+// Run refreshes every realm straight away and then each interval, until ctx is done
+func (cc *CountCache) Run(ctx context.Context) {
+	ticker := time.NewTicker(cc.interval)
+	defer ticker.Stop()
+	for {
+		cc.refreshAll(ctx)
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// refreshAll logs the service account in and refreshes each realm, a realm that fails keeps its previous
+// entry until it goes stale
+func (cc *CountCache) refreshAll(ctx context.Context) {
+	jwt, err := cc.client.LoginClient(ctx, cc.clientID, cc.secret, cc.loginRealm)
+	if err != nil {
+		cc.lh.Debug0().LogDebug("Member count refresh login failed:", logharbour.DebugInfo{Variables: map[string]any{"error": err}})
+		return
+	}
+	for _, realm := range cc.realms {
+		if _, err := cc.Refresh(ctx, jwt.AccessToken, realm); err != nil {
+			cc.lh.Debug0().LogDebug("Member count refresh failed:", logharbour.DebugInfo{Variables: map[string]any{"realm": realm, "error": err}})
+		}
+	}
+}
+
+// Refresh recounts the members of every top level group of realm with token and replaces the realm's entry,
+// it returns the number of groups counted. Only one refresh of a realm runs at a time, a second one gets
+// errRefreshRunning
+func (cc *CountCache) Refresh(ctx context.Context, token, realm string) (int, error) {
+	cc.mu.Lock()
+	if cc.running[realm] {
+		cc.mu.Unlock()
+		return 0, errRefreshRunning
+	}
+	cc.running[realm] = true
+	cc.mu.Unlock()
+	defer func() {
+		cc.mu.Lock()
+		delete(cc.running, realm)
+		cc.mu.Unlock()
+	}()
+
+	counts := map[string]int{}
+	for first := 0; ; first += keycloakPageSize {
+		groups, err := cc.client.GetGroups(ctx, token, realm, gocloak.GetGroupsParams{
+			First:               gocloak.IntP(first),
+			Max:                 gocloak.IntP(keycloakPageSize),
+			BriefRepresentation: gocloak.BoolP(true),
+		})
+		if err != nil {
+			return 0, err
+		}
+		for _, grp := range groups {
+			nusers, err := countGroupMembers(ctx, cc.client, token, realm, *grp.ID, false)
+			if err != nil {
+				return 0, err
+			}
+			counts[*grp.ID] = nusers
+		}
+		if len(groups) < keycloakPageSize {
+			break
+		}
+	}
+
+	cc.mu.Lock()
+	cc.entries[realm] = realmCounts{counts: counts, refreshed: time.Now()}
+	cc.mu.Unlock()
+	return len(counts), nil
+}
+
+// refreshedAt returns when the realm's counts were last refreshed, zero if they never were
+func (cc *CountCache) refreshedAt(realm string) time.Time {
+	cc.mu.RLock()
+	defer cc.mu.RUnlock()
+	return cc.entries[realm].refreshed
+}
+
+// cachedCounts returns the cached member counts of groups, when they were taken, and the groups the cache has
+// no count for. A realm whose entry is older than twice the refresh interval is treated as uncached, so a
+// refresh job that keeps failing can't serve old counts forever
+func (cc *CountCache) cachedCounts(realm string, groups []*gocloak.Group) (counts map[string]int, asOf time.Time, missing []*gocloak.Group) {
+	counts = make(map[string]int, len(groups))
+	cc.mu.RLock()
+	entry, ok := cc.entries[realm]
+	cc.mu.RUnlock()
+	if !ok || time.Since(entry.refreshed) > 2*cc.interval {
+		return counts, time.Time{}, groups
+	}
+	for _, grp := range groups {
+		if nusers, ok := entry.counts[*grp.ID]; ok {
+			counts[*grp.ID] = nusers
+		} else {
+			missing = append(missing, grp)
+		}
+	}
+	return counts, entry.refreshed, missing
+}
+
+// listMemberCounts returns the member counts for a Group_list page. Counts come from the "countCache"
+// dependency where it has them, the remaining groups are counted live in parallel. asOf is the time the
+// cached counts were taken, zero when none were used
+func listMemberCounts(c *gin.Context, s *service.Service, client *gocloak.GoCloak, token, realm string, groups []*gocloak.Group) (counts map[string]int, asOf time.Time) {
+	cache, _ := s.Dependencies["countCache"].(*CountCache)
+	if cache == nil {
+		return countMembersFanOut(c, s, client, token, realm, groups), time.Time{}
+	}
+	counts, asOf, missing := cache.cachedCounts(realm, groups)
+	if len(missing) > 0 {
+		for id, nusers := range countMembersFanOut(c, s, client, token, realm, missing) {
+			counts[id] = nusers
+		}
+	}
+	if len(missing) == len(groups) {
+		asOf = time.Time{}
+	}
+	return counts, asOf
+}
+
+// Group_refreshCounts handles the POST /grouprefreshcounts request, it refreshes the cached member counts of
+// the caller's realm right away instead of waiting for the next scheduled refresh. A full recount is expensive,
+// so it needs the admin capability, and is refused while the realm is being refreshed or within
+// minManualRefreshGap of its last refresh
+func Group_refreshCounts(c *gin.Context, s *service.Service) {
+	utils.Handler("Group_refreshCounts", []string{utils.CapAdmin}, groupRefreshCounts)(c, s)
+}
+
+// groupRefreshCounts is the business logic of Group_refreshCounts, utils.Handler has done the token, realm and authz checks
+func groupRefreshCounts(ctx utils.HandlerContext) {
+	c, l := ctx.Gin, ctx.Logger
+
+	cache, _ := ctx.Service.Dependencies["countCache"].(*CountCache)
+	if cache == nil {
+		l.Log("Member count cache is not configured")
+		wscutils.SendErrorResponse(c, wscutils.NewErrorResponse(utils.ErrFailedToLoadDependence))
+		return
+	}
+
+	if wait := minManualRefreshGap - time.Since(cache.refreshedAt(ctx.Realm)); wait > 0 {
+		l.Log("Member count refresh requested too soon")
+		c.Header("Retry-After", strconv.Itoa(int(wait.Seconds())+1))
+		str := "realm"
+		wscutils.SendErrorResponse(c, wscutils.NewResponse(wscutils.ErrorStatus, nil, []wscutils.ErrorMessage{wscutils.BuildErrorMessage(utils.ErrRefreshThrottled, &str, "too_soon")}))
+		return
+	}
+	ngroups, err := cache.Refresh(c, ctx.Token, ctx.Realm)
+	if errors.Is(err, errRefreshRunning) {
+		l.Log("Member count refresh already running")
+		str := "realm"
+		wscutils.SendErrorResponse(c, wscutils.NewResponse(wscutils.ErrorStatus, nil, []wscutils.ErrorMessage{wscutils.BuildErrorMessage(utils.ErrRefreshThrottled, &str, "running")}))
+		return
+	}
+	if err != nil {
+		utils.GocloakErrorHandler(c, l, err)
+		return
+	}
+	l.LogActivity("Member counts refreshed:", map[string]any{"realm": ctx.Realm, "groups": ngroups})
+
+	utils.SendSuccess(c, opGroupRefreshCounts, wscutils.NewSuccessResponse(map[string]any{"realm": ctx.Realm, "groups": ngroups}))
+}
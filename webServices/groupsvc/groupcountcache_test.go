@@ -0,0 +1,90 @@
+package groupsvc
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/remiges-tech/idshield/internal/keycloaktest"
+	"github.com/remiges-tech/idshield/utils"
+	"github.com/remiges-tech/logharbour/logharbour"
+)
+
+func newTestCountCache(kc *keycloaktest.Server) *CountCache {
+	lh := logharbour.NewLogger(logharbour.NewLoggerContext(logharbour.Debug2), "idshield", io.Discard)
+	return NewCountCache(kc.Client(), lh, "idshield", "", "acme", []string{"acme"}, time.Minute)
+}
+
+func TestGroupListCountCache(t *testing.T) {
+	kc := keycloaktest.NewServer(t)
+	realm := kc.Realm("acme")
+	alice, bob := realm.AddUser("alice", true), realm.AddUser("bob", true)
+	realm.AddGroup("/admins", nil).AddMembers(alice, bob)
+	ops := realm.AddGroup("/ops", nil).AddMembers(alice)
+	token := keycloaktest.Token("acme", "alice")
+
+	cache := newTestCountCache(kc)
+	if n, err := cache.Refresh(context.Background(), token, "acme"); err != nil || n != 2 {
+		t.Fatalf("Refresh() = %d, %v, want 2 groups counted", n, err)
+	}
+	// a member added after the refresh only shows once the cache is refreshed again, a group added after it
+	// has no cached count and is counted live
+	ops.AddMembers(bob)
+	realm.AddGroup("/sales", nil).AddMembers(bob)
+	s, _ := keycloaktest.NewService()
+	s.WithDependency("gocloak", kc.Client()).WithDependency("keycloakURL", kc.URL).WithDependency("countCache", cache)
+
+	sales := realm.Group("/sales")
+	memberCalls := kc.CallCount("GET /admin/realms/acme/groups/")
+	w := keycloaktest.Do(s, Group_list, keycloaktest.NewRequest(http.MethodGet, "/grouplist", token, nil))
+	var items []groupListResponse
+	page := utils.Page{Items: &items}
+	keycloaktest.Decode(t, w, &page)
+	got := map[string]int{}
+	for _, item := range items {
+		got[*item.ShortName] = item.Nusers
+	}
+	if want := map[string]int{"/admins": 2, "/ops": 1, "/sales": 1}; w.Code != http.StatusOK || !reflect.DeepEqual(got, want) {
+		t.Fatalf("Group_list() = %d %v, want %v", w.Code, got, want)
+	}
+	if page.AsOf == nil || time.Since(*page.AsOf) > time.Minute {
+		t.Errorf("Group_list() asOf = %v, want the time of the refresh", page.AsOf)
+	}
+	if n := kc.CallCount("GET /admin/realms/acme/groups/") - memberCalls; n != 2 || kc.CallCount("GET /admin/realms/acme/groups/"+sales.ID+"/members") != 1 {
+		t.Errorf("Group_list() made %d group calls, want the top level count and the uncached group's members", n)
+	}
+}
+
+func TestGroupRefreshCounts(t *testing.T) {
+	authz := utils.NewFakeAuthorizer().Allow("alice", utils.CapAdmin).Allow("bob", utils.CapGroupRead)
+	prev := utils.SetAuthorizer(authz)
+	t.Cleanup(func() { utils.SetAuthorizer(prev) })
+	kc := keycloaktest.NewServer(t)
+	kc.Realm("acme").AddGroup("/admins", nil).AddMembers(kc.Realm("acme").AddUser("alice", true))
+	cache := newTestCountCache(kc)
+	s, _ := keycloaktest.NewService()
+	s.WithDependency("gocloak", kc.Client()).WithDependency("countCache", cache)
+
+	w := keycloaktest.Do(s, Group_refreshCounts, keycloaktest.NewRequest(http.MethodPost, "/grouprefreshcounts", keycloaktest.Token("acme", "bob"), nil))
+	if resp := keycloaktest.Decode(t, w, nil); w.Code != http.StatusBadRequest || !reflect.DeepEqual(resp.ErrCodes(), []string{utils.ErrUnauthorized}) {
+		t.Errorf("Group_refreshCounts() as bob = %d %s, want 400 %s", w.Code, w.Body, utils.ErrUnauthorized)
+	}
+
+	token := keycloaktest.Token("acme", "alice")
+	w = keycloaktest.Do(s, Group_refreshCounts, keycloaktest.NewRequest(http.MethodPost, "/grouprefreshcounts", token, nil))
+	var data map[string]any
+	keycloaktest.Decode(t, w, &data)
+	if w.Code != http.StatusOK || data["groups"] != float64(1) || cache.refreshedAt("acme").IsZero() {
+		t.Fatalf("Group_refreshCounts() = %d %s, want the realm's one group counted", w.Code, w.Body)
+	}
+
+	// a second refresh straight after is refused until minManualRefreshGap has passed
+	w = keycloaktest.Do(s, Group_refreshCounts, keycloaktest.NewRequest(http.MethodPost, "/grouprefreshcounts", token, nil))
+	resp := keycloaktest.Decode(t, w, nil)
+	if w.Code != http.StatusBadRequest || !reflect.DeepEqual(resp.ErrCodes(), []string{utils.ErrRefreshThrottled}) || w.Header().Get("Retry-After") == "" {
+		t.Errorf("second Group_refreshCounts() = %d %s, want 400 %s with Retry-After", w.Code, w.Body, utils.ErrRefreshThrottled)
+	}
+}
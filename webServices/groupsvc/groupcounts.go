@@ -0,0 +1,93 @@
+package groupsvc
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/Nerzal/gocloak/v13"
+	"github.com/gin-gonic/gin"
+	"github.com/remiges-tech/alya/service"
+	"github.com/remiges-tech/idshield/types"
+)
+
+// defaults used for the member count fan-out when member_count is not configured
+const (
+	defaultCountCallTimeout = 2 * time.Second
+	defaultCountDeadline    = 5 * time.Second
+	defaultCountConcurrency = 8
+)
+
+// getMemberCountLimits returns the configured member count fan-out limits, unset values fall back to the defaults
+func getMemberCountLimits(s *service.Service) (callTimeout, deadline time.Duration, concurrency int) {
+	cfg, _ := s.Dependencies["memberCount"].(types.FanOut)
+	callTimeout, deadline, concurrency = defaultCountCallTimeout, defaultCountDeadline, defaultCountConcurrency
+	if cfg.CallTimeoutMs > 0 {
+		callTimeout = time.Duration(cfg.CallTimeoutMs) * time.Millisecond
+	}
+	if cfg.DeadlineMs > 0 {
+		deadline = time.Duration(cfg.DeadlineMs) * time.Millisecond
+	}
+	if cfg.Concurrency > 0 {
+		concurrency = cfg.Concurrency
+	}
+	return callTimeout, deadline, concurrency
+}
+
+// countMembersFanOut counts the members of each group in parallel and returns the counts keyed by group ID.
+// A group is missing from the result when its own call failed or timed out, or when the overall deadline
+// passed before it finished, so one slow group can't hold up the whole page
+func countMembersFanOut(c *gin.Context, s *service.Service, client *gocloak.GoCloak, token, realm string, groups []*gocloak.Group) map[string]int {
+	callTimeout, deadline, concurrency := getMemberCountLimits(s)
+	ctx, cancel := context.WithTimeout(c, deadline)
+	defer cancel()
+
+	var (
+		mu     sync.Mutex
+		wg     sync.WaitGroup
+		counts = make(map[string]int, len(groups))
+		slots  = make(chan struct{}, concurrency)
+	)
+	for _, grp := range groups {
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		wg.Add(1)
+		go func(groupID string) {
+			defer wg.Done()
+			defer func() { <-slots }()
+			callCtx, callCancel := context.WithTimeout(ctx, callTimeout)
+			defer callCancel()
+			nusers, err := countGroupMembers(callCtx, client, token, realm, groupID, false)
+			if err != nil {
+				return
+			}
+			mu.Lock()
+			counts[groupID] = nusers
+			mu.Unlock()
+		}(*grp.ID)
+	}
+
+	// the calls are bound to ctx, so once the deadline passes they return and the wait is short
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	result := make(map[string]int, len(counts))
+	for id, n := range counts {
+		result[id] = n
+	}
+	return result
+}
@@ -0,0 +1,114 @@
+package groupsvc
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/Nerzal/gocloak/v13"
+	"github.com/remiges-tech/alya/wscutils"
+	"github.com/remiges-tech/idshield/internal/keycloaktest"
+	"github.com/remiges-tech/idshield/utils"
+)
+
+func TestMissingRoles(t *testing.T) {
+	tests := []struct {
+		name        string
+		have, other []string
+		want        []string
+	}{
+		{"nothing", nil, nil, []string{}},
+		{"all missing sorted", []string{"write", "read"}, nil, []string{"read", "write"}},
+		{"shared left out", []string{"read", "write"}, []string{"read"}, []string{"write"}},
+		{"duplicates once", []string{"write", "write"}, nil, []string{"write"}},
+		{"none missing", []string{"read"}, []string{"read", "write"}, []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := missingRoles(tt.have, tt.other); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("missingRoles() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRoleDifference(t *testing.T) {
+	a := &gocloak.Group{
+		RealmRoles:  &[]string{"admin", "user"},
+		ClientRoles: &map[string][]string{"app": {"edit", "view"}, "reports": {"view"}},
+	}
+	b := &gocloak.Group{
+		RealmRoles:  &[]string{"user"},
+		ClientRoles: &map[string][]string{"app": {"view"}, "reports": {"view"}},
+	}
+	tests := []struct {
+		name string
+		a, b *gocloak.Group
+		want roleSet
+	}{
+		{"a minus b", a, b, roleSet{RealmRoles: []string{"admin"}, ClientRoles: map[string][]string{"app": {"edit"}}}},
+		{"b minus a", b, a, roleSet{RealmRoles: []string{}, ClientRoles: map[string][]string{}}},
+		{"against a group without roles", a, &gocloak.Group{}, roleSet{
+			RealmRoles:  []string{"admin", "user"},
+			ClientRoles: map[string][]string{"app": {"edit", "view"}, "reports": {"view"}},
+		}},
+		{"group without roles", &gocloak.Group{}, a, roleSet{RealmRoles: []string{}, ClientRoles: map[string][]string{}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := roleDifference(tt.a, tt.b); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("roleDifference() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGroupDiffRoles(t *testing.T) {
+	kc := keycloaktest.NewServer(t)
+	realm := kc.Realm("acme")
+	admins := realm.AddGroup("/admins", nil)
+	admins.RealmRoles = []string{"admin", "user", "audit"}
+	admins.ClientRoles = map[string][]string{"app": {"edit", "view"}, "reports": {"view"}}
+	ops := realm.AddGroup("/ops", nil)
+	ops.RealmRoles = []string{"user", "deploy"}
+	ops.ClientRoles = map[string][]string{"app": {"view"}, "monitor": {"view"}}
+	s, _ := keycloaktest.NewService()
+	s.WithDependency("gocloak", kc.Client())
+
+	w := keycloaktest.Do(s, Group_diffRoles, keycloaktest.NewRequest(http.MethodGet, "/groupdiffroles?shortNameA=admins&shortNameB=ops", keycloaktest.Token("acme", "alice"), nil))
+	var data roleDiffResponse
+	keycloaktest.Decode(t, w, &data)
+	want := roleDiffResponse{
+		ShortNameA: "admins",
+		ShortNameB: "ops",
+		OnlyInA:    roleSet{RealmRoles: []string{"admin", "audit"}, ClientRoles: map[string][]string{"app": {"edit"}, "reports": {"view"}}},
+		OnlyInB:    roleSet{RealmRoles: []string{"deploy"}, ClientRoles: map[string][]string{"monitor": {"view"}}},
+	}
+	if w.Code != http.StatusOK || !reflect.DeepEqual(data, want) {
+		t.Errorf("Group_diffRoles() = %d %+v, want %+v", w.Code, data, want)
+	}
+}
+
+func TestGroupDiffRolesInvalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		query   string
+		wantErr []string
+	}{
+		{"shortNameB missing", "shortNameA=admins", []string{wscutils.ErrcodeMissing}},
+		{"unknown group", "shortNameA=admins&shortNameB=auditors", []string{utils.ErrResourceNotFound, utils.ErrNotExist}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kc := keycloaktest.NewServer(t)
+			kc.Realm("acme").AddGroup("/admins", nil)
+			s, _ := keycloaktest.NewService()
+			s.WithDependency("gocloak", kc.Client())
+
+			w := keycloaktest.Do(s, Group_diffRoles, keycloaktest.NewRequest(http.MethodGet, "/groupdiffroles?"+tt.query, keycloaktest.Token("acme", "alice"), nil))
+			if resp := keycloaktest.Decode(t, w, nil); w.Code != http.StatusBadRequest || !reflect.DeepEqual(resp.ErrCodes(), tt.wantErr) {
+				t.Errorf("Group_diffRoles(%s) = %d %s, want 400 %v", tt.query, w.Code, w.Body, tt.wantErr)
+			}
+		})
+	}
+}
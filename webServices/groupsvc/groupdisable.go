@@ -0,0 +1,127 @@
+package groupsvc
+
+import (
+	"errors"
+
+	"github.com/Nerzal/gocloak/v13"
+	"github.com/gin-gonic/gin"
+	"github.com/remiges-tech/alya/service"
+	"github.com/remiges-tech/alya/wscutils"
+	"github.com/remiges-tech/idshield/utils"
+	"github.com/remiges-tech/logharbour/logharbour"
+)
+
+// per-user outcomes reported by Group_disableMembers and Group_enableMembers
+const (
+	memberStatusDisabled  = "disabled"
+	memberStatusEnabled   = "enabled"
+	memberStatusUnchanged = "unchanged"
+	memberStatusError     = "error"
+)
+
+type groupMembersStateRequest struct {
+	ShortName string `json:"shortName" validate:"required"`
+}
+
+type memberStateResult struct {
+	UserID   string `json:"userId"`
+	Username string `json:"username"`
+	Status   string `json:"status"`
+	Error    string `json:"error,omitempty"`
+}
+
+// Group_disableMembers handles the POST /groupdisablemembers request, it disables every member of the group,
+// e.g. when the group has been compromised, and reports the outcome for each user
+func Group_disableMembers(c *gin.Context, s *service.Service) {
+	utils.Handler("Group_disableMembers", []string{utils.CapUserDisable}, func(ctx utils.HandlerContext) {
+		setMembersEnabled(ctx, false)
+	})(c, s)
+}
+
+// Group_enableMembers handles the POST /groupenablemembers request, it re-enables every member of the group
+// and reports the outcome for each user
+func Group_enableMembers(c *gin.Context, s *service.Service) {
+	utils.Handler("Group_enableMembers", []string{utils.CapUserDisable}, func(ctx utils.HandlerContext) {
+		setMembersEnabled(ctx, true)
+	})(c, s)
+}
+
+// setMembersEnabled sets enabled on every member of the requested group. Members already in that state are
+// left alone, and every user actually changed is logged since the operation can lock out a whole team
+func setMembersEnabled(ctx utils.HandlerContext, enabled bool) {
+	c, l := ctx.Gin, ctx.Logger
+
+	var req groupMembersStateRequest
+	if !utils.RequireJSON(c) {
+		l.Log("Unsupported content type")
+		return
+	}
+	if err := wscutils.BindJSON(c, &req); err != nil {
+		l.LogActivity("Error Unmarshalling JSON to struct:", logharbour.DebugInfo{Variables: map[string]any{"Error": err.Error()}})
+		return
+	}
+	if req.ShortName == "" {
+		l.Log("shortName missing")
+		wscutils.SendErrorResponse(c, wscutils.NewResponse(wscutils.ErrorStatus, nil, []wscutils.ErrorMessage{wscutils.BuildErrorMessage(wscutils.ErrcodeMissing, nil, "shortName")}))
+		return
+	}
+
+	grp, err := utils.GetGroupByExactName(c, ctx.Client, ctx.Token, ctx.Realm, req.ShortName)
+	if errors.Is(err, utils.ErrGroupNotFound) {
+		l.Log("Error while gcClient.GetGroups Group doesn't exist ")
+		str := "shortName"
+		wscutils.SendErrorResponse(c, utils.NotFound(utils.ResourceGroup, req.ShortName, wscutils.BuildErrorMessage(utils.ErrNotExist, &str)))
+		return
+	}
+	if err != nil {
+		utils.GocloakErrorHandler(c, l, err)
+		return
+	}
+
+	// collect every member up front, so that the pages don't depend on the updates made below
+	var members []*gocloak.User
+	for page := 0; ; page += keycloakPageSize {
+		batch, err := ctx.Client.GetGroupMembers(c, ctx.Token, ctx.Realm, *grp.ID, gocloak.GetGroupsParams{
+			First:               gocloak.IntP(page),
+			Max:                 gocloak.IntP(keycloakPageSize),
+			BriefRepresentation: gocloak.BoolP(true),
+		})
+		if err != nil {
+			utils.GocloakErrorHandler(c, l, err)
+			return
+		}
+		members = append(members, batch...)
+		if len(batch) < keycloakPageSize {
+			break
+		}
+	}
+
+	status, op := memberStatusDisabled, opGroupDisableMembers
+	if enabled {
+		status, op = memberStatusEnabled, opGroupEnableMembers
+	}
+	results := []memberStateResult{}
+	for _, member := range members {
+		result := memberStateResult{UserID: gocloak.PString(member.ID), Username: gocloak.PString(member.Username)}
+		if gocloak.PBool(member.Enabled) == enabled {
+			result.Status = memberStatusUnchanged
+			results = append(results, result)
+			continue
+		}
+		err := ctx.Client.UpdateUser(c, ctx.Token, ctx.Realm, gocloak.User{
+			ID:       member.ID,
+			Username: member.Username,
+			Enabled:  gocloak.BoolP(enabled),
+		})
+		if err != nil {
+			result.Status, result.Error = memberStatusError, err.Error()
+			results = append(results, result)
+			continue
+		}
+		l.LogActivity("Group member "+status+":", map[string]any{"group": req.ShortName, "userId": result.UserID, "username": result.Username, "by": ctx.Username})
+		result.Status = status
+		results = append(results, result)
+	}
+
+	utils.SendSuccess(c, op, utils.NewMutationResponse(map[string]any{"results": results}, ctx.Username))
+}
@@ -0,0 +1,62 @@
+package groupsvc
+
+import (
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/remiges-tech/idshield/internal/keycloaktest"
+	"github.com/remiges-tech/idshield/utils"
+)
+
+func TestGroupDisableMembers(t *testing.T) {
+	kc := keycloaktest.NewServer(t)
+	realm := kc.Realm("acme")
+	alice, bob, carol := realm.AddUser("alice", true), realm.AddUser("bob", true), realm.AddUser("carol", false)
+	dave := realm.AddUser("dave", true)
+	realm.AddGroup("/ops", nil).AddMembers(alice, bob, carol)
+	s, logs := keycloaktest.NewService()
+	s.WithDependency("gocloak", kc.Client())
+	token := keycloaktest.Token("acme", "root")
+	body := groupMembersStateRequest{ShortName: "ops"}
+
+	w := keycloaktest.Do(s, Group_disableMembers, keycloaktest.NewRequest(http.MethodPost, "/groupdisablemembers", token, keycloaktest.Data(body)))
+	var data struct {
+		Results []memberStateResult `json:"results"`
+	}
+	keycloaktest.Decode(t, w, &utils.MutationResult{Result: &data})
+	want := []memberStateResult{
+		{UserID: alice.ID, Username: "alice", Status: memberStatusDisabled},
+		{UserID: bob.ID, Username: "bob", Status: memberStatusDisabled},
+		{UserID: carol.ID, Username: "carol", Status: memberStatusUnchanged},
+	}
+	if w.Code != http.StatusOK || !reflect.DeepEqual(data.Results, want) {
+		t.Fatalf("Group_disableMembers() = %d %+v, want %+v", w.Code, data.Results, want)
+	}
+	if alice.Enabled || bob.Enabled || carol.Enabled || !dave.Enabled {
+		t.Errorf("enabled = alice %v bob %v carol %v dave %v, want only dave, who is not a member", alice.Enabled, bob.Enabled, carol.Enabled, dave.Enabled)
+	}
+	// only the users actually changed are logged
+	if got := strings.Count(logs.String(), "Group member disabled:"); got != 2 {
+		t.Errorf("logged %d disabled members, want 2", got)
+	}
+
+	w = keycloaktest.Do(s, Group_enableMembers, keycloaktest.NewRequest(http.MethodPost, "/groupenablemembers", token, keycloaktest.Data(body)))
+	keycloaktest.Decode(t, w, &utils.MutationResult{Result: &data})
+	if w.Code != http.StatusOK || len(data.Results) != 3 || !alice.Enabled || !bob.Enabled || !carol.Enabled {
+		t.Errorf("Group_enableMembers() = %d %+v, want every member enabled", w.Code, data.Results)
+	}
+}
+
+func TestGroupDisableMembersUnknownGroup(t *testing.T) {
+	kc := keycloaktest.NewServer(t)
+	kc.Realm("acme")
+	s, _ := keycloaktest.NewService()
+	s.WithDependency("gocloak", kc.Client())
+
+	w := keycloaktest.Do(s, Group_disableMembers, keycloaktest.NewRequest(http.MethodPost, "/groupdisablemembers", keycloaktest.Token("acme", "root"), keycloaktest.Data(groupMembersStateRequest{ShortName: "ops"})))
+	if resp := keycloaktest.Decode(t, w, nil); w.Code != http.StatusBadRequest || !reflect.DeepEqual(resp.ErrCodes(), []string{utils.ErrResourceNotFound, utils.ErrNotExist}) {
+		t.Errorf("Group_disableMembers() = %d %s, want 400 %s %s", w.Code, w.Body, utils.ErrResourceNotFound, utils.ErrNotExist)
+	}
+}
@@ -0,0 +1,171 @@
+package groupsvc
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/Nerzal/gocloak/v13"
+	"github.com/gin-gonic/gin"
+	"github.com/remiges-tech/alya/router"
+	"github.com/remiges-tech/alya/service"
+	"github.com/remiges-tech/alya/wscutils"
+	"github.com/remiges-tech/idshield/types"
+	"github.com/remiges-tech/idshield/utils"
+	"github.com/remiges-tech/logharbour/logharbour"
+)
+
+// exportedGroup is the export format of a group: everything needed to recreate it, with its subgroups,
+// in another realm. Ids are left out as they are realm specific
+type exportedGroup struct {
+	Name        string              `json:"name"`
+	Path        string              `json:"path"`
+	Attributes  map[string][]string `json:"attributes"`
+	RealmRoles  []string            `json:"realmRoles"`
+	ClientRoles map[string][]string `json:"clientRoles"`
+	SubGroups   []exportedGroup     `json:"subGroups"`
+}
+
+// Realm_exportGroups handles the GET /realmexportgroups request, it streams every group of the realm, with its
+// hierarchy and role mappings, as a JSON array of exported groups. Top-level groups are fetched a page at a
+// time and written as they are exported, so the realm is never held in memory as a whole. Once streaming has
+// started errors can't change the response status, so the array is left unterminated to mark the export as failed
+func Realm_exportGroups(c *gin.Context, s *service.Service) {
+	l := utils.RequestLogger(c, s, "Realm_exportGroups")
+	l.Log("Starting execution of Realm_exportGroups()")
+	token, err := router.ExtractToken(c.GetHeader("Authorization"))
+	if err != nil {
+		l.Debug0().LogDebug("Missing or incorrect Authorization header format:", logharbour.DebugInfo{Variables: map[string]any{"error": err}})
+		wscutils.SendErrorResponse(c, wscutils.NewErrorResponse(utils.ErrTokenMissing))
+		return
+	}
+	r, err := utils.ExtractClaimFromJwt(token, "iss")
+	if err != nil {
+		l.Debug0().LogDebug("Missing or incorrect realm:", logharbour.DebugInfo{Variables: map[string]any{"error": err}})
+		wscutils.SendErrorResponse(c, wscutils.NewErrorResponse(utils.ErrRealmNotFound))
+		return
+	}
+	parts := strings.Split(r, "/realms/")
+	if len(parts) != 2 {
+		l.Debug0().LogDebug("Missing or incorrect realm:", logharbour.DebugInfo{Variables: map[string]any{"iss": r}})
+		wscutils.SendErrorResponse(c, wscutils.NewErrorResponse(utils.ErrRealmNotFound))
+		return
+	}
+	realm := utils.CanonicalRealm(c, s, token, parts[1])
+	l = utils.WithRealm(l, realm)
+	username, err := utils.ExtractClaimFromJwt(token, "preferred_username")
+	if err != nil {
+		l.Debug0().LogDebug("Missing username:", logharbour.DebugInfo{Variables: map[string]any{"error": err}})
+		wscutils.SendErrorResponse(c, wscutils.NewErrorResponse(utils.ErrUserNotFound))
+		return
+	}
+
+	isCapable, _ := utils.Authz_check(types.OpReq{
+		User:      username,
+		CapNeeded: []string{utils.CapGroupRead},
+	}, false)
+
+	if !isCapable {
+		l.Log("Unauthorized user:")
+		wscutils.SendErrorResponse(c, wscutils.NewErrorResponse(utils.ErrUnauthorized))
+		return
+	}
+
+	// Extracting the GoCloak client from the service dependencies
+	gcClient, ok := s.Dependencies["gocloak"].(*gocloak.GoCloak)
+	if !ok {
+		l.Log("Failed to load the dependency to *gocloak.GoCloak")
+		wscutils.SendErrorResponse(c, wscutils.NewErrorResponse(utils.ErrFailedToLoadDependence))
+		return
+	}
+
+	// the first page is fetched before anything is written, so that a failure there still gets an error response
+	groups, err := gcClient.GetGroups(c, token, realm, gocloak.GetGroupsParams{
+		First:               gocloak.IntP(0),
+		Max:                 gocloak.IntP(keycloakPageSize),
+		BriefRepresentation: gocloak.BoolP(true),
+	})
+	if err != nil {
+		utils.GocloakErrorHandler(c, l, err)
+		return
+	}
+
+	c.Header("Content-Type", "application/json")
+	c.Status(http.StatusOK)
+	enc := json.NewEncoder(c.Writer)
+	c.Writer.WriteString("[")
+	exported := 0
+	for first := 0; ; first += keycloakPageSize {
+		if first > 0 {
+			groups, err = gcClient.GetGroups(c, token, realm, gocloak.GetGroupsParams{
+				First:               gocloak.IntP(first),
+				Max:                 gocloak.IntP(keycloakPageSize),
+				BriefRepresentation: gocloak.BoolP(true),
+			})
+			if err != nil {
+				l.Debug0().LogDebug("Export aborted:", logharbour.DebugInfo{Variables: map[string]any{"error": err, "exported": exported}})
+				return
+			}
+		}
+		for _, grp := range groups {
+			export, err := exportGroup(c, gcClient, token, realm, *grp.ID, 1)
+			if err != nil {
+				l.Debug0().LogDebug("Export aborted:", logharbour.DebugInfo{Variables: map[string]any{"error": err, "exported": exported}})
+				return
+			}
+			if exported > 0 {
+				c.Writer.WriteString(",")
+			}
+			if err = enc.Encode(export); err != nil {
+				l.Debug0().LogDebug("Export aborted:", logharbour.DebugInfo{Variables: map[string]any{"error": err, "exported": exported}})
+				return
+			}
+			c.Writer.Flush()
+			exported++
+		}
+		if len(groups) < keycloakPageSize {
+			break
+		}
+	}
+	c.Writer.WriteString("]")
+
+	l.LogActivity("Groups exported:", map[string]any{"realm": realm, "count": exported})
+	l.Log("Finished execution of Realm_exportGroups()")
+}
+
+// exportGroup fetches the full representation of the group and its subgroups, down to maxTreeDepth,
+// and converts them to the export format
+func exportGroup(c *gin.Context, gcClient *gocloak.GoCloak, token, realm, groupID string, depth int) (exportedGroup, error) {
+	grp, err := gcClient.GetGroup(c, token, realm, groupID)
+	if err != nil {
+		return exportedGroup{}, err
+	}
+	export := exportedGroup{
+		Name:        gocloak.PString(grp.Name),
+		Path:        gocloak.PString(grp.Path),
+		Attributes:  map[string][]string{},
+		RealmRoles:  []string{},
+		ClientRoles: map[string][]string{},
+		SubGroups:   []exportedGroup{},
+	}
+	if grp.Attributes != nil {
+		export.Attributes = *grp.Attributes
+	}
+	if grp.RealmRoles != nil {
+		export.RealmRoles = *grp.RealmRoles
+	}
+	if grp.ClientRoles != nil {
+		export.ClientRoles = *grp.ClientRoles
+	}
+	if depth >= maxTreeDepth || grp.SubGroups == nil {
+		return export, nil
+	}
+	for _, sub := range *grp.SubGroups {
+		child, err := exportGroup(c, gcClient, token, realm, *sub.ID, depth+1)
+		if err != nil {
+			return export, err
+		}
+		export.SubGroups = append(export.SubGroups, child)
+	}
+	return export, nil
+}
@@ -0,0 +1,66 @@
+package groupsvc
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/remiges-tech/idshield/internal/keycloaktest"
+)
+
+func TestRealmExportGroups(t *testing.T) {
+	kc := keycloaktest.NewServer(t)
+	realm := kc.Realm("acme")
+	finance := realm.AddGroup("/finance", map[string][]string{"dept": {"fin"}})
+	finance.RealmRoles = []string{"auditor"}
+	finance.ClientRoles = map[string][]string{"ledger": {"read"}}
+	realm.AddGroup("/finance/payroll", map[string][]string{"site": {"pune"}})
+	// enough top level groups to need a second page
+	for i := 0; i < keycloakPageSize; i++ {
+		realm.AddGroup(fmt.Sprintf("/team-%03d", i), nil)
+	}
+	s, _ := keycloaktest.NewService()
+	s.WithDependency("gocloak", kc.Client())
+
+	w := keycloaktest.Do(s, Realm_exportGroups, keycloaktest.NewRequest(http.MethodGet, "/realmexportgroups", keycloaktest.Token("acme", "alice"), nil))
+	var exported []exportedGroup
+	if err := json.Unmarshal(w.Body.Bytes(), &exported); err != nil {
+		t.Fatalf("Realm_exportGroups() = %d, can't decode %q: %v", w.Code, w.Body, err)
+	}
+	if w.Code != http.StatusOK || len(exported) != keycloakPageSize+1 {
+		t.Fatalf("Realm_exportGroups() = %d with %d groups, want %d", w.Code, len(exported), keycloakPageSize+1)
+	}
+	want := exportedGroup{
+		Name: "finance", Path: "/finance",
+		Attributes:  map[string][]string{"dept": {"fin"}},
+		RealmRoles:  []string{"auditor"},
+		ClientRoles: map[string][]string{"ledger": {"read"}},
+		SubGroups: []exportedGroup{{
+			Name: "payroll", Path: "/finance/payroll",
+			Attributes: map[string][]string{"site": {"pune"}}, RealmRoles: []string{}, ClientRoles: map[string][]string{}, SubGroups: []exportedGroup{},
+		}},
+	}
+	if !reflect.DeepEqual(exported[0], want) {
+		t.Errorf("exported finance = %+v, want %+v", exported[0], want)
+	}
+	if last := exported[len(exported)-1]; last.Name != fmt.Sprintf("team-%03d", keycloakPageSize-1) {
+		t.Errorf("last exported group = %s, want the last team", last.Name)
+	}
+}
+
+func TestRealmExportGroupsFirstPageError(t *testing.T) {
+	kc := keycloaktest.NewServer(t)
+	kc.Realm("acme")
+	kc.Handle(http.MethodGet, "/admin/realms/acme/groups", func(w http.ResponseWriter, r *http.Request) {
+		keycloaktest.Error(w, http.StatusInternalServerError, "unknown_error")
+	})
+	s, _ := keycloaktest.NewService()
+	s.WithDependency("gocloak", kc.Client())
+
+	w := keycloaktest.Do(s, Realm_exportGroups, keycloaktest.NewRequest(http.MethodGet, "/realmexportgroups", keycloaktest.Token("acme", "alice"), nil))
+	if resp := keycloaktest.Decode(t, w, nil); w.Code != http.StatusBadRequest || resp.Status != "error" {
+		t.Errorf("Realm_exportGroups() = %d %s, want an error response", w.Code, w.Body)
+	}
+}
@@ -0,0 +1,88 @@
+package groupsvc
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/remiges-tech/alya/service"
+)
+
+// groupFields are the groupResponse fields a client can select with the fields query param
+var groupFields = map[string]bool{
+	"id": true, "name": true, "longName": true, "path": true, "subGroups": true, "subGroupCount": true, "attributes": true,
+	"access": true, "clientRoles": true, "realmRoles": true, "description": true, "nusers": true, "createdat": true,
+}
+
+// parseFields splits the comma separated fields query param, a nil set means every field is returned.
+// The names that aren't groupResponse fields are returned as invalid
+func parseFields(param string) (map[string]bool, []string) {
+	if strings.TrimSpace(param) == "" {
+		return nil, nil
+	}
+	fields := make(map[string]bool)
+	var invalid []string
+	for _, field := range strings.Split(param, ",") {
+		field = strings.TrimSpace(field)
+		if !groupFields[field] {
+			invalid = append(invalid, field)
+			continue
+		}
+		fields[field] = true
+	}
+	return fields, invalid
+}
+
+// selectFields returns only the selected fields of resp, a group response in either form. nusers is kept even
+// when zero, omitempty would otherwise drop a field the client explicitly asked for
+func selectFields(resp any, fields map[string]bool, nusers int) (map[string]any, error) {
+	data, err := json.Marshal(resp)
+	if err != nil {
+		return nil, err
+	}
+	all := map[string]any{}
+	if err := json.Unmarshal(data, &all); err != nil {
+		return nil, err
+	}
+	selected := make(map[string]any, len(fields))
+	for field := range fields {
+		if value, ok := all[field]; ok {
+			selected[field] = value
+		}
+	}
+	if fields["nusers"] {
+		selected["nusers"] = nusers
+	}
+	return selected, nil
+}
+
+// flatGroupResponse is groupResponse with single-value attributes collapsed to scalars, its Attributes
+// shadows the embedded one
+type flatGroupResponse struct {
+	groupResponse
+	Attributes map[string]any `json:"attributes,omitempty"`
+}
+
+// flattenGroupResponse returns grpResp with every single-value attribute as a scalar while multi-value ones
+// stay arrays. longName and description already have their own fields, so their attributes, prefixed or
+// legacy, are left out
+func flattenGroupResponse(s *service.Service, grpResp groupResponse) flatGroupResponse {
+	flat := flatGroupResponse{groupResponse: grpResp}
+	if grpResp.Attributes == nil {
+		return flat
+	}
+	skip := map[string]bool{}
+	for _, name := range []string{longNameAttr, descriptionAttr} {
+		skip[managedKey(s, name)], skip[legacyManagedAttrs[name]] = true, true
+	}
+	flat.Attributes = make(map[string]any)
+	for key, values := range *grpResp.Attributes {
+		switch {
+		case skip[key]:
+		case len(values) == 1:
+			flat.Attributes[key] = values[0]
+		default:
+			flat.Attributes[key] = values
+		}
+	}
+	return flat
+}
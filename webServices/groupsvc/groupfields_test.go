@@ -0,0 +1,130 @@
+package groupsvc
+
+import (
+	"net/http"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/remiges-tech/idshield/internal/keycloaktest"
+	"github.com/remiges-tech/idshield/utils"
+)
+
+func TestParseFields(t *testing.T) {
+	tests := []struct {
+		param       string
+		want        map[string]bool
+		wantInvalid []string
+	}{
+		{"", nil, nil},
+		{"  ", nil, nil},
+		{"id,name", map[string]bool{"id": true, "name": true}, nil},
+		{" id , nusers ", map[string]bool{"id": true, "nusers": true}, nil},
+		{"id,secret,Name", map[string]bool{"id": true}, []string{"secret", "Name"}},
+		{"id,,name", map[string]bool{"id": true, "name": true}, []string{""}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.param, func(t *testing.T) {
+			got, invalid := parseFields(tt.param)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseFields(%q) = %v, want %v", tt.param, got, tt.want)
+			}
+			if !reflect.DeepEqual(invalid, tt.wantInvalid) {
+				t.Errorf("parseFields(%q) invalid = %q, want %q", tt.param, invalid, tt.wantInvalid)
+			}
+		})
+	}
+}
+
+func TestGroupGetFields(t *testing.T) {
+	tests := []struct {
+		fields     string
+		wantKeys   []string
+		wantNusers bool
+		wantCalls  int
+	}{
+		{"name,attributes", []string{"attributes", "name"}, false, 0},
+		{"name,nusers", []string{"name", "nusers"}, true, 1},
+		{"", nil, true, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.fields, func(t *testing.T) {
+			kc := keycloaktest.NewServer(t)
+			realm := kc.Realm("acme")
+			admins := realm.AddGroup("/admins", map[string][]string{"longName": {"Admins"}}).AddMembers(realm.AddUser("alice", true), realm.AddUser("bob", true))
+			s, _ := keycloaktest.NewService()
+			s.WithDependency("gocloak", kc.Client())
+
+			w := keycloaktest.Do(s, Group_get, keycloaktest.NewRequest(http.MethodGet, "/groupget?shortName=admins&fields="+tt.fields, keycloaktest.Token("acme", "alice"), nil))
+			var data map[string]any
+			keycloaktest.Decode(t, w, &data)
+			if w.Code != http.StatusOK {
+				t.Fatalf("Group_get() = %d %s, want 200", w.Code, w.Body)
+			}
+			if tt.wantKeys != nil {
+				keys := []string{}
+				for key := range data {
+					keys = append(keys, key)
+				}
+				sort.Strings(keys)
+				if !reflect.DeepEqual(keys, tt.wantKeys) {
+					t.Errorf("fields returned = %v, want %v", keys, tt.wantKeys)
+				}
+			}
+			if tt.wantNusers && data["nusers"] != float64(2) {
+				t.Errorf("nusers = %v, want 2", data["nusers"])
+			}
+			if got := kc.CallCount("GET /admin/realms/acme/groups/" + admins.ID + "/members"); got != tt.wantCalls {
+				t.Errorf("member calls = %d, want %d", got, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestGroupGetInvalidFields(t *testing.T) {
+	kc := keycloaktest.NewServer(t)
+	kc.Realm("acme").AddGroup("/admins", nil)
+	s, _ := keycloaktest.NewService()
+	s.WithDependency("gocloak", kc.Client())
+
+	w := keycloaktest.Do(s, Group_get, keycloaktest.NewRequest(http.MethodGet, "/groupget?shortName=admins&fields=name,secret", keycloaktest.Token("acme", "alice"), nil))
+	resp := keycloaktest.Decode(t, w, nil)
+	if w.Code != http.StatusBadRequest || !reflect.DeepEqual(resp.ErrCodes(), []string{utils.ErrInvalidParam}) || !reflect.DeepEqual(resp.Messages[0].Vals, []string{"secret"}) {
+		t.Errorf("Group_get(fields=name,secret) = %d %s, want 400 %s naming secret", w.Code, w.Body, utils.ErrInvalidParam)
+	}
+}
+
+func TestGroupGetFlatten(t *testing.T) {
+	tests := []struct {
+		query     string
+		wantAttrs any
+	}{
+		{"", map[string]any{"dept": []any{"hr"}, "site": []any{"pune", "delhi"}, "idshield_longName": []any{"Admins"}, "idshield_description": []any{"The admins"}}},
+		{"&flatten=true", map[string]any{"dept": "hr", "site": []any{"pune", "delhi"}}},
+		{"&flatten=true&fields=longName,attributes", map[string]any{"dept": "hr", "site": []any{"pune", "delhi"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			kc := keycloaktest.NewServer(t)
+			kc.Realm("acme").AddGroup("/admins", map[string][]string{
+				"dept": {"hr"}, "site": {"pune", "delhi"}, "idshield_longName": {"Admins"}, "idshield_description": {"The admins"},
+			})
+			s, _ := keycloaktest.NewService()
+			s.WithDependency("gocloak", kc.Client())
+
+			w := keycloaktest.Do(s, Group_get, keycloaktest.NewRequest(http.MethodGet, "/groupget?shortName=admins"+tt.query, keycloaktest.Token("acme", "alice"), nil))
+			var data map[string]any
+			keycloaktest.Decode(t, w, &data)
+			if w.Code != http.StatusOK {
+				t.Fatalf("Group_get(%s) = %d %s, want 200", tt.query, w.Code, w.Body)
+			}
+			if !reflect.DeepEqual(data["attributes"], tt.wantAttrs) {
+				t.Errorf("Group_get(%s) attributes = %v, want %v", tt.query, data["attributes"], tt.wantAttrs)
+			}
+			// longName comes out in its own field whether or not the attributes are flattened
+			if data["longName"] != "Admins" {
+				t.Errorf("Group_get(%s) longName = %v, want Admins", tt.query, data["longName"])
+			}
+		})
+	}
+}
@@ -0,0 +1,153 @@
+package groupsvc
+
+import (
+	"strconv"
+
+	"github.com/Nerzal/gocloak/v13"
+	"github.com/gin-gonic/gin"
+	"github.com/remiges-tech/alya/service"
+	"github.com/remiges-tech/alya/wscutils"
+	"github.com/remiges-tech/idshield/utils"
+	"github.com/remiges-tech/logharbour/logharbour"
+)
+
+// outcomes of the individual groups of an import, a group that is created but whose role mappings fail
+// is statusPartiallyCreated
+const (
+	importStatusCreated = "created"
+	importStatusError   = "error"
+	// the group's parent couldn't be created, so it wasn't attempted
+	importStatusSkipped = "skipped"
+)
+
+type importResult struct {
+	Path        string       `json:"path"`
+	ID          string       `json:"id,omitempty"`
+	Status      string       `json:"status"`
+	Error       string       `json:"error,omitempty"`
+	FailedSteps []failedStep `json:"failedSteps,omitempty"`
+}
+
+// Group_import handles the POST /groupimport request, it recreates the groups of a Realm_exportGroups document,
+// with their hierarchy, attributes and role mappings, in the caller's realm. The whole document is checked to be
+// a tree before anything is created: a group listed under one of its own descendants is rejected with
+// invalid_hierarchy_cycle. Groups are then created top down and each one's outcome is reported, a group that
+// fails to be created leaves its subgroups skipped
+func Group_import(c *gin.Context, s *service.Service) {
+	utils.Handler("Group_import", []string{utils.CapGroupCreate}, groupImport)(c, s)
+}
+
+// groupImport is the business logic of Group_import, utils.Handler has done the token, realm and authz checks
+func groupImport(ctx utils.HandlerContext) {
+	c, s, l := ctx.Gin, ctx.Service, ctx.Logger
+
+	var groups []exportedGroup
+	if !utils.RequireJSON(c) {
+		l.Log("Unsupported content type")
+		return
+	}
+	if !utils.LimitRequestBody(c, getMaxRequestBody(s)) {
+		l.Log("Request body too large")
+		return
+	}
+	if err := utils.BindJSONStrict(c, &groups); err != nil {
+		l.LogActivity("Error Unmarshalling JSON to struct:", logharbour.DebugInfo{Variables: map[string]any{"Error": err.Error()}})
+		return
+	}
+	if len(groups) == 0 {
+		l.Log("No groups to import")
+		wscutils.SendErrorResponse(c, wscutils.NewResponse(wscutils.ErrorStatus, nil, []wscutils.ErrorMessage{wscutils.BuildErrorMessage(wscutils.ErrcodeMissing, nil, "data")}))
+		return
+	}
+
+	if errMsg, ok := checkImportHierarchy(groups, "", map[string]bool{}, map[string]bool{}, getMaxNestingDepth(s)); !ok {
+		l.LogActivity("Import document rejected:", map[string]any{"errcode": errMsg.ErrCode, "vals": errMsg.Vals})
+		wscutils.SendErrorResponse(c, wscutils.NewResponse(wscutils.ErrorStatus, nil, []wscutils.ErrorMessage{errMsg}))
+		return
+	}
+
+	results := []importResult{}
+	for _, grp := range groups {
+		results = importGroup(ctx, grp, "", "", results)
+	}
+	l.LogActivity("Groups imported:", map[string]any{"realm": ctx.Realm, "groups": len(results)})
+
+	utils.SendSuccess(c, opGroupImport, utils.NewMutationResponse(map[string]any{"results": results}, ctx.Username))
+}
+
+// checkImportHierarchy walks the document and returns the error message for the first group that keeps it from
+// being a tree. Groups are told apart by path, a group without one takes its parent's path and its name. A group
+// whose path is one of its ancestors' closes a cycle. Any other path given twice, or not matching where the group
+// sits in the document, is an invalid param, as is a group nested deeper than maxDepth
+func checkImportHierarchy(groups []exportedGroup, parentPath string, ancestors, seen map[string]bool, maxDepth int) (wscutils.ErrorMessage, bool) {
+	field := "path"
+	for _, grp := range groups {
+		if grp.Name == "" {
+			return wscutils.BuildErrorMessage(wscutils.ErrcodeMissing, nil, "name"), false
+		}
+		path := parentPath + "/" + grp.Name
+		if grp.Path != "" {
+			if ancestors[grp.Path] {
+				return wscutils.BuildErrorMessage(utils.ErrInvalidHierarchyCycle, &field, grp.Path), false
+			}
+			if grp.Path != path {
+				return wscutils.BuildErrorMessage(utils.ErrInvalidParam, &field, grp.Path), false
+			}
+		}
+		if seen[path] {
+			return wscutils.BuildErrorMessage(utils.ErrInvalidParam, &field, path), false
+		}
+		if groupDepth(path) > maxDepth {
+			return wscutils.BuildErrorMessage(utils.ErrMaxNestingDepthExceeded, &field, strconv.Itoa(maxDepth)), false
+		}
+		seen[path], ancestors[path] = true, true
+		errMsg, ok := checkImportHierarchy(grp.SubGroups, path, ancestors, seen, maxDepth)
+		delete(ancestors, path)
+		if !ok {
+			return errMsg, false
+		}
+	}
+	return wscutils.ErrorMessage{}, true
+}
+
+// importGroup creates grp under the group parentID, at the top level when it is "", maps its roles and then
+// imports its subgroups, appending the outcome of each group to results
+func importGroup(ctx utils.HandlerContext, grp exportedGroup, parentID, parentPath string, results []importResult) []importResult {
+	c, gcClient, token, realm := ctx.Gin, ctx.Client, ctx.Token, ctx.Realm
+	result := importResult{Path: parentPath + "/" + grp.Name}
+
+	created := gocloak.Group{Name: gocloak.StringP(grp.Name), Attributes: &grp.Attributes}
+	var err error
+	if parentID == "" {
+		result.ID, err = gcClient.CreateGroup(c, token, realm, created)
+	} else {
+		result.ID, err = gcClient.CreateChildGroup(c, token, realm, parentID, created)
+	}
+	if err != nil {
+		result.Status, result.Error = importStatusError, err.Error()
+		return skipImport(grp.SubGroups, result.Path, append(results, result))
+	}
+
+	steps := append(assignRealmRoles(c, gcClient, token, realm, result.ID, grp.RealmRoles), assignClientRoles(c, gcClient, token, realm, result.ID, grp.ClientRoles)...)
+	result.Status = importStatusCreated
+	if result.FailedSteps = failedSteps(steps); len(result.FailedSteps) > 0 {
+		result.Status = statusPartiallyCreated
+	}
+	ctx.Logger.LogActivity("Group imported:", map[string]any{"path": result.Path, "id": result.ID, "status": result.Status})
+	emitGroupEvent(ctx.Service, utils.EventGroupCreated, realm, result.ID, ctx.Username)
+
+	results = append(results, result)
+	for _, sub := range grp.SubGroups {
+		results = importGroup(ctx, sub, result.ID, result.Path, results)
+	}
+	return results
+}
+
+// skipImport marks every group below a group that couldn't be created as skipped
+func skipImport(groups []exportedGroup, parentPath string, results []importResult) []importResult {
+	for _, grp := range groups {
+		path := parentPath + "/" + grp.Name
+		results = skipImport(grp.SubGroups, path, append(results, importResult{Path: path, Status: importStatusSkipped}))
+	}
+	return results
+}
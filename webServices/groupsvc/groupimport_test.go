@@ -0,0 +1,123 @@
+package groupsvc
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/remiges-tech/alya/service"
+	"github.com/remiges-tech/idshield/internal/keycloaktest"
+)
+
+// a document exported from one realm imports into another as the same tree
+func TestGroupImportRoundTrip(t *testing.T) {
+	kc := keycloaktest.NewServer(t)
+	acme := kc.Realm("acme")
+	finance := acme.AddGroup("/finance", map[string][]string{"dept": {"fin"}})
+	finance.RealmRoles = []string{"auditor"}
+	finance.ClientRoles = map[string][]string{"ledger": {"read"}}
+	acme.AddGroup("/finance/payroll", map[string][]string{"site": {"pune"}})
+	acme.AddGroup("/ops", nil)
+	beta := kc.Realm("beta")
+	beta.Roles = []string{"auditor"}
+	beta.AddClient("ledger", "read")
+	s, _ := keycloaktest.NewService()
+	s.WithDependency("gocloak", kc.Client())
+
+	exported := exportRealm(t, s, "acme")
+	w := keycloaktest.Do(s, Group_import, keycloaktest.NewRequest(http.MethodPost, "/groupimport", keycloaktest.Token("beta", "alice"), keycloaktest.Data(exported)))
+	var data struct {
+		Result struct {
+			Results []importResult `json:"results"`
+		} `json:"result"`
+	}
+	if resp := keycloaktest.Decode(t, w, &data); w.Code != http.StatusOK || resp.Status != "success" {
+		t.Fatalf("Group_import() = %d %s, want success", w.Code, w.Body)
+	}
+	var paths []string
+	for _, result := range data.Result.Results {
+		if result.Status != importStatusCreated || result.ID == "" {
+			t.Errorf("import of %s = %+v, want created", result.Path, result)
+		}
+		paths = append(paths, result.Path)
+	}
+	if want := []string{"/finance", "/finance/payroll", "/ops"}; !reflect.DeepEqual(paths, want) {
+		t.Errorf("imported paths = %v, want %v", paths, want)
+	}
+	if got := exportRealm(t, s, "beta"); !reflect.DeepEqual(got, exported) {
+		t.Errorf("re-exported groups = %+v, want %+v", got, exported)
+	}
+}
+
+// a group listed under its own descendant is rejected before any group is created
+func TestGroupImportCycle(t *testing.T) {
+	tests := []struct {
+		name    string
+		groups  []exportedGroup
+		errCode string
+	}{
+		{"cycle", []exportedGroup{{Name: "a", Path: "/a", SubGroups: []exportedGroup{
+			{Name: "b", Path: "/a/b", SubGroups: []exportedGroup{{Name: "a", Path: "/a"}}},
+		}}}, "invalid_hierarchy_cycle"},
+		{"self", []exportedGroup{{Name: "a", Path: "/a", SubGroups: []exportedGroup{{Name: "a", Path: "/a"}}}}, "invalid_hierarchy_cycle"},
+		{"path elsewhere", []exportedGroup{{Name: "a", Path: "/a", SubGroups: []exportedGroup{{Name: "b", Path: "/c/b"}}}}, "invalid_param"},
+		{"duplicate", []exportedGroup{{Name: "a", Path: "/a"}, {Name: "a"}}, "invalid_param"},
+		{"no name", []exportedGroup{{Path: "/a"}}, "missing"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kc := keycloaktest.NewServer(t)
+			kc.Realm("beta")
+			s, _ := keycloaktest.NewService()
+			s.WithDependency("gocloak", kc.Client())
+
+			w := keycloaktest.Do(s, Group_import, keycloaktest.NewRequest(http.MethodPost, "/groupimport", keycloaktest.Token("beta", "alice"), keycloaktest.Data(tt.groups)))
+			if resp := keycloaktest.Decode(t, w, nil); w.Code != http.StatusBadRequest || !reflect.DeepEqual(resp.ErrCodes(), []string{tt.errCode}) {
+				t.Errorf("Group_import() = %d %v, want 400 %s", w.Code, resp.ErrCodes(), tt.errCode)
+			}
+			if n := kc.CallCount("POST /admin/realms/beta/groups"); n != 0 {
+				t.Errorf("%d groups created, want none", n)
+			}
+		})
+	}
+}
+
+// a group that can't be created is reported, and its subgroups are skipped while the rest are imported
+func TestGroupImportCreateFails(t *testing.T) {
+	kc := keycloaktest.NewServer(t)
+	kc.Realm("beta").AddGroup("/finance", nil)
+	s, _ := keycloaktest.NewService()
+	s.WithDependency("gocloak", kc.Client())
+
+	groups := []exportedGroup{
+		{Name: "finance", SubGroups: []exportedGroup{{Name: "payroll"}}},
+		{Name: "ops"},
+	}
+	w := keycloaktest.Do(s, Group_import, keycloaktest.NewRequest(http.MethodPost, "/groupimport", keycloaktest.Token("beta", "alice"), keycloaktest.Data(groups)))
+	var data struct {
+		Result struct {
+			Results []importResult `json:"results"`
+		} `json:"result"`
+	}
+	if resp := keycloaktest.Decode(t, w, &data); w.Code != http.StatusOK || resp.Status != "success" {
+		t.Fatalf("Group_import() = %d %s, want success", w.Code, w.Body)
+	}
+	var statuses []string
+	for _, result := range data.Result.Results {
+		statuses = append(statuses, result.Path+" "+result.Status)
+	}
+	if want := []string{"/finance error", "/finance/payroll skipped", "/ops created"}; !reflect.DeepEqual(statuses, want) {
+		t.Errorf("import results = %v, want %v", statuses, want)
+	}
+}
+
+func exportRealm(t *testing.T, s *service.Service, realm string) []exportedGroup {
+	t.Helper()
+	w := keycloaktest.Do(s, Realm_exportGroups, keycloaktest.NewRequest(http.MethodGet, "/realmexportgroups", keycloaktest.Token(realm, "alice"), nil))
+	var exported []exportedGroup
+	if err := json.Unmarshal(w.Body.Bytes(), &exported); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("Realm_exportGroups(%s) = %d %s", realm, w.Code, w.Body)
+	}
+	return exported
+}
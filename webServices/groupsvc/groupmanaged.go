@@ -0,0 +1,79 @@
+package groupsvc
+
+import (
+	"github.com/remiges-tech/alya/service"
+)
+
+// defaultManagedAttrPrefix namespaces the group attributes idshield manages when no prefix is configured
+const defaultManagedAttrPrefix = "idshield_"
+
+// names of the group attributes idshield manages itself, they are stored under the managed prefix so they
+// can't collide with the tenant's own attributes
+const (
+	longNameAttr    = "longName"
+	descriptionAttr = "description"
+	createdByAttr   = "createdBy"
+)
+
+// legacyManagedAttrs maps each managed attribute to the key it was stored under before the prefix was
+// introduced. Reads fall back to the legacy key, and a group is migrated to the prefixed keys the next time
+// it is updated
+var legacyManagedAttrs = map[string]string{
+	longNameAttr:    "longName",
+	descriptionAttr: "idshield_description",
+	createdByAttr:   "createdBy",
+}
+
+// managedAttrPrefix returns the configured prefix of the managed attributes
+func managedAttrPrefix(s *service.Service) string {
+	prefix, _ := s.Dependencies["managedAttrPrefix"].(string)
+	if prefix == "" {
+		return defaultManagedAttrPrefix
+	}
+	return prefix
+}
+
+// managedKey returns the attribute key the managed attribute name is stored under
+func managedKey(s *service.Service, name string) string {
+	return managedAttrPrefix(s) + name
+}
+
+// managedAttr returns the value of the managed attribute name, falling back to its legacy key for groups
+// that haven't been written since the prefix was introduced
+func managedAttr(s *service.Service, attrs *map[string][]string, name string) (string, bool) {
+	if attrs == nil {
+		return "", false
+	}
+	for _, key := range []string{managedKey(s, name), legacyManagedAttrs[name]} {
+		if values := (*attrs)[key]; len(values) > 0 {
+			return values[0], true
+		}
+	}
+	return "", false
+}
+
+// reservedAttrKeys returns the keys, prefixed and legacy, of the managed attributes, which can't be changed
+// through the attribute endpoints
+func reservedAttrKeys(s *service.Service) []string {
+	var keys []string
+	for name, legacy := range legacyManagedAttrs {
+		keys = append(keys, managedKey(s, name), legacy)
+	}
+	return append(keys, managedKey(s, protectedAttr))
+}
+
+// migrateManagedAttrs moves the managed attributes attr still carries under their legacy key to the prefixed
+// key, a value already under the prefixed key wins
+func migrateManagedAttrs(s *service.Service, attr map[string][]string) {
+	for name, legacy := range legacyManagedAttrs {
+		key := managedKey(s, name)
+		values, ok := attr[legacy]
+		if !ok || key == legacy {
+			continue
+		}
+		if _, migrated := attr[key]; !migrated {
+			attr[key] = values
+		}
+		delete(attr, legacy)
+	}
+}
@@ -0,0 +1,130 @@
+package groupsvc
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/remiges-tech/alya/service"
+	"github.com/remiges-tech/idshield/internal/keycloaktest"
+)
+
+func TestManagedAttr(t *testing.T) {
+	s := &service.Service{Dependencies: service.Dependencies{}}
+	tests := []struct {
+		name      string
+		attrs     *map[string][]string
+		attr      string
+		want      string
+		wantFound bool
+	}{
+		{"nil attributes", nil, longNameAttr, "", false},
+		{"prefixed key", &map[string][]string{"idshield_longName": {"Admins"}}, longNameAttr, "Admins", true},
+		{"legacy key", &map[string][]string{"createdBy": {"alice"}}, createdByAttr, "alice", true},
+		{"prefixed key wins", &map[string][]string{"idshield_longName": {"new"}, "longName": {"old"}},
+			longNameAttr, "new", true},
+		{"empty values", &map[string][]string{"idshield_longName": {}}, longNameAttr, "", false},
+		{"absent", &map[string][]string{"dept": {"hr"}}, createdByAttr, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, found := managedAttr(s, tt.attrs, tt.attr)
+			if got != tt.want || found != tt.wantFound {
+				t.Errorf("managedAttr(%q) = %q, %v, want %q, %v", tt.attr, got, found, tt.want, tt.wantFound)
+			}
+		})
+	}
+}
+
+func TestManagedKey(t *testing.T) {
+	tests := []struct {
+		prefix any
+		want   string
+	}{
+		{nil, "idshield_longName"},
+		{"", "idshield_longName"},
+		{"acme-", "acme-longName"},
+	}
+	for _, tt := range tests {
+		s := &service.Service{Dependencies: service.Dependencies{"managedAttrPrefix": tt.prefix}}
+		if got := managedKey(s, longNameAttr); got != tt.want {
+			t.Errorf("managedKey() with prefix %v = %q, want %q", tt.prefix, got, tt.want)
+		}
+	}
+}
+
+func TestMigrateManagedAttrs(t *testing.T) {
+	s := &service.Service{Dependencies: service.Dependencies{}}
+	attr := map[string][]string{"dept": {"hr"}, "longName": {"old"}, "idshield_longName": {"new"}, "createdBy": {"alice"}, "idshield_description": {"team"}}
+	migrateManagedAttrs(s, attr)
+	want := map[string][]string{"dept": {"hr"}, "idshield_longName": {"new"}, "idshield_createdBy": {"alice"}, "idshield_description": {"team"}}
+	if !reflect.DeepEqual(attr, want) {
+		t.Errorf("migrateManagedAttrs() = %v, want %v", attr, want)
+	}
+}
+
+func TestGroupManagedAttrPrefix(t *testing.T) {
+	tests := []struct {
+		name   string
+		prefix string
+		want   map[string][]string
+	}{
+		{"default prefix", "", map[string][]string{"dept": {"hr"}, "site": {"pune"},
+			"idshield_longName": {"Admins"}, "idshield_description": {"Admins of acme"}, "idshield_createdBy": {"alice"}}},
+		{"configured prefix", "acme-", map[string][]string{"dept": {"hr"}, "site": {"pune"},
+			"acme-longName": {"Admins"}, "acme-description": {"Admins of acme"}, "acme-createdBy": {"alice"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kc := keycloaktest.NewServer(t)
+			realm := kc.Realm("acme")
+			s, _ := keycloaktest.NewService()
+			s.WithDependency("gocloak", kc.Client()).WithDependency("managedAttrPrefix", tt.prefix)
+			token := keycloaktest.Token("acme", "alice")
+			create := map[string]any{"shortName": "admins", "longName": "Admins", "description": "Admins of acme", "attr": map[string]string{"dept": "hr", "site": "pune"}}
+
+			w := keycloaktest.Do(s, Group_new, keycloaktest.NewRequest(http.MethodPost, "/groupnew", token, keycloaktest.Data(create)))
+			grp := realm.Group("/admins")
+			if w.Code != http.StatusOK || grp == nil {
+				t.Fatalf("Group_new() = %d %s, want the group created", w.Code, w.Body)
+			}
+			if !reflect.DeepEqual(grp.Attributes, tt.want) {
+				t.Errorf("attributes = %v, want %v", grp.Attributes, tt.want)
+			}
+
+			// the managed attributes are read back from under the prefix
+			w = keycloaktest.Do(s, Group_get, keycloaktest.NewRequest(http.MethodGet, "/groupget?shortName=admins", token, nil))
+			var data groupResponse
+			keycloaktest.Decode(t, w, &data)
+			if w.Code != http.StatusOK || data.Description == nil || *data.Description != "Admins of acme" {
+				t.Errorf("Group_get() = %d %s, want the description", w.Code, w.Body)
+			}
+		})
+	}
+}
+
+func TestGroupUpdateMigratesLegacyAttrs(t *testing.T) {
+	kc := keycloaktest.NewServer(t)
+	realm := kc.Realm("acme")
+	admins := realm.AddGroup("/admins", map[string][]string{"longName": {"Admins"}, "createdBy": {"bob"}, "dept": {"hr"}})
+	s, _ := keycloaktest.NewService()
+	s.WithDependency("gocloak", kc.Client()).WithDependency("keycloakURL", kc.URL)
+	token := keycloaktest.Token("acme", "alice")
+
+	// the un-prefixed longName is still read before the group is migrated
+	w := keycloaktest.Do(s, Group_list, keycloaktest.NewRequest(http.MethodGet, "/grouplist", token, nil))
+	var page struct {
+		Items []groupListResponse `json:"items"`
+	}
+	keycloaktest.Decode(t, w, &page)
+	if w.Code != http.StatusOK || len(page.Items) != 1 || page.Items[0].LongName == nil || *page.Items[0].LongName != "Admins" {
+		t.Fatalf("Group_list() = %d %s, want the legacy longName", w.Code, w.Body)
+	}
+
+	update := map[string]any{"shortName": "admins", "longName": "Administrators", "attr": map[string]string{"dept": "it"}}
+	w = keycloaktest.Do(s, Group_update, keycloaktest.NewRequest(http.MethodPost, "/groupupdate", token, keycloaktest.Data(update)))
+	want := map[string][]string{"idshield_longName": {"Administrators"}, "idshield_createdBy": {"bob"}, "dept": {"it"}}
+	if w.Code != http.StatusOK || !reflect.DeepEqual(admins.Attributes, want) {
+		t.Errorf("Group_update() = %d with attributes %v, want %v", w.Code, admins.Attributes, want)
+	}
+}
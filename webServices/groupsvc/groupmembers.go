@@ -0,0 +1,350 @@
+package groupsvc
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/Nerzal/gocloak/v13"
+	"github.com/gin-gonic/gin"
+	"github.com/remiges-tech/alya/router"
+	"github.com/remiges-tech/alya/service"
+	"github.com/remiges-tech/alya/wscutils"
+	"github.com/remiges-tech/idshield/types"
+	"github.com/remiges-tech/idshield/utils"
+	"github.com/remiges-tech/logharbour/logharbour"
+)
+
+// page size used when walking through all users or members of a realm
+const keycloakPageSize = 100
+
+type memberResponse struct {
+	ID        *string `json:"id,omitempty"`
+	Username  *string `json:"username,omitempty"`
+	Email     *string `json:"email,omitempty"`
+	FirstName *string `json:"firstName,omitempty"`
+	LastName  *string `json:"lastName,omitempty"`
+	Enabled   *bool   `json:"enabled,omitempty"`
+}
+
+// Group_nonMembers handles the GET /groupnonmembers request, it returns the realm users who are not members of the given group.
+// Keycloak has no inverse membership query, so every member of the group and every user of the realm is fetched
+// and the page is built after subtracting one from the other; the cost grows with the size of the realm.
+func Group_nonMembers(c *gin.Context, s *service.Service) {
+	l := utils.RequestLogger(c, s, "Group_nonMembers")
+	l.Log("Starting execution of Group_nonMembers()")
+	token, err := router.ExtractToken(c.GetHeader("Authorization"))
+	if err != nil {
+		l.Debug0().LogDebug("Missing or incorrect Authorization header format:", logharbour.DebugInfo{Variables: map[string]any{"error": err}})
+		wscutils.SendErrorResponse(c, wscutils.NewErrorResponse(utils.ErrTokenMissing))
+		return
+	}
+	r, err := utils.ExtractClaimFromJwt(token, "iss")
+	if err != nil {
+		l.Debug0().LogDebug("Missing or incorrect realm:", logharbour.DebugInfo{Variables: map[string]any{"error": err}})
+		wscutils.SendErrorResponse(c, wscutils.NewErrorResponse(utils.ErrRealmNotFound))
+		return
+	}
+	parts := strings.Split(r, "/realms/")
+	if len(parts) != 2 {
+		l.Debug0().LogDebug("Missing or incorrect realm:", logharbour.DebugInfo{Variables: map[string]any{"iss": r}})
+		wscutils.SendErrorResponse(c, wscutils.NewErrorResponse(utils.ErrRealmNotFound))
+		return
+	}
+	realm := utils.CanonicalRealm(c, s, token, parts[1])
+	l = utils.WithRealm(l, realm)
+	username, err := utils.ExtractClaimFromJwt(token, "preferred_username")
+	if err != nil {
+		l.Debug0().LogDebug("Missing username:", logharbour.DebugInfo{Variables: map[string]any{"error": err}})
+		wscutils.SendErrorResponse(c, wscutils.NewErrorResponse(utils.ErrUserNotFound))
+		return
+	}
+
+	isCapable, _ := utils.Authz_check(types.OpReq{
+		User:      username,
+		CapNeeded: []string{utils.CapGroupRead, utils.CapUserRead},
+	}, false)
+
+	if !isCapable {
+		l.Log("Unauthorized user:")
+		wscutils.SendErrorResponse(c, wscutils.NewErrorResponse(utils.ErrUnauthorized))
+		return
+	}
+
+	shortName := c.Query("shortName")
+	if gocloak.NilOrEmpty(&shortName) {
+		l.Log("shortName missing")
+		wscutils.SendErrorResponse(c, wscutils.NewResponse(wscutils.ErrorStatus, nil, []wscutils.ErrorMessage{wscutils.BuildErrorMessage(wscutils.ErrcodeMissing, nil, "shortName")}))
+		return
+	}
+	first, max, err := utils.GetPagingParams(c)
+	if err != nil {
+		l.Debug0().LogDebug("Invalid paging params:", logharbour.DebugInfo{Variables: map[string]any{"error": err}})
+		wscutils.SendErrorResponse(c, wscutils.NewErrorResponse(utils.ErrInvalidParam))
+		return
+	}
+	max = utils.GetRealmConfig(c, s, token, realm).CapMax(max)
+
+	// Extracting the GoCloak client from the service dependencies
+	gcClient, ok := s.Dependencies["gocloak"].(*gocloak.GoCloak)
+	if !ok {
+		l.Log("Failed to load the dependency to *gocloak.GoCloak")
+		wscutils.SendErrorResponse(c, wscutils.NewErrorResponse(utils.ErrFailedToLoadDependence))
+		return
+	}
+
+	found, err := utils.GetGroupByExactName(c, gcClient, token, realm, shortName)
+	if errors.Is(err, utils.ErrGroupNotFound) {
+		l.Log("Error while gcClient.GetGroups Group doesn't exist ")
+		str := "shortName"
+		wscutils.SendErrorResponse(c, utils.NotFound(utils.ResourceGroup, shortName, wscutils.BuildErrorMessage(utils.ErrNotExist, &str)))
+		return
+	}
+	if err != nil {
+		utils.GocloakErrorHandler(c, l, err)
+		return
+	}
+	groupID := *found.ID
+
+	// collect the ids of every member of the group
+	memberIDs := make(map[string]bool)
+	for page := 0; ; page += keycloakPageSize {
+		members, err := gcClient.GetGroupMembers(c, token, realm, groupID, gocloak.GetGroupsParams{
+			First: gocloak.IntP(page),
+			Max:   gocloak.IntP(keycloakPageSize),
+		})
+		if err != nil {
+			utils.GocloakErrorHandler(c, l, err)
+			return
+		}
+		for _, member := range members {
+			memberIDs[*member.ID] = true
+		}
+		if len(members) < keycloakPageSize {
+			break
+		}
+	}
+
+	// walk the realm users, skipping members, until the requested page is filled
+	nonMembers := []memberResponse{}
+	skipped := 0
+	for page := 0; len(nonMembers) < max; page += keycloakPageSize {
+		users, err := gcClient.GetUsers(c, token, realm, gocloak.GetUsersParams{
+			First: gocloak.IntP(page),
+			Max:   gocloak.IntP(keycloakPageSize),
+		})
+		if err != nil {
+			utils.GocloakErrorHandler(c, l, err)
+			return
+		}
+		for _, user := range users {
+			if memberIDs[*user.ID] {
+				continue
+			}
+			if skipped < first {
+				skipped++
+				continue
+			}
+			if len(nonMembers) == max {
+				break
+			}
+			nonMembers = append(nonMembers, toMemberResponse(user))
+		}
+		if len(users) < keycloakPageSize {
+			break
+		}
+	}
+
+	utils.SendSuccess(c, opGroupNonMembers, wscutils.NewSuccessResponse(map[string]any{"users": nonMembers, "first": first, "max": max}))
+
+	l.Log("Finished execution of Group_nonMembers()")
+}
+
+// Group_members handles the GET /groupmembers request, it returns a page of the group's members together with
+// the total member count, both limited to enabled members with activeOnly=true. Pages larger than
+// keycloakPageSize are fetched in several calls
+func Group_members(c *gin.Context, s *service.Service) {
+	l := utils.RequestLogger(c, s, "Group_members")
+	l.Log("Starting execution of Group_members()")
+	token, err := router.ExtractToken(c.GetHeader("Authorization"))
+	if err != nil {
+		l.Debug0().LogDebug("Missing or incorrect Authorization header format:", logharbour.DebugInfo{Variables: map[string]any{"error": err}})
+		wscutils.SendErrorResponse(c, wscutils.NewErrorResponse(utils.ErrTokenMissing))
+		return
+	}
+	r, err := utils.ExtractClaimFromJwt(token, "iss")
+	if err != nil {
+		l.Debug0().LogDebug("Missing or incorrect realm:", logharbour.DebugInfo{Variables: map[string]any{"error": err}})
+		wscutils.SendErrorResponse(c, wscutils.NewErrorResponse(utils.ErrRealmNotFound))
+		return
+	}
+	parts := strings.Split(r, "/realms/")
+	if len(parts) != 2 {
+		l.Debug0().LogDebug("Missing or incorrect realm:", logharbour.DebugInfo{Variables: map[string]any{"iss": r}})
+		wscutils.SendErrorResponse(c, wscutils.NewErrorResponse(utils.ErrRealmNotFound))
+		return
+	}
+	realm := utils.CanonicalRealm(c, s, token, parts[1])
+	l = utils.WithRealm(l, realm)
+	username, err := utils.ExtractClaimFromJwt(token, "preferred_username")
+	if err != nil {
+		l.Debug0().LogDebug("Missing username:", logharbour.DebugInfo{Variables: map[string]any{"error": err}})
+		wscutils.SendErrorResponse(c, wscutils.NewErrorResponse(utils.ErrUserNotFound))
+		return
+	}
+
+	isCapable, _ := utils.Authz_check(types.OpReq{
+		User:      username,
+		CapNeeded: []string{utils.CapGroupRead},
+	}, false)
+
+	if !isCapable {
+		l.Log("Unauthorized user:")
+		wscutils.SendErrorResponse(c, wscutils.NewErrorResponse(utils.ErrUnauthorized))
+		return
+	}
+
+	shortName := c.Query("shortName")
+	if gocloak.NilOrEmpty(&shortName) {
+		l.Log("shortName missing")
+		wscutils.SendErrorResponse(c, wscutils.NewResponse(wscutils.ErrorStatus, nil, []wscutils.ErrorMessage{wscutils.BuildErrorMessage(wscutils.ErrcodeMissing, nil, "shortName")}))
+		return
+	}
+	first, max, err := utils.GetPagingParams(c)
+	if err != nil {
+		l.Debug0().LogDebug("Invalid paging params:", logharbour.DebugInfo{Variables: map[string]any{"error": err}})
+		wscutils.SendErrorResponse(c, wscutils.NewErrorResponse(utils.ErrInvalidParam))
+		return
+	}
+	max = utils.GetRealmConfig(c, s, token, realm).CapMax(max)
+
+	// Extracting the GoCloak client from the service dependencies
+	gcClient, ok := s.Dependencies["gocloak"].(*gocloak.GoCloak)
+	if !ok {
+		l.Log("Failed to load the dependency to *gocloak.GoCloak")
+		wscutils.SendErrorResponse(c, wscutils.NewErrorResponse(utils.ErrFailedToLoadDependence))
+		return
+	}
+
+	grp, err := utils.GetGroupByExactName(c, gcClient, token, realm, shortName)
+	if errors.Is(err, utils.ErrGroupNotFound) {
+		l.Log("Error while gcClient.GetGroups Group doesn't exist ")
+		str := "shortName"
+		wscutils.SendErrorResponse(c, utils.NotFound(utils.ResourceGroup, shortName, wscutils.BuildErrorMessage(utils.ErrNotExist, &str)))
+		return
+	}
+	if err != nil {
+		utils.GocloakErrorHandler(c, l, err)
+		return
+	}
+
+	// activeOnly=true leaves out disabled members, the same as the member count of Group_get
+	activeOnly := c.Query("activeOnly") == "true"
+	total, err := countGroupMembers(c, gcClient, token, realm, *grp.ID, activeOnly)
+	if err != nil {
+		utils.GocloakErrorHandler(c, l, err)
+		return
+	}
+
+	members := []memberResponse{}
+	if activeOnly {
+		if members, err = activeGroupMembers(c, gcClient, token, realm, *grp.ID, first, max); err != nil {
+			utils.GocloakErrorHandler(c, l, err)
+			return
+		}
+	} else {
+		for offset := first; len(members) < max; offset += keycloakPageSize {
+			batchSize := keycloakPageSize
+			if remaining := max - len(members); remaining < batchSize {
+				batchSize = remaining
+			}
+			batch, err := gcClient.GetGroupMembers(c, token, realm, *grp.ID, gocloak.GetGroupsParams{
+				First: gocloak.IntP(offset),
+				Max:   gocloak.IntP(batchSize),
+			})
+			if err != nil {
+				utils.GocloakErrorHandler(c, l, err)
+				return
+			}
+			for _, member := range batch {
+				members = append(members, toMemberResponse(member))
+			}
+			if len(batch) < batchSize {
+				break
+			}
+		}
+	}
+
+	utils.SendSuccess(c, opGroupMembers, wscutils.NewSuccessResponse(utils.NewPage(members, len(members), total, first, max)))
+
+	l.Log("Finished execution of Group_members()")
+}
+
+// countGroupMembers returns the total number of members of a group, paging through GetGroupMembers.
+// With activeOnly set, members whose enabled flag is false are not counted
+func countGroupMembers(c context.Context, gcClient *gocloak.GoCloak, token, realm, groupID string, activeOnly bool) (int, error) {
+	count := 0
+	for page := 0; ; page += keycloakPageSize {
+		members, err := gcClient.GetGroupMembers(c, token, realm, groupID, gocloak.GetGroupsParams{
+			First:               gocloak.IntP(page),
+			Max:                 gocloak.IntP(keycloakPageSize),
+			BriefRepresentation: gocloak.BoolP(true),
+		})
+		if err != nil {
+			return 0, err
+		}
+		for _, member := range members {
+			if activeOnly && !gocloak.PBool(member.Enabled) {
+				continue
+			}
+			count++
+		}
+		if len(members) < keycloakPageSize {
+			return count, nil
+		}
+	}
+}
+
+// activeGroupMembers returns up to max enabled members of the group, skipping the first enabled ones. Keycloak
+// can't filter members by their enabled flag, so the group is paged from its start and disabled members dropped
+func activeGroupMembers(c context.Context, gcClient *gocloak.GoCloak, token, realm, groupID string, first, max int) ([]memberResponse, error) {
+	members := []memberResponse{}
+	skipped := 0
+	for page := 0; len(members) < max; page += keycloakPageSize {
+		batch, err := gcClient.GetGroupMembers(c, token, realm, groupID, gocloak.GetGroupsParams{
+			First: gocloak.IntP(page),
+			Max:   gocloak.IntP(keycloakPageSize),
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, member := range batch {
+			if !gocloak.PBool(member.Enabled) {
+				continue
+			}
+			if skipped < first {
+				skipped++
+				continue
+			}
+			if len(members) < max {
+				members = append(members, toMemberResponse(member))
+			}
+		}
+		if len(batch) < keycloakPageSize {
+			break
+		}
+	}
+	return members, nil
+}
+
+// toMemberResponse maps a keycloak user to the member fields returned by the group endpoints
+func toMemberResponse(user *gocloak.User) memberResponse {
+	return memberResponse{
+		ID:        user.ID,
+		Username:  user.Username,
+		Email:     user.Email,
+		FirstName: user.FirstName,
+		LastName:  user.LastName,
+		Enabled:   user.Enabled,
+	}
+}
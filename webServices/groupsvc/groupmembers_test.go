@@ -0,0 +1,130 @@
+package groupsvc
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/remiges-tech/idshield/internal/keycloaktest"
+	"github.com/remiges-tech/idshield/utils"
+)
+
+func TestGroupNonMembers(t *testing.T) {
+	kc := keycloaktest.NewServer(t)
+	realm := kc.Realm("acme")
+	alice, bob := realm.AddUser("alice", true), realm.AddUser("bob", true)
+	realm.AddUser("carol", true)
+	realm.AddUser("dave", false)
+	realm.AddUser("erin", true)
+	realm.AddGroup("/admins", nil).AddMembers(alice, bob)
+	realm.AddGroup("/admins-eu", nil)
+	s, _ := keycloaktest.NewService()
+	s.WithDependency("gocloak", kc.Client())
+
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"shortName=admins", []string{"carol", "dave", "erin"}},
+		{"shortName=admins&first=1&max=1", []string{"dave"}},
+		{"shortName=admins-eu&max=2", []string{"alice", "bob"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			w := keycloaktest.Do(s, Group_nonMembers, keycloaktest.NewRequest(http.MethodGet, "/groupnonmembers?"+tt.query, keycloaktest.Token("acme", "alice"), nil))
+			var data struct {
+				Users []memberResponse `json:"users"`
+			}
+			keycloaktest.Decode(t, w, &data)
+			got := []string{}
+			for _, user := range data.Users {
+				got = append(got, *user.Username)
+			}
+			if w.Code != http.StatusOK || !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Group_nonMembers(%s) = %d %v, want %v", tt.query, w.Code, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGroupNonMembersUnknownGroup(t *testing.T) {
+	kc := keycloaktest.NewServer(t)
+	kc.Realm("acme").AddGroup("/admins-eu", nil)
+	s, _ := keycloaktest.NewService()
+	s.WithDependency("gocloak", kc.Client())
+
+	w := keycloaktest.Do(s, Group_nonMembers, keycloaktest.NewRequest(http.MethodGet, "/groupnonmembers?shortName=admins", keycloaktest.Token("acme", "alice"), nil))
+	resp := keycloaktest.Decode(t, w, nil)
+	if w.Code != http.StatusBadRequest || !reflect.DeepEqual(resp.ErrCodes(), []string{utils.ErrResourceNotFound, utils.ErrNotExist}) {
+		t.Errorf("Group_nonMembers() = %d %s, want 400 %s %s", w.Code, w.Body, utils.ErrResourceNotFound, utils.ErrNotExist)
+	}
+}
+
+func TestGroupMembersPaging(t *testing.T) {
+	kc := keycloaktest.NewServer(t)
+	realm := kc.Realm("acme")
+	grp := realm.AddGroup("/admins", nil)
+	for i := 0; i < 120; i++ {
+		grp.AddMembers(realm.AddUser(fmt.Sprintf("user%03d", i), true))
+	}
+	s, _ := keycloaktest.NewService()
+	s.WithDependency("gocloak", kc.Client())
+
+	tests := []struct {
+		first     int
+		wantCount int
+		wantFirst string
+		wantMore  bool
+	}{
+		{0, 50, "user000", true},
+		{50, 50, "user050", true},
+		{100, 20, "user100", false},
+	}
+	for _, tt := range tests {
+		query := fmt.Sprintf("shortName=admins&first=%d&max=50", tt.first)
+		w := keycloaktest.Do(s, Group_members, keycloaktest.NewRequest(http.MethodGet, "/groupmembers?"+query, keycloaktest.Token("acme", "alice"), nil))
+		var members []memberResponse
+		page := utils.Page{Items: &members}
+		keycloaktest.Decode(t, w, &page)
+		if w.Code != http.StatusOK || page.Total != 120 || len(members) != tt.wantCount || page.HasMore != tt.wantMore {
+			t.Fatalf("Group_members(%s) = %d total %d, %d members, hasMore %v, want total 120, %d members, hasMore %v",
+				query, w.Code, page.Total, len(members), page.HasMore, tt.wantCount, tt.wantMore)
+		}
+		if *members[0].Username != tt.wantFirst {
+			t.Errorf("Group_members(%s) first member = %s, want %s", query, *members[0].Username, tt.wantFirst)
+		}
+	}
+}
+
+func TestGroupMembersActiveOnly(t *testing.T) {
+	kc := keycloaktest.NewServer(t)
+	realm := kc.Realm("acme")
+	realm.AddGroup("/admins", nil).AddMembers(
+		realm.AddUser("alice", true), realm.AddUser("bob", false), realm.AddUser("carol", true), realm.AddUser("dave", true))
+	s, _ := keycloaktest.NewService()
+	s.WithDependency("gocloak", kc.Client())
+
+	tests := []struct {
+		query     string
+		wantTotal int
+		want      []string
+	}{
+		{"shortName=admins", 4, []string{"alice", "bob", "carol", "dave"}},
+		{"shortName=admins&activeOnly=true", 3, []string{"alice", "carol", "dave"}},
+		{"shortName=admins&activeOnly=true&first=1&max=1", 3, []string{"carol"}},
+	}
+	for _, tt := range tests {
+		w := keycloaktest.Do(s, Group_members, keycloaktest.NewRequest(http.MethodGet, "/groupmembers?"+tt.query, keycloaktest.Token("acme", "alice"), nil))
+		var members []memberResponse
+		page := utils.Page{Items: &members}
+		keycloaktest.Decode(t, w, &page)
+		got := []string{}
+		for _, member := range members {
+			got = append(got, *member.Username)
+		}
+		if w.Code != http.StatusOK || page.Total != tt.wantTotal || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Group_members(%s) = %d total %d %v, want total %d %v", tt.query, w.Code, page.Total, got, tt.wantTotal, tt.want)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package groupsvc
+
+import (
+	"strings"
+
+	"github.com/Nerzal/gocloak/v13"
+	"github.com/gin-gonic/gin"
+	"github.com/remiges-tech/alya/service"
+	"github.com/remiges-tech/alya/wscutils"
+	"github.com/remiges-tech/idshield/utils"
+	"github.com/remiges-tech/logharbour/logharbour"
+)
+
+// groupMoveRequest names the group to move by path and its new parent by path or id, with neither
+// (or a "/" target) the group moves to the top level
+type groupMoveRequest struct {
+	Source   string `json:"source" validate:"required"`
+	Target   string `json:"target"`
+	TargetID string `json:"targetId"`
+}
+
+type groupMoveResponse struct {
+	ID   *string `json:"id"`
+	Path string  `json:"path"`
+}
+
+// Group_move handles the POST /groupmove request, it moves a group, with its subgroups, under another group
+// or to the top level of the realm
+func Group_move(c *gin.Context, s *service.Service) {
+	utils.Handler("Group_move", []string{utils.CapGroupUpdate}, groupMove)(c, s)
+}
+
+// groupMove is the business logic of Group_move, utils.Handler has done the token, realm and authz checks
+func groupMove(ctx utils.HandlerContext) {
+	c, s, l := ctx.Gin, ctx.Service, ctx.Logger
+	token, realm, gcClient := ctx.Token, ctx.Realm, ctx.Client
+
+	var req groupMoveRequest
+	if !utils.RequireJSON(c) {
+		l.Log("Unsupported content type")
+		return
+	}
+	if err := wscutils.BindJSON(c, &req); err != nil {
+		l.LogActivity("Error Unmarshalling JSON to struct:", logharbour.DebugInfo{Variables: map[string]any{"Error": err.Error()}})
+		return
+	}
+	if strings.Trim(req.Source, "/") == "" {
+		l.Log("source missing")
+		wscutils.SendErrorResponse(c, wscutils.NewResponse(wscutils.ErrorStatus, nil, []wscutils.ErrorMessage{wscutils.BuildErrorMessage(wscutils.ErrcodeMissing, nil, "source")}))
+		return
+	}
+	if req.Target != "" && req.TargetID != "" {
+		l.Log("both target and targetId given")
+		wscutils.SendErrorResponse(c, wscutils.NewResponse(wscutils.ErrorStatus, nil, []wscutils.ErrorMessage{wscutils.BuildErrorMessage(utils.ErrInvalidParam, nil, "target", "targetId")}))
+		return
+	}
+	source := normalizeGroupPath(strings.TrimSuffix(req.Source, "/"))
+	toTopLevel := strings.Trim(req.Target, "/") == "" && req.TargetID == ""
+	target := normalizeGroupPath(strings.TrimSuffix(req.Target, "/"))
+
+	// naming the same group as source and target is rejected before any lookup
+	if req.TargetID == "" && !toTopLevel && source == target {
+		l.Log("source and target are the same group")
+		moveError(c, utils.ErrInvalidMoveSelf, req.Target)
+		return
+	}
+
+	grp, err := gcClient.GetGroupByPath(c, token, realm, escapeGroupPath(source))
+	if err != nil {
+		utils.GocloakErrorHandler(c, l, err)
+		return
+	}
+
+	var parent *gocloak.Group
+	if !toTopLevel {
+		if req.TargetID != "" {
+			parent, err = gcClient.GetGroup(c, token, realm, req.TargetID)
+		} else {
+			parent, err = gcClient.GetGroupByPath(c, token, realm, escapeGroupPath(target))
+		}
+		if err != nil {
+			utils.GocloakErrorHandler(c, l, err)
+			return
+		}
+		// the group given as its own parent, e.g. by id
+		if gocloak.PString(parent.ID) == gocloak.PString(grp.ID) {
+			l.Log("group can't be its own parent")
+			moveError(c, utils.ErrInvalidMoveSelf, req.Target+req.TargetID)
+			return
+		}
+		// a group moved under one of its own descendants would detach the whole branch from the tree
+		if strings.HasPrefix(gocloak.PString(parent.Path), gocloak.PString(grp.Path)+"/") {
+			l.Log("group can't be moved under its own descendant")
+			moveError(c, utils.ErrInvalidMoveDescendant, req.Target+req.TargetID)
+			return
+		}
+	}
+
+	// posting an existing group, id included, under a parent (or at the top level) moves it there
+	moved := gocloak.Group{ID: grp.ID, Name: grp.Name}
+	if toTopLevel {
+		_, err = gcClient.CreateGroup(c, token, realm, moved)
+	} else {
+		_, err = gcClient.CreateChildGroup(c, token, realm, *parent.ID, moved)
+	}
+	if err != nil {
+		utils.GocloakErrorHandler(c, l, err)
+		return
+	}
+
+	newPath := "/" + gocloak.PString(grp.Name)
+	if !toTopLevel {
+		newPath = gocloak.PString(parent.Path) + newPath
+	}
+	l.LogActivity("Group moved:", map[string]any{"group": gocloak.PString(grp.ID), "from": gocloak.PString(grp.Path), "to": newPath, "by": ctx.Username})
+	utils.SendSuccess(c, opGroupMove, utils.NewMutationResponse(groupMoveResponse{ID: grp.ID, Path: newPath}, ctx.Username))
+	emitGroupEvent(s, utils.EventGroupUpdated, realm, gocloak.PString(grp.ID), ctx.Username)
+}
+
+// moveError rejects a move whose target is invalid for the group being moved
+func moveError(c *gin.Context, errCode, target string) {
+	field := "target"
+	wscutils.SendErrorResponse(c, wscutils.NewResponse(wscutils.ErrorStatus, nil, []wscutils.ErrorMessage{wscutils.BuildErrorMessage(errCode, &field, target)}))
+}
@@ -0,0 +1,88 @@
+package groupsvc
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/remiges-tech/idshield/internal/keycloaktest"
+	"github.com/remiges-tech/idshield/utils"
+)
+
+func TestGroupMove(t *testing.T) {
+	tests := []struct {
+		name     string
+		body     groupMoveRequest
+		wantPath string
+	}{
+		{"under another group", groupMoveRequest{Source: "/sales/eu", Target: "/marketing"}, "/marketing/eu"},
+		{"under a group given by id", groupMoveRequest{Source: "sales/eu", TargetID: "marketing"}, "/marketing/eu"},
+		{"to the top level", groupMoveRequest{Source: "/sales/eu", Target: "/"}, "/eu"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kc := keycloaktest.NewServer(t)
+			realm := kc.Realm("acme")
+			realm.AddGroup("/sales", nil)
+			eu := realm.AddGroup("/sales/eu", nil)
+			realm.AddGroup("/sales/eu/paris", nil)
+			marketing := realm.AddGroup("/marketing", nil)
+			if tt.body.TargetID != "" {
+				tt.body.TargetID = marketing.ID
+			}
+			s, _ := keycloaktest.NewService()
+			s.WithDependency("gocloak", kc.Client())
+
+			w := keycloaktest.Do(s, Group_move, keycloaktest.NewRequest(http.MethodPost, "/groupmove", keycloaktest.Token("acme", "alice"), keycloaktest.Data(tt.body)))
+			var data groupMoveResponse
+			keycloaktest.Decode(t, w, &utils.MutationResult{Result: &data})
+			if w.Code != http.StatusOK || data.Path != tt.wantPath || eu.Path() != tt.wantPath {
+				t.Fatalf("Group_move() = %d %s, want eu moved to %s", w.Code, w.Body, tt.wantPath)
+			}
+			if paris := realm.Group(tt.wantPath + "/paris"); paris == nil {
+				t.Error("subgroup paris didn't move along with eu")
+			}
+		})
+	}
+}
+
+func TestGroupMoveRejects(t *testing.T) {
+	tests := []struct {
+		name        string
+		body        groupMoveRequest
+		wantErr     string
+		wantLookups int
+	}{
+		// the same path twice is caught before any group is looked up
+		{"same source and target", groupMoveRequest{Source: "/sales", Target: "sales/"}, utils.ErrInvalidMoveSelf, 0},
+		{"own parent by id", groupMoveRequest{Source: "/sales", TargetID: "sales"}, utils.ErrInvalidMoveSelf, 2},
+		{"under a descendant", groupMoveRequest{Source: "/sales", Target: "/sales/eu/paris"}, utils.ErrInvalidMoveDescendant, 2},
+		{"target and targetId", groupMoveRequest{Source: "/sales", Target: "/marketing", TargetID: "sales"}, utils.ErrInvalidParam, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kc := keycloaktest.NewServer(t)
+			realm := kc.Realm("acme")
+			sales := realm.AddGroup("/sales", nil)
+			realm.AddGroup("/sales/eu/paris", nil)
+			realm.AddGroup("/marketing", nil)
+			if tt.body.TargetID != "" {
+				tt.body.TargetID = sales.ID
+			}
+			s, _ := keycloaktest.NewService()
+			s.WithDependency("gocloak", kc.Client())
+
+			w := keycloaktest.Do(s, Group_move, keycloaktest.NewRequest(http.MethodPost, "/groupmove", keycloaktest.Token("acme", "alice"), keycloaktest.Data(tt.body)))
+			resp := keycloaktest.Decode(t, w, nil)
+			if w.Code != http.StatusBadRequest || !reflect.DeepEqual(resp.ErrCodes(), []string{tt.wantErr}) {
+				t.Errorf("Group_move() = %d %s, want 400 %s", w.Code, w.Body, tt.wantErr)
+			}
+			if got := kc.CallCount("GET /admin/realms/acme/group"); got != tt.wantLookups {
+				t.Errorf("group lookups = %d, want %d", got, tt.wantLookups)
+			}
+			if sales.Path() != "/sales" || realm.Group("/sales/eu/paris") == nil {
+				t.Error("the hierarchy was changed")
+			}
+		})
+	}
+}
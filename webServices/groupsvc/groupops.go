@@ -0,0 +1,37 @@
+package groupsvc
+
+// operation names returned in the success envelope of the group handlers
+const (
+	opGroupCreate          = "group.create"
+	opGroupCreateWithRoles = "group.createWithRoles"
+	opGroupProvision       = "group.provision"
+	opGroupNewSubgroup     = "group.newSubgroup"
+	opGroupGet             = "group.get"
+	opGroupBatchGet        = "group.batchGet"
+	opGroupDetail          = "group.detail"
+	opGroupUpdate          = "group.update"
+	opGroupDelete          = "group.delete"
+	opGroupBulkDelete      = "group.bulkDelete"
+	opGroupDeleteTree      = "group.deleteTree"
+	opGroupList            = "group.list"
+	opGroupRefreshCounts   = "group.refreshCounts"
+	opGroupImport          = "group.import"
+	opGroupTree            = "group.tree"
+	opGroupAncestry        = "group.ancestry"
+	opGroupChildCount      = "group.childCount"
+	opGroupDiffRoles       = "group.diffRoles"
+	opGroupAttributes      = "group.attributes"
+	opGroupPatchAttributes = "group.patchAttributes"
+	opGroupClearAttributes = "group.clearAttributes"
+	opGroupFindByAttribute = "group.findByAttribute"
+	opGroupCountByAttr     = "group.countByAttribute"
+	opGroupAutocomplete    = "group.autocomplete"
+	opGroupCheckName       = "group.checkName"
+	opGroupMembers         = "group.members"
+	opGroupNonMembers      = "group.nonMembers"
+	opGroupAuditMembers    = "group.auditMembers"
+	opGroupTransferMembers = "group.transferMembers"
+	opGroupMove            = "group.move"
+	opGroupDisableMembers  = "group.disableMembers"
+	opGroupEnableMembers   = "group.enableMembers"
+)
@@ -0,0 +1,99 @@
+package groupsvc
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/remiges-tech/alya/service"
+	"github.com/remiges-tech/idshield/internal/keycloaktest"
+)
+
+// every successful group response carries status, operation, data and messages, and nothing else
+func TestGroupSuccessEnvelope(t *testing.T) {
+	newGroup := map[string]any{"shortName": "auditors", "longName": "Auditors", "attr": map[string]string{"dept": "finance"}}
+	tests := []struct {
+		op      string
+		handler service.HandlerFunc
+		method  string
+		target  string
+		body    any
+	}{
+		{opGroupCreate, Group_new, http.MethodPost, "/groupnew", newGroup},
+		{opGroupCreateWithRoles, Group_newWithRoles, http.MethodPost, "/groupnewwithroles", map[string]any{"shortName": "auditors", "longName": "Auditors", "attr": map[string]string{"dept": "finance"}, "realmRoles": []string{"auditor"}}},
+		{opGroupProvision, Group_provision, http.MethodPost, "/groupprovision", map[string]any{"shortName": "auditors", "longName": "Auditors", "attr": map[string]string{"dept": "finance"}, "members": []string{"bob"}}},
+		{opGroupNewSubgroup, Group_newSubgroup, http.MethodPost, "/groupnewsubgroup", map[string]any{"shortName": "auditors", "longName": "Auditors", "attr": map[string]string{"dept": "finance"}, "parent": "/admins"}},
+		{opGroupGet, Group_get, http.MethodGet, "/groupget?shortName=admins", nil},
+		{opGroupBatchGet, Group_batchGet, http.MethodPost, "/groupbatchget", map[string]any{"ids": []string{"missing"}}},
+		{opGroupDetail, Group_detail, http.MethodGet, "/groupdetail?shortName=admins", nil},
+		{opGroupUpdate, Group_update, http.MethodPost, "/groupupdate", map[string]any{"shortName": "admins", "longName": "Admins", "attr": map[string]string{"dept": "it"}}},
+		{opGroupDelete, Group_delete, http.MethodDelete, "/groupdelete?shortName=ops", nil},
+		{opGroupDeleteTree, Group_deleteTree, http.MethodDelete, "/groupdeletetree?path=/ops", nil},
+		{opGroupBulkDelete, Group_bulkDelete, http.MethodPost, "/groupbulkdelete", map[string]any{"shortNames": []string{"ops"}}},
+		{opGroupList, Group_list, http.MethodGet, "/grouplist", nil},
+		{opGroupDiffRoles, Group_diffRoles, http.MethodGet, "/groupdiffroles?shortNameA=admins&shortNameB=ops", nil},
+		{opGroupRefreshCounts, Group_refreshCounts, http.MethodPost, "/grouprefreshcounts", nil},
+		{opGroupImport, Group_import, http.MethodPost, "/groupimport", []map[string]any{{"name": "auditors", "path": "/auditors", "attributes": map[string][]string{"dept": {"finance"}}}}},
+		{opGroupTree, Group_tree, http.MethodGet, "/grouptree", nil},
+		{opGroupAncestry, Group_ancestry, http.MethodGet, "/groupancestry?path=/admins/eu", nil},
+		{opGroupChildCount, Group_childCount, http.MethodGet, "/groupchildcount?path=/admins", nil},
+		{opGroupAttributes, Group_attributes, http.MethodGet, "/groupattributes?shortName=admins", nil},
+		{opGroupPatchAttributes, Group_patchAttributes, http.MethodPatch, "/grouppatchattributes", map[string]any{"shortName": "admins", "patch": map[string]any{"site": "pune"}}},
+		{opGroupClearAttributes, Group_clearAttributes, http.MethodPost, "/groupclearattributes?shortName=admins&confirm=true", nil},
+		{opGroupFindByAttribute, Group_findByAttribute, http.MethodGet, "/groupfindbyattribute?key=dept&value=hr", nil},
+		{opGroupCountByAttr, Group_countByAttribute, http.MethodGet, "/groupcountbyattribute?key=dept&value=hr", nil},
+		{opGroupAutocomplete, Group_autocomplete, http.MethodGet, "/groupautocomplete?q=adm", nil},
+		{opGroupCheckName, Group_checkName, http.MethodGet, "/groupcheckname?shortName=auditors", nil},
+		{opGroupMembers, Group_members, http.MethodGet, "/groupmembers?shortName=admins", nil},
+		{opGroupNonMembers, Group_nonMembers, http.MethodGet, "/groupnonmembers?shortName=ops", nil},
+		{opGroupAuditMembers, Group_auditMembers, http.MethodGet, "/groupauditmembers?shortName=admins", nil},
+		{opGroupTransferMembers, Group_transferMembers, http.MethodPost, "/grouptransfermembers", map[string]any{"source": "admins", "target": "ops"}},
+		{opGroupMove, Group_move, http.MethodPost, "/groupmove", map[string]any{"source": "/admins/eu", "target": "/ops"}},
+		{opGroupDisableMembers, Group_disableMembers, http.MethodPost, "/groupdisablemembers", map[string]any{"shortName": "admins"}},
+		{opGroupEnableMembers, Group_enableMembers, http.MethodPost, "/groupenablemembers", map[string]any{"shortName": "admins"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.op, func(t *testing.T) {
+			kc := keycloaktest.NewServer(t)
+			realm := kc.Realm("acme")
+			realm.AddGroup("/admins", map[string][]string{"dept": {"hr"}, "idshield_longName": {"Admins"}}).AddMembers(realm.AddUser("bob", true))
+			realm.AddGroup("/admins/eu", nil)
+			realm.AddGroup("/ops", nil)
+			kc.Handle(http.MethodGet, "/admin/realms/acme", realmWithEvents(true))
+			kc.Handle(http.MethodGet, "/admin/realms/acme/admin-events", func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				w.Write([]byte("[]"))
+			})
+			s, _ := keycloaktest.NewService()
+			s.WithDependency("gocloak", kc.Client()).WithDependency("keycloakURL", kc.URL).WithDependency("countCache", newTestCountCache(kc))
+
+			var body map[string]any
+			if tt.body != nil {
+				body = keycloaktest.Data(tt.body)
+			}
+			w := keycloaktest.Do(s, tt.handler, keycloaktest.NewRequest(tt.method, tt.target, keycloaktest.Token("acme", "alice"), body))
+			if w.Code != http.StatusOK {
+				t.Fatalf("%s = %d %s, want 200", tt.target, w.Code, w.Body)
+			}
+			var envelope map[string]json.RawMessage
+			if err := json.Unmarshal(w.Body.Bytes(), &envelope); err != nil {
+				t.Fatalf("response %s isn't a JSON object: %v", w.Body, err)
+			}
+			var keys []string
+			for key := range envelope {
+				keys = append(keys, key)
+			}
+			sort.Strings(keys)
+			if want := []string{"data", "messages", "operation", "status"}; !reflect.DeepEqual(keys, want) {
+				t.Errorf("envelope keys = %v, want %v", keys, want)
+			}
+			var op string
+			json.Unmarshal(envelope["operation"], &op)
+			if op != tt.op {
+				t.Errorf("operation = %q, want %q", op, tt.op)
+			}
+		})
+	}
+}
@@ -0,0 +1,86 @@
+package groupsvc
+
+import (
+	"context"
+	"regexp"
+
+	"github.com/Nerzal/gocloak/v13"
+	"github.com/gin-gonic/gin"
+	"github.com/remiges-tech/alya/service"
+	"github.com/remiges-tech/alya/wscutils"
+	"github.com/remiges-tech/idshield/utils"
+	"github.com/remiges-tech/logharbour/logharbour"
+)
+
+// protectedAttr is the managed attribute marking a group as protected when set to "true". It is reserved, so
+// it can only be set or cleared in Keycloak itself
+const protectedAttr = "protected"
+
+// isProtected reports whether grp is a system group idshield must not change, either because its name
+// matches the configured protected_group_regex or because it carries the protected attribute
+func isProtected(s *service.Service, grp *gocloak.Group) bool {
+	if pattern, _ := s.Dependencies["protectedGroupPattern"].(*regexp.Regexp); pattern != nil && grp.Name != nil && pattern.MatchString(*grp.Name) {
+		return true
+	}
+	if grp.Attributes == nil {
+		return false
+	}
+	values := (*grp.Attributes)[managedKey(s, protectedAttr)]
+	return len(values) > 0 && values[0] == "true"
+}
+
+// checkNotProtected fetches the group and refuses the mutation with group_protected when it is protected.
+// On failure the error response has already been sent
+func checkNotProtected(c *gin.Context, s *service.Service, l *logharbour.Logger, gcClient *gocloak.GoCloak, token, realm, groupID string) bool {
+	grp, err := gcClient.GetGroup(c, token, realm, groupID)
+	if err != nil {
+		utils.GocloakErrorHandler(c, l, err)
+		return false
+	}
+	if isProtected(s, grp) {
+		l.Log("Refusing to modify protected group")
+		str := "shortName"
+		wscutils.SendErrorResponse(c, wscutils.NewResponse(wscutils.ErrorStatus, nil, []wscutils.ErrorMessage{wscutils.BuildErrorMessage(utils.ErrGroupProtected, &str, gocloak.PString(grp.Name))}))
+		return false
+	}
+	return true
+}
+
+// protectedInSubtree returns the name of the first protected group among the group and all its descendants, ""
+// when there is none. Keycloak's delete cascades to every subgroup, so a delete is only safe when this is "".
+// Each group is fetched on its own as subgroups embedded in a representation may come without attributes
+func protectedInSubtree(c context.Context, s *service.Service, gcClient *gocloak.GoCloak, token, realm, groupID string) (string, error) {
+	grp, err := gcClient.GetGroup(c, token, realm, groupID)
+	if err != nil {
+		return "", err
+	}
+	if isProtected(s, grp) {
+		return gocloak.PString(grp.Name), nil
+	}
+	if grp.SubGroups == nil {
+		return "", nil
+	}
+	for _, sub := range *grp.SubGroups {
+		if name, err := protectedInSubtree(c, s, gcClient, token, realm, *sub.ID); err != nil || name != "" {
+			return name, err
+		}
+	}
+	return "", nil
+}
+
+// checkSubtreeNotProtected refuses a delete with group_protected, naming the protected group, when the group or
+// any of its descendants is protected. On failure the error response has already been sent
+func checkSubtreeNotProtected(c *gin.Context, s *service.Service, l *logharbour.Logger, gcClient *gocloak.GoCloak, token, realm, groupID string) bool {
+	name, err := protectedInSubtree(c, s, gcClient, token, realm, groupID)
+	if err != nil {
+		utils.GocloakErrorHandler(c, l, err)
+		return false
+	}
+	if name != "" {
+		l.Log("Refusing to delete a subtree holding a protected group")
+		str := "shortName"
+		wscutils.SendErrorResponse(c, wscutils.NewResponse(wscutils.ErrorStatus, nil, []wscutils.ErrorMessage{wscutils.BuildErrorMessage(utils.ErrGroupProtected, &str, name)}))
+		return false
+	}
+	return true
+}
@@ -0,0 +1,145 @@
+package groupsvc
+
+import (
+	"net/http"
+	"reflect"
+	"regexp"
+	"testing"
+
+	"github.com/Nerzal/gocloak/v13"
+	"github.com/remiges-tech/alya/service"
+	"github.com/remiges-tech/idshield/internal/keycloaktest"
+	"github.com/remiges-tech/idshield/utils"
+)
+
+func TestIsProtected(t *testing.T) {
+	pattern := regexp.MustCompile(`^sys-`)
+	tests := []struct {
+		name    string
+		pattern *regexp.Regexp
+		grp     gocloak.Group
+		want    bool
+	}{
+		{"plain group", pattern, gocloak.Group{Name: gocloak.StringP("admins")}, false},
+		{"name matches pattern", pattern, gocloak.Group{Name: gocloak.StringP("sys-root")}, true},
+		{"no pattern configured", nil, gocloak.Group{Name: gocloak.StringP("sys-root")}, false},
+		{"protected attribute", nil, gocloak.Group{Name: gocloak.StringP("admins"),
+			Attributes: &map[string][]string{"idshield_protected": {"true"}}}, true},
+		{"protected attribute false", nil, gocloak.Group{Name: gocloak.StringP("admins"),
+			Attributes: &map[string][]string{"idshield_protected": {"false"}}}, false},
+		{"unprefixed attribute ignored", nil, gocloak.Group{Name: gocloak.StringP("admins"),
+			Attributes: &map[string][]string{"protected": {"true"}}}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &service.Service{Dependencies: service.Dependencies{}}
+			if tt.pattern != nil {
+				s.Dependencies["protectedGroupPattern"] = tt.pattern
+			}
+			if got := isProtected(s, &tt.grp); got != tt.want {
+				t.Errorf("isProtected() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGroupUpdateProtected(t *testing.T) {
+	tests := []struct {
+		name  string
+		group string
+		attrs map[string][]string
+	}{
+		{"by pattern", "sys-root", map[string][]string{"team": {"core"}}},
+		{"by attribute", "admins", map[string][]string{"team": {"core"}, "idshield_protected": {"true"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kc := keycloaktest.NewServer(t)
+			grp := kc.Realm("acme").AddGroup("/"+tt.group, tt.attrs)
+			s, _ := keycloaktest.NewService()
+			s.WithDependency("gocloak", kc.Client()).WithDependency("protectedGroupPattern", regexp.MustCompile(`^sys-`))
+			body := group{ShortName: tt.group, LongName: "Changed", Attributes: map[string]string{"team": "ops"}}
+
+			w := keycloaktest.Do(s, Group_update, keycloaktest.NewRequest(http.MethodPut, "/groupupdate", keycloaktest.Token("acme", "alice"), keycloaktest.Data(body)))
+			resp := keycloaktest.Decode(t, w, nil)
+			if w.Code != http.StatusBadRequest || !reflect.DeepEqual(resp.ErrCodes(), []string{utils.ErrGroupProtected}) {
+				t.Fatalf("Group_update(%s) = %d %s, want 400 %s", tt.group, w.Code, w.Body, utils.ErrGroupProtected)
+			}
+			if !reflect.DeepEqual(resp.Messages[0].Vals, []string{tt.group}) {
+				t.Errorf("group_protected vals = %v, want [%s]", resp.Messages[0].Vals, tt.group)
+			}
+			if got := grp.Attributes["team"]; !reflect.DeepEqual(got, []string{"core"}) {
+				t.Errorf("team = %v, want it left at core", got)
+			}
+		})
+	}
+}
+
+// Keycloak's delete cascades, so a protected descendant keeps the whole subtree from being deleted
+func TestGroupDeleteProtectedSubtree(t *testing.T) {
+	kc := keycloaktest.NewServer(t)
+	realm := kc.Realm("acme")
+	realm.AddGroup("/ops", nil)
+	realm.AddGroup("/ops/eu", nil)
+	realm.AddGroup("/ops/eu/sys-core", nil)
+	realm.AddGroup("/sales", nil)
+	s, _ := keycloaktest.NewService()
+	s.WithDependency("gocloak", kc.Client()).WithDependency("keycloakURL", kc.URL).
+		WithDependency("protectedGroupPattern", regexp.MustCompile(`^sys-`))
+	token := keycloaktest.Token("acme", "alice")
+
+	w := keycloaktest.Do(s, Group_delete, keycloaktest.NewRequest(http.MethodDelete, "/groupdelete?shortName=ops&force=true", token, nil))
+	resp := keycloaktest.Decode(t, w, nil)
+	if w.Code != http.StatusBadRequest || !reflect.DeepEqual(resp.ErrCodes(), []string{utils.ErrGroupProtected}) || !reflect.DeepEqual(resp.Messages[0].Vals, []string{"sys-core"}) {
+		t.Errorf("Group_delete(ops) = %d %s, want 400 %s naming sys-core", w.Code, w.Body, utils.ErrGroupProtected)
+	}
+	if realm.Group("/ops/eu/sys-core") == nil {
+		t.Fatalf("Group_delete(ops) deleted the protected subgroup")
+	}
+
+	w = keycloaktest.Do(s, Group_deleteTree, keycloaktest.NewRequest(http.MethodDelete, "/groupdeletetree?path=/ops", token, nil))
+	if resp := keycloaktest.Decode(t, w, nil); w.Code != http.StatusBadRequest || !reflect.DeepEqual(resp.ErrCodes(), []string{utils.ErrGroupProtected}) {
+		t.Errorf("Group_deleteTree(/ops) = %d %s, want 400 %s", w.Code, w.Body, utils.ErrGroupProtected)
+	}
+
+	body := groupBulkDeleteRequest{ShortNames: []string{"ops", "sales"}}
+	w = keycloaktest.Do(s, Group_bulkDelete, keycloaktest.NewRequest(http.MethodPost, "/groupbulkdelete", token, keycloaktest.Data(body)))
+	var data struct {
+		Results []bulkResult `json:"results"`
+	}
+	keycloaktest.Decode(t, w, &utils.MutationResult{Result: &data})
+	got := map[string]string{}
+	for _, result := range data.Results {
+		got[result.ShortName] = result.Status
+	}
+	if want := map[string]string{"ops": bulkStatusProtected, "sales": bulkStatusDeleted}; w.Code != http.StatusOK || !reflect.DeepEqual(got, want) {
+		t.Errorf("Group_bulkDelete() = %d %v, want %v", w.Code, got, want)
+	}
+	if realm.Group("/ops") == nil || realm.Group("/sales") != nil {
+		t.Errorf("Group_bulkDelete() deleted the wrong groups")
+	}
+}
+
+// the bulk delete protection check fails closed, a group that can't be read isn't deleted
+func TestGroupBulkDeleteProtectionCheckFails(t *testing.T) {
+	kc := keycloaktest.NewServer(t)
+	ops := kc.Realm("acme").AddGroup("/ops", nil)
+	kc.Handle(http.MethodGet, "/admin/realms/acme/groups/"+ops.ID, func(w http.ResponseWriter, r *http.Request) {
+		keycloaktest.Error(w, http.StatusInternalServerError, "unknown_error")
+	})
+	s, _ := keycloaktest.NewService()
+	s.WithDependency("gocloak", kc.Client()).WithDependency("keycloakURL", kc.URL)
+
+	body := groupBulkDeleteRequest{ShortNames: []string{"ops"}}
+	w := keycloaktest.Do(s, Group_bulkDelete, keycloaktest.NewRequest(http.MethodPost, "/groupbulkdelete", keycloaktest.Token("acme", "alice"), keycloaktest.Data(body)))
+	var data struct {
+		Results []bulkResult `json:"results"`
+	}
+	keycloaktest.Decode(t, w, &utils.MutationResult{Result: &data})
+	if w.Code != http.StatusOK || len(data.Results) != 1 || data.Results[0].Status != bulkStatusError {
+		t.Errorf("Group_bulkDelete() = %d %+v, want ops in error", w.Code, data.Results)
+	}
+	if kc.CallCount("DELETE /admin/realms/acme/groups/"+ops.ID) != 0 {
+		t.Errorf("Group_bulkDelete() deleted a group whose protection couldn't be checked")
+	}
+}
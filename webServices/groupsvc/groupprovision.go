@@ -0,0 +1,99 @@
+package groupsvc
+
+import (
+	"github.com/Nerzal/gocloak/v13"
+	"github.com/gin-gonic/gin"
+	"github.com/remiges-tech/alya/service"
+	"github.com/remiges-tech/alya/wscutils"
+	"github.com/remiges-tech/idshield/utils"
+	"github.com/remiges-tech/logharbour/logharbour"
+)
+
+type groupProvision struct {
+	group
+	Members     []string            `json:"members"`
+	RealmRoles  []string            `json:"realmRoles"`
+	ClientRoles map[string][]string `json:"clientRoles"`
+	// Rollback deletes the group when any step fails, instead of leaving it partially configured
+	Rollback bool `json:"rollback"`
+}
+
+type provisionResponse struct {
+	ID    string       `json:"id"`
+	Steps []stepResult `json:"steps"`
+}
+
+// Group_provision handles the POST /groupprovision request, it creates a fully configured group in one call:
+// the group is created, then its realm and client roles are assigned and finally its members are added.
+// Every step is reported; when some fail the group is rolled back (rollback=true) or returned as partially_created
+func Group_provision(c *gin.Context, s *service.Service) {
+	utils.Handler("Group_provision", []string{utils.CapGroupCreate, utils.CapGroupRoleAssign, utils.CapGroupMemberAdd}, provisionGroup)(c, s)
+}
+
+// provisionGroup is the business logic of Group_provision, utils.Handler has done the token, realm and authz checks
+func provisionGroup(ctx utils.HandlerContext) {
+	c, s, l := ctx.Gin, ctx.Service, ctx.Logger
+	token, realm, username, gcClient := ctx.Token, ctx.Realm, ctx.Username, ctx.Client
+
+	var g groupProvision
+
+	if !utils.RequireJSON(c) {
+		l.Log("Unsupported content type")
+		return
+	}
+	if !utils.LimitRequestBody(c, getMaxRequestBody(s)) {
+		l.Log("Request body too large")
+		return
+	}
+	if err := utils.BindJSONStrict(c, &g); err != nil {
+		l.LogActivity("Error Unmarshalling JSON to struct:", logharbour.DebugInfo{Variables: map[string]any{"Error": err.Error()}})
+		return
+	}
+	l.Debug0().LogDebug("Group_provision request:", logharbour.DebugInfo{Variables: map[string]any{"shortName": g.ShortName, "longName": g.LongName, "attr": utils.MaskAttributes(g.Attributes, getSensitiveAttrs(s)), "members": g.Members, "realmRoles": g.RealmRoles, "clientRoles": g.ClientRoles}})
+
+	if !prepareNewGroup(ctx, &g.group) {
+		return
+	}
+
+	attr := g.keycloakAttributes(s)
+	applyCreateDefaults(c, s, token, realm, attr, username)
+	ID, err := gcClient.CreateGroup(c, token, realm, gocloak.Group{
+		Name:       &g.ShortName,
+		Attributes: &attr,
+	})
+	if err != nil {
+		utils.GocloakErrorHandler(c, l, err)
+		return
+	}
+
+	steps := []stepResult{{Step: "create", Status: stepStatusOK}}
+	steps = append(steps, assignRealmRoles(c, gcClient, token, realm, ID, g.RealmRoles)...)
+	steps = append(steps, assignClientRoles(c, gcClient, token, realm, ID, g.ClientRoles)...)
+	steps = append(steps, addMembers(c, gcClient, token, realm, ID, g.Members)...)
+
+	failed := failedSteps(steps)
+	if len(failed) == 0 {
+		utils.SendSuccess(c, opGroupProvision, utils.NewMutationResponse(provisionResponse{ID: ID, Steps: steps}, username))
+		emitGroupEvent(s, utils.EventGroupCreated, realm, ID, username)
+		return
+	}
+	l.LogActivity("Provisioning steps failed:", map[string]any{"id": ID, "failedSteps": failed})
+
+	if g.Rollback {
+		err := gcClient.DeleteGroup(c, token, realm, ID)
+		if err == nil {
+			l.LogActivity("Group provisioning rolled back:", map[string]any{"id": ID})
+			names := make([]string, 0, len(failed))
+			for _, step := range failed {
+				names = append(names, step.Step)
+			}
+			wscutils.SendErrorResponse(c, wscutils.NewResponse(wscutils.ErrorStatus, nil, []wscutils.ErrorMessage{wscutils.BuildErrorMessage(utils.ErrGroupCreateRolledBack, nil, names...)}))
+			return
+		}
+		// the group could not be removed, so the caller has to know it exists
+		steps = append(steps, newStepResult("rollback", err))
+	}
+
+	utils.SendSuccess(c, opGroupProvision, &wscutils.Response{Status: statusPartiallyCreated, Data: provisionResponse{ID: ID, Steps: steps}, Messages: []wscutils.ErrorMessage{}})
+	emitGroupEvent(s, utils.EventGroupCreated, realm, ID, username)
+}
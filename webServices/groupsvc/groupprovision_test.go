@@ -0,0 +1,143 @@
+package groupsvc
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/remiges-tech/idshield/internal/keycloaktest"
+	"github.com/remiges-tech/idshield/utils"
+)
+
+func TestGroupProvision(t *testing.T) {
+	kc := keycloaktest.NewServer(t)
+	realm := kc.Realm("acme")
+	realm.Roles = []string{"auditor"}
+	realm.AddClient("ledger", "read", "write")
+	alice, bob := realm.AddUser("alice", true), realm.AddUser("bob", true)
+	s, _ := keycloaktest.NewService()
+	s.WithDependency("gocloak", kc.Client())
+	body := groupProvision{
+		group:       group{ShortName: "auditors", LongName: "Auditors", Attributes: map[string]string{"dept": "finance"}},
+		Members:     []string{"alice", "bob"},
+		RealmRoles:  []string{"auditor"},
+		ClientRoles: map[string][]string{"ledger": {"read"}},
+	}
+
+	w := keycloaktest.Do(s, Group_provision, keycloaktest.NewRequest(http.MethodPost, "/groupprovision", keycloaktest.Token("acme", "alice"), keycloaktest.Data(body)))
+	var data provisionResponse
+	resp := keycloaktest.Decode(t, w, &utils.MutationResult{Result: &data})
+	grp := realm.Group("/auditors")
+	if w.Code != http.StatusOK || resp.Status != "success" || grp == nil || data.ID != grp.ID {
+		t.Fatalf("Group_provision() = %d %s, want the group created", w.Code, w.Body)
+	}
+	wantSteps := []stepResult{
+		{Step: "create", Status: stepStatusOK},
+		{Step: "realmRole:auditor", Status: stepStatusOK},
+		{Step: "clientRole:ledger/read", Status: stepStatusOK},
+		{Step: "member:alice", Status: stepStatusOK},
+		{Step: "member:bob", Status: stepStatusOK},
+	}
+	if !reflect.DeepEqual(data.Steps, wantSteps) {
+		t.Errorf("steps = %+v, want %+v", data.Steps, wantSteps)
+	}
+	if !reflect.DeepEqual(grp.RealmRoles, []string{"auditor"}) || !reflect.DeepEqual(grp.ClientRoles, map[string][]string{"ledger": {"read"}}) {
+		t.Errorf("roles = %v %v, want [auditor] and ledger/read", grp.RealmRoles, grp.ClientRoles)
+	}
+	if !reflect.DeepEqual(grp.Members, []*keycloaktest.User{alice, bob}) {
+		t.Errorf("members = %v, want alice and bob", grp.Members)
+	}
+}
+
+func TestGroupProvisionFailedStep(t *testing.T) {
+	tests := []struct {
+		name     string
+		rollback bool
+	}{
+		{"partially created", false},
+		{"rolled back", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kc := keycloaktest.NewServer(t)
+			realm := kc.Realm("acme")
+			realm.Roles = []string{"auditor"}
+			realm.AddUser("alice", true)
+			s, _ := keycloaktest.NewService()
+			s.WithDependency("gocloak", kc.Client())
+			body := groupProvision{
+				group:      group{ShortName: "auditors", LongName: "Auditors", Attributes: map[string]string{"dept": "finance"}},
+				Members:    []string{"alice", "mallory"},
+				RealmRoles: []string{"auditor"},
+				Rollback:   tt.rollback,
+			}
+
+			w := keycloaktest.Do(s, Group_provision, keycloaktest.NewRequest(http.MethodPost, "/groupprovision", keycloaktest.Token("acme", "alice"), keycloaktest.Data(body)))
+			if tt.rollback {
+				resp := keycloaktest.Decode(t, w, nil)
+				if w.Code != http.StatusBadRequest || !reflect.DeepEqual(resp.ErrCodes(), []string{utils.ErrGroupCreateRolledBack}) || resp.Messages[0].Vals[0] != "member:mallory" {
+					t.Errorf("Group_provision() = %d %s, want 400 %s for member:mallory", w.Code, w.Body, utils.ErrGroupCreateRolledBack)
+				}
+				if realm.Group("/auditors") != nil {
+					t.Errorf("Group_provision() left the group behind after rolling back")
+				}
+				return
+			}
+
+			var data provisionResponse
+			resp := keycloaktest.Decode(t, w, &data)
+			grp := realm.Group("/auditors")
+			if w.Code != http.StatusOK || resp.Status != statusPartiallyCreated || grp == nil || data.ID != grp.ID {
+				t.Fatalf("Group_provision() = %d %s, want %s with the group's id", w.Code, w.Body, statusPartiallyCreated)
+			}
+			failed := failedSteps(data.Steps)
+			if len(failed) != 1 || failed[0].Step != "member:mallory" {
+				t.Errorf("failed steps = %+v, want member:mallory", failed)
+			}
+			if len(grp.Members) != 1 || grp.Members[0].Username != "alice" {
+				t.Errorf("members = %v, want the member that was found kept", grp.Members)
+			}
+		})
+	}
+}
+
+func TestGroupProvisionTrimsPaddedValues(t *testing.T) {
+	kc := keycloaktest.NewServer(t)
+	realm := kc.Realm("acme")
+	s, _ := keycloaktest.NewService()
+	s.WithDependency("gocloak", kc.Client())
+	body := groupProvision{group: group{ShortName: " auditors ", LongName: " Auditors ", Attributes: map[string]string{" dept": "finance"}}}
+
+	w := keycloaktest.Do(s, Group_provision, keycloaktest.NewRequest(http.MethodPost, "/groupprovision", keycloaktest.Token("acme", "alice"), keycloaktest.Data(body)))
+	grp := realm.Group("/auditors")
+	if w.Code != http.StatusOK || grp == nil {
+		t.Fatalf("Group_provision() = %d %s, want the group created as /auditors", w.Code, w.Body)
+	}
+	if !reflect.DeepEqual(grp.Attributes["idshield_longName"], []string{"Auditors"}) || !reflect.DeepEqual(grp.Attributes["dept"], []string{"finance"}) {
+		t.Errorf("attributes = %v, want trimmed longName and dept", grp.Attributes)
+	}
+}
+
+func TestGroupProvisionRepeatedMember(t *testing.T) {
+	kc := keycloaktest.NewServer(t)
+	realm := kc.Realm("acme")
+	alice := realm.AddUser("alice", true)
+	s, _ := keycloaktest.NewService()
+	s.WithDependency("gocloak", kc.Client())
+	body := groupProvision{group: group{ShortName: "auditors", LongName: "Auditors", Attributes: map[string]string{"dept": "finance"}}, Members: []string{"alice", "alice"}}
+
+	w := keycloaktest.Do(s, Group_provision, keycloaktest.NewRequest(http.MethodPost, "/groupprovision", keycloaktest.Token("acme", "alice"), keycloaktest.Data(body)))
+	var data provisionResponse
+	keycloaktest.Decode(t, w, &utils.MutationResult{Result: &data})
+	want := []stepResult{
+		{Step: "create", Status: stepStatusOK},
+		{Step: "member:alice", Status: stepStatusOK},
+		{Step: "member:alice", Status: stepStatusAlreadyMember},
+	}
+	if w.Code != http.StatusOK || !reflect.DeepEqual(data.Steps, want) {
+		t.Errorf("Group_provision() = %d %+v, want %+v", w.Code, data.Steps, want)
+	}
+	if grp := realm.Group("/auditors"); grp == nil || !reflect.DeepEqual(grp.Members, []*keycloaktest.User{alice}) {
+		t.Errorf("members = %v, want alice once", grp)
+	}
+}
@@ -0,0 +1,122 @@
+package groupsvc
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/remiges-tech/alya/wscutils"
+	"github.com/remiges-tech/idshield/internal/keycloaktest"
+)
+
+func TestGroupFindByAttribute(t *testing.T) {
+	kc := keycloaktest.NewServer(t)
+	realm := kc.Realm("acme")
+	realm.AddGroup("/hr", map[string][]string{"dept": {"hr"}})
+	realm.AddGroup("/finance/payroll", map[string][]string{"dept": {"hr"}})
+	realm.AddGroup("/sales", map[string][]string{"dept": {"sales"}})
+	s, _ := keycloaktest.NewService()
+	s.WithDependency("gocloak", kc.Client())
+	token := keycloaktest.Token("acme", "alice")
+
+	w := keycloaktest.Do(s, Group_findByAttribute, keycloaktest.NewRequest(http.MethodGet, "/groupfindbyattribute?key=dept&value=hr", token, nil))
+	var data struct {
+		Groups []groupResponse `json:"groups"`
+	}
+	keycloaktest.Decode(t, w, &data)
+	var names []string
+	for _, grp := range data.Groups {
+		names = append(names, *grp.Name)
+	}
+	sort.Strings(names)
+	if want := []string{"hr", "payroll"}; w.Code != http.StatusOK || !reflect.DeepEqual(names, want) {
+		t.Errorf("Group_findByAttribute(dept=hr) = %d %v, want %v", w.Code, names, want)
+	}
+
+	w = keycloaktest.Do(s, Group_findByAttribute, keycloaktest.NewRequest(http.MethodGet, "/groupfindbyattribute?key=dept", token, nil))
+	if resp := keycloaktest.Decode(t, w, nil); w.Code != http.StatusBadRequest || !reflect.DeepEqual(resp.ErrCodes(), []string{wscutils.ErrcodeMissing}) {
+		t.Errorf("Group_findByAttribute() without value = %d %s, want 400 missing", w.Code, w.Body)
+	}
+}
+
+func TestGroupCountByAttribute(t *testing.T) {
+	kc := keycloaktest.NewServer(t)
+	realm := kc.Realm("acme")
+	realm.AddGroup("/finance", map[string][]string{"department": {"finance"}})
+	realm.AddGroup("/finance/payroll", map[string][]string{"department": {"finance"}})
+	realm.AddGroup("/audit", map[string][]string{"department": {"finance", "audit"}})
+	realm.AddGroup("/sales", map[string][]string{"department": {"sales"}})
+	s, _ := keycloaktest.NewService()
+	s.WithDependency("gocloak", kc.Client())
+	token := keycloaktest.Token("acme", "alice")
+
+	tests := []struct {
+		query string
+		want  int
+	}{
+		{"key=department&value=finance", 3},
+		{"key=department&value=sales", 1},
+		{"key=department&value=legal", 0},
+	}
+	for _, tt := range tests {
+		w := keycloaktest.Do(s, Group_countByAttribute, keycloaktest.NewRequest(http.MethodGet, "/groupcountbyattribute?"+tt.query, token, nil))
+		var data struct {
+			Count int `json:"count"`
+		}
+		keycloaktest.Decode(t, w, &data)
+		if w.Code != http.StatusOK || data.Count != tt.want {
+			t.Errorf("Group_countByAttribute(%s) = %d %d, want %d", tt.query, w.Code, data.Count, tt.want)
+		}
+	}
+}
+
+func TestGroupAutocomplete(t *testing.T) {
+	kc := keycloaktest.NewServer(t)
+	realm := kc.Realm("acme")
+	for i := 0; i < 25; i++ {
+		realm.AddGroup(fmt.Sprintf("/team-%02d", i), map[string][]string{"dept": {"hr"}})
+	}
+	realm.AddGroup("/sales", nil)
+	s, _ := keycloaktest.NewService()
+	s.WithDependency("gocloak", kc.Client())
+
+	w := keycloaktest.Do(s, Group_autocomplete, keycloaktest.NewRequest(http.MethodGet, "/groupautocomplete?q=team", keycloaktest.Token("acme", "alice"), nil))
+	var data []map[string]any
+	keycloaktest.Decode(t, w, &data)
+	if w.Code != http.StatusOK || len(data) != maxAutocompleteResults {
+		t.Fatalf("Group_autocomplete(team) = %d with %d suggestions, want %d", w.Code, len(data), maxAutocompleteResults)
+	}
+	for _, suggestion := range data {
+		keys := []string{}
+		for key := range suggestion {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		if !reflect.DeepEqual(keys, []string{"id", "name"}) || !strings.HasPrefix(suggestion["name"].(string), "team-") {
+			t.Errorf("suggestion = %v, want only the id and name of a team group", suggestion)
+		}
+	}
+	if n := kc.CallCount("GET /admin/realms/acme/groups?"); n != 1 {
+		t.Errorf("group listings = %d, want a single capped one", n)
+	}
+}
+
+func TestGroupCheckName(t *testing.T) {
+	kc := keycloaktest.NewServer(t)
+	kc.Realm("acme").AddGroup("/admins", nil)
+	s, _ := keycloaktest.NewService()
+	s.WithDependency("gocloak", kc.Client())
+
+	// a name only contained in an existing one is still available
+	for shortName, want := range map[string]bool{"admins": false, "admin": true, "auditors": true} {
+		w := keycloaktest.Do(s, Group_checkName, keycloaktest.NewRequest(http.MethodGet, "/groupcheckname?shortName="+shortName, keycloaktest.Token("acme", "alice"), nil))
+		var data map[string]bool
+		keycloaktest.Decode(t, w, &data)
+		if w.Code != http.StatusOK || data["available"] != want {
+			t.Errorf("Group_checkName(%s) = %d %v, want available %v", shortName, w.Code, data, want)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package groupsvc
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/Nerzal/gocloak/v13"
+	"github.com/gin-gonic/gin"
+	"github.com/remiges-tech/alya/service"
+	"github.com/remiges-tech/alya/wscutils"
+	"github.com/remiges-tech/idshield/utils"
+	"github.com/remiges-tech/logharbour/logharbour"
+)
+
+// defaultMaxNestingDepth is used when max_nesting_depth is not configured, Group_tree doesn't expand deeper anyway
+const defaultMaxNestingDepth = maxTreeDepth
+
+type subgroup struct {
+	group
+	// Parent is the path of the group the subgroup is created under
+	Parent string `json:"parent" validate:"required"`
+}
+
+// Group_newSubgroup handles the POST /groupnewsubgroup request, it creates a group under an existing parent group.
+// The subgroup may not be nested deeper than the configured maximum depth, a top level group being at depth 1
+func Group_newSubgroup(c *gin.Context, s *service.Service) {
+	utils.Handler("Group_newSubgroup", []string{utils.CapGroupCreate}, groupNewSubgroup)(c, s)
+}
+
+// groupNewSubgroup is the business logic of Group_newSubgroup, utils.Handler has done the token, realm and authz checks
+func groupNewSubgroup(ctx utils.HandlerContext) {
+	c, s, l := ctx.Gin, ctx.Service, ctx.Logger
+	token, realm, username, gcClient := ctx.Token, ctx.Realm, ctx.Username, ctx.Client
+
+	var g subgroup
+	if !utils.RequireJSON(c) {
+		l.Log("Unsupported content type")
+		return
+	}
+	if !utils.LimitRequestBody(c, getMaxRequestBody(s)) {
+		l.Log("Request body too large")
+		return
+	}
+	if err := utils.BindJSONStrict(c, &g); err != nil {
+		l.LogActivity("Error Unmarshalling JSON to struct:", logharbour.DebugInfo{Variables: map[string]any{"Error": err.Error()}})
+		return
+	}
+	l.Debug0().LogDebug("Group_newSubgroup request:", logharbour.DebugInfo{Variables: map[string]any{"parent": g.Parent, "shortName": g.ShortName, "longName": g.LongName, "attr": utils.MaskAttributes(g.Attributes, getSensitiveAttrs(s))}})
+
+	parentPath := normalizeGroupPath(strings.TrimSuffix(strings.TrimSpace(g.Parent), "/"))
+	if parentPath == "/" {
+		l.Log("parent missing")
+		wscutils.SendErrorResponse(c, wscutils.NewResponse(wscutils.ErrorStatus, nil, []wscutils.ErrorMessage{wscutils.BuildErrorMessage(wscutils.ErrcodeMissing, nil, "parent")}))
+		return
+	}
+	// the parent's depth is known from its path, so a subgroup too deep is rejected before any Keycloak call
+	if maxDepth := getMaxNestingDepth(s); groupDepth(parentPath)+1 > maxDepth {
+		l.Log("subgroup would exceed the maximum nesting depth")
+		str := "parent"
+		wscutils.SendErrorResponse(c, wscutils.NewResponse(wscutils.ErrorStatus, nil, []wscutils.ErrorMessage{wscutils.BuildErrorMessage(utils.ErrMaxNestingDepthExceeded, &str, strconv.Itoa(maxDepth))}))
+		return
+	}
+	if !prepareNewGroup(ctx, &g.group) {
+		return
+	}
+
+	parent, err := gcClient.GetGroupByPath(c, token, realm, escapeGroupPath(parentPath))
+	if err != nil {
+		utils.GocloakErrorHandler(c, l, err)
+		return
+	}
+
+	attr := g.keycloakAttributes(s)
+	applyCreateDefaults(c, s, token, realm, attr, username)
+	ID, err := gcClient.CreateChildGroup(c, token, realm, *parent.ID, gocloak.Group{
+		Name:       &g.ShortName,
+		Attributes: &attr,
+	})
+	if err != nil {
+		utils.GocloakErrorHandler(c, l, err)
+		return
+	}
+
+	utils.SendSuccess(c, opGroupNewSubgroup, utils.NewMutationResponse(ID, username))
+	emitGroupEvent(s, utils.EventGroupCreated, realm, ID, username)
+}
+
+// groupDepth returns the depth of the group at path, a top level group being at depth 1
+func groupDepth(path string) int {
+	return len(strings.Split(strings.Trim(path, "/"), "/"))
+}
+
+// getMaxNestingDepth returns the configured maximum group nesting depth, or the default when unset
+func getMaxNestingDepth(s *service.Service) int {
+	depth, _ := s.Dependencies["maxNestingDepth"].(int)
+	if depth <= 0 {
+		return defaultMaxNestingDepth
+	}
+	return depth
+}
@@ -0,0 +1,65 @@
+package groupsvc
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/remiges-tech/idshield/internal/keycloaktest"
+	"github.com/remiges-tech/idshield/utils"
+)
+
+func TestGroupDepth(t *testing.T) {
+	tests := map[string]int{"/org": 1, "/org/": 1, "/org/sales": 2, "/org/sales/emea": 3}
+	for path, want := range tests {
+		if got := groupDepth(path); got != want {
+			t.Errorf("groupDepth(%q) = %d, want %d", path, got, want)
+		}
+	}
+}
+
+func TestGroupNewSubgroup(t *testing.T) {
+	kc := keycloaktest.NewServer(t)
+	realm := kc.Realm("acme")
+	realm.AddGroup("/org/sales", nil)
+	s, _ := keycloaktest.NewService()
+	s.WithDependency("gocloak", kc.Client()).WithDependency("maxNestingDepth", 3)
+	token := keycloaktest.Token("acme", "alice")
+
+	// /org/sales/emea is at depth 3, the limit
+	body := subgroup{group: group{ShortName: "emea", LongName: "EMEA sales", Attributes: map[string]string{"region": "emea"}}, Parent: "/org/sales"}
+	w := keycloaktest.Do(s, Group_newSubgroup, keycloaktest.NewRequest(http.MethodPost, "/groupnewsubgroup", token, keycloaktest.Data(body)))
+	var data utils.MutationResult
+	keycloaktest.Decode(t, w, &data)
+	emea := realm.Group("/org/sales/emea")
+	if w.Code != http.StatusOK || emea == nil || data.Result != emea.ID {
+		t.Fatalf("Group_newSubgroup() at the limit = %d %s, want the subgroup created", w.Code, w.Body)
+	}
+	if !reflect.DeepEqual(emea.Attributes["idshield_longName"], []string{"EMEA sales"}) || !reflect.DeepEqual(emea.Attributes["idshield_createdBy"], []string{"alice"}) {
+		t.Errorf("subgroup attributes = %v, want the managed attributes set", emea.Attributes)
+	}
+
+	// /org/sales/emea/uk would be at depth 4
+	body = subgroup{group: group{ShortName: "uk", LongName: "UK sales", Attributes: map[string]string{"region": "uk"}}, Parent: "org/sales/emea"}
+	w = keycloaktest.Do(s, Group_newSubgroup, keycloaktest.NewRequest(http.MethodPost, "/groupnewsubgroup", token, keycloaktest.Data(body)))
+	resp := keycloaktest.Decode(t, w, nil)
+	if w.Code != http.StatusBadRequest || !reflect.DeepEqual(resp.ErrCodes(), []string{utils.ErrMaxNestingDepthExceeded}) || !reflect.DeepEqual(resp.Messages[0].Vals, []string{"3"}) {
+		t.Errorf("Group_newSubgroup() beyond the limit = %d %s, want 400 %s", w.Code, w.Body, utils.ErrMaxNestingDepthExceeded)
+	}
+	if realm.Group("/org/sales/emea/uk") != nil {
+		t.Error("subgroup beyond the limit was created")
+	}
+}
+
+func TestGroupNewSubgroupUnknownParent(t *testing.T) {
+	kc := keycloaktest.NewServer(t)
+	kc.Realm("acme").AddGroup("/org", nil)
+	s, _ := keycloaktest.NewService()
+	s.WithDependency("gocloak", kc.Client())
+
+	body := subgroup{group: group{ShortName: "emea", LongName: "EMEA", Attributes: map[string]string{"region": "emea"}}, Parent: "/org/sales"}
+	w := keycloaktest.Do(s, Group_newSubgroup, keycloaktest.NewRequest(http.MethodPost, "/groupnewsubgroup", keycloaktest.Token("acme", "alice"), keycloaktest.Data(body)))
+	if w.Code == http.StatusOK {
+		t.Errorf("Group_newSubgroup() under an unknown parent = %d %s, want an error", w.Code, w.Body)
+	}
+}
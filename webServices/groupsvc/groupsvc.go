@@ -1,7 +1,14 @@
 package groupsvc
 
 import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 
@@ -17,93 +24,116 @@ import (
 )
 
 type group struct {
-	ID         string            `json:"id,omitempty"`
-	ShortName  string            `json:"shortName" validate:"required"`
-	LongName   string            `json:"longName" validate:"required"`
-	Attributes map[string]string `json:"attr" validate:"required"`
+	ID          string     `json:"id,omitempty"`
+	ShortName   string     `json:"shortName" validate:"required"`
+	LongName    string     `json:"longName" validate:"required"`
+	Description *string    `json:"description,omitempty"`
+	Attributes  groupAttrs `json:"attr" validate:"required,min=1,dive,keys,required,endkeys"`
+	// keyCollisions holds the sets of submitted attribute keys that normalize found to differ only by
+	// casing or surrounding whitespace
+	keyCollisions [][]string
 }
 
+// default attribute limits applied when none are configured
+const (
+	defaultAttrMaxKeys = 50
+	defaultAttrMaxSize = 16384
+)
+
+// defaultAttrKeyPattern allows alphanumerics, underscores and hyphens in attribute keys
+var defaultAttrKeyPattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// defaultMaxRequestBody caps group request bodies when no limit is configured
+const defaultMaxRequestBody = 1 << 20
+
 type groupListResponse struct {
-	ShortName *string `json:"shortName,omitempty"`
-	LongName  *string `json:"longName,omitempty"`
-	Nusers    int     `json:"nusers"`
+	ShortName    *string `json:"shortName,omitempty"`
+	LongName     *string `json:"longName,omitempty"`
+	Nusers       int     `json:"nusers"`
+	HasSubGroups bool    `json:"hasSubGroups"`
+	// NusersUnavailable marks a group whose member count didn't arrive before the fan-out deadline
+	NusersUnavailable bool `json:"nusersUnavailable,omitempty"`
 }
+
+// groupResponse is returned by the group read endpoints. Access holds the calling admin's permissions
+// on the group as evaluated by Keycloak:
+//
+//	view             - read the group
+//	viewMembers      - list the group's members
+//	manage           - update or delete the group and its subgroups
+//	manageMembers    - manage the users who are members of the group
+//	manageMembership - add users to or remove users from the group
+//
+// Keycloak only fills Access in the full representation returned for a single group (GetGroup, GetGroupByPath),
+// never in search or list results
 type groupResponse struct {
-	ID          *string              `json:"id,omitempty"`
-	Name        *string              `json:"name,omitempty"`
-	Path        *string              `json:"path,omitempty"`
-	SubGroups   *[]gocloak.Group     `json:"subGroups,omitempty"`
-	Attributes  *map[string][]string `json:"attributes,omitempty"`
-	Access      *map[string]bool     `json:"access,omitempty"`
-	ClientRoles *map[string][]string `json:"clientRoles,omitempty"`
-	RealmRoles  *[]string            `json:"realmRoles,omitempty"`
-	Nusers      int                  `json:"nusers,omitempty"`
-	CreatedAt   time.Time            `json:"createdat,omitempty"`
+	ID            *string              `json:"id,omitempty"`
+	Name          *string              `json:"name,omitempty"`
+	LongName      *string              `json:"longName,omitempty"`
+	Path          *string              `json:"path,omitempty"`
+	SubGroups     *[]gocloak.Group     `json:"subGroups,omitempty"`
+	SubGroupCount int                  `json:"subGroupCount"`
+	Attributes    *map[string][]string `json:"attributes,omitempty"`
+	Access        *map[string]bool     `json:"access,omitempty"`
+	ClientRoles   *map[string][]string `json:"clientRoles,omitempty"`
+	RealmRoles    *[]string            `json:"realmRoles,omitempty"`
+	Description   *string              `json:"description,omitempty"`
+	Nusers        int                  `json:"nusers,omitempty"`
+	CreatedAt     time.Time            `json:"createdat,omitempty"`
 }
 
+// statusAlreadyExists is returned by Group_new with ifNotExists=true when the group was already there
+const statusAlreadyExists = "already_exists"
+
+// Group_new handles the POST /groupnew request, it creates a group with the given attributes
 func Group_new(c *gin.Context, s *service.Service) {
-	l := s.LogHarbour
-	l.Log("Starting execution of Group_new()")
+	utils.Handler("Group_new", []string{utils.CapGroupCreate}, groupNew)(c, s)
+}
 
-	token, err := router.ExtractToken(c.GetHeader("Authorization"))
-	if err != nil {
-		l.Debug0().LogDebug("Missing or incorrect Authorization header format:", logharbour.DebugInfo{Variables: map[string]any{"error": err}})
-		wscutils.SendErrorResponse(c, wscutils.NewErrorResponse(utils.ErrTokenMissing))
+// groupNew is the business logic of Group_new, utils.Handler has done the token, realm and authz checks
+func groupNew(ctx utils.HandlerContext) {
+	c, s, l := ctx.Gin, ctx.Service, ctx.Logger
+
+	var g group
+
+	if !utils.RequireJSON(c) {
+		l.Log("Unsupported content type")
 		return
 	}
-	r, err := utils.ExtractClaimFromJwt(token, "iss")
-	if err != nil {
-		l.Debug0().LogDebug("Missing or incorrect realm:", logharbour.DebugInfo{Variables: map[string]any{"error": err}})
-		wscutils.SendErrorResponse(c, wscutils.NewErrorResponse(utils.ErrRealmNotFound))
+	if !utils.LimitRequestBody(c, getMaxRequestBody(s)) {
+		l.Log("Request body too large")
 		return
 	}
-	parts := strings.Split(r, "/realms/")
-	realm := parts[1]
-	username, err := utils.ExtractClaimFromJwt(token, "preferred_username")
-	if err != nil {
-		l.Debug0().LogDebug("Missing username:", logharbour.DebugInfo{Variables: map[string]any{"error": err}})
-		wscutils.SendErrorResponse(c, wscutils.NewErrorResponse(utils.ErrUserNotFound))
+	if err := utils.BindJSONStrict(c, &g); err != nil {
+		l.LogActivity("Error Unmarshalling JSON to struct:", logharbour.DebugInfo{Variables: map[string]any{"Error": err.Error()}})
 		return
 	}
+	l.Debug0().LogDebug("Group_new request:", logharbour.DebugInfo{Variables: map[string]any{"shortName": g.ShortName, "longName": g.LongName, "attr": utils.MaskAttributes(g.Attributes, getSensitiveAttrs(s))}})
 
-	isCapable, _ := utils.Authz_check(types.OpReq{
-		User:      username,
-		CapNeeded: []string{"GroupCreate"},
-	}, false)
-
-	if !isCapable {
-		l.Log("Unauthorized user:")
-		wscutils.SendErrorResponse(c, wscutils.NewErrorResponse(utils.ErrUnauthorized))
+	if !validateNewGroup(ctx, &g) {
 		return
 	}
 
-	var g group
-
-	if err := wscutils.BindJSON(c, &g); err != nil {
-		l.LogActivity("Error Unmarshalling JSON to struct:", logharbour.DebugInfo{Variables: map[string]any{"Error": err.Error()}})
-		return
+	// with ifNotExists=true an existing group is not a conflict, its ID is returned so provisioning scripts can rerun
+	if c.Query("ifNotExists") == "true" {
+		existing, err := utils.GetGroupByExactName(c, ctx.Client, ctx.Token, ctx.Realm, g.ShortName)
+		if err == nil {
+			l.Log("Group already exists, not created")
+			utils.SendSuccess(c, opGroupCreate, &wscutils.Response{Status: statusAlreadyExists, Data: *existing.ID, Messages: []wscutils.ErrorMessage{}})
+			return
+		}
+		if !errors.Is(err, utils.ErrGroupNotFound) {
+			utils.GocloakErrorHandler(c, l, err)
+			return
+		}
 	}
 
-	//Validate incoming request
-	validationErrors := validateGroup(c, g)
-	if len(validationErrors) > 0 {
-		l.Debug0().LogDebug("Validation errors:", logharbour.DebugInfo{Variables: map[string]interface{}{"validationErrors": validationErrors}})
-		wscutils.SendErrorResponse(c, wscutils.NewResponse(wscutils.ErrorStatus, nil, validationErrors))
+	if !checkLongNameUnique(c, s, l, ctx.Client, ctx.Token, ctx.Realm, g.LongName, "") {
 		return
 	}
 
-	// Extracting the GoCloak client from the service dependencies
-	gcClient, ok := s.Dependencies["gocloak"].(*gocloak.GoCloak)
-	if !ok {
-		l.Log("Failed to convert the dependency to *gocloak.GoCloak")
-		wscutils.SendErrorResponse(c, wscutils.NewErrorResponse(utils.ErrFailedToLoadDependence))
-	}
-	attr := make(map[string][]string)
-	for key, value := range g.Attributes {
-		attr[key] = []string{value}
-	}
-
-	attr["longName"] = []string{g.LongName}
+	attr := g.keycloakAttributes(s)
+	applyCreateDefaults(c, s, ctx.Token, ctx.Realm, attr, ctx.Username)
 
 	group := gocloak.Group{
 		Name:       &g.ShortName,
@@ -111,7 +141,7 @@ func Group_new(c *gin.Context, s *service.Service) {
 	}
 
 	// Create a group
-	ID, err := gcClient.CreateGroup(c, token, realm, group)
+	ID, err := ctx.Client.CreateGroup(c, ctx.Token, ctx.Realm, group)
 	if err != nil {
 		l.LogActivity("Error while creating user:", logharbour.DebugInfo{Variables: map[string]any{"error": err}})
 		wscutils.SendErrorResponse(c, &wscutils.Response{Data: err})
@@ -119,18 +149,20 @@ func Group_new(c *gin.Context, s *service.Service) {
 	}
 
 	// Send success response
-	wscutils.SendSuccessResponse(c, &wscutils.Response{Status: "success", Data: ID})
-
-	// Log the completion of execution
-	l.Log("Finished execution of Group_new()")
+	utils.SendSuccess(c, opGroupCreate, utils.NewMutationResponse(ID, ctx.Username))
+	emitGroupEvent(s, utils.EventGroupCreated, ctx.Realm, ID, ctx.Username)
 }
 
 // Group_get: handles the GET /groupget request, this will accept short group name if it exist will return single group
 func Group_get(c *gin.Context, s *service.Service) {
-	lh := s.LogHarbour
+	lh := utils.RequestLogger(c, s, "Group_get")
 	lh.Log("Group_get request received")
-	client := s.Dependencies["gocloak"].(*gocloak.GoCloak)
-	var groupParams gocloak.GetGroupsParams
+	client, ok := s.Dependencies["gocloak"].(*gocloak.GoCloak)
+	if !ok {
+		lh.Log("Failed to load the dependency to *gocloak.GoCloak")
+		wscutils.SendErrorResponse(c, wscutils.NewErrorResponse(utils.ErrFailedToLoadDependence))
+		return
+	}
 
 	token, err := router.ExtractToken(c.GetHeader("Authorization")) // separate "Bearer_" word from token
 	lh.Log("token extracted from header")
@@ -144,73 +176,232 @@ func Group_get(c *gin.Context, s *service.Service) {
 	reqUserName, _ := utils.ExtractClaimFromJwt(token, "preferred_username")
 
 	// Authz_check():
-	isCapable, _ := utils.Authz_check(types.OpReq{User: reqUserName, CapNeeded: []string{"devloper", "admin"}}, false)
+	isCapable, _ := utils.Authz_check(types.OpReq{User: reqUserName, CapNeeded: []string{utils.CapDeveloper, utils.CapAdmin}}, false)
 	if !isCapable {
-		wscutils.SendErrorResponse(c, wscutils.NewResponse(wscutils.ErrorStatus, nil, []wscutils.ErrorMessage{wscutils.BuildErrorMessage("User_not_authorized_to_perform_this_action", nil)}))
-		lh.Debug0().Log("User_not_authorized_to_perform_this_action")
+		wscutils.SendErrorResponse(c, wscutils.NewResponse(wscutils.ErrorStatus, nil, []wscutils.ErrorMessage{wscutils.BuildErrorMessage(utils.ErrUserNotAuthorized, nil)}))
+		lh.Debug0().Log(utils.ErrUserNotAuthorized)
 		return
 	}
 
 	realm, err := utils.ExtractClaimFromJwt(token, "iss")
 	if err != nil {
-		wscutils.SendErrorResponse(c, wscutils.NewResponse(wscutils.ErrorStatus, nil, []wscutils.ErrorMessage{wscutils.BuildErrorMessage("invalid_token_payload", &realm)}))
+		wscutils.SendErrorResponse(c, wscutils.NewResponse(wscutils.ErrorStatus, nil, []wscutils.ErrorMessage{wscutils.BuildErrorMessage(utils.ErrInvalidTokenPayload, &realm)}))
 		lh.Debug0().Log(fmt.Sprintf("invalid token payload: %v", map[string]any{"error": err.Error()}))
 		return
 	}
 	split := strings.Split(realm, "/")
-	realm = split[len(split)-1]
+	realm = utils.CanonicalRealm(c, s, token, split[len(split)-1])
+	lh = utils.WithRealm(lh, realm)
 
 	lh.Log(fmt.Sprintf("Group_get realm parsed: %v", map[string]any{"realm": realm}))
 	if gocloak.NilOrEmpty(&realm) {
-		wscutils.SendErrorResponse(c, wscutils.NewResponse(wscutils.ErrorStatus, nil, []wscutils.ErrorMessage{wscutils.BuildErrorMessage("realm_not_found", &realm)}))
+		wscutils.SendErrorResponse(c, wscutils.NewResponse(wscutils.ErrorStatus, nil, []wscutils.ErrorMessage{wscutils.BuildErrorMessage(utils.ErrRealmNotFound, &realm)}))
 		lh.Debug0().Log(fmt.Sprintf("realm_not_found: %v", map[string]any{"realm": realm}))
 		return
 	}
 
+	// exactly one of shortName, id or path identifies the group
 	shortName := c.Query("shortName")
-	if gocloak.NilOrEmpty(&shortName) {
-		wscutils.SendErrorResponse(c, wscutils.NewResponse(wscutils.ErrorStatus, nil, []wscutils.ErrorMessage{wscutils.BuildErrorMessage(wscutils.ErrcodeMissing, nil, "shortName")}))
-		lh.Debug0().Log("shortName missing")
+	id := c.Query("id")
+	path := c.Query("path")
+	if errCode := validateLookup(shortName, id, path); errCode != "" {
+		wscutils.SendErrorResponse(c, wscutils.NewResponse(wscutils.ErrorStatus, nil, []wscutils.ErrorMessage{wscutils.BuildErrorMessage(errCode, nil, "shortName", "id", "path")}))
+		lh.Debug0().Log(errCode)
 		return
 	}
-	// step 4: process the request
-	// Search given shortName in groups and store it's ID and PATH
-	groupParams.Search = &shortName
-	groups, err := client.GetGroups(c, token, realm, groupParams)
-	lh.Log("GetGroups() request received")
-
-	// if err or response is empty then no group with given name, Hence return
-	if err != nil || len(groups) == 0 {
-		wscutils.SendErrorResponse(c, wscutils.NewResponse(wscutils.ErrorStatus, nil, []wscutils.ErrorMessage{wscutils.BuildErrorMessage("group_not_found", &realm)}))
+
+	// fields limits the response to the listed fields, the member count is only fetched when nusers is one of them
+	fields, invalidFields := parseFields(c.Query("fields"))
+	if len(invalidFields) > 0 {
+		str := "fields"
+		wscutils.SendErrorResponse(c, wscutils.NewResponse(wscutils.ErrorStatus, nil, []wscutils.ErrorMessage{wscutils.BuildErrorMessage(utils.ErrInvalidParam, &str, invalidFields...)}))
+		lh.Debug0().Log(fmt.Sprintf("invalid fields requested: %v", invalidFields))
+		return
+	}
+
+	// step 4: process the request, every lookup ends in a single-group fetch so the full
+	// representation, including the Access flags, is returned
+	var group *gocloak.Group
+	switch {
+	case id != "":
+		group, err = client.GetGroup(c, token, realm, id)
+		lh.Log("GetGroup() request received")
+	case path != "":
+		group, err = client.GetGroupByPath(c, token, realm, escapeGroupPath(normalizeGroupPath(path)))
+		lh.Log("GetGroupByPath() request received")
+	default:
+		// Search given shortName in groups, only an exact name match is accepted
+		found, searchErr := utils.GetGroupByExactName(c, client, token, realm, shortName)
+		lh.Log("GetGroups() request received")
+		if searchErr != nil {
+			err = searchErr
+			break
+		}
+		// get the details of that group with path including attributes
+		group, err = client.GetGroupByPath(c, token, realm, escapeGroupPath(*found.Path))
+	}
+	if err != nil || group == nil {
+		identifier := shortName + id + path // validateLookup lets exactly one of them through
+		wscutils.SendErrorResponse(c, utils.NotFound(utils.ResourceGroup, identifier, wscutils.BuildErrorMessage(utils.ErrGroupNotFoundCode, &realm)))
 		lh.Debug0().Log(fmt.Sprintf("group not found in given realm error: %v", map[string]any{"realm": realm}))
 		return
 	}
-	// if group found then only you will be here, hence ignore the err & get the details of that group with path including attributes
-	group, _ := client.GetGroupByPath(c, token, realm, *groups[0].Path)
 
-	grpResp := groupResponse{
-		ID:          group.ID,
-		Name:        group.Name,
-		SubGroups:   group.SubGroups,
-		Attributes:  group.Attributes,
-		Access:      group.Access,
-		ClientRoles: group.ClientRoles,
-		RealmRoles:  group.RealmRoles,
-		// CreatedAt:   time.Time{},
+	grpResp := toGroupResponse(s, group, c.Query("briefSubGroups") == "true")
+
+	// to get the count of the users available in that group, activeOnly=true skips disabled users
+	if fields == nil || fields["nusers"] {
+		grpResp.Nusers, err = countGroupMembers(c, client, token, realm, *group.ID, c.Query("activeOnly") == "true")
+		if err != nil {
+			utils.GocloakErrorHandler(c, lh, err)
+			return
+		}
 	}
 
-	// to get the count of the users available in that group
-	userCountGroup, _ := client.GetGroupMembers(c, token, realm, *group.ID, groupParams)
-	grpResp.Nusers = len(userCountGroup)
+	// flatten=true collapses single-value attributes to scalars
+	var resp any = grpResp
+	if c.Query("flatten") == "true" {
+		resp = flattenGroupResponse(s, grpResp)
+	}
+	if fields != nil {
+		if resp, err = selectFields(resp, fields, grpResp.Nusers); err != nil {
+			utils.GocloakErrorHandler(c, lh, err)
+			return
+		}
+	}
+
+	// polling clients send back the ETag and get an empty 304 while the group is unchanged
+	etag, err := utils.ETag(resp)
+	if err == nil {
+		c.Header("ETag", etag)
+		if ifNoneMatch := c.GetHeader("If-None-Match"); ifNoneMatch != "" && utils.ETagMatches(ifNoneMatch, etag) {
+			lh.Log("Group not modified")
+			c.Status(http.StatusNotModified)
+			return
+		}
+	}
 
 	// step 5: if there are no errors, send success response
-	lh.Log(fmt.Sprintf("Group found: %v", grpResp))
-	wscutils.SendSuccessResponse(c, wscutils.NewSuccessResponse(grpResp))
+	lh.Log(fmt.Sprintf("Group found: %v", resp))
+	utils.SendSuccess(c, opGroupGet, wscutils.NewSuccessResponse(resp))
+}
+
+// Group_detail handles the GET /groupdetail request, it returns the group together with a page of its members
+// so a group-detail view needs a single round trip
+func Group_detail(c *gin.Context, s *service.Service) {
+	l := utils.RequestLogger(c, s, "Group_detail")
+	l.Log("Starting execution of Group_detail()")
+	token, err := router.ExtractToken(c.GetHeader("Authorization"))
+	if err != nil {
+		l.Debug0().LogDebug("Missing or incorrect Authorization header format:", logharbour.DebugInfo{Variables: map[string]any{"error": err}})
+		wscutils.SendErrorResponse(c, wscutils.NewErrorResponse(utils.ErrTokenMissing))
+		return
+	}
+	r, err := utils.ExtractClaimFromJwt(token, "iss")
+	if err != nil {
+		l.Debug0().LogDebug("Missing or incorrect realm:", logharbour.DebugInfo{Variables: map[string]any{"error": err}})
+		wscutils.SendErrorResponse(c, wscutils.NewErrorResponse(utils.ErrRealmNotFound))
+		return
+	}
+	parts := strings.Split(r, "/realms/")
+	if len(parts) != 2 {
+		l.Debug0().LogDebug("Missing or incorrect realm:", logharbour.DebugInfo{Variables: map[string]any{"iss": r}})
+		wscutils.SendErrorResponse(c, wscutils.NewErrorResponse(utils.ErrRealmNotFound))
+		return
+	}
+	realm := utils.CanonicalRealm(c, s, token, parts[1])
+	l = utils.WithRealm(l, realm)
+	username, err := utils.ExtractClaimFromJwt(token, "preferred_username")
+	if err != nil {
+		l.Debug0().LogDebug("Missing username:", logharbour.DebugInfo{Variables: map[string]any{"error": err}})
+		wscutils.SendErrorResponse(c, wscutils.NewErrorResponse(utils.ErrUserNotFound))
+		return
+	}
+
+	isCapable, _ := utils.Authz_check(types.OpReq{
+		User:      username,
+		CapNeeded: []string{utils.CapGroupRead},
+	}, false)
+
+	if !isCapable {
+		l.Log("Unauthorized user:")
+		wscutils.SendErrorResponse(c, wscutils.NewErrorResponse(utils.ErrUnauthorized))
+		return
+	}
+
+	shortName := c.Query("shortName")
+	if gocloak.NilOrEmpty(&shortName) {
+		l.Log("shortName missing")
+		wscutils.SendErrorResponse(c, wscutils.NewResponse(wscutils.ErrorStatus, nil, []wscutils.ErrorMessage{wscutils.BuildErrorMessage(wscutils.ErrcodeMissing, nil, "shortName")}))
+		return
+	}
+	first, max, err := utils.GetPagingParams(c)
+	if err != nil {
+		l.Debug0().LogDebug("Invalid paging params:", logharbour.DebugInfo{Variables: map[string]any{"error": err}})
+		wscutils.SendErrorResponse(c, wscutils.NewErrorResponse(utils.ErrInvalidParam))
+		return
+	}
+	max = utils.GetRealmConfig(c, s, token, realm).CapMax(max)
+
+	// Extracting the GoCloak client from the service dependencies
+	gcClient, ok := s.Dependencies["gocloak"].(*gocloak.GoCloak)
+	if !ok {
+		l.Log("Failed to load the dependency to *gocloak.GoCloak")
+		wscutils.SendErrorResponse(c, wscutils.NewErrorResponse(utils.ErrFailedToLoadDependence))
+		return
+	}
+
+	found, err := utils.GetGroupByExactName(c, gcClient, token, realm, shortName)
+	if errors.Is(err, utils.ErrGroupNotFound) {
+		l.Log("Error while gcClient.GetGroups Group doesn't exist ")
+		str := "shortName"
+		wscutils.SendErrorResponse(c, utils.NotFound(utils.ResourceGroup, shortName, wscutils.BuildErrorMessage(utils.ErrNotExist, &str)))
+		return
+	}
+	if err != nil {
+		utils.GocloakErrorHandler(c, l, err)
+		return
+	}
+	group, err := gcClient.GetGroupByPath(c, token, realm, escapeGroupPath(*found.Path))
+	if err != nil {
+		utils.GocloakErrorHandler(c, l, err)
+		return
+	}
+	grpResp := toGroupResponse(s, group, c.Query("briefSubGroups") == "true")
+
+	// to get the count of the users available in that group, activeOnly=true skips disabled users
+	grpResp.Nusers, err = countGroupMembers(c, gcClient, token, realm, *group.ID, c.Query("activeOnly") == "true")
+	if err != nil {
+		utils.GocloakErrorHandler(c, l, err)
+		return
+	}
+
+	members, err := gcClient.GetGroupMembers(c, token, realm, *group.ID, gocloak.GetGroupsParams{
+		First: &first,
+		Max:   &max,
+	})
+	if err != nil {
+		utils.GocloakErrorHandler(c, l, err)
+		return
+	}
+	memberList := []memberResponse{}
+	for _, member := range members {
+		memberList = append(memberList, toMemberResponse(member))
+	}
+
+	utils.SendSuccess(c, opGroupDetail, wscutils.NewSuccessResponse(map[string]any{
+		"group":   grpResp,
+		"members": memberList,
+		"first":   first,
+		"max":     max,
+	}))
+
+	l.Log("Finished execution of Group_detail()")
 }
 
 // HandleCreateUserRequest is for updating group capabilities.
 func Group_update(c *gin.Context, s *service.Service) {
-	l := s.LogHarbour
+	l := utils.RequestLogger(c, s, "Group_update")
 	l.Log("Starting execution of Group_update() ")
 	token, err := router.ExtractToken(c.GetHeader("Authorization"))
 	if err != nil {
@@ -225,7 +416,13 @@ func Group_update(c *gin.Context, s *service.Service) {
 		return
 	}
 	parts := strings.Split(r, "/realms/")
-	realm := parts[1]
+	if len(parts) != 2 {
+		l.Debug0().LogDebug("Missing or incorrect realm:", logharbour.DebugInfo{Variables: map[string]any{"iss": r}})
+		wscutils.SendErrorResponse(c, wscutils.NewErrorResponse(utils.ErrRealmNotFound))
+		return
+	}
+	realm := utils.CanonicalRealm(c, s, token, parts[1])
+	l = utils.WithRealm(l, realm)
 	username, err := utils.ExtractClaimFromJwt(token, "preferred_username")
 	if err != nil {
 		l.Debug0().LogDebug("Missing username:", logharbour.DebugInfo{Variables: map[string]any{"error": err}})
@@ -235,7 +432,7 @@ func Group_update(c *gin.Context, s *service.Service) {
 
 	isCapable, _ := utils.Authz_check(types.OpReq{
 		User:      username,
-		CapNeeded: []string{"GroupUpdate"},
+		CapNeeded: []string{utils.CapGroupUpdate},
 	}, false)
 
 	if !isCapable {
@@ -246,15 +443,25 @@ func Group_update(c *gin.Context, s *service.Service) {
 
 	var g group
 
+	if !utils.RequireJSON(c) {
+		l.Log("Unsupported content type")
+		return
+	}
+	if !utils.LimitRequestBody(c, getMaxRequestBody(s)) {
+		l.Log("Request body too large")
+		return
+	}
 	// Unmarshal JSON request into group struct
-	err = wscutils.BindJSON(c, &g)
+	err = utils.BindJSONStrict(c, &g)
 	if err != nil {
 		l.LogActivity("Error Unmarshalling JSON to struct:", logharbour.DebugInfo{Variables: map[string]any{"Error": err.Error()}})
 		return
 	}
+	g.normalize()
+	l.Debug0().LogDebug("Group_update request:", logharbour.DebugInfo{Variables: map[string]any{"id": g.ID, "shortName": g.ShortName, "longName": g.LongName, "attr": utils.MaskAttributes(g.Attributes, getSensitiveAttrs(s))}})
 
 	// Validate the group struct
-	validationErrors := validateGroup(c, g)
+	validationErrors := validateGroup(c, g, getAttrLimits(s))
 	if len(validationErrors) > 0 {
 		l.Debug0().LogDebug("Validation errors:", logharbour.DebugInfo{Variables: map[string]any{"validationErrors": validationErrors}})
 		wscutils.SendErrorResponse(c, wscutils.NewResponse(wscutils.ErrorStatus, nil, validationErrors))
@@ -266,30 +473,42 @@ func Group_update(c *gin.Context, s *service.Service) {
 	if !ok {
 		l.Log("Failed to convert the dependency to *gocloak.GoCloak")
 		wscutils.SendErrorResponse(c, wscutils.NewErrorResponse(utils.ErrFailedToLoadDependence))
+		return
 	}
 
-	groups, err := gcClient.GetGroups(c, token, realm, gocloak.GetGroupsParams{
-		Search: &g.ShortName,
-	})
-	if err != nil {
-		utils.GocloakErrorHandler(c, l, err)
+	// An explicit id is used as is, otherwise the group is located by an exact shortName match
+	// since Keycloak's search is a substring match and may return overlapping names
+	groupID := g.ID
+	if groupID == "" {
+		found, err := utils.GetGroupByExactName(c, gcClient, token, realm, g.ShortName)
+		if errors.Is(err, utils.ErrGroupNotFound) {
+			l.Log("Error while gcClient.GetGroups Group doesn't exist ")
+			str := "shortName"
+			wscutils.SendErrorResponse(c, utils.NotFound(utils.ResourceGroup, g.ShortName, wscutils.BuildErrorMessage(utils.ErrNotExist, &str)))
+			return
+		}
+		if err != nil {
+			utils.GocloakErrorHandler(c, l, err)
+			return
+		}
+		groupID = *found.ID
+	}
+	if !checkNotProtected(c, s, l, gcClient, token, realm, groupID) {
 		return
 	}
-	if len(groups) == 0 {
-		l.Log("Error while gcClient.GetGroups Group doesn't exist ")
-		str := "shortName"
-		wscutils.SendErrorResponse(c, wscutils.NewResponse("error", nil, []wscutils.ErrorMessage{wscutils.BuildErrorMessage(utils.ErrNotExist, &str)}))
+	if !checkLongNameUnique(c, s, l, gcClient, token, realm, g.LongName, groupID) {
 		return
 	}
-	attr := make(map[string][]string)
-	for key, value := range g.Attributes {
-		attr[key] = []string{value}
+	// the update starts from the group's current attributes, so createdBy and anything else the caller left out survive
+	current, err := gcClient.GetGroup(c, token, realm, groupID)
+	if err != nil {
+		utils.GocloakErrorHandler(c, l, err)
+		return
 	}
-
-	attr["longName"] = []string{g.LongName}
+	attr := g.updatedAttributes(s, current.Attributes)
 
 	UpdateGroupParm := gocloak.Group{
-		ID:         groups[0].ID,
+		ID:         &groupID,
 		Name:       &g.ShortName,
 		Attributes: &attr,
 	}
@@ -302,18 +521,127 @@ func Group_update(c *gin.Context, s *service.Service) {
 	}
 
 	// Send success response
-	wscutils.SendSuccessResponse(c, &wscutils.Response{Status: "success"})
+	utils.SendSuccess(c, opGroupUpdate, utils.NewMutationResponse(nil, username))
+	emitGroupEvent(s, utils.EventGroupUpdated, realm, groupID, username)
 
 	l.Log("Finished update Group_Update()")
 }
 
+// Group_delete handles the DELETE /groupdelete request. A group that still has members is only deleted
+// when force=true is passed, otherwise the request is refused so memberships are not silently orphaned
+func Group_delete(c *gin.Context, s *service.Service) {
+	l := utils.RequestLogger(c, s, "Group_delete")
+	l.Log("Starting execution of Group_delete()")
+	token, err := router.ExtractToken(c.GetHeader("Authorization"))
+	if err != nil {
+		l.Debug0().LogDebug("Missing or incorrect Authorization header format:", logharbour.DebugInfo{Variables: map[string]any{"error": err}})
+		wscutils.SendErrorResponse(c, wscutils.NewErrorResponse(utils.ErrTokenMissing))
+		return
+	}
+	r, err := utils.ExtractClaimFromJwt(token, "iss")
+	if err != nil {
+		l.Debug0().LogDebug("Missing or incorrect realm:", logharbour.DebugInfo{Variables: map[string]any{"error": err}})
+		wscutils.SendErrorResponse(c, wscutils.NewErrorResponse(utils.ErrRealmNotFound))
+		return
+	}
+	parts := strings.Split(r, "/realms/")
+	if len(parts) != 2 {
+		l.Debug0().LogDebug("Missing or incorrect realm:", logharbour.DebugInfo{Variables: map[string]any{"iss": r}})
+		wscutils.SendErrorResponse(c, wscutils.NewErrorResponse(utils.ErrRealmNotFound))
+		return
+	}
+	realm := utils.CanonicalRealm(c, s, token, parts[1])
+	l = utils.WithRealm(l, realm)
+	username, err := utils.ExtractClaimFromJwt(token, "preferred_username")
+	if err != nil {
+		l.Debug0().LogDebug("Missing username:", logharbour.DebugInfo{Variables: map[string]any{"error": err}})
+		wscutils.SendErrorResponse(c, wscutils.NewErrorResponse(utils.ErrUserNotFound))
+		return
+	}
+
+	isCapable, _ := utils.Authz_check(types.OpReq{
+		User:      username,
+		CapNeeded: []string{utils.CapGroupDelete},
+	}, false)
+
+	if !isCapable {
+		l.Log("Unauthorized user:")
+		wscutils.SendErrorResponse(c, wscutils.NewErrorResponse(utils.ErrUnauthorized))
+		return
+	}
+
+	shortName := c.Query("shortName")
+	if gocloak.NilOrEmpty(&shortName) {
+		l.Log("shortName missing")
+		wscutils.SendErrorResponse(c, wscutils.NewResponse(wscutils.ErrorStatus, nil, []wscutils.ErrorMessage{wscutils.BuildErrorMessage(wscutils.ErrcodeMissing, nil, "shortName")}))
+		return
+	}
+	force := c.Query("force") == "true"
+
+	// Extracting the GoCloak client from the service dependencies
+	gcClient, ok := s.Dependencies["gocloak"].(*gocloak.GoCloak)
+	if !ok {
+		l.Log("Failed to load the dependency to *gocloak.GoCloak")
+		wscutils.SendErrorResponse(c, wscutils.NewErrorResponse(utils.ErrFailedToLoadDependence))
+		return
+	}
+
+	found, err := utils.GetGroupByExactName(c, gcClient, token, realm, shortName)
+	if errors.Is(err, utils.ErrGroupNotFound) {
+		l.Log("Error while gcClient.GetGroups Group doesn't exist ")
+		str := "shortName"
+		wscutils.SendErrorResponse(c, utils.NotFound(utils.ResourceGroup, shortName, wscutils.BuildErrorMessage(utils.ErrNotExist, &str)))
+		return
+	}
+	if err != nil {
+		utils.GocloakErrorHandler(c, l, err)
+		return
+	}
+	groupID := *found.ID
+	if !checkSubtreeNotProtected(c, s, l, gcClient, token, realm, groupID) {
+		return
+	}
+
+	if !force {
+		nmembers, err := countGroupMembers(c, gcClient, token, realm, groupID, false)
+		if err != nil {
+			utils.GocloakErrorHandler(c, l, err)
+			return
+		}
+		if nmembers > 0 {
+			l.Log("Refusing to delete non-empty group without force")
+			str := "shortName"
+			wscutils.SendErrorResponse(c, wscutils.NewResponse(wscutils.ErrorStatus, nil, []wscutils.ErrorMessage{wscutils.BuildErrorMessage(utils.ErrGroupNotEmpty, &str, strconv.Itoa(nmembers))}))
+			return
+		}
+	}
+
+	err = gcClient.DeleteGroup(c, token, realm, groupID)
+	if err != nil {
+		l.LogActivity("Error while deleting group:", logharbour.DebugInfo{Variables: map[string]any{"error": err}})
+		utils.GocloakErrorHandler(c, l, err)
+		return
+	}
+
+	// Send success response
+	utils.SendSuccess(c, opGroupDelete, utils.NewMutationResponse(nil, username))
+	emitGroupEvent(s, utils.EventGroupDeleted, realm, groupID, username)
+
+	l.Log("Finished execution of Group_delete()")
+}
+
 // Group_list handles the GET /grouplist request
 func Group_list(c *gin.Context, s *service.Service) {
-	lh := s.LogHarbour
+	lh := utils.RequestLogger(c, s, "Group_list")
 	lh.Log("Group_list request received")
-	var listResponse []groupListResponse
+	listResponse := []groupListResponse{}
 
-	client := s.Dependencies["gocloak"].(*gocloak.GoCloak)
+	client, ok := s.Dependencies["gocloak"].(*gocloak.GoCloak)
+	if !ok {
+		lh.Log("Failed to load the dependency to *gocloak.GoCloak")
+		wscutils.SendErrorResponse(c, wscutils.NewErrorResponse(utils.ErrFailedToLoadDependence))
+		return
+	}
 
 	token, err := router.ExtractToken(c.GetHeader("Authorization")) // separate "Bearer " word from token
 	if err != nil {
@@ -330,14 +658,15 @@ func Group_list(c *gin.Context, s *service.Service) {
 		return
 	}
 	// Authz_check():
-	isCapable, _ := utils.Authz_check(types.OpReq{User: reqUserName, CapNeeded: []string{"devloper", "admin"}}, false)
+	isCapable, _ := utils.Authz_check(types.OpReq{User: reqUserName, CapNeeded: []string{utils.CapDeveloper, utils.CapAdmin}}, false)
 	if !isCapable {
 		wscutils.SendErrorResponse(c, wscutils.NewResponse(wscutils.ErrorStatus, nil, []wscutils.ErrorMessage{wscutils.BuildErrorMessage(utils.ErrUserNotAuthorized, nil)}))
 		lh.Debug0().Log(utils.ErrUserNotAuthorized)
 		return
 	}
 
-	realm := utils.GetRealmFromJwt(c, token)
+	realm := utils.CanonicalRealm(c, s, token, utils.GetRealmFromJwt(c, token))
+	lh = utils.WithRealm(lh, realm)
 	if gocloak.NilOrEmpty(&realm) {
 		wscutils.SendErrorResponse(c, wscutils.NewResponse(wscutils.ErrorStatus, nil, []wscutils.ErrorMessage{wscutils.BuildErrorMessage(utils.ErrRealmNotFound, &realm)}))
 		lh.Debug0().LogActivity("realm_not_found :", map[string]any{"realm": realm})
@@ -345,54 +674,371 @@ func Group_list(c *gin.Context, s *service.Service) {
 	}
 	lh.LogActivity("User_update realm parsed: %v", map[string]any{"realm": realm})
 
-	// step 4: process the request
-	groups, err := client.GetGroups(c, token, realm, gocloak.GetGroupsParams{})
-
-	if err != nil || len(groups) == 0 {
-		switch err.Error() {
-		case utils.ErrHTTPUnauthorized:
-			wscutils.SendErrorResponse(c, wscutils.NewResponse(wscutils.ErrorStatus, nil, []wscutils.ErrorMessage{wscutils.BuildErrorMessage(wscutils.ErrcodeTokenVerificationFailed, &realm, err.Error())}))
-			lh.Debug0().LogActivity("token expired error from keycloak :", map[string]any{"error": err.Error()})
-		default:
-			wscutils.SendErrorResponse(c, wscutils.NewResponse(wscutils.ErrorStatus, nil, []wscutils.ErrorMessage{wscutils.BuildErrorMessage(utils.ErrUserNotFound, &realm, err.Error())}))
-			lh.Debug0().LogActivity("user not found in given realm :", map[string]any{"realm": realm, "error": err.Error()})
+	// spreadsheet exports ask for CSV, through the Accept header or ?format=csv
+	asCSV := c.Query("format") == "csv" || strings.Contains(c.GetHeader("Accept"), csvContentType)
+	if asCSV {
+		if isCapable, _ = utils.Authz_check(types.OpReq{User: reqUserName, CapNeeded: []string{utils.CapGroupRead}}, false); !isCapable {
+			wscutils.SendErrorResponse(c, wscutils.NewResponse(wscutils.ErrorStatus, nil, []wscutils.ErrorMessage{wscutils.BuildErrorMessage(utils.ErrUserNotAuthorized, nil)}))
+			lh.Debug0().Log(utils.ErrUserNotAuthorized)
+			return
 		}
+	}
+
+	first, max, err := utils.GetPagingParams(c)
+	if err != nil {
+		wscutils.SendErrorResponse(c, wscutils.NewErrorResponse(utils.ErrInvalidParam))
+		lh.Debug0().LogActivity("invalid paging params :", map[string]any{"error": err.Error()})
+		return
+	}
+	// a max above the page size ceiling is served clamped rather than rejected, with a warning to the client
+	if capped := utils.GetRealmConfig(c, s, token, realm).CapMax(max); capped < max {
+		c.Header("Warning", fmt.Sprintf(`299 idshield "max reduced from %d to %d"`, max, capped))
+		lh.Debug0().LogActivity("max clamped :", map[string]any{"requested": max, "max": capped})
+		max = capped
+	}
+
+	// step 4: process the request
+	// the brief representation Keycloak returns by default has no attributes, so longName would be missing.
+	// The full representation makes the page heavier to fetch, but is still a single call where fetching
+	// each group on its own would cost one more round trip per group
+	groups, err := client.GetGroups(c, token, realm, gocloak.GetGroupsParams{
+		First:               &first,
+		Max:                 &max,
+		BriefRepresentation: gocloak.BoolP(false),
+	})
+	var total int
+	if err == nil {
+		total, err = utils.CountTopLevelGroups(c, s, token, realm)
+	}
+
+	// an empty realm is not an error, it falls through and returns an empty groups list
+	if err != nil {
+		utils.GocloakErrorHandler(c, lh, err)
 		return
 	}
 
+	if asCSV {
+		writeGroupsCSV(c, s, lh, client, token, realm, groups)
+		return
+	}
+
+	// member counts come from the count cache where it has them, the others are fetched in parallel and
+	// groups still missing a count at the deadline are flagged
+	counts, asOf := listMemberCounts(c, s, client, token, realm, groups)
+	partial := false
 	for _, eachGroup := range groups {
 		// setting response fields
+		// GetGroups embeds the subgroups of each group, so no extra call is needed to know if it has children
 		eachGrpRep := groupListResponse{
-			ShortName: eachGroup.Path,
-			LongName:  eachGroup.Name,
+			ShortName:    eachGroup.Path,
+			LongName:     eachGroup.Name,
+			HasSubGroups: eachGroup.SubGroups != nil && len(*eachGroup.SubGroups) > 0,
+		}
+		// groups created outside idshield have no longName attribute and keep their name
+		if longName, ok := managedAttr(s, eachGroup.Attributes, longNameAttr); ok {
+			eachGrpRep.LongName = &longName
 		}
 
-		// to get the count of the users available in that group
-		userCountGroup, _ := client.GetGroupMembers(c, token, realm, *eachGroup.ID, gocloak.GetGroupsParams{})
-		eachGrpRep.Nusers = len(userCountGroup)
+		if nusers, ok := counts[*eachGroup.ID]; ok {
+			eachGrpRep.Nusers = nusers
+		} else {
+			eachGrpRep.NusersUnavailable = true
+			partial = true
+		}
 
 		listResponse = append(listResponse, eachGrpRep)
 	}
 	// step 5: if there are no errors, send success response
-	wscutils.SendSuccessResponse(c, wscutils.NewSuccessResponse(map[string]any{"groups": listResponse}))
+	page := utils.NewPage(listResponse, len(listResponse), total, first, max)
+	page.Partial = partial
+	if !asOf.IsZero() {
+		page.AsOf = &asOf
+	}
+	utils.SendSuccess(c, opGroupList, wscutils.NewSuccessResponse(page))
+}
+
+// csvContentType is the media type of Group_list's CSV output
+const csvContentType = "text/csv"
+
+// writeGroupsCSV streams the groups as CSV rows of shortName, longName, nusers and path, each row is flushed as
+// soon as its member count is known. Once streaming has started errors can't change the response status,
+// so a failure ends the CSV early and is only logged
+func writeGroupsCSV(c *gin.Context, s *service.Service, lh *logharbour.Logger, client *gocloak.GoCloak, token, realm string, groups []*gocloak.Group) {
+	c.Header("Content-Type", csvContentType+"; charset=utf-8")
+	c.Header("Content-Disposition", `attachment; filename="groups.csv"`)
+	c.Status(http.StatusOK)
+
+	w := csv.NewWriter(c.Writer)
+	w.Write([]string{"shortName", "longName", "nusers", "path"})
+	w.Flush()
+	for _, grp := range groups {
+		nusers, err := countGroupMembers(c, client, token, realm, *grp.ID, false)
+		if err != nil {
+			lh.Debug0().LogActivity("CSV export aborted :", map[string]any{"group": gocloak.PString(grp.Name), "error": err.Error()})
+			return
+		}
+		longName, _ := managedAttr(s, grp.Attributes, longNameAttr)
+		w.Write([]string{gocloak.PString(grp.Name), longName, strconv.Itoa(nusers), gocloak.PString(grp.Path)})
+		w.Flush()
+		if err = w.Error(); err != nil {
+			lh.Debug0().LogActivity("CSV export aborted :", map[string]any{"error": err.Error()})
+			return
+		}
+	}
 }
 
 // validateCreateUser performs validation for the createUserRequest.
-func validateGroup(c *gin.Context, g group) []wscutils.ErrorMessage {
-	// Validate the request body
+func validateGroup(c *gin.Context, g group, limits types.AttrLimits) []wscutils.ErrorMessage {
+	// Validate the request body, every invalid field is reported in a single response
 	validationErrors := wscutils.WscValidate(g, g.getValsForGroup)
 
-	if len(validationErrors) > 0 {
-		return validationErrors
+	// Keycloak caps attribute storage size, reject oversized maps before they reach CreateGroup
+	field := "attr"
+	validationErrors = append(validationErrors, attrLimitErrors(g.Attributes, len(g.Attributes), limits, field)...)
+	if invalidKeys := g.invalidAttrKeys(limits.KeyPattern); len(invalidKeys) > 0 {
+		validationErrors = append(validationErrors, wscutils.BuildErrorMessage(utils.ErrInvalidAttrKey, &field, invalidKeys...))
+	}
+	// typed values are replaced by their canonical form here, g shares its attribute map with the caller
+	if invalidKeys := g.coerceAttrs(limits.Types); len(invalidKeys) > 0 {
+		vals := make([]string, 0, len(invalidKeys))
+		for _, key := range invalidKeys {
+			vals = append(vals, key+":"+limits.Types[key])
+		}
+		validationErrors = append(validationErrors, wscutils.BuildErrorMessage(utils.ErrInvalidAttrValue, &field, vals...))
+	}
+	for _, keys := range g.keyCollisions {
+		validationErrors = append(validationErrors, wscutils.BuildErrorMessage(utils.ErrDuplicateAttrKey, &field, keys...))
 	}
 	return validationErrors
 }
 
+// attrLimitErrors reports the attribute count and size limits broken by attrs, which holds n attribute keys
+func attrLimitErrors(attrs any, n int, limits types.AttrLimits, field string) []wscutils.ErrorMessage {
+	var validationErrors []wscutils.ErrorMessage
+	if n > limits.MaxKeys {
+		validationErrors = append(validationErrors, wscutils.BuildErrorMessage(utils.ErrAttributesTooLarge, &field, "maxKeys", strconv.Itoa(limits.MaxKeys)))
+	}
+	serialized, err := json.Marshal(attrs)
+	if err == nil && len(serialized) > limits.MaxSize {
+		validationErrors = append(validationErrors, wscutils.BuildErrorMessage(utils.ErrAttributesTooLarge, &field, "maxSize", strconv.Itoa(limits.MaxSize)))
+	}
+	return validationErrors
+}
+
+// prepareNewGroup is the step every create path runs before CreateGroup: it normalizes g, validates it and,
+// when enabled, checks its longName is unique. On failure the error response has already been sent
+func prepareNewGroup(ctx utils.HandlerContext, g *group) bool {
+	return validateNewGroup(ctx, g) && checkLongNameUnique(ctx.Gin, ctx.Service, ctx.Logger, ctx.Client, ctx.Token, ctx.Realm, g.LongName, "")
+}
+
+// validateNewGroup normalizes g and validates it, the part of prepareNewGroup that needs no lookup. On failure
+// the error response has already been sent
+func validateNewGroup(ctx utils.HandlerContext, g *group) bool {
+	c, s, l := ctx.Gin, ctx.Service, ctx.Logger
+	g.normalize()
+	validationErrors := validateGroup(c, *g, getAttrLimits(s))
+	if len(validationErrors) > 0 {
+		l.Debug0().LogDebug("Validation errors:", logharbour.DebugInfo{Variables: map[string]any{"validationErrors": validationErrors}})
+		wscutils.SendErrorResponse(c, wscutils.NewResponse(wscutils.ErrorStatus, nil, validationErrors))
+		return false
+	}
+	return true
+}
+
+// normalize trims surrounding whitespace from the names and attribute keys before validation, so a padded
+// shortName can't pass the required check and then never be found by a trimmed search. Attribute keys that
+// collide once trimmed and compared case-insensitively are recorded for validateGroup to reject
+func (g *group) normalize() {
+	g.ShortName = strings.TrimSpace(g.ShortName)
+	g.LongName = strings.TrimSpace(g.LongName)
+	if g.Attributes == nil {
+		return
+	}
+	attr := make(groupAttrs, len(g.Attributes))
+	folded := make(map[string][]string, len(g.Attributes))
+	for key, value := range g.Attributes {
+		trimmed := strings.TrimSpace(key)
+		attr[trimmed] = value
+		fold := strings.ToLower(trimmed)
+		folded[fold] = append(folded[fold], key)
+	}
+	g.Attributes = attr
+
+	// keys that differ only by casing or padding are the same key typed twice, and trimming would silently
+	// keep just one of the values, so they are reported instead
+	g.keyCollisions = nil
+	for _, keys := range folded {
+		if len(keys) > 1 {
+			sort.Strings(keys)
+			g.keyCollisions = append(g.keyCollisions, keys)
+		}
+	}
+	sort.Slice(g.keyCollisions, func(i, j int) bool { return g.keyCollisions[i][0] < g.keyCollisions[j][0] })
+}
+
+// invalidAttrKeys returns the sorted attribute keys that don't match the allowed key pattern,
+// keys with dots or special characters break Keycloak's attribute filtering
+func (g *group) invalidAttrKeys(pattern *regexp.Regexp) []string {
+	var invalid []string
+	for key := range g.Attributes {
+		if !pattern.MatchString(key) {
+			invalid = append(invalid, key)
+		}
+	}
+	sort.Strings(invalid)
+	return invalid
+}
+
+// validateLookup checks that exactly one group lookup key is set, returning the error code otherwise
+func validateLookup(shortName, id, path string) string {
+	set := 0
+	for _, key := range []string{shortName, id, path} {
+		if key != "" {
+			set++
+		}
+	}
+	switch {
+	case set == 0:
+		return utils.ErrMissingLookup
+	case set > 1:
+		return utils.ErrAmbiguousLookup
+	}
+	return ""
+}
+
+// toGroupResponse maps a keycloak group to the response returned by the group read endpoints.
+// With briefSubGroups the subgroups themselves are left out and only their count is returned
+func toGroupResponse(s *service.Service, group *gocloak.Group, briefSubGroups bool) groupResponse {
+	grpResp := groupResponse{
+		ID:          group.ID,
+		Name:        group.Name,
+		SubGroups:   group.SubGroups,
+		Attributes:  group.Attributes,
+		Access:      group.Access,
+		ClientRoles: group.ClientRoles,
+		RealmRoles:  normalizeRoles(group.RealmRoles),
+	}
+	if group.SubGroups != nil {
+		grpResp.SubGroupCount = len(*group.SubGroups)
+	}
+	if briefSubGroups {
+		grpResp.SubGroups = nil
+	}
+	if longName, ok := managedAttr(s, group.Attributes, longNameAttr); ok {
+		grpResp.LongName = &longName
+	}
+	if description, ok := managedAttr(s, group.Attributes, descriptionAttr); ok {
+		grpResp.Description = &description
+	}
+	return grpResp
+}
+
+// normalizeRoles returns the role names sorted and de-duplicated, composite roles can list the same role more than once
+func normalizeRoles(roles *[]string) *[]string {
+	if roles == nil {
+		return nil
+	}
+	seen := make(map[string]bool)
+	normalized := []string{}
+	for _, role := range *roles {
+		if !seen[role] {
+			seen[role] = true
+			normalized = append(normalized, role)
+		}
+	}
+	sort.Strings(normalized)
+	return &normalized
+}
+
+// emitGroupEvent notifies the configured webhook, if any, of a successful group mutation
+func emitGroupEvent(s *service.Service, eventType, realm, groupID, actor string) {
+	webhook, ok := s.Dependencies["webhook"].(*utils.Webhook)
+	if !ok {
+		return
+	}
+	webhook.Emit(s.LogHarbour, utils.GroupEvent{
+		Type:      eventType,
+		Realm:     realm,
+		GroupID:   groupID,
+		Actor:     actor,
+		Timestamp: time.Now().UTC(),
+	})
+}
+
+// getMaxRequestBody returns the configured request body limit, or the default when unset
+func getMaxRequestBody(s *service.Service) int64 {
+	limit, _ := s.Dependencies["maxRequestBody"].(int64)
+	if limit <= 0 {
+		return defaultMaxRequestBody
+	}
+	return limit
+}
+
+// applyCreateDefaults fills in the default attributes configured for the realm that the request didn't set itself
+// and stamps the creator, which the request can never override
+func applyCreateDefaults(c *gin.Context, s *service.Service, token, realm string, attr map[string][]string, username string) {
+	for key, value := range utils.GetRealmConfig(c, s, token, realm).DefaultAttrs {
+		if _, ok := attr[key]; !ok {
+			attr[key] = []string{value}
+		}
+	}
+	attr[managedKey(s, createdByAttr)] = []string{username}
+}
+
+// checkLongNameUnique rejects a longName already carried by another group than groupID with longname_not_unique,
+// when the "uniqueLongNames" dependency enables the check. Keycloak itself only keeps group names unique.
+// On failure the error response has already been sent
+func checkLongNameUnique(c *gin.Context, s *service.Service, l *logharbour.Logger, gcClient *gocloak.GoCloak, token, realm, longName, groupID string) bool {
+	if enabled, _ := s.Dependencies["uniqueLongNames"].(bool); !enabled {
+		return true
+	}
+	// groups not yet migrated still carry the longName under its legacy key
+	var groups []*gocloak.Group
+	for _, key := range []string{managedKey(s, longNameAttr), legacyManagedAttrs[longNameAttr]} {
+		found, err := utils.SearchGroupsByAttribute(c, gcClient, token, realm, key, longName)
+		if err != nil {
+			utils.GocloakErrorHandler(c, l, err)
+			return false
+		}
+		groups = append(groups, found...)
+	}
+	for _, grp := range groups {
+		if grp.ID != nil && *grp.ID != groupID {
+			l.Log("longName already in use")
+			field := "longName"
+			wscutils.SendErrorResponse(c, wscutils.NewResponse(wscutils.ErrorStatus, nil, []wscutils.ErrorMessage{wscutils.BuildErrorMessage(utils.ErrLongNameNotUnique, &field, longName)}))
+			return false
+		}
+	}
+	return true
+}
+
+// getSensitiveAttrs returns the configured attribute keys whose values must not appear in logs
+func getSensitiveAttrs(s *service.Service) []string {
+	keys, _ := s.Dependencies["sensitiveAttrs"].([]string)
+	return keys
+}
+
+// getAttrLimits returns the configured attribute limits, falling back to the defaults for unset values
+func getAttrLimits(s *service.Service) types.AttrLimits {
+	limits, _ := s.Dependencies["attrLimits"].(types.AttrLimits)
+	if limits.MaxKeys <= 0 {
+		limits.MaxKeys = defaultAttrMaxKeys
+	}
+	if limits.MaxSize <= 0 {
+		limits.MaxSize = defaultAttrMaxSize
+	}
+	if limits.KeyPattern == nil {
+		limits.KeyPattern = defaultAttrKeyPattern
+	}
+	return limits
+}
+
 // getValsForUser returns validation error details based on the field and tag.
 func (g *group) getValsForGroup(err validator.FieldError) []string {
 	var vals []string
 	switch err.Field() {
-	case "Name":
+	case "ShortName":
 		switch err.Tag() {
 		case "required":
 			vals = append(vals, "non-empty")
@@ -409,6 +1055,14 @@ func (g *group) getValsForGroup(err validator.FieldError) []string {
 		case "required":
 			vals = append(vals, "non-empty")
 			vals = append(vals, " ")
+		case "min":
+			// an empty map passes required, min=1 asks for at least one attribute
+			vals = append(vals, "min", err.Param())
+		}
+	default:
+		// keys are validated with dive, the field is then reported as Attributes[key]
+		if strings.HasPrefix(err.Field(), "Attributes[") && err.Tag() == "required" {
+			vals = append(vals, "non-empty key")
 		}
 	}
 	return vals
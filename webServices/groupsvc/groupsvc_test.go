@@ -0,0 +1,1469 @@
+package groupsvc
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/remiges-tech/alya/service"
+	"github.com/remiges-tech/alya/wscutils"
+	"github.com/remiges-tech/idshield/internal/keycloaktest"
+	"github.com/remiges-tech/idshield/types"
+	"github.com/remiges-tech/idshield/utils"
+	"github.com/remiges-tech/logharbour/logharbour"
+)
+
+// manyAttrs returns n attributes whose values are size bytes long
+func manyAttrs(n, size int) map[string]string {
+	attrs := make(map[string]string, n)
+	for i := 0; i < n; i++ {
+		attrs[fmt.Sprintf("key%d", i)] = strings.Repeat("v", size)
+	}
+	return attrs
+}
+
+func TestValidateGroupAttrLimits(t *testing.T) {
+	limits := types.AttrLimits{MaxKeys: 3, MaxSize: 100, KeyPattern: defaultAttrKeyPattern}
+	tests := []struct {
+		name  string
+		attrs map[string]string
+		want  []string
+	}{
+		{"within limits", manyAttrs(3, 5), nil},
+		{"too many keys", manyAttrs(4, 1), []string{"maxKeys", "3"}},
+		{"too large", manyAttrs(2, 60), []string{"maxSize", "100"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			errs := validateGroup(nil, group{ShortName: "admins", LongName: "Admins", Attributes: tt.attrs}, limits)
+			if tt.want == nil {
+				if len(errs) > 0 {
+					t.Errorf("validateGroup() = %v, want no errors", errs)
+				}
+				return
+			}
+			if len(errs) != 1 || errs[0].ErrCode != utils.ErrAttributesTooLarge || !reflect.DeepEqual(errs[0].Vals, tt.want) {
+				t.Errorf("validateGroup() = %+v, want %s %v", errs, utils.ErrAttributesTooLarge, tt.want)
+			}
+		})
+	}
+}
+
+func TestGroupNewOversizedAttributes(t *testing.T) {
+	s, _ := keycloaktest.NewService()
+	s.WithDependency("gocloak", keycloaktest.NewServer(t).Client()).WithDependency("attrLimits", types.AttrLimits{MaxKeys: 10, MaxSize: 1024})
+	body := map[string]any{"shortName": "admins", "longName": "Admins", "attr": manyAttrs(11, 200)}
+
+	w := keycloaktest.Do(s, Group_new, keycloaktest.NewRequest(http.MethodPost, "/groupnew", keycloaktest.Token("acme", "alice"), keycloaktest.Data(body)))
+	resp := keycloaktest.Decode(t, w, nil)
+	if want := []string{utils.ErrAttributesTooLarge, utils.ErrAttributesTooLarge}; w.Code != http.StatusBadRequest || !reflect.DeepEqual(resp.ErrCodes(), want) {
+		t.Errorf("Group_new() = %d %s, want 400 %v", w.Code, w.Body, want)
+	}
+}
+
+func TestInvalidAttrKeys(t *testing.T) {
+	g := group{Attributes: map[string]string{"dept": "", "cost-centre": "", "a.b": "", "x y": "", "_ok_1": ""}}
+	want := []string{"a.b", "x y"}
+	if got := g.invalidAttrKeys(defaultAttrKeyPattern); !reflect.DeepEqual(got, want) {
+		t.Errorf("invalidAttrKeys() = %v, want %v", got, want)
+	}
+}
+
+func TestGroupNewInvalidAttrKeys(t *testing.T) {
+	body := map[string]any{"shortName": "admins", "longName": "Admins", "attr": map[string]string{"dept": "hr", "my key": "x", "a.b": "y"}}
+
+	s, _ := keycloaktest.NewService()
+	s.WithDependency("gocloak", keycloaktest.NewServer(t).Client())
+	w := keycloaktest.Do(s, Group_new, keycloaktest.NewRequest(http.MethodPost, "/groupnew", keycloaktest.Token("acme", "alice"), keycloaktest.Data(body)))
+	resp := keycloaktest.Decode(t, w, nil)
+	if w.Code != http.StatusBadRequest || !reflect.DeepEqual(resp.ErrCodes(), []string{utils.ErrInvalidAttrKey}) {
+		t.Fatalf("Group_new() = %d %s, want 400 %s", w.Code, w.Body, utils.ErrInvalidAttrKey)
+	}
+	if want := []string{"a.b", "my key"}; !reflect.DeepEqual(resp.Messages[0].Vals, want) {
+		t.Errorf("Group_new() invalid keys = %v, want %v", resp.Messages[0].Vals, want)
+	}
+
+	// a looser configured pattern lets the same keys through to keycloak
+	kc := keycloaktest.NewServer(t)
+	realm := kc.Realm("acme")
+	s.WithDependency("gocloak", kc.Client())
+	s.WithDependency("attrLimits", types.AttrLimits{KeyPattern: regexp.MustCompile(`^[A-Za-z0-9_. -]+$`)})
+	w = keycloaktest.Do(s, Group_new, keycloaktest.NewRequest(http.MethodPost, "/groupnew", keycloaktest.Token("acme", "alice"), keycloaktest.Data(body)))
+	if w.Code != http.StatusOK || realm.Group("/admins") == nil {
+		t.Errorf("Group_new() with a looser pattern = %d %s, want the group created", w.Code, w.Body)
+	}
+}
+
+func TestGroupUpdateOverlappingNames(t *testing.T) {
+	kc := keycloaktest.NewServer(t)
+	realm := kc.Realm("acme")
+	adminsEU := realm.AddGroup("/admins-eu", map[string][]string{"longName": {"EU admins"}})
+	admins := realm.AddGroup("/admins", map[string][]string{"longName": {"Admins"}})
+	s, _ := keycloaktest.NewService()
+	s.WithDependency("gocloak", kc.Client())
+	token := keycloaktest.Token("acme", "alice")
+
+	tests := []struct {
+		name  string
+		body  group
+		want  *keycloaktest.Group
+		other *keycloaktest.Group
+	}{
+		{"by shortName", group{ShortName: "admins", LongName: "Admins", Attributes: map[string]string{"team": "core"}}, admins, adminsEU},
+		{"by id", group{ID: adminsEU.ID, ShortName: "admins-eu", LongName: "EU admins", Attributes: map[string]string{"team": "eu"}}, adminsEU, admins},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := tt.other.Attributes
+			w := keycloaktest.Do(s, Group_update, keycloaktest.NewRequest(http.MethodPut, "/groupupdate", token, keycloaktest.Data(tt.body)))
+			if w.Code != http.StatusOK {
+				t.Fatalf("Group_update() = %d %s, want 200", w.Code, w.Body)
+			}
+			if got := tt.want.Attributes["team"]; !reflect.DeepEqual(got, []string{tt.body.Attributes["team"]}) {
+				t.Errorf("%s team = %v, want %s", tt.want.Name, got, tt.body.Attributes["team"])
+			}
+			if !reflect.DeepEqual(tt.other.Attributes, before) {
+				t.Errorf("%s attributes = %v, want them unchanged", tt.other.Name, tt.other.Attributes)
+			}
+		})
+	}
+}
+
+func TestGroupNewEmitsWebhookEvent(t *testing.T) {
+	kc := keycloaktest.NewServer(t)
+	kc.Realm("acme")
+	events := make(chan map[string]any, 1)
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var event map[string]any
+		json.NewDecoder(r.Body).Decode(&event)
+		events <- event
+	}))
+	defer hook.Close()
+	s, _ := keycloaktest.NewService()
+	s.WithDependency("gocloak", kc.Client()).WithDependency("webhook", utils.NewWebhook(hook.URL, 0))
+	body := group{ShortName: "admins", LongName: "Admins", Attributes: map[string]string{"dept": "ops"}}
+
+	w := keycloaktest.Do(s, Group_new, keycloaktest.NewRequest(http.MethodPost, "/groupnew", keycloaktest.Token("acme", "alice"), keycloaktest.Data(body)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Group_new() = %d %s, want 200", w.Code, w.Body)
+	}
+	select {
+	case event := <-events:
+		keys := []string{}
+		for key := range event {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		if want := []string{"actor", "groupId", "realm", "timestamp", "type"}; !reflect.DeepEqual(keys, want) {
+			t.Errorf("event keys = %v, want %v", keys, want)
+		}
+		grp := kc.Realm("acme").Group("/admins")
+		if event["type"] != utils.EventGroupCreated || event["realm"] != "acme" || event["groupId"] != grp.ID || event["actor"] != "alice" {
+			t.Errorf("event = %v, want %s of %s in acme by alice", event, utils.EventGroupCreated, grp.ID)
+		}
+		if _, err := time.Parse(time.RFC3339, event["timestamp"].(string)); err != nil {
+			t.Errorf("event timestamp %v: %v", event["timestamp"], err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no event delivered to the webhook")
+	}
+}
+
+func TestNormalizeRoles(t *testing.T) {
+	tests := []struct {
+		name  string
+		roles *[]string
+		want  *[]string
+	}{
+		{"nil", nil, nil},
+		{"empty", &[]string{}, &[]string{}},
+		{"sorted and deduplicated", &[]string{"write", "admin", "write", "read", "admin"}, &[]string{"admin", "read", "write"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := normalizeRoles(tt.roles); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("normalizeRoles() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGroupGetNormalizesRealmRoles(t *testing.T) {
+	kc := keycloaktest.NewServer(t)
+	kc.Realm("acme").AddGroup("/admins", nil).RealmRoles = []string{"write", "admin", "write", "read", "admin"}
+	s, _ := keycloaktest.NewService()
+	s.WithDependency("gocloak", kc.Client())
+
+	w := keycloaktest.Do(s, Group_get, keycloaktest.NewRequest(http.MethodGet, "/groupget?shortName=admins", keycloaktest.Token("acme", "alice"), nil))
+	var data groupResponse
+	keycloaktest.Decode(t, w, &data)
+	if want := []string{"admin", "read", "write"}; w.Code != http.StatusOK || data.RealmRoles == nil || !reflect.DeepEqual(*data.RealmRoles, want) {
+		t.Errorf("Group_get() = %d %s, want realmRoles %v", w.Code, w.Body, want)
+	}
+}
+
+func TestGroupGetSubGroupCount(t *testing.T) {
+	kc := keycloaktest.NewServer(t)
+	realm := kc.Realm("acme")
+	realm.AddGroup("/admins", nil)
+	realm.AddGroup("/admins/eu", nil)
+	realm.AddGroup("/admins/us", nil)
+	s, _ := keycloaktest.NewService()
+	s.WithDependency("gocloak", kc.Client())
+	token := keycloaktest.Token("acme", "alice")
+
+	tests := []struct {
+		query         string
+		wantSubGroups bool
+	}{
+		{"shortName=admins", true},
+		{"shortName=admins&briefSubGroups=true", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			w := keycloaktest.Do(s, Group_get, keycloaktest.NewRequest(http.MethodGet, "/groupget?"+tt.query, token, nil))
+			var data groupResponse
+			keycloaktest.Decode(t, w, &data)
+			if w.Code != http.StatusOK || data.SubGroupCount != 2 {
+				t.Fatalf("Group_get() = %d %s, want subGroupCount 2", w.Code, w.Body)
+			}
+			if gotSubGroups := data.SubGroups != nil && len(*data.SubGroups) == 2; gotSubGroups != tt.wantSubGroups {
+				t.Errorf("subGroups = %v, want them returned %v", data.SubGroups, tt.wantSubGroups)
+			}
+		})
+	}
+}
+
+func TestGroupDetail(t *testing.T) {
+	kc := keycloaktest.NewServer(t)
+	realm := kc.Realm("acme")
+	admins := realm.AddGroup("/admins", map[string][]string{"longName": {"Admins"}})
+	admins.AddMembers(realm.AddUser("alice", true), realm.AddUser("bob", true), realm.AddUser("carol", true))
+	realm.AddGroup("/admins-eu", nil)
+	s, _ := keycloaktest.NewService()
+	s.WithDependency("gocloak", kc.Client())
+
+	w := keycloaktest.Do(s, Group_detail, keycloaktest.NewRequest(http.MethodGet, "/groupdetail?shortName=admins&first=1&max=1", keycloaktest.Token("acme", "alice"), nil))
+	var data struct {
+		Group   groupResponse    `json:"group"`
+		Members []memberResponse `json:"members"`
+	}
+	keycloaktest.Decode(t, w, &data)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Group_detail() = %d %s, want 200", w.Code, w.Body)
+	}
+	if data.Group.ID == nil || *data.Group.ID != admins.ID || data.Group.Nusers != 3 {
+		t.Errorf("Group_detail() group = %+v, want %s with 3 users", data.Group, admins.ID)
+	}
+	if len(data.Members) != 1 || *data.Members[0].Username != "bob" {
+		t.Errorf("Group_detail() members = %+v, want [bob]", data.Members)
+	}
+}
+
+func TestGroupNewEmptyGroup(t *testing.T) {
+	s, _ := keycloaktest.NewService()
+	s.WithDependency("gocloak", keycloaktest.NewServer(t).Client())
+
+	w := keycloaktest.Do(s, Group_new, keycloaktest.NewRequest(http.MethodPost, "/groupnew", keycloaktest.Token("acme", "alice"), keycloaktest.Data(map[string]any{})))
+	resp := keycloaktest.Decode(t, w, nil)
+	fields := []string{}
+	for _, msg := range resp.Messages {
+		if msg.Field != nil {
+			fields = append(fields, *msg.Field)
+		}
+	}
+	sort.Strings(fields)
+	if want := []string{"Attributes", "LongName", "ShortName"}; w.Code != http.StatusBadRequest || !reflect.DeepEqual(fields, want) {
+		t.Errorf("Group_new() = %d %s, want errors for %v", w.Code, w.Body, want)
+	}
+}
+
+func TestGroupNewEmptyAttributes(t *testing.T) {
+	kc := keycloaktest.NewServer(t)
+	realm := kc.Realm("acme")
+	s, _ := keycloaktest.NewService()
+	s.WithDependency("gocloak", kc.Client())
+
+	tests := []struct {
+		name  string
+		attr  map[string]string
+		field string
+		vals  []string
+	}{
+		{"empty map", map[string]string{}, "Attributes", []string{"min", "1"}},
+		{"empty key", map[string]string{"": "fin"}, "Attributes[]", []string{"non-empty key"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			create := map[string]any{"shortName": "finance", "longName": "Finance", "attr": tt.attr}
+			w := keycloaktest.Do(s, Group_new, keycloaktest.NewRequest(http.MethodPost, "/groupnew", keycloaktest.Token("acme", "alice"), keycloaktest.Data(create)))
+			resp := keycloaktest.Decode(t, w, nil)
+			if w.Code != http.StatusBadRequest || len(resp.Messages) == 0 || resp.Messages[0].Field == nil || *resp.Messages[0].Field != tt.field {
+				t.Fatalf("Group_new() = %d %s, want an error on %s", w.Code, w.Body, tt.field)
+			}
+			if !reflect.DeepEqual(resp.Messages[0].Vals, tt.vals) {
+				t.Errorf("vals = %v, want %v", resp.Messages[0].Vals, tt.vals)
+			}
+			if realm.Group("/finance") != nil {
+				t.Error("group was created")
+			}
+		})
+	}
+}
+
+func TestGroupDescriptionRoundTrip(t *testing.T) {
+	kc := keycloaktest.NewServer(t)
+	kc.Realm("acme")
+	s, _ := keycloaktest.NewService()
+	s.WithDependency("gocloak", kc.Client())
+	token := keycloaktest.Token("acme", "alice")
+	description := "Operators of the billing platform"
+
+	tests := []struct {
+		shortName   string
+		description *string
+	}{
+		{"billing", &description},
+		{"support", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.shortName, func(t *testing.T) {
+			body := group{ShortName: tt.shortName, LongName: tt.shortName, Description: tt.description, Attributes: map[string]string{"dept": "ops"}}
+			w := keycloaktest.Do(s, Group_new, keycloaktest.NewRequest(http.MethodPost, "/groupnew", token, keycloaktest.Data(body)))
+			if w.Code != http.StatusOK {
+				t.Fatalf("Group_new() = %d %s, want 200", w.Code, w.Body)
+			}
+
+			w = keycloaktest.Do(s, Group_get, keycloaktest.NewRequest(http.MethodGet, "/groupget?shortName="+tt.shortName, token, nil))
+			var data groupResponse
+			keycloaktest.Decode(t, w, &data)
+			if !reflect.DeepEqual(data.Description, tt.description) {
+				t.Errorf("Group_get() description = %v, want %v", data.Description, tt.description)
+			}
+		})
+	}
+}
+
+func TestGroupDelete(t *testing.T) {
+	tests := []struct {
+		name     string
+		query    string
+		members  int
+		wantCode int
+		wantErr  []string
+		deleted  bool
+	}{
+		{"empty", "shortName=admins", 0, http.StatusOK, nil, true},
+		{"non-empty", "shortName=admins", 2, http.StatusBadRequest, []string{utils.ErrGroupNotEmpty}, false},
+		{"non-empty forced", "shortName=admins&force=true", 2, http.StatusOK, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kc := keycloaktest.NewServer(t)
+			realm := kc.Realm("acme")
+			admins := realm.AddGroup("/admins", nil)
+			for i := 0; i < tt.members; i++ {
+				admins.AddMembers(realm.AddUser(fmt.Sprintf("user%d", i), true))
+			}
+			realm.AddGroup("/admins-eu", nil)
+			s, _ := keycloaktest.NewService()
+			s.WithDependency("gocloak", kc.Client())
+
+			w := keycloaktest.Do(s, Group_delete, keycloaktest.NewRequest(http.MethodDelete, "/groupdelete?"+tt.query, keycloaktest.Token("acme", "alice"), nil))
+			resp := keycloaktest.Decode(t, w, nil)
+			if w.Code != tt.wantCode || len(tt.wantErr) > 0 && !reflect.DeepEqual(resp.ErrCodes(), tt.wantErr) {
+				t.Errorf("Group_delete(%s) = %d %s, want %d %v", tt.query, w.Code, w.Body, tt.wantCode, tt.wantErr)
+			}
+			if tt.wantErr != nil && !reflect.DeepEqual(resp.Messages[0].Vals, []string{strconv.Itoa(tt.members)}) {
+				t.Errorf("Group_delete(%s) vals = %v, want the member count %d", tt.query, resp.Messages[0].Vals, tt.members)
+			}
+			if deleted := realm.Group("/admins") == nil; deleted != tt.deleted || realm.Group("/admins-eu") == nil {
+				t.Errorf("Group_delete(%s) deleted admins = %v, want %v and admins-eu kept", tt.query, deleted, tt.deleted)
+			}
+		})
+	}
+}
+
+func TestGroupListEmptyRealm(t *testing.T) {
+	kc := keycloaktest.NewServer(t)
+	kc.Realm("acme")
+	s, _ := keycloaktest.NewService()
+	s.WithDependency("gocloak", kc.Client()).WithDependency("keycloakURL", kc.URL)
+
+	w := keycloaktest.Do(s, Group_list, keycloaktest.NewRequest(http.MethodGet, "/grouplist", keycloaktest.Token("acme", "alice"), nil))
+	var data map[string]json.RawMessage
+	keycloaktest.Decode(t, w, &data)
+	if w.Code != http.StatusOK || string(data["items"]) != "[]" {
+		t.Errorf("Group_list() = %d %s, want 200 with an empty groups list", w.Code, w.Body)
+	}
+}
+
+func TestGroupListPage(t *testing.T) {
+	kc := keycloaktest.NewServer(t)
+	realm := kc.Realm("acme")
+	for _, path := range []string{"/admins", "/org/finance", "/org/sales", "/auditors"} {
+		realm.AddGroup(path, nil)
+	}
+	s, _ := keycloaktest.NewService()
+	s.WithDependency("gocloak", kc.Client()).WithDependency("keycloakURL", kc.URL)
+	token := keycloaktest.Token("acme", "alice")
+
+	// total counts the top level groups only, as those are what Group_list pages through
+	tests := []struct {
+		query string
+		want  utils.Page
+		items int
+	}{
+		{"first=0&max=2", utils.Page{Total: 3, First: 0, Max: 2, HasMore: true}, 2},
+		{"first=2&max=2", utils.Page{Total: 3, First: 2, Max: 2, HasMore: false}, 1},
+	}
+	for _, tt := range tests {
+		w := keycloaktest.Do(s, Group_list, keycloaktest.NewRequest(http.MethodGet, "/grouplist?"+tt.query, token, nil))
+		var items []groupListResponse
+		got := utils.Page{Items: &items}
+		keycloaktest.Decode(t, w, &got)
+		got.Items = nil
+		if w.Code != http.StatusOK || got != tt.want || len(items) != tt.items {
+			t.Errorf("Group_list(%s) = %d %+v with %d items, want %+v with %d", tt.query, w.Code, got, len(items), tt.want, tt.items)
+		}
+	}
+
+	w := keycloaktest.Do(s, Group_list, keycloaktest.NewRequest(http.MethodGet, "/grouplist?max=0", token, nil))
+	if resp := keycloaktest.Decode(t, w, nil); w.Code != http.StatusBadRequest || !reflect.DeepEqual(resp.ErrCodes(), []string{utils.ErrInvalidParam}) {
+		t.Errorf("Group_list(max=0) = %d %s, want 400 %s", w.Code, w.Body, utils.ErrInvalidParam)
+	}
+}
+
+func TestGroupListLongName(t *testing.T) {
+	kc := keycloaktest.NewServer(t)
+	realm := kc.Realm("acme")
+	realm.AddGroup("/admins", map[string][]string{"longName": {"Administrators"}})
+	// created outside idshield, without a longName attribute
+	realm.AddGroup("/legacy", nil)
+	s, _ := keycloaktest.NewService()
+	s.WithDependency("gocloak", kc.Client()).WithDependency("keycloakURL", kc.URL)
+
+	w := keycloaktest.Do(s, Group_list, keycloaktest.NewRequest(http.MethodGet, "/grouplist", keycloaktest.Token("acme", "alice"), nil))
+	var items []groupListResponse
+	keycloaktest.Decode(t, w, &utils.Page{Items: &items})
+	got := map[string]string{}
+	for _, item := range items {
+		got[*item.ShortName] = *item.LongName
+	}
+	if want := map[string]string{"/admins": "Administrators", "/legacy": "legacy"}; w.Code != http.StatusOK || !reflect.DeepEqual(got, want) {
+		t.Errorf("Group_list() = %d %v, want longNames %v", w.Code, got, want)
+	}
+}
+
+func TestGroupListRealmPageSizeCap(t *testing.T) {
+	kc := keycloaktest.NewServer(t)
+	s, _ := keycloaktest.NewService()
+	s.WithDependency("gocloak", kc.Client()).WithDependency("keycloakURL", kc.URL).
+		WithDependency("realmConfig", utils.RealmConfig{MaxPageSize: 4})
+
+	// wayne overrides the global cap of 4, stark doesn't set one
+	tests := []struct {
+		realm   string
+		maxAttr string
+		wantMax int
+	}{
+		{"wayne", "2", 2},
+		{"stark", "", 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.realm, func(t *testing.T) {
+			realm := kc.Realm(tt.realm)
+			if tt.maxAttr != "" {
+				realm.Attributes[utils.RealmAttrMaxPageSize] = tt.maxAttr
+			}
+			for i := 0; i < 6; i++ {
+				realm.AddGroup(fmt.Sprintf("/team%d", i), nil)
+			}
+
+			w := keycloaktest.Do(s, Group_list, keycloaktest.NewRequest(http.MethodGet, "/grouplist?max=50", keycloaktest.Token(tt.realm, "alice"), nil))
+			var items []groupListResponse
+			got := utils.Page{Items: &items}
+			keycloaktest.Decode(t, w, &got)
+			if w.Code != http.StatusOK || got.Max != tt.wantMax || len(items) != tt.wantMax || !got.HasMore {
+				t.Errorf("Group_list(max=50) = %d max %d with %d items, want max %d", w.Code, got.Max, len(items), tt.wantMax)
+			}
+		})
+	}
+}
+
+func TestGroupListClampsMax(t *testing.T) {
+	kc := keycloaktest.NewServer(t)
+	kc.Realm("acme").AddGroup("/admins", nil)
+	s, _ := keycloaktest.NewService()
+	s.WithDependency("gocloak", kc.Client()).WithDependency("keycloakURL", kc.URL).
+		WithDependency("realmConfig", utils.RealmConfig{MaxPageSize: 1000})
+	token := keycloaktest.Token("acme", "alice")
+
+	w := keycloaktest.Do(s, Group_list, keycloaktest.NewRequest(http.MethodGet, "/grouplist?max=10000", token, nil))
+	var got utils.Page
+	keycloaktest.Decode(t, w, &got)
+	if w.Code != http.StatusOK || got.Max != 1000 {
+		t.Errorf("Group_list(max=10000) = %d max %d, want 200 clamped to 1000", w.Code, got.Max)
+	}
+	if want := `299 idshield "max reduced from 10000 to 1000"`; w.Header().Get("Warning") != want {
+		t.Errorf("Warning = %q, want %q", w.Header().Get("Warning"), want)
+	}
+
+	w = keycloaktest.Do(s, Group_list, keycloaktest.NewRequest(http.MethodGet, "/grouplist?max=1000", token, nil))
+	if w.Code != http.StatusOK || w.Header().Get("Warning") != "" {
+		t.Errorf("Group_list(max=1000) = %d with Warning %q, want 200 without one", w.Code, w.Header().Get("Warning"))
+	}
+}
+
+func TestGroupListPartialCounts(t *testing.T) {
+	tests := []struct {
+		name  string
+		limit types.FanOut
+	}{
+		{"call timeout", types.FanOut{CallTimeoutMs: 50, DeadlineMs: 5000}},
+		{"overall deadline", types.FanOut{CallTimeoutMs: 5000, DeadlineMs: 50}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kc := keycloaktest.NewServer(t)
+			realm := kc.Realm("acme")
+			realm.AddGroup("/admins", nil).AddMembers(realm.AddUser("alice", true), realm.AddUser("bob", true))
+			slow := realm.AddGroup("/slow", nil)
+			// the slow group's member call hangs until the caller gives up
+			kc.Handle(http.MethodGet, "/admin/realms/acme/groups/"+slow.ID+"/members", func(w http.ResponseWriter, r *http.Request) {
+				select {
+				case <-r.Context().Done():
+				case <-time.After(10 * time.Second):
+				}
+			})
+			s, _ := keycloaktest.NewService()
+			s.WithDependency("gocloak", kc.Client()).WithDependency("keycloakURL", kc.URL).WithDependency("memberCount", tt.limit)
+
+			start := time.Now()
+			w := keycloaktest.Do(s, Group_list, keycloaktest.NewRequest(http.MethodGet, "/grouplist", keycloaktest.Token("acme", "alice"), nil))
+			if elapsed := time.Since(start); elapsed > 3*time.Second {
+				t.Errorf("Group_list() took %v, want it bounded by the fan-out limits", elapsed)
+			}
+			var got struct {
+				Items   []groupListResponse `json:"items"`
+				Partial bool                `json:"partial"`
+			}
+			keycloaktest.Decode(t, w, &got)
+			if w.Code != http.StatusOK || !got.Partial || len(got.Items) != 2 {
+				t.Fatalf("Group_list() = %d %s, want 200 with partial counts", w.Code, w.Body)
+			}
+			for _, item := range got.Items {
+				switch *item.ShortName {
+				case "/admins":
+					if item.Nusers != 2 || item.NusersUnavailable {
+						t.Errorf("admins = %+v, want 2 members counted", item)
+					}
+				case "/slow":
+					if !item.NusersUnavailable {
+						t.Errorf("slow = %+v, want its count flagged unavailable", item)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestGroupListRateLimited(t *testing.T) {
+	kc := keycloaktest.NewServer(t)
+	kc.Realm("acme").AddGroup("/admins", nil)
+	kc.Handle(http.MethodGet, "/admin/realms/acme/groups", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "12")
+		keycloaktest.Error(w, http.StatusTooManyRequests, "Too many requests")
+	})
+	client := kc.Client()
+	client.RestyClient().OnAfterResponse(utils.CaptureRetryAfter)
+	s, _ := keycloaktest.NewService()
+	s.WithDependency("gocloak", client).WithDependency("keycloakURL", kc.URL)
+
+	w := keycloaktest.Do(s, Group_list, keycloaktest.NewRequest(http.MethodGet, "/grouplist", keycloaktest.Token("acme", "alice"), nil))
+	resp := keycloaktest.Decode(t, w, nil)
+	if w.Code != http.StatusBadRequest || !reflect.DeepEqual(resp.ErrCodes(), []string{utils.ErrDownstreamRateLimited}) || w.Header().Get("Retry-After") != "12" {
+		t.Errorf("Group_list() = %d %s with Retry-After %q, want 400 %s and 12", w.Code, w.Body, w.Header().Get("Retry-After"), utils.ErrDownstreamRateLimited)
+	}
+}
+
+func TestGroupListCSV(t *testing.T) {
+	kc := keycloaktest.NewServer(t)
+	realm := kc.Realm("acme")
+	realm.AddGroup("/admins", map[string][]string{"longName": {"Administrators, Global"}}).AddMembers(realm.AddUser("alice", true), realm.AddUser("bob", true))
+	realm.AddGroup("/auditors", nil)
+	s, _ := keycloaktest.NewService()
+	s.WithDependency("gocloak", kc.Client()).WithDependency("keycloakURL", kc.URL)
+	token := keycloaktest.Token("acme", "alice")
+
+	want := "shortName,longName,nusers,path\n" +
+		"admins,\"Administrators, Global\",2,/admins\n" +
+		"auditors,,0,/auditors\n"
+	for name, req := range map[string]*http.Request{
+		"format": keycloaktest.NewRequest(http.MethodGet, "/grouplist?format=csv", token, nil),
+		"accept": keycloaktest.NewRequest(http.MethodGet, "/grouplist", token, nil),
+	} {
+		t.Run(name, func(t *testing.T) {
+			if name == "accept" {
+				req.Header.Set("Accept", "text/csv")
+			}
+			w := keycloaktest.Do(s, Group_list, req)
+			if w.Code != http.StatusOK || !strings.HasPrefix(w.Header().Get("Content-Type"), "text/csv") || w.Body.String() != want {
+				t.Errorf("Group_list() = %d %s %q, want text/csv %q", w.Code, w.Header().Get("Content-Type"), w.Body, want)
+			}
+		})
+	}
+}
+
+func TestGroupListHasSubGroups(t *testing.T) {
+	kc := keycloaktest.NewServer(t)
+	realm := kc.Realm("acme")
+	realm.AddGroup("/org/admins", nil)
+	realm.AddGroup("/sales", nil)
+	s, _ := keycloaktest.NewService()
+	s.WithDependency("gocloak", kc.Client()).WithDependency("keycloakURL", kc.URL)
+
+	w := keycloaktest.Do(s, Group_list, keycloaktest.NewRequest(http.MethodGet, "/grouplist", keycloaktest.Token("acme", "alice"), nil))
+	var data struct {
+		Groups []groupListResponse `json:"items"`
+	}
+	keycloaktest.Decode(t, w, &data)
+	got := map[string]bool{}
+	for _, g := range data.Groups {
+		got[*g.ShortName] = g.HasSubGroups
+	}
+	if want := map[string]bool{"/org": true, "/sales": false}; w.Code != http.StatusOK || !reflect.DeepEqual(got, want) {
+		t.Errorf("Group_list() hasSubGroups = %d %v, want %v", w.Code, got, want)
+	}
+}
+
+func TestGroupGetLookupKeys(t *testing.T) {
+	kc := keycloaktest.NewServer(t)
+	admins := kc.Realm("acme").AddGroup("/admins", nil)
+	s, _ := keycloaktest.NewService()
+	s.WithDependency("gocloak", kc.Client())
+
+	// every combination of the three lookup keys, as bits shortName, id, path
+	for set := 0; set < 8; set++ {
+		query := url.Values{}
+		if set&1 != 0 {
+			query.Set("shortName", "admins")
+		}
+		if set&2 != 0 {
+			query.Set("id", admins.ID)
+		}
+		if set&4 != 0 {
+			query.Set("path", "/admins")
+		}
+		var wantErr string
+		switch set {
+		case 0:
+			wantErr = utils.ErrMissingLookup
+		case 1, 2, 4:
+		default:
+			wantErr = utils.ErrAmbiguousLookup
+		}
+		t.Run(query.Encode(), func(t *testing.T) {
+			w := keycloaktest.Do(s, Group_get, keycloaktest.NewRequest(http.MethodGet, "/groupget?"+query.Encode(), keycloaktest.Token("acme", "alice"), nil))
+			var data groupResponse
+			resp := keycloaktest.Decode(t, w, &data)
+			if wantErr != "" {
+				if w.Code != http.StatusBadRequest || !reflect.DeepEqual(resp.ErrCodes(), []string{wantErr}) {
+					t.Errorf("Group_get() = %d %s, want 400 %s", w.Code, w.Body, wantErr)
+				}
+				return
+			}
+			if w.Code != http.StatusOK || data.ID == nil || *data.ID != admins.ID {
+				t.Errorf("Group_get() = %d %s, want group %s", w.Code, w.Body, admins.ID)
+			}
+		})
+	}
+}
+
+func TestValidateLookup(t *testing.T) {
+	tests := []struct {
+		shortName, id, path string
+		want                string
+	}{
+		{"", "", "", utils.ErrMissingLookup},
+		{"admins", "", "", ""},
+		{"", "1234", "", ""},
+		{"", "", "/org/admins", ""},
+		{"admins", "1234", "", utils.ErrAmbiguousLookup},
+		{"admins", "1234", "/org/admins", utils.ErrAmbiguousLookup},
+	}
+	for _, tt := range tests {
+		if got := validateLookup(tt.shortName, tt.id, tt.path); got != tt.want {
+			t.Errorf("validateLookup(%q, %q, %q) = %q, want %q", tt.shortName, tt.id, tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestGroupHandlersLogClientIP(t *testing.T) {
+	tests := []struct {
+		name    string
+		proxies []string
+		want    string
+	}{
+		{"behind a trusted proxy", []string{"192.0.2.1"}, "203.0.113.7"},
+		{"no trusted proxy", nil, "192.0.2.1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kc := keycloaktest.NewServer(t)
+			kc.Realm("acme")
+			s, logs := keycloaktest.NewService()
+			s.WithDependency("gocloak", kc.Client()).WithDependency("keycloakURL", kc.URL)
+			if err := s.Router.SetTrustedProxies(tt.proxies); err != nil {
+				t.Fatal(err)
+			}
+			req := keycloaktest.NewRequest(http.MethodGet, "/grouplist", keycloaktest.Token("acme", "alice"), nil)
+			req.RemoteAddr = "192.0.2.1:40000"
+			req.Header.Set("X-Forwarded-For", "203.0.113.7")
+
+			keycloaktest.Do(s, Group_list, req)
+			for _, line := range strings.Split(strings.TrimSpace(logs.String()), "\n") {
+				var entry struct {
+					RemoteIP string `json:"remote_ip"`
+				}
+				if err := json.Unmarshal([]byte(line), &entry); err != nil {
+					t.Fatalf("log entry %q: %v", line, err)
+				}
+				if entry.RemoteIP != tt.want {
+					t.Errorf("logged remote_ip = %q, want %q", entry.RemoteIP, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestGroupNewRequestTooLarge(t *testing.T) {
+	kc := keycloaktest.NewServer(t)
+	kc.Realm("acme")
+	s, _ := keycloaktest.NewService()
+	s.WithDependency("gocloak", kc.Client()).WithDependency("maxRequestBody", int64(512))
+	token := keycloaktest.Token("acme", "alice")
+
+	small := group{ShortName: "admins", LongName: "Admins", Attributes: map[string]string{"dept": "hr"}}
+	w := keycloaktest.Do(s, Group_new, keycloaktest.NewRequest(http.MethodPost, "/groupnew", token, keycloaktest.Data(small)))
+	if w.Code != http.StatusOK {
+		t.Errorf("Group_new() under the limit = %d %s, want 200", w.Code, w.Body)
+	}
+
+	large := group{ShortName: "auditors", LongName: "Auditors", Attributes: map[string]string{"notes": strings.Repeat("x", 600)}}
+	w = keycloaktest.Do(s, Group_new, keycloaktest.NewRequest(http.MethodPost, "/groupnew", token, keycloaktest.Data(large)))
+	resp := keycloaktest.Decode(t, w, nil)
+	if w.Code != http.StatusBadRequest || !reflect.DeepEqual(resp.ErrCodes(), []string{utils.ErrRequestTooLarge}) {
+		t.Errorf("Group_new() over the limit = %d %s, want 400 %s", w.Code, w.Body, utils.ErrRequestTooLarge)
+	}
+	if kc.Realm("acme").Group("/auditors") != nil {
+		t.Errorf("Group_new() created the group of an oversized request")
+	}
+}
+
+func TestGroupGetExactName(t *testing.T) {
+	kc := keycloaktest.NewServer(t)
+	realm := kc.Realm("acme")
+	realm.AddGroup("/admins-eu", nil)
+	admins := realm.AddGroup("/admins", nil)
+	s, _ := keycloaktest.NewService()
+	s.WithDependency("gocloak", kc.Client())
+	token := keycloaktest.Token("acme", "alice")
+
+	w := keycloaktest.Do(s, Group_get, keycloaktest.NewRequest(http.MethodGet, "/groupget?shortName=admins", token, nil))
+	var data groupResponse
+	keycloaktest.Decode(t, w, &data)
+	if w.Code != http.StatusOK || data.ID == nil || *data.ID != admins.ID {
+		t.Errorf("Group_get(admins) = %d %s, want group %s", w.Code, w.Body, admins.ID)
+	}
+
+	w = keycloaktest.Do(s, Group_get, keycloaktest.NewRequest(http.MethodGet, "/groupget?shortName=admin", token, nil))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Group_get(admin) = %d %s, want 400 for a partial match", w.Code, w.Body)
+	}
+}
+
+func TestGroupGetSpecialCharacters(t *testing.T) {
+	kc := keycloaktest.NewServer(t)
+	realm := kc.Realm("acme")
+	sales := realm.AddGroup("/sales team", nil)
+	rnd := realm.AddGroup("/r&d #1?", nil)
+	qa := realm.AddGroup("/org/q&a #2", nil)
+	office := realm.AddGroup("/कार्यालय", nil)
+	s, _ := keycloaktest.NewService()
+	s.WithDependency("gocloak", kc.Client())
+
+	tests := []struct {
+		query url.Values
+		want  *keycloaktest.Group
+	}{
+		{url.Values{"shortName": {"sales team"}}, sales},
+		{url.Values{"path": {"/sales team"}}, sales},
+		{url.Values{"shortName": {"r&d #1?"}}, rnd},
+		{url.Values{"path": {"/r&d #1?"}}, rnd},
+		{url.Values{"path": {"/org/q&a #2"}}, qa},
+		{url.Values{"path": {"/कार्यालय"}}, office},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query.Encode(), func(t *testing.T) {
+			w := keycloaktest.Do(s, Group_get, keycloaktest.NewRequest(http.MethodGet, "/groupget?"+tt.query.Encode(), keycloaktest.Token("acme", "alice"), nil))
+			var data groupResponse
+			keycloaktest.Decode(t, w, &data)
+			if w.Code != http.StatusOK || data.ID == nil || *data.ID != tt.want.ID {
+				t.Errorf("Group_get() = %d %s, want group %s", w.Code, w.Body, tt.want.ID)
+			}
+		})
+	}
+}
+
+func TestGroupGetActiveOnly(t *testing.T) {
+	kc := keycloaktest.NewServer(t)
+	realm := kc.Realm("acme")
+	realm.AddGroup("/admins", nil).AddMembers(realm.AddUser("alice", true), realm.AddUser("bob", false), realm.AddUser("carol", true))
+	s, _ := keycloaktest.NewService()
+	s.WithDependency("gocloak", kc.Client()).WithDependency("keycloakURL", kc.URL)
+
+	tests := []struct {
+		query string
+		want  int
+	}{
+		{"shortName=admins", 3},
+		{"shortName=admins&activeOnly=true", 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			w := keycloaktest.Do(s, Group_get, keycloaktest.NewRequest(http.MethodGet, "/groupget?"+tt.query, keycloaktest.Token("acme", "alice"), nil))
+			var data groupResponse
+			keycloaktest.Decode(t, w, &data)
+			if w.Code != http.StatusOK || data.Nusers != tt.want {
+				t.Errorf("Group_get(%s) = %d nusers %d, want %d", tt.query, w.Code, data.Nusers, tt.want)
+			}
+		})
+	}
+}
+
+// TestGroupListConcurrent fires Group_list callers of two realms at once through one service and its shared
+// gocloak client, run it with -race to check the client carries no per-request state
+func TestGroupListConcurrent(t *testing.T) {
+	kc := keycloaktest.NewServer(t)
+	kc.Realm("acme").AddGroup("/admins", nil)
+	kc.Realm("globex").AddGroup("/auditors", nil)
+	s, _ := keycloaktest.NewService()
+	// the test buffer isn't safe for concurrent writes, the logger of main writes to stdout
+	s.WithLogHarbour(logharbour.NewLogger(logharbour.NewLoggerContext(logharbour.Info), "idshield", io.Discard))
+	s.WithDependency("gocloak", kc.Client()).WithDependency("keycloakURL", kc.URL)
+
+	const callers = 50
+	var wg sync.WaitGroup
+	errs := make(chan string, callers)
+	for i := 0; i < callers; i++ {
+		realm, want := "acme", "/admins"
+		if i%2 == 1 {
+			realm, want = "globex", "/auditors"
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w := keycloaktest.Do(s, Group_list, keycloaktest.NewRequest(http.MethodGet, "/grouplist", keycloaktest.Token(realm, "alice"), nil))
+			var data struct {
+				Groups []groupListResponse `json:"items"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &struct {
+				Data any `json:"data"`
+			}{&data}); err != nil || w.Code != http.StatusOK || len(data.Groups) != 1 || *data.Groups[0].ShortName != want {
+				errs <- fmt.Sprintf("Group_list() in %s = %d %s, want %s", realm, w.Code, w.Body, want)
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+}
+
+func TestGroupNewPerformedByAt(t *testing.T) {
+	kc := keycloaktest.NewServer(t)
+	realm := kc.Realm("acme")
+	s, _ := keycloaktest.NewService()
+	s.WithDependency("gocloak", kc.Client())
+	token := keycloaktest.Token("acme", "alice")
+	body := map[string]any{"shortName": "admins", "longName": "Admins", "attr": map[string]string{"dept": "hr"}}
+
+	before := time.Now().UTC().Truncate(time.Second)
+	w := keycloaktest.Do(s, Group_new, keycloaktest.NewRequest(http.MethodPost, "/groupnew", token, keycloaktest.Data(body)))
+	var data utils.MutationResult
+	keycloaktest.Decode(t, w, &data)
+	if w.Code != http.StatusOK || data.PerformedBy != "alice" || data.Result != realm.Group("/admins").ID {
+		t.Errorf("Group_new() = %d %s, want the new group's id performed by alice", w.Code, w.Body)
+	}
+	at, err := time.Parse(time.RFC3339, data.PerformedAt)
+	if err != nil || at.Before(before) || at.After(time.Now()) {
+		t.Errorf("Group_new() performedAt = %q, want the RFC3339 server time", data.PerformedAt)
+	}
+
+	// read endpoints keep their plain response
+	w = keycloaktest.Do(s, Group_get, keycloaktest.NewRequest(http.MethodGet, "/groupget?shortName=admins", token, nil))
+	var fields map[string]json.RawMessage
+	keycloaktest.Decode(t, w, &fields)
+	if _, ok := fields["performedBy"]; w.Code != http.StatusOK || ok {
+		t.Errorf("Group_get() = %d %s, want no performedBy", w.Code, w.Body)
+	}
+}
+
+func TestGroupRequestLogsMaskSensitiveAttrs(t *testing.T) {
+	kc := keycloaktest.NewServer(t)
+	realm := kc.Realm("acme")
+	s, logs := keycloaktest.NewService()
+	s.WithDependency("gocloak", kc.Client()).WithDependency("sensitiveAttrs", []string{"pan"})
+	token := keycloaktest.Token("acme", "alice")
+
+	create := map[string]any{"shortName": "admins", "longName": "Admins", "attr": map[string]string{"dept": "hr", "pan": "ABCDE1234F"}}
+	w := keycloaktest.Do(s, Group_new, keycloaktest.NewRequest(http.MethodPost, "/groupnew", token, keycloaktest.Data(create)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Group_new() = %d %s, want 200", w.Code, w.Body)
+	}
+	update := map[string]any{"shortName": "admins", "longName": "Admins", "attr": map[string]string{"dept": "hr", "pan": "FGHIJ5678K"}}
+	w = keycloaktest.Do(s, Group_update, keycloaktest.NewRequest(http.MethodPost, "/groupupdate", token, keycloaktest.Data(update)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Group_update() = %d %s, want 200", w.Code, w.Body)
+	}
+
+	for _, value := range []string{"ABCDE1234F", "FGHIJ5678K"} {
+		if strings.Contains(logs.String(), value) {
+			t.Errorf("logs contain the sensitive value %s", value)
+		}
+	}
+	if !strings.Contains(logs.String(), utils.MaskedValue) {
+		t.Errorf("logs don't contain the masked value %s", utils.MaskedValue)
+	}
+	// masking only applies to the logs, keycloak gets the real value
+	if got := realm.Group("/admins").Attributes["pan"]; !reflect.DeepEqual(got, []string{"FGHIJ5678K"}) {
+		t.Errorf("pan attribute = %v, want [FGHIJ5678K]", got)
+	}
+}
+
+func TestGroupHandlersLogLevel(t *testing.T) {
+	tests := []struct {
+		level     string
+		wantDebug bool
+	}{
+		{"info", false},
+		{"debug", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.level, func(t *testing.T) {
+			priority, err := utils.ParseLogLevel(tt.level)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var logs bytes.Buffer
+			s, _ := keycloaktest.NewService()
+			s.WithLogHarbour(logharbour.NewLogger(logharbour.NewLoggerContext(priority), "idshield", &logs))
+
+			// a request without a token logs the header error at Debug0
+			w := keycloaktest.Do(s, Group_new, keycloaktest.NewRequest(http.MethodPost, "/groupnew", "", nil))
+			if w.Code != http.StatusBadRequest {
+				t.Fatalf("Group_new() = %d %s, want 400", w.Code, w.Body)
+			}
+			if got := strings.Contains(logs.String(), "Missing or incorrect Authorization header format"); got != tt.wantDebug {
+				t.Errorf("debug entry logged = %v, want %v at %s", got, tt.wantDebug, tt.level)
+			}
+			if !strings.Contains(logs.String(), "Starting execution of Group_new()") {
+				t.Errorf("info entry not logged at %s", tt.level)
+			}
+		})
+	}
+}
+
+func TestGroupGetAccess(t *testing.T) {
+	kc := keycloaktest.NewServer(t)
+	admins := kc.Realm("acme").AddGroup("/org/admins", nil)
+	s, _ := keycloaktest.NewService()
+	s.WithDependency("gocloak", kc.Client())
+
+	for _, query := range []string{"shortName=org", "id=" + admins.ID, "path=/org/admins"} {
+		w := keycloaktest.Do(s, Group_get, keycloaktest.NewRequest(http.MethodGet, "/groupget?"+query, keycloaktest.Token("acme", "alice"), nil))
+		var data groupResponse
+		keycloaktest.Decode(t, w, &data)
+		if w.Code != http.StatusOK || data.Access == nil || !(*data.Access)["view"] {
+			t.Errorf("Group_get(%s) = %d %s, want the access flags of the group", query, w.Code, w.Body)
+		}
+	}
+}
+
+func TestGroupGetNotModified(t *testing.T) {
+	kc := keycloaktest.NewServer(t)
+	admins := kc.Realm("acme").AddGroup("/admins", map[string][]string{"dept": {"hr"}})
+	s, _ := keycloaktest.NewService()
+	s.WithDependency("gocloak", kc.Client())
+	token := keycloaktest.Token("acme", "alice")
+	get := func(ifNoneMatch string) *httptest.ResponseRecorder {
+		req := keycloaktest.NewRequest(http.MethodGet, "/groupget?shortName=admins", token, nil)
+		if ifNoneMatch != "" {
+			req.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		return keycloaktest.Do(s, Group_get, req)
+	}
+
+	w := get("")
+	etag := w.Header().Get("ETag")
+	if w.Code != http.StatusOK || etag == "" {
+		t.Fatalf("Group_get() = %d with ETag %q, want 200 with an ETag", w.Code, etag)
+	}
+
+	w = get(etag)
+	if w.Code != http.StatusNotModified || w.Body.Len() != 0 {
+		t.Errorf("Group_get() with a matching If-None-Match = %d %q, want an empty 304", w.Code, w.Body)
+	}
+
+	// a changed group no longer matches the old tag
+	kc.Lock(func() { admins.Attributes["dept"] = []string{"it"} })
+	w = get(etag)
+	if w.Code != http.StatusOK || w.Header().Get("ETag") == etag {
+		t.Errorf("Group_get() of a changed group = %d with ETag %q, want 200 with a new ETag", w.Code, w.Header().Get("ETag"))
+	}
+}
+
+func TestGroupRequestUnknownField(t *testing.T) {
+	body := map[string]any{"shortNam": "admins", "longName": "Admins", "attr": map[string]string{"dept": "hr"}}
+	for name, handler := range map[string]service.HandlerFunc{"Group_new": Group_new, "Group_update": Group_update} {
+		kc := keycloaktest.NewServer(t)
+		realm := kc.Realm("acme")
+		s, _ := keycloaktest.NewService()
+		s.WithDependency("gocloak", kc.Client())
+
+		w := keycloaktest.Do(s, handler, keycloaktest.NewRequest(http.MethodPost, "/", keycloaktest.Token("acme", "alice"), keycloaktest.Data(body)))
+		resp := keycloaktest.Decode(t, w, nil)
+		if w.Code != http.StatusBadRequest || !reflect.DeepEqual(resp.ErrCodes(), []string{utils.ErrUnknownField}) || *resp.Messages[0].Field != "shortNam" {
+			t.Errorf("%s() = %d %s, want 400 %s for shortNam", name, w.Code, w.Body, utils.ErrUnknownField)
+		}
+		if len(realm.Groups) != 0 {
+			t.Errorf("%s() created a group from a request with an unknown field", name)
+		}
+	}
+}
+
+func TestGroupHandlersMissingGocloak(t *testing.T) {
+	body := keycloaktest.Data(map[string]any{"shortName": "admins", "longName": "Admins", "attr": map[string]string{"dept": "hr"}})
+	tests := []struct {
+		name    string
+		handler service.HandlerFunc
+		method  string
+		target  string
+		body    any
+	}{
+		{"Group_new", Group_new, http.MethodPost, "/groupnew", body},
+		{"Group_update", Group_update, http.MethodPost, "/groupupdate", body},
+		{"Group_get", Group_get, http.MethodGet, "/groupget?shortName=admins", nil},
+		{"Group_list", Group_list, http.MethodGet, "/grouplist", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, _ := keycloaktest.NewService()
+			w := keycloaktest.Do(s, tt.handler, keycloaktest.NewRequest(tt.method, tt.target, keycloaktest.Token("acme", "alice"), tt.body))
+			// a second response written after the first would make the body undecodable
+			resp := keycloaktest.Decode(t, w, nil)
+			if w.Code != http.StatusBadRequest || !reflect.DeepEqual(resp.ErrCodes(), []string{utils.ErrFailedToLoadDependence}) {
+				t.Errorf("%s() = %d %s, want a single 400 %s", tt.name, w.Code, w.Body, utils.ErrFailedToLoadDependence)
+			}
+		})
+	}
+}
+
+func TestGroupNewDefaultAttributes(t *testing.T) {
+	kc := keycloaktest.NewServer(t)
+	realm := kc.Realm("acme")
+	s, _ := keycloaktest.NewService()
+	s.WithDependency("gocloak", kc.Client()).WithDependency("realmConfig", utils.RealmConfig{DefaultAttrs: map[string]string{"source": "idshield", "tier": "standard"}})
+	token := keycloaktest.Token("acme", "alice")
+
+	// the request overrides tier and tries to set createdBy itself
+	create := map[string]any{"shortName": "admins", "longName": "Admins", "attr": map[string]string{"tier": "gold", "idshield_createdBy": "mallory"}}
+	w := keycloaktest.Do(s, Group_new, keycloaktest.NewRequest(http.MethodPost, "/groupnew", token, keycloaktest.Data(create)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Group_new() = %d %s, want 200", w.Code, w.Body)
+	}
+	attrs := realm.Group("/admins").Attributes
+	want := map[string][]string{"source": {"idshield"}, "tier": {"gold"}, "idshield_createdBy": {"alice"}}
+	for key, values := range want {
+		if !reflect.DeepEqual(attrs[key], values) {
+			t.Errorf("attribute %s = %v, want %v", key, attrs[key], values)
+		}
+	}
+
+	// an update that leaves createdBy out keeps it
+	update := map[string]any{"shortName": "admins", "longName": "Admins", "attr": map[string]string{"tier": "silver"}}
+	w = keycloaktest.Do(s, Group_update, keycloaktest.NewRequest(http.MethodPost, "/groupupdate", keycloaktest.Token("acme", "bob"), keycloaktest.Data(update)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Group_update() = %d %s, want 200", w.Code, w.Body)
+	}
+	attrs = realm.Group("/admins").Attributes
+	if !reflect.DeepEqual(attrs["idshield_createdBy"], []string{"alice"}) || !reflect.DeepEqual(attrs["tier"], []string{"silver"}) {
+		t.Errorf("attributes after update = %v, want createdBy alice and tier silver", attrs)
+	}
+}
+
+func TestGroupGetNormalizedRealm(t *testing.T) {
+	kc := keycloaktest.NewServer(t)
+	kc.Realm("Initech").AddGroup("/admins", nil)
+	// the token's issuer spells the realm in lower case
+	token := keycloaktest.Token("initech", "alice")
+
+	tests := []struct {
+		name     string
+		enabled  bool
+		wantCode int
+	}{
+		{"normalization off", false, http.StatusBadRequest},
+		{"normalization on", true, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, _ := keycloaktest.NewService()
+			s.WithDependency("gocloak", kc.Client()).WithDependency("normalizeRealm", tt.enabled)
+			w := keycloaktest.Do(s, Group_get, keycloaktest.NewRequest(http.MethodGet, "/groupget?shortName=admins", token, nil))
+			if w.Code != tt.wantCode {
+				t.Errorf("Group_get() = %d %s, want %d", w.Code, w.Body, tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestGroupNormalize(t *testing.T) {
+	tests := []struct {
+		name          string
+		in            group
+		wantShortName string
+		wantLongName  string
+		wantAttrs     groupAttrs
+	}{
+		{"names trimmed", group{ShortName: "  admins ", LongName: "\tAdministrators\n"}, "admins", "Administrators", nil},
+		{"attribute keys trimmed", group{ShortName: "admins", LongName: "Admins", Attributes: groupAttrs{" dept ": "hr", "site": " pune "}},
+			"admins", "Admins", groupAttrs{"dept": "hr", "site": " pune "}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := tt.in
+			g.normalize()
+			if g.ShortName != tt.wantShortName || g.LongName != tt.wantLongName || !reflect.DeepEqual(g.Attributes, tt.wantAttrs) {
+				t.Errorf("normalize() = %q %q %v, want %q %q %v", g.ShortName, g.LongName, g.Attributes, tt.wantShortName, tt.wantLongName, tt.wantAttrs)
+			}
+		})
+	}
+}
+
+func TestGroupNewTrimsPaddedValues(t *testing.T) {
+	kc := keycloaktest.NewServer(t)
+	realm := kc.Realm("acme")
+	s, _ := keycloaktest.NewService()
+	s.WithDependency("gocloak", kc.Client())
+	token := keycloaktest.Token("acme", "alice")
+
+	create := map[string]any{"shortName": " finance ", "longName": " Finance Team ", "attr": map[string]string{" dept ": "fin"}}
+	w := keycloaktest.Do(s, Group_new, keycloaktest.NewRequest(http.MethodPost, "/groupnew", token, keycloaktest.Data(create)))
+	grp := realm.Group("/finance")
+	if w.Code != http.StatusOK || grp == nil {
+		t.Fatalf("Group_new() = %d %s, want the group created as /finance", w.Code, w.Body)
+	}
+	if !reflect.DeepEqual(grp.Attributes["idshield_longName"], []string{"Finance Team"}) || !reflect.DeepEqual(grp.Attributes["dept"], []string{"fin"}) {
+		t.Errorf("attributes = %v, want trimmed longName and dept", grp.Attributes)
+	}
+
+	update := map[string]any{"shortName": "finance ", "longName": "  Finance ", "attr": map[string]string{"dept ": "acc"}}
+	w = keycloaktest.Do(s, Group_update, keycloaktest.NewRequest(http.MethodPost, "/groupupdate", token, keycloaktest.Data(update)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Group_update() = %d %s, want 200", w.Code, w.Body)
+	}
+	grp = realm.Group("/finance")
+	if grp == nil || !reflect.DeepEqual(grp.Attributes["idshield_longName"], []string{"Finance"}) || !reflect.DeepEqual(grp.Attributes["dept"], []string{"acc"}) {
+		t.Errorf("group after update = %+v, want /finance with trimmed values", grp)
+	}
+
+	// a shortName of only spaces is missing once trimmed
+	create = map[string]any{"shortName": "   ", "longName": "Blank"}
+	w = keycloaktest.Do(s, Group_new, keycloaktest.NewRequest(http.MethodPost, "/groupnew", token, keycloaktest.Data(create)))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Group_new(blank shortName) = %d %s, want 400", w.Code, w.Body)
+	}
+}
+
+func TestGroupUniqueLongNames(t *testing.T) {
+	kc := keycloaktest.NewServer(t)
+	realm := kc.Realm("acme")
+	realm.AddGroup("/finance", map[string][]string{"longName": {"Finance Team"}})
+	realm.AddGroup("/sales", map[string][]string{"longName": {"Sales"}})
+	s, _ := keycloaktest.NewService()
+	s.WithDependency("gocloak", kc.Client()).WithDependency("uniqueLongNames", true)
+	token := keycloaktest.Token("acme", "alice")
+	duplicate := map[string]any{"shortName": "fin", "longName": "Finance Team", "attr": map[string]string{"dept": "fin"}}
+
+	for name, handler := range map[string]service.HandlerFunc{"Group_new": Group_new, "Group_newWithRoles": Group_newWithRoles} {
+		w := keycloaktest.Do(s, handler, keycloaktest.NewRequest(http.MethodPost, "/groupnew", token, keycloaktest.Data(duplicate)))
+		if resp := keycloaktest.Decode(t, w, nil); w.Code != http.StatusBadRequest || !reflect.DeepEqual(resp.ErrCodes(), []string{utils.ErrLongNameNotUnique}) {
+			t.Errorf("%s(duplicate longName) = %d %s, want 400 %s", name, w.Code, w.Body, utils.ErrLongNameNotUnique)
+		}
+	}
+	if realm.Group("/fin") != nil {
+		t.Error("group with a duplicate longName was created")
+	}
+
+	// a group keeps its own longName on update, but can't take another group's
+	update := map[string]any{"shortName": "finance", "longName": "Finance Team", "attr": map[string]string{"dept": "acc"}}
+	w := keycloaktest.Do(s, Group_update, keycloaktest.NewRequest(http.MethodPost, "/groupupdate", token, keycloaktest.Data(update)))
+	if w.Code != http.StatusOK {
+		t.Errorf("Group_update(own longName) = %d %s, want 200", w.Code, w.Body)
+	}
+	update = map[string]any{"shortName": "sales", "longName": "Finance Team", "attr": map[string]string{"dept": "sales"}}
+	w = keycloaktest.Do(s, Group_update, keycloaktest.NewRequest(http.MethodPost, "/groupupdate", token, keycloaktest.Data(update)))
+	if resp := keycloaktest.Decode(t, w, nil); w.Code != http.StatusBadRequest || !reflect.DeepEqual(resp.ErrCodes(), []string{utils.ErrLongNameNotUnique}) {
+		t.Errorf("Group_update(taken longName) = %d %s, want 400 %s", w.Code, w.Body, utils.ErrLongNameNotUnique)
+	}
+
+	// without the setting duplicates are allowed
+	s.WithDependency("uniqueLongNames", false)
+	w = keycloaktest.Do(s, Group_new, keycloaktest.NewRequest(http.MethodPost, "/groupnew", token, keycloaktest.Data(duplicate)))
+	if w.Code != http.StatusOK || realm.Group("/fin") == nil {
+		t.Errorf("Group_new(duplicate longName, not strict) = %d %s, want the group created", w.Code, w.Body)
+	}
+}
+
+func TestGroupNewContentType(t *testing.T) {
+	kc := keycloaktest.NewServer(t)
+	realm := kc.Realm("acme")
+	s, _ := keycloaktest.NewService()
+	s.WithDependency("gocloak", kc.Client())
+
+	tests := []struct {
+		shortName   string
+		contentType string
+		wantErr     string
+	}{
+		{"finance", "application/json; charset=utf-8", ""},
+		{"sales", "application/x-www-form-urlencoded", utils.ErrUnsupportedMediaType},
+		{"hr", "text/plain", utils.ErrUnsupportedMediaType},
+		{"legal", "", utils.ErrUnsupportedMediaType},
+	}
+	for _, tt := range tests {
+		t.Run(tt.contentType, func(t *testing.T) {
+			body := map[string]any{"shortName": tt.shortName, "longName": tt.shortName, "attr": map[string]string{"dept": tt.shortName}}
+			req := keycloaktest.NewRequest(http.MethodPost, "/groupnew", keycloaktest.Token("acme", "alice"), keycloaktest.Data(body))
+			req.Header.Set("Content-Type", tt.contentType)
+			w := keycloaktest.Do(s, Group_new, req)
+			if tt.wantErr == "" {
+				if w.Code != http.StatusOK || realm.Group("/"+tt.shortName) == nil {
+					t.Errorf("Group_new() = %d %s, want the group created", w.Code, w.Body)
+				}
+				return
+			}
+			resp := keycloaktest.Decode(t, w, nil)
+			if w.Code != http.StatusBadRequest || !reflect.DeepEqual(resp.ErrCodes(), []string{tt.wantErr}) || realm.Group("/"+tt.shortName) != nil {
+				t.Errorf("Group_new() = %d %s, want 400 %s and no group", w.Code, w.Body, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestGroupNewAuthorization(t *testing.T) {
+	tests := []struct {
+		name     string
+		user     string
+		wantCode int
+		wantErr  []string
+	}{
+		{"allowed", "alice", http.StatusOK, []string{}},
+		{"denied", "bob", http.StatusBadRequest, []string{utils.ErrUnauthorized}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			authz := utils.NewFakeAuthorizer().Allow("alice", utils.CapGroupCreate).Allow("bob", utils.CapGroupRead)
+			prev := utils.SetAuthorizer(authz)
+			t.Cleanup(func() { utils.SetAuthorizer(prev) })
+			kc := keycloaktest.NewServer(t)
+			realm := kc.Realm("acme")
+			s, _ := keycloaktest.NewService()
+			s.WithDependency("gocloak", kc.Client())
+			body := map[string]any{"shortName": "admins", "longName": "Admins", "attr": map[string]string{"dept": "hr"}}
+
+			w := keycloaktest.Do(s, Group_new, keycloaktest.NewRequest(http.MethodPost, "/groupnew", keycloaktest.Token("acme", tt.user), keycloaktest.Data(body)))
+			resp := keycloaktest.Decode(t, w, nil)
+			if w.Code != tt.wantCode || !reflect.DeepEqual(resp.ErrCodes(), tt.wantErr) {
+				t.Fatalf("Group_new() as %s = %d %s, want %d %v", tt.user, w.Code, w.Body, tt.wantCode, tt.wantErr)
+			}
+			if created := realm.Group("/admins") != nil; created != (tt.wantCode == http.StatusOK) {
+				t.Errorf("group created = %v, want %v", created, !created)
+			}
+		})
+	}
+}
+
+func TestGroupGetLogsRealm(t *testing.T) {
+	tests := []struct {
+		name     string
+		query    string
+		wantCode int
+		wantLast string
+	}{
+		{"success", "shortName=admins", http.StatusOK, "Group found"},
+		{"error", "shortName=missing", http.StatusBadRequest, "group not found"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kc := keycloaktest.NewServer(t)
+			kc.Realm("acme").AddGroup("/admins", nil)
+			s, logs := keycloaktest.NewService()
+			s.WithDependency("gocloak", kc.Client())
+
+			w := keycloaktest.Do(s, Group_get, keycloaktest.NewRequest(http.MethodGet, "/groupget?"+tt.query, keycloaktest.Token("acme", "alice"), nil))
+			if w.Code != tt.wantCode {
+				t.Fatalf("Group_get() = %d %s, want %d", w.Code, w.Body, tt.wantCode)
+			}
+			// every entry names the handler, and once the realm is parsed every entry carries it too. Log puts the text
+			// of an entry in its data
+			realmKnown := false
+			var last logharbour.LogEntry
+			for _, line := range strings.Split(strings.TrimSpace(logs.String()), "\n") {
+				var entry logharbour.LogEntry
+				if err := json.Unmarshal([]byte(line), &entry); err != nil {
+					t.Fatalf("log entry %q: %v", line, err)
+				}
+				if entry.Op != "Group_get" {
+					t.Errorf("entry %q has op %q, want Group_get", entry.Data, entry.Op)
+				}
+				if entry.WhatInstanceId == "acme" {
+					realmKnown = true
+				}
+				if realmKnown && (entry.WhatClass != "realm" || entry.WhatInstanceId != "acme") {
+					t.Errorf("entry %q has realm %s=%q, want realm=acme", entry.Data, entry.WhatClass, entry.WhatInstanceId)
+				}
+				last = entry
+			}
+			if !strings.HasPrefix(fmt.Sprint(last.Data), tt.wantLast) || last.WhatInstanceId != "acme" {
+				t.Errorf("last entry = %q in realm %q, want %q in acme", last.Data, last.WhatInstanceId, tt.wantLast)
+			}
+		})
+	}
+}
+
+func TestGroupNewIfNotExists(t *testing.T) {
+	kc := keycloaktest.NewServer(t)
+	realm := kc.Realm("acme")
+	s, _ := keycloaktest.NewService()
+	s.WithDependency("gocloak", kc.Client())
+	token := keycloaktest.Token("acme", "alice")
+	body := map[string]any{"shortName": "admins", "longName": "Admins", "attr": map[string]string{"dept": "hr"}}
+
+	w := keycloaktest.Do(s, Group_new, keycloaktest.NewRequest(http.MethodPost, "/groupnew?ifNotExists=true", token, keycloaktest.Data(body)))
+	var created utils.MutationResult
+	if resp := keycloaktest.Decode(t, w, &created); w.Code != http.StatusOK || resp.Status != wscutils.SuccessStatus {
+		t.Fatalf("first Group_new() = %d %s, want the group created", w.Code, w.Body)
+	}
+	if created.Result != realm.Group("/admins").ID {
+		t.Fatalf("first Group_new() id = %v, want %s", created.Result, realm.Group("/admins").ID)
+	}
+
+	createsBefore := kc.CallCount("POST /admin/realms/acme/groups")
+	w = keycloaktest.Do(s, Group_new, keycloaktest.NewRequest(http.MethodPost, "/groupnew?ifNotExists=true", token, keycloaktest.Data(body)))
+	var id string
+	resp := keycloaktest.Decode(t, w, &id)
+	if w.Code != http.StatusOK || resp.Status != statusAlreadyExists || len(resp.ErrCodes()) != 0 {
+		t.Fatalf("second Group_new() = %d %s, want 200 %s", w.Code, w.Body, statusAlreadyExists)
+	}
+	if id != realm.Group("/admins").ID {
+		t.Errorf("second Group_new() id = %q, want the existing %q", id, realm.Group("/admins").ID)
+	}
+	if n := kc.CallCount("POST /admin/realms/acme/groups"); n != createsBefore {
+		t.Errorf("second Group_new() made %d create calls, want none", n-createsBefore)
+	}
+}
+
+func TestGroupNotFound(t *testing.T) {
+	tests := []struct {
+		name       string
+		handler    service.HandlerFunc
+		method     string
+		target     string
+		body       any
+		wantLegacy string
+	}{
+		{"get", Group_get, http.MethodGet, "/groupget?shortName=missing", nil, utils.ErrGroupNotFoundCode},
+		{"detail", Group_detail, http.MethodGet, "/groupdetail?shortName=missing", nil, utils.ErrNotExist},
+		{"update", Group_update, http.MethodPost, "/groupupdate", map[string]any{"shortName": "missing", "longName": "Missing", "attr": map[string]string{"dept": "hr"}}, utils.ErrNotExist},
+		{"delete", Group_delete, http.MethodDelete, "/groupdelete?shortName=missing", nil, utils.ErrNotExist},
+		{"members", Group_members, http.MethodGet, "/groupmembers?shortName=missing", nil, utils.ErrNotExist},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kc := keycloaktest.NewServer(t)
+			kc.Realm("acme").AddGroup("/admins", nil)
+			s, _ := keycloaktest.NewService()
+			s.WithDependency("gocloak", kc.Client())
+			var body map[string]any
+			if tt.body != nil {
+				body = keycloaktest.Data(tt.body)
+			}
+
+			w := keycloaktest.Do(s, tt.handler, keycloaktest.NewRequest(tt.method, tt.target, keycloaktest.Token("acme", "alice"), body))
+			var detail utils.NotFoundDetail
+			resp := keycloaktest.Decode(t, w, &detail)
+			if want := []string{utils.ErrResourceNotFound, tt.wantLegacy}; w.Code != http.StatusBadRequest || !reflect.DeepEqual(resp.ErrCodes(), want) {
+				t.Fatalf("%s = %d %v, want 400 %v", tt.target, w.Code, resp.ErrCodes(), want)
+			}
+			if want := (utils.NotFoundDetail{ResourceType: utils.ResourceGroup, Identifier: "missing"}); detail != want {
+				t.Errorf("%s data = %+v, want %+v", tt.target, detail, want)
+			}
+			if vals := resp.Messages[0].Vals; !reflect.DeepEqual(vals, []string{utils.ResourceGroup, "missing"}) {
+				t.Errorf("%s resource_not_found vals = %v, want [group missing]", tt.target, vals)
+			}
+		})
+	}
+}
+
+func TestGroupAttrKeyCollision(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler service.HandlerFunc
+		target  string
+	}{
+		{"new", Group_new, "/groupnew"},
+		{"update", Group_update, "/groupupdate"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kc := keycloaktest.NewServer(t)
+			realm := kc.Realm("acme")
+			if tt.name == "update" {
+				realm.AddGroup("/finance", map[string][]string{"idshield_longName": {"Finance"}, "dept": {"fin"}})
+			}
+			s, _ := keycloaktest.NewService()
+			s.WithDependency("gocloak", kc.Client())
+			body := map[string]any{"shortName": "finance", "longName": "Finance", "attr": map[string]string{"Dept": "a", "dept ": "b", "site": "pune"}}
+
+			w := keycloaktest.Do(s, tt.handler, keycloaktest.NewRequest(http.MethodPost, tt.target, keycloaktest.Token("acme", "alice"), keycloaktest.Data(body)))
+			resp := keycloaktest.Decode(t, w, nil)
+			if w.Code != http.StatusBadRequest || !reflect.DeepEqual(resp.ErrCodes(), []string{utils.ErrDuplicateAttrKey}) {
+				t.Fatalf("%s = %d %s, want 400 %s", tt.target, w.Code, w.Body, utils.ErrDuplicateAttrKey)
+			}
+			if vals := resp.Messages[0].Vals; !reflect.DeepEqual(vals, []string{"Dept", "dept "}) {
+				t.Errorf("%s conflicting keys = %q, want [Dept dept ]", tt.target, vals)
+			}
+			if grp := realm.Group("/finance"); tt.name == "new" && grp != nil {
+				t.Errorf("Group_new() created the group despite the collision")
+			} else if tt.name == "update" && !reflect.DeepEqual(grp.Attributes["dept"], []string{"fin"}) {
+				t.Errorf("Group_update() changed dept to %v despite the collision", grp.Attributes["dept"])
+			}
+		})
+	}
+}
@@ -0,0 +1,177 @@
+package groupsvc
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/Nerzal/gocloak/v13"
+	"github.com/gin-gonic/gin"
+	"github.com/remiges-tech/alya/router"
+	"github.com/remiges-tech/alya/service"
+	"github.com/remiges-tech/alya/wscutils"
+	"github.com/remiges-tech/idshield/types"
+	"github.com/remiges-tech/idshield/utils"
+	"github.com/remiges-tech/logharbour/logharbour"
+)
+
+type groupTransferRequest struct {
+	Source           string `json:"source" validate:"required"`
+	Target           string `json:"target" validate:"required"`
+	RemoveFromSource bool   `json:"removeFromSource"`
+}
+
+type transferFailure struct {
+	UserID   string `json:"userId"`
+	Username string `json:"username,omitempty"`
+	Error    string `json:"error"`
+}
+
+type groupTransferResponse struct {
+	Total         int               `json:"total"`
+	Transferred   int               `json:"transferred"`
+	AlreadyMember int               `json:"alreadyMember"`
+	Removed       int               `json:"removed"`
+	Failures      []transferFailure `json:"failures"`
+}
+
+// Group_transferMembers handles the POST /grouptransfermembers request, it adds every member of the source group
+// to the target group and, with removeFromSource set, removes them from the source. Members are processed on a
+// best-effort basis and the failures are reported per user
+func Group_transferMembers(c *gin.Context, s *service.Service) {
+	l := utils.RequestLogger(c, s, "Group_transferMembers")
+	l.Log("Starting execution of Group_transferMembers()")
+	token, err := router.ExtractToken(c.GetHeader("Authorization"))
+	if err != nil {
+		l.Debug0().LogDebug("Missing or incorrect Authorization header format:", logharbour.DebugInfo{Variables: map[string]any{"error": err}})
+		wscutils.SendErrorResponse(c, wscutils.NewErrorResponse(utils.ErrTokenMissing))
+		return
+	}
+	r, err := utils.ExtractClaimFromJwt(token, "iss")
+	if err != nil {
+		l.Debug0().LogDebug("Missing or incorrect realm:", logharbour.DebugInfo{Variables: map[string]any{"error": err}})
+		wscutils.SendErrorResponse(c, wscutils.NewErrorResponse(utils.ErrRealmNotFound))
+		return
+	}
+	parts := strings.Split(r, "/realms/")
+	if len(parts) != 2 {
+		l.Debug0().LogDebug("Missing or incorrect realm:", logharbour.DebugInfo{Variables: map[string]any{"iss": r}})
+		wscutils.SendErrorResponse(c, wscutils.NewErrorResponse(utils.ErrRealmNotFound))
+		return
+	}
+	realm := utils.CanonicalRealm(c, s, token, parts[1])
+	l = utils.WithRealm(l, realm)
+	username, err := utils.ExtractClaimFromJwt(token, "preferred_username")
+	if err != nil {
+		l.Debug0().LogDebug("Missing username:", logharbour.DebugInfo{Variables: map[string]any{"error": err}})
+		wscutils.SendErrorResponse(c, wscutils.NewErrorResponse(utils.ErrUserNotFound))
+		return
+	}
+
+	var req groupTransferRequest
+	if !utils.RequireJSON(c) {
+		l.Log("Unsupported content type")
+		return
+	}
+	if err = wscutils.BindJSON(c, &req); err != nil {
+		l.LogActivity("Error Unmarshalling JSON to struct:", logharbour.DebugInfo{Variables: map[string]any{"Error": err.Error()}})
+		return
+	}
+
+	// removing members from the source needs the extra capability
+	capNeeded := []string{utils.CapGroupMemberAdd}
+	if req.RemoveFromSource {
+		capNeeded = append(capNeeded, utils.CapGroupMemberRemove)
+	}
+	isCapable, _ := utils.Authz_check(types.OpReq{
+		User:      username,
+		CapNeeded: capNeeded,
+	}, false)
+
+	if !isCapable {
+		l.Log("Unauthorized user:")
+		wscutils.SendErrorResponse(c, wscutils.NewErrorResponse(utils.ErrUnauthorized))
+		return
+	}
+
+	if req.Source == "" || req.Target == "" {
+		l.Log("source or target missing")
+		wscutils.SendErrorResponse(c, wscutils.NewResponse(wscutils.ErrorStatus, nil, []wscutils.ErrorMessage{wscutils.BuildErrorMessage(wscutils.ErrcodeMissing, nil, "source", "target")}))
+		return
+	}
+	if req.Source == req.Target {
+		l.Log("source and target are the same group")
+		str := "target"
+		wscutils.SendErrorResponse(c, wscutils.NewResponse(wscutils.ErrorStatus, nil, []wscutils.ErrorMessage{wscutils.BuildErrorMessage(utils.ErrInvalidParam, &str, req.Target)}))
+		return
+	}
+
+	// Extracting the GoCloak client from the service dependencies
+	gcClient, ok := s.Dependencies["gocloak"].(*gocloak.GoCloak)
+	if !ok {
+		l.Log("Failed to load the dependency to *gocloak.GoCloak")
+		wscutils.SendErrorResponse(c, wscutils.NewErrorResponse(utils.ErrFailedToLoadDependence))
+		return
+	}
+
+	groupIDs := make(map[string]string)
+	for field, shortName := range map[string]string{"source": req.Source, "target": req.Target} {
+		grp, err := utils.GetGroupByExactName(c, gcClient, token, realm, shortName)
+		if errors.Is(err, utils.ErrGroupNotFound) {
+			l.Log("Error while gcClient.GetGroups Group doesn't exist ")
+			str := field
+			wscutils.SendErrorResponse(c, utils.NotFound(utils.ResourceGroup, shortName, wscutils.BuildErrorMessage(utils.ErrNotExist, &str)))
+			return
+		}
+		if err != nil {
+			utils.GocloakErrorHandler(c, l, err)
+			return
+		}
+		groupIDs[field] = *grp.ID
+	}
+
+	// collect every source member up front, removing members while paging would shift the pages
+	var members []*gocloak.User
+	for page := 0; ; page += keycloakPageSize {
+		batch, err := gcClient.GetGroupMembers(c, token, realm, groupIDs["source"], gocloak.GetGroupsParams{
+			First:               gocloak.IntP(page),
+			Max:                 gocloak.IntP(keycloakPageSize),
+			BriefRepresentation: gocloak.BoolP(true),
+		})
+		if err != nil {
+			utils.GocloakErrorHandler(c, l, err)
+			return
+		}
+		members = append(members, batch...)
+		if len(batch) < keycloakPageSize {
+			break
+		}
+	}
+
+	resp := groupTransferResponse{Total: len(members), Failures: []transferFailure{}}
+	for _, member := range members {
+		userID := gocloak.PString(member.ID)
+		added, err := utils.AddUserToGroupIfAbsent(c, gcClient, token, realm, userID, groupIDs["target"])
+		if err != nil {
+			resp.Failures = append(resp.Failures, transferFailure{UserID: userID, Username: gocloak.PString(member.Username), Error: err.Error()})
+			continue
+		}
+		if added {
+			resp.Transferred++
+		} else {
+			resp.AlreadyMember++
+		}
+		if !req.RemoveFromSource {
+			continue
+		}
+		if err := gcClient.DeleteUserFromGroup(c, token, realm, userID, groupIDs["source"]); err != nil {
+			resp.Failures = append(resp.Failures, transferFailure{UserID: userID, Username: gocloak.PString(member.Username), Error: err.Error()})
+			continue
+		}
+		resp.Removed++
+	}
+	l.LogActivity("Group members transferred:", map[string]any{"source": req.Source, "target": req.Target, "transferred": resp.Transferred, "alreadyMember": resp.AlreadyMember, "removed": resp.Removed, "failed": len(resp.Failures)})
+
+	utils.SendSuccess(c, opGroupTransferMembers, utils.NewMutationResponse(resp, username))
+
+	l.Log("Finished execution of Group_transferMembers()")
+}
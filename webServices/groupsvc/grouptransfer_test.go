@@ -0,0 +1,95 @@
+package groupsvc
+
+import (
+	"net/http"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/remiges-tech/idshield/internal/keycloaktest"
+	"github.com/remiges-tech/idshield/utils"
+)
+
+// memberNames returns the sorted usernames of the members of g
+func memberNames(g *keycloaktest.Group) []string {
+	names := []string{}
+	for _, member := range g.Members {
+		names = append(names, member.Username)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestGroupTransferMembers(t *testing.T) {
+	tests := []struct {
+		name             string
+		removeFromSource bool
+		wantSource       []string
+		wantRemoved      int
+	}{
+		{"copy", false, []string{"alice", "bob", "carol"}, 0},
+		{"move", true, []string{}, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kc := keycloaktest.NewServer(t)
+			realm := kc.Realm("acme")
+			carol := realm.AddUser("carol", true)
+			source := realm.AddGroup("/sales", nil).AddMembers(realm.AddUser("alice", true), realm.AddUser("bob", true), carol)
+			// carol is already in the target and is counted apart from the members actually transferred
+			target := realm.AddGroup("/marketing", nil).AddMembers(carol)
+			s, _ := keycloaktest.NewService()
+			s.WithDependency("gocloak", kc.Client())
+			body := groupTransferRequest{Source: "sales", Target: "marketing", RemoveFromSource: tt.removeFromSource}
+
+			w := keycloaktest.Do(s, Group_transferMembers, keycloaktest.NewRequest(http.MethodPost, "/grouptransfermembers", keycloaktest.Token("acme", "alice"), keycloaktest.Data(body)))
+			var data groupTransferResponse
+			keycloaktest.Decode(t, w, &utils.MutationResult{Result: &data})
+			want := groupTransferResponse{Total: 3, Transferred: 2, AlreadyMember: 1, Removed: tt.wantRemoved, Failures: []transferFailure{}}
+			if w.Code != http.StatusOK || !reflect.DeepEqual(data, want) {
+				t.Errorf("Group_transferMembers() = %d %+v, want %+v", w.Code, data, want)
+			}
+			if got := memberNames(target); !reflect.DeepEqual(got, []string{"alice", "bob", "carol"}) {
+				t.Errorf("target members = %v, want all three", got)
+			}
+			if got := memberNames(source); !reflect.DeepEqual(got, tt.wantSource) {
+				t.Errorf("source members = %v, want %v", got, tt.wantSource)
+			}
+		})
+	}
+}
+
+func TestGroupTransferMembersFailure(t *testing.T) {
+	kc := keycloaktest.NewServer(t)
+	realm := kc.Realm("acme")
+	bob := realm.AddUser("bob", true)
+	source := realm.AddGroup("/sales", nil).AddMembers(realm.AddUser("alice", true), bob)
+	target := realm.AddGroup("/marketing", nil)
+	kc.Handle(http.MethodPut, "/admin/realms/acme/users/"+bob.ID+"/groups/"+target.ID, func(w http.ResponseWriter, r *http.Request) {
+		keycloaktest.Error(w, http.StatusInternalServerError, "unknown_error")
+	})
+	s, _ := keycloaktest.NewService()
+	s.WithDependency("gocloak", kc.Client())
+	body := groupTransferRequest{Source: "sales", Target: "marketing", RemoveFromSource: true}
+
+	w := keycloaktest.Do(s, Group_transferMembers, keycloaktest.NewRequest(http.MethodPost, "/grouptransfermembers", keycloaktest.Token("acme", "alice"), keycloaktest.Data(body)))
+	var data groupTransferResponse
+	keycloaktest.Decode(t, w, &utils.MutationResult{Result: &data})
+	if w.Code != http.StatusOK || data.Transferred != 1 || data.Removed != 1 || len(data.Failures) != 1 || data.Failures[0].Username != "bob" {
+		t.Errorf("Group_transferMembers() = %d %+v, want bob reported as failed", w.Code, data)
+	}
+	// a member that couldn't be added to the target stays in the source
+	if got := memberNames(source); !reflect.DeepEqual(got, []string{"bob"}) {
+		t.Errorf("source members = %v, want [bob]", got)
+	}
+}
+
+func TestGroupTransferMembersSameGroup(t *testing.T) {
+	s, _ := keycloaktest.NewService()
+	body := groupTransferRequest{Source: "sales", Target: "sales"}
+
+	w := keycloaktest.Do(s, Group_transferMembers, keycloaktest.NewRequest(http.MethodPost, "/grouptransfermembers", keycloaktest.Token("acme", "alice"), keycloaktest.Data(body)))
+	if resp := keycloaktest.Decode(t, w, nil); w.Code != http.StatusBadRequest || !reflect.DeepEqual(resp.ErrCodes(), []string{utils.ErrInvalidParam}) {
+		t.Errorf("Group_transferMembers() = %d %s, want 400 %s", w.Code, w.Body, utils.ErrInvalidParam)
+	}
+}
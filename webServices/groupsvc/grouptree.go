@@ -0,0 +1,275 @@
+package groupsvc
+
+import (
+	"strings"
+
+	"github.com/Nerzal/gocloak/v13"
+	"github.com/gin-gonic/gin"
+	"github.com/remiges-tech/alya/router"
+	"github.com/remiges-tech/alya/service"
+	"github.com/remiges-tech/alya/wscutils"
+	"github.com/remiges-tech/idshield/types"
+	"github.com/remiges-tech/idshield/utils"
+	"github.com/remiges-tech/logharbour/logharbour"
+)
+
+// maxTreeDepth guards the recursive subgroup expansion against runaway recursion
+const maxTreeDepth = 10
+
+type groupTreeNode struct {
+	ID       *string         `json:"id,omitempty"`
+	Name     *string         `json:"name,omitempty"`
+	Path     *string         `json:"path,omitempty"`
+	Children []groupTreeNode `json:"children"`
+}
+
+// Group_tree handles the GET /grouptree request, it returns the whole group hierarchy of the realm
+func Group_tree(c *gin.Context, s *service.Service) {
+	l := utils.RequestLogger(c, s, "Group_tree")
+	l.Log("Starting execution of Group_tree()")
+	token, err := router.ExtractToken(c.GetHeader("Authorization"))
+	if err != nil {
+		l.Debug0().LogDebug("Missing or incorrect Authorization header format:", logharbour.DebugInfo{Variables: map[string]any{"error": err}})
+		wscutils.SendErrorResponse(c, wscutils.NewErrorResponse(utils.ErrTokenMissing))
+		return
+	}
+	r, err := utils.ExtractClaimFromJwt(token, "iss")
+	if err != nil {
+		l.Debug0().LogDebug("Missing or incorrect realm:", logharbour.DebugInfo{Variables: map[string]any{"error": err}})
+		wscutils.SendErrorResponse(c, wscutils.NewErrorResponse(utils.ErrRealmNotFound))
+		return
+	}
+	parts := strings.Split(r, "/realms/")
+	if len(parts) != 2 {
+		l.Debug0().LogDebug("Missing or incorrect realm:", logharbour.DebugInfo{Variables: map[string]any{"iss": r}})
+		wscutils.SendErrorResponse(c, wscutils.NewErrorResponse(utils.ErrRealmNotFound))
+		return
+	}
+	realm := utils.CanonicalRealm(c, s, token, parts[1])
+	l = utils.WithRealm(l, realm)
+	username, err := utils.ExtractClaimFromJwt(token, "preferred_username")
+	if err != nil {
+		l.Debug0().LogDebug("Missing username:", logharbour.DebugInfo{Variables: map[string]any{"error": err}})
+		wscutils.SendErrorResponse(c, wscutils.NewErrorResponse(utils.ErrUserNotFound))
+		return
+	}
+
+	isCapable, _ := utils.Authz_check(types.OpReq{
+		User:      username,
+		CapNeeded: []string{utils.CapGroupRead},
+	}, false)
+
+	if !isCapable {
+		l.Log("Unauthorized user:")
+		wscutils.SendErrorResponse(c, wscutils.NewErrorResponse(utils.ErrUnauthorized))
+		return
+	}
+
+	// Extracting the GoCloak client from the service dependencies
+	gcClient, ok := s.Dependencies["gocloak"].(*gocloak.GoCloak)
+	if !ok {
+		l.Log("Failed to load the dependency to *gocloak.GoCloak")
+		wscutils.SendErrorResponse(c, wscutils.NewErrorResponse(utils.ErrFailedToLoadDependence))
+		return
+	}
+
+	groups, err := gcClient.GetGroups(c, token, realm, gocloak.GetGroupsParams{})
+	if err != nil {
+		utils.GocloakErrorHandler(c, l, err)
+		return
+	}
+
+	tree := []groupTreeNode{}
+	for _, grp := range groups {
+		node, err := buildTreeNode(c, gcClient, token, realm, *grp, 1)
+		if err != nil {
+			utils.GocloakErrorHandler(c, l, err)
+			return
+		}
+		tree = append(tree, node)
+	}
+
+	utils.SendSuccess(c, opGroupTree, wscutils.NewSuccessResponse(tree))
+
+	l.Log("Finished execution of Group_tree()")
+}
+
+// buildTreeNode expands the subgroups of grp recursively, stopping once maxTreeDepth is reached.
+// Subgroups already embedded by GetGroups are used as is, otherwise they are fetched through GetGroup.
+func buildTreeNode(c *gin.Context, gcClient *gocloak.GoCloak, token, realm string, grp gocloak.Group, depth int) (groupTreeNode, error) {
+	node := groupTreeNode{
+		ID:       grp.ID,
+		Name:     grp.Name,
+		Path:     grp.Path,
+		Children: []groupTreeNode{},
+	}
+	if depth >= maxTreeDepth {
+		return node, nil
+	}
+	subGroups := grp.SubGroups
+	if subGroups == nil {
+		full, err := gcClient.GetGroup(c, token, realm, *grp.ID)
+		if err != nil {
+			return node, err
+		}
+		subGroups = full.SubGroups
+	}
+	if subGroups == nil {
+		return node, nil
+	}
+	for _, sub := range *subGroups {
+		child, err := buildTreeNode(c, gcClient, token, realm, sub, depth+1)
+		if err != nil {
+			return node, err
+		}
+		node.Children = append(node.Children, child)
+	}
+	return node, nil
+}
+
+type ancestorResponse struct {
+	ID   *string `json:"id,omitempty"`
+	Name *string `json:"name,omitempty"`
+	Path *string `json:"path,omitempty"`
+}
+
+// Group_ancestry handles the GET /groupancestry request, it returns the chain of groups from the root down to
+// the group given by path or id, the group itself being last
+func Group_ancestry(c *gin.Context, s *service.Service) {
+	utils.Handler("Group_ancestry", []string{utils.CapGroupRead}, groupAncestry)(c, s)
+}
+
+// groupAncestry is the business logic of Group_ancestry, utils.Handler has done the token, realm and authz checks
+func groupAncestry(ctx utils.HandlerContext) {
+	c, l := ctx.Gin, ctx.Logger
+
+	path, id := c.Query("path"), c.Query("id")
+	if errCode := validateLookup("", id, path); errCode != "" {
+		l.Log(errCode)
+		wscutils.SendErrorResponse(c, wscutils.NewResponse(wscutils.ErrorStatus, nil, []wscutils.ErrorMessage{wscutils.BuildErrorMessage(errCode, nil, "id", "path")}))
+		return
+	}
+	if id != "" {
+		grp, err := ctx.Client.GetGroup(c, ctx.Token, ctx.Realm, id)
+		if err != nil {
+			utils.GocloakErrorHandler(c, l, err)
+			return
+		}
+		path = gocloak.PString(grp.Path)
+	}
+
+	// every prefix of the path is an ancestor, resolved root first
+	segments := strings.Split(strings.Trim(normalizeGroupPath(path), "/"), "/")
+	chain := []ancestorResponse{}
+	for i := range segments {
+		grp, err := ctx.Client.GetGroupByPath(c, ctx.Token, ctx.Realm, escapeGroupPath("/"+strings.Join(segments[:i+1], "/")))
+		if err != nil {
+			utils.GocloakErrorHandler(c, l, err)
+			return
+		}
+		chain = append(chain, ancestorResponse{ID: grp.ID, Name: grp.Name, Path: grp.Path})
+	}
+
+	utils.SendSuccess(c, opGroupAncestry, wscutils.NewSuccessResponse(map[string]any{"ancestry": chain}))
+}
+
+// Group_childCount handles the GET /groupchildcount request, it returns the number of immediate subgroups of
+// the group given by path or id, so a tree UI can tell whether a node is expandable without loading its children
+func Group_childCount(c *gin.Context, s *service.Service) {
+	utils.Handler("Group_childCount", []string{utils.CapGroupRead}, groupChildCount)(c, s)
+}
+
+// groupChildCount is the business logic of Group_childCount, utils.Handler has done the token, realm and authz checks
+func groupChildCount(ctx utils.HandlerContext) {
+	c, l := ctx.Gin, ctx.Logger
+
+	path, id := c.Query("path"), c.Query("id")
+	if errCode := validateLookup("", id, path); errCode != "" {
+		l.Log(errCode)
+		wscutils.SendErrorResponse(c, wscutils.NewResponse(wscutils.ErrorStatus, nil, []wscutils.ErrorMessage{wscutils.BuildErrorMessage(errCode, nil, "id", "path")}))
+		return
+	}
+
+	var grp *gocloak.Group
+	var err error
+	if id != "" {
+		grp, err = ctx.Client.GetGroup(c, ctx.Token, ctx.Realm, id)
+	} else {
+		grp, err = ctx.Client.GetGroupByPath(c, ctx.Token, ctx.Realm, escapeGroupPath(normalizeGroupPath(path)))
+	}
+	if err != nil {
+		utils.GocloakErrorHandler(c, l, err)
+		return
+	}
+
+	// the single-group fetch embeds only the immediate subgroups, their own children are not counted
+	count := 0
+	if grp.SubGroups != nil {
+		count = len(*grp.SubGroups)
+	}
+
+	utils.SendSuccess(c, opGroupChildCount, wscutils.NewSuccessResponse(map[string]any{"id": grp.ID, "childCount": count}))
+}
+
+// Group_deleteTree handles the DELETE /groupdeletetree request for the group given by path or id. Without
+// confirm=true it is a dry run that only returns the subtree Keycloak would delete along with the group, with
+// it the group is deleted, which cascades to every subgroup, and each removed node is logged. Like Group_tree
+// the listing stops at maxTreeDepth, deeper subgroups are still deleted by the cascade
+func Group_deleteTree(c *gin.Context, s *service.Service) {
+	utils.Handler("Group_deleteTree", []string{utils.CapGroupDelete}, groupDeleteTree)(c, s)
+}
+
+// groupDeleteTree is the business logic of Group_deleteTree, utils.Handler has done the token, realm and authz checks
+func groupDeleteTree(ctx utils.HandlerContext) {
+	c, l := ctx.Gin, ctx.Logger
+
+	path, id := c.Query("path"), c.Query("id")
+	if errCode := validateLookup("", id, path); errCode != "" {
+		l.Log(errCode)
+		wscutils.SendErrorResponse(c, wscutils.NewResponse(wscutils.ErrorStatus, nil, []wscutils.ErrorMessage{wscutils.BuildErrorMessage(errCode, nil, "id", "path")}))
+		return
+	}
+
+	var grp *gocloak.Group
+	var err error
+	if id != "" {
+		grp, err = ctx.Client.GetGroup(c, ctx.Token, ctx.Realm, id)
+	} else {
+		grp, err = ctx.Client.GetGroupByPath(c, ctx.Token, ctx.Realm, escapeGroupPath(normalizeGroupPath(path)))
+	}
+	if err != nil {
+		utils.GocloakErrorHandler(c, l, err)
+		return
+	}
+	if !checkSubtreeNotProtected(c, ctx.Service, l, ctx.Client, ctx.Token, ctx.Realm, *grp.ID) {
+		return
+	}
+	tree, err := buildTreeNode(c, ctx.Client, ctx.Token, ctx.Realm, *grp, 1)
+	if err != nil {
+		utils.GocloakErrorHandler(c, l, err)
+		return
+	}
+
+	if c.Query("confirm") != "true" {
+		utils.SendSuccess(c, opGroupDeleteTree, wscutils.NewSuccessResponse(map[string]any{"dryRun": true, "tree": tree}))
+		return
+	}
+
+	if err = ctx.Client.DeleteGroup(c, ctx.Token, ctx.Realm, *grp.ID); err != nil {
+		l.LogActivity("Error while deleting group tree:", logharbour.DebugInfo{Variables: map[string]any{"error": err}})
+		utils.GocloakErrorHandler(c, l, err)
+		return
+	}
+	logDeletedNodes(l, tree, ctx.Username)
+
+	utils.SendSuccess(c, opGroupDeleteTree, utils.NewMutationResponse(map[string]any{"dryRun": false, "tree": tree}, ctx.Username))
+	emitGroupEvent(ctx.Service, utils.EventGroupDeleted, ctx.Realm, *grp.ID, ctx.Username)
+}
+
+// logDeletedNodes logs every node of a deleted tree, children after their parent
+func logDeletedNodes(l *logharbour.Logger, node groupTreeNode, by string) {
+	l.LogActivity("Group deleted:", map[string]any{"id": gocloak.PString(node.ID), "path": gocloak.PString(node.Path), "by": by})
+	for _, child := range node.Children {
+		logDeletedNodes(l, child, by)
+	}
+}
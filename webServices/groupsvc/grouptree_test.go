@@ -0,0 +1,185 @@
+package groupsvc
+
+import (
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/remiges-tech/idshield/internal/keycloaktest"
+	"github.com/remiges-tech/idshield/utils"
+)
+
+// treePaths flattens a tree into its paths, depth first
+func treePaths(nodes []groupTreeNode) []string {
+	paths := []string{}
+	for _, node := range nodes {
+		paths = append(paths, *node.Path)
+		paths = append(paths, treePaths(node.Children)...)
+	}
+	return paths
+}
+
+func TestGroupTree(t *testing.T) {
+	kc := keycloaktest.NewServer(t)
+	realm := kc.Realm("acme")
+	realm.AddGroup("/org/sales/emea", nil)
+	realm.AddGroup("/org/sales/apac", nil)
+	realm.AddGroup("/org/support", nil)
+	realm.AddGroup("/partners", nil)
+	s, _ := keycloaktest.NewService()
+	s.WithDependency("gocloak", kc.Client())
+
+	w := keycloaktest.Do(s, Group_tree, keycloaktest.NewRequest(http.MethodGet, "/grouptree", keycloaktest.Token("acme", "alice"), nil))
+	var tree []groupTreeNode
+	keycloaktest.Decode(t, w, &tree)
+	want := []string{"/org", "/org/sales", "/org/sales/emea", "/org/sales/apac", "/org/support", "/partners"}
+	if got := treePaths(tree); w.Code != http.StatusOK || !reflect.DeepEqual(got, want) {
+		t.Errorf("Group_tree() = %d %v, want %v", w.Code, got, want)
+	}
+}
+
+func TestGroupTreeMaxDepth(t *testing.T) {
+	kc := keycloaktest.NewServer(t)
+	path := strings.Repeat("/g", maxTreeDepth+2)
+	kc.Realm("acme").AddGroup(path, nil)
+	s, _ := keycloaktest.NewService()
+	s.WithDependency("gocloak", kc.Client())
+
+	w := keycloaktest.Do(s, Group_tree, keycloaktest.NewRequest(http.MethodGet, "/grouptree", keycloaktest.Token("acme", "alice"), nil))
+	var tree []groupTreeNode
+	keycloaktest.Decode(t, w, &tree)
+	if got := len(treePaths(tree)); w.Code != http.StatusOK || got != maxTreeDepth {
+		t.Errorf("Group_tree() = %d with %d levels, want %d", w.Code, got, maxTreeDepth)
+	}
+}
+
+func TestGroupAncestry(t *testing.T) {
+	kc := keycloaktest.NewServer(t)
+	realm := kc.Realm("acme")
+	emea := realm.AddGroup("/org/sales/emea", nil)
+	realm.AddGroup("/org/support", nil)
+	s, _ := keycloaktest.NewService()
+	s.WithDependency("gocloak", kc.Client())
+	want := []string{realm.Group("/org").ID, realm.Group("/org/sales").ID, emea.ID}
+
+	for _, query := range []string{"path=/org/sales/emea", "path=org/sales/emea", "id=" + emea.ID} {
+		t.Run(query, func(t *testing.T) {
+			w := keycloaktest.Do(s, Group_ancestry, keycloaktest.NewRequest(http.MethodGet, "/groupancestry?"+query, keycloaktest.Token("acme", "alice"), nil))
+			var data struct {
+				Ancestry []ancestorResponse `json:"ancestry"`
+			}
+			keycloaktest.Decode(t, w, &data)
+			got := []string{}
+			for _, ancestor := range data.Ancestry {
+				got = append(got, *ancestor.ID)
+			}
+			if w.Code != http.StatusOK || !reflect.DeepEqual(got, want) {
+				t.Errorf("Group_ancestry() = %d %v, want %v", w.Code, got, want)
+			}
+		})
+	}
+
+	w := keycloaktest.Do(s, Group_ancestry, keycloaktest.NewRequest(http.MethodGet, "/groupancestry?path=/org/marketing", keycloaktest.Token("acme", "alice"), nil))
+	if w.Code == http.StatusOK {
+		t.Errorf("Group_ancestry(unknown path) = %d %s, want an error", w.Code, w.Body)
+	}
+}
+
+func TestGroupChildCount(t *testing.T) {
+	kc := keycloaktest.NewServer(t)
+	realm := kc.Realm("acme")
+	sales := realm.AddGroup("/sales", nil)
+	realm.AddGroup("/sales/emea/uk", nil)
+	realm.AddGroup("/sales/apac", nil)
+	realm.AddGroup("/sales/amer", nil)
+	leaf := realm.AddGroup("/support", nil)
+	s, _ := keycloaktest.NewService()
+	s.WithDependency("gocloak", kc.Client())
+
+	// the grandchild uk isn't an immediate subgroup and isn't counted
+	tests := []struct {
+		query string
+		want  int
+	}{
+		{"path=/sales", 3},
+		{"path=sales", 3},
+		{"id=" + sales.ID, 3},
+		{"id=" + leaf.ID, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			w := keycloaktest.Do(s, Group_childCount, keycloaktest.NewRequest(http.MethodGet, "/groupchildcount?"+tt.query, keycloaktest.Token("acme", "alice"), nil))
+			var data struct {
+				ChildCount int `json:"childCount"`
+			}
+			keycloaktest.Decode(t, w, &data)
+			if w.Code != http.StatusOK || data.ChildCount != tt.want {
+				t.Errorf("Group_childCount() = %d %s, want childCount %d", w.Code, w.Body, tt.want)
+			}
+		})
+	}
+
+	w := keycloaktest.Do(s, Group_childCount, keycloaktest.NewRequest(http.MethodGet, "/groupchildcount?path=/sales&id="+sales.ID, keycloaktest.Token("acme", "alice"), nil))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Group_childCount(path and id) = %d %s, want 400", w.Code, w.Body)
+	}
+}
+
+func TestGroupDeleteTree(t *testing.T) {
+	tests := []struct {
+		name        string
+		confirm     bool
+		wantDeleted bool
+	}{
+		{"dry run", false, false},
+		{"confirmed", true, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kc := keycloaktest.NewServer(t)
+			realm := kc.Realm("acme")
+			realm.AddGroup("/org/sales/emea", nil)
+			realm.AddGroup("/org/sales/apac", nil)
+			realm.AddGroup("/org/support", nil)
+			realm.AddGroup("/partners", nil)
+			s, logs := keycloaktest.NewService()
+			s.WithDependency("gocloak", kc.Client())
+			query := "path=/org"
+			if tt.confirm {
+				query += "&confirm=true"
+			}
+
+			w := keycloaktest.Do(s, Group_deleteTree, keycloaktest.NewRequest(http.MethodDelete, "/groupdeletetree?"+query, keycloaktest.Token("acme", "alice"), nil))
+			var data struct {
+				DryRun bool          `json:"dryRun"`
+				Tree   groupTreeNode `json:"tree"`
+			}
+			if tt.confirm {
+				keycloaktest.Decode(t, w, &utils.MutationResult{Result: &data})
+			} else {
+				keycloaktest.Decode(t, w, &data)
+			}
+			if w.Code != http.StatusOK || data.DryRun == tt.confirm {
+				t.Fatalf("Group_deleteTree() = %d %s, want 200 with dryRun %v", w.Code, w.Body, !tt.confirm)
+			}
+			// the listing nests every subgroup under its parent
+			want := []string{"/org", "/org/sales", "/org/sales/emea", "/org/sales/apac", "/org/support"}
+			if got := treePaths([]groupTreeNode{data.Tree}); !reflect.DeepEqual(got, want) {
+				t.Errorf("tree = %v, want %v", got, want)
+			}
+			if len(data.Tree.Children) != 2 || len(data.Tree.Children[0].Children) != 2 || len(data.Tree.Children[1].Children) != 0 {
+				t.Errorf("tree = %+v, want sales with 2 subgroups and support with none under org", data.Tree)
+			}
+			if deleted := realm.Group("/org") == nil; deleted != tt.wantDeleted {
+				t.Errorf("/org deleted = %v, want %v", deleted, tt.wantDeleted)
+			}
+			if realm.Group("/partners") == nil {
+				t.Error("/partners was deleted along with /org")
+			}
+			if got := strings.Count(logs.String(), "Group deleted:"); tt.confirm && got != len(want) {
+				t.Errorf("%d deleted nodes logged, want %d", got, len(want))
+			}
+		})
+	}
+}
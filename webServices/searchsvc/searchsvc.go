@@ -0,0 +1,140 @@
+package searchsvc
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/Nerzal/gocloak/v13"
+	"github.com/gin-gonic/gin"
+	"github.com/remiges-tech/alya/router"
+	"github.com/remiges-tech/alya/service"
+	"github.com/remiges-tech/alya/wscutils"
+	"github.com/remiges-tech/idshield/types"
+	"github.com/remiges-tech/idshield/utils"
+	"github.com/remiges-tech/logharbour/logharbour"
+)
+
+// maxResultsPerType caps the groups and the users returned by a single global search
+const maxResultsPerType = 10
+
+// type discriminators of the combined search results
+const (
+	resultTypeGroup = "group"
+	resultTypeUser  = "user"
+)
+
+type searchResult struct {
+	Type string  `json:"type"`
+	ID   *string `json:"id,omitempty"`
+	Name *string `json:"name,omitempty"`
+	// Path is set for groups, Email for users
+	Path  *string `json:"path,omitempty"`
+	Email *string `json:"email,omitempty"`
+}
+
+// Search_global handles the GET /searchglobal request, it searches the realm's groups and users for q
+// concurrently and returns both in a single list, each entry tagged with its type
+func Search_global(c *gin.Context, s *service.Service) {
+	l := s.LogHarbour.WithRemoteIP(c.ClientIP())
+	l.Log("Starting execution of Search_global()")
+	token, err := router.ExtractToken(c.GetHeader("Authorization"))
+	if err != nil {
+		l.Debug0().LogDebug("Missing or incorrect Authorization header format:", logharbour.DebugInfo{Variables: map[string]any{"error": err}})
+		wscutils.SendErrorResponse(c, wscutils.NewErrorResponse(utils.ErrTokenMissing))
+		return
+	}
+	r, err := utils.ExtractClaimFromJwt(token, "iss")
+	if err != nil {
+		l.Debug0().LogDebug("Missing or incorrect realm:", logharbour.DebugInfo{Variables: map[string]any{"error": err}})
+		wscutils.SendErrorResponse(c, wscutils.NewErrorResponse(utils.ErrRealmNotFound))
+		return
+	}
+	parts := strings.Split(r, "/realms/")
+	if len(parts) != 2 {
+		l.Debug0().LogDebug("Missing or incorrect realm:", logharbour.DebugInfo{Variables: map[string]any{"iss": r}})
+		wscutils.SendErrorResponse(c, wscutils.NewErrorResponse(utils.ErrRealmNotFound))
+		return
+	}
+	realm := parts[1]
+	username, err := utils.ExtractClaimFromJwt(token, "preferred_username")
+	if err != nil {
+		l.Debug0().LogDebug("Missing username:", logharbour.DebugInfo{Variables: map[string]any{"error": err}})
+		wscutils.SendErrorResponse(c, wscutils.NewErrorResponse(utils.ErrUserNotFound))
+		return
+	}
+
+	isCapable, _ := utils.Authz_check(types.OpReq{
+		User:      username,
+		CapNeeded: []string{utils.CapGroupRead, utils.CapUserRead},
+	}, false)
+
+	if !isCapable {
+		l.Log("Unauthorized user:")
+		wscutils.SendErrorResponse(c, wscutils.NewErrorResponse(utils.ErrUnauthorized))
+		return
+	}
+
+	q := c.Query("q")
+	if q == "" {
+		l.Log("q missing")
+		wscutils.SendErrorResponse(c, wscutils.NewResponse(wscutils.ErrorStatus, nil, []wscutils.ErrorMessage{wscutils.BuildErrorMessage(wscutils.ErrcodeMissing, nil, "q")}))
+		return
+	}
+
+	// Extracting the GoCloak client from the service dependencies
+	gcClient, ok := s.Dependencies["gocloak"].(*gocloak.GoCloak)
+	if !ok {
+		l.Log("Failed to load the dependency to *gocloak.GoCloak")
+		wscutils.SendErrorResponse(c, wscutils.NewErrorResponse(utils.ErrFailedToLoadDependence))
+		return
+	}
+
+	var (
+		wg                  sync.WaitGroup
+		groups              []*gocloak.Group
+		users               []*gocloak.User
+		groupsErr, usersErr error
+	)
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		groups, groupsErr = gcClient.GetGroups(c, token, realm, gocloak.GetGroupsParams{
+			Search:              &q,
+			Max:                 gocloak.IntP(maxResultsPerType),
+			BriefRepresentation: gocloak.BoolP(true),
+		})
+	}()
+	go func() {
+		defer wg.Done()
+		users, usersErr = gcClient.GetUsers(c, token, realm, gocloak.GetUsersParams{
+			Search:              &q,
+			Max:                 gocloak.IntP(maxResultsPerType),
+			BriefRepresentation: gocloak.BoolP(true),
+		})
+	}()
+	wg.Wait()
+	for _, err := range []error{groupsErr, usersErr} {
+		if err != nil {
+			utils.GocloakErrorHandler(c, l, err)
+			return
+		}
+	}
+
+	results := []searchResult{}
+	for i, grp := range groups {
+		if i == maxResultsPerType {
+			break
+		}
+		results = append(results, searchResult{Type: resultTypeGroup, ID: grp.ID, Name: grp.Name, Path: grp.Path})
+	}
+	for i, user := range users {
+		if i == maxResultsPerType {
+			break
+		}
+		results = append(results, searchResult{Type: resultTypeUser, ID: user.ID, Name: user.Username, Email: user.Email})
+	}
+
+	wscutils.SendSuccessResponse(c, wscutils.NewSuccessResponse(results))
+
+	l.Log("Finished execution of Search_global()")
+}
@@ -0,0 +1,46 @@
+package searchsvc
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/remiges-tech/alya/wscutils"
+	"github.com/remiges-tech/idshield/internal/keycloaktest"
+)
+
+func TestSearchGlobal(t *testing.T) {
+	kc := keycloaktest.NewServer(t)
+	realm := kc.Realm("acme")
+	realm.AddGroup("/finance", nil)
+	realm.AddGroup("/hr", nil)
+	realm.AddUser("finn", true)
+	realm.AddUser("alice", true)
+	s, _ := keycloaktest.NewService()
+	s.WithDependency("gocloak", kc.Client())
+
+	w := keycloaktest.Do(s, Search_global, keycloaktest.NewRequest(http.MethodGet, "/searchglobal?q=fin", keycloaktest.Token("acme", "alice"), nil))
+	var results []searchResult
+	keycloaktest.Decode(t, w, &results)
+	got := []string{}
+	for _, result := range results {
+		got = append(got, result.Type+":"+*result.Name)
+	}
+	want := []string{"group:finance", "user:finn"}
+	if w.Code != http.StatusOK || !reflect.DeepEqual(got, want) {
+		t.Errorf("Search_global() = %d %v, want %v", w.Code, got, want)
+	}
+}
+
+func TestSearchGlobalMissingQuery(t *testing.T) {
+	kc := keycloaktest.NewServer(t)
+	kc.Realm("acme")
+	s, _ := keycloaktest.NewService()
+	s.WithDependency("gocloak", kc.Client())
+
+	w := keycloaktest.Do(s, Search_global, keycloaktest.NewRequest(http.MethodGet, "/searchglobal", keycloaktest.Token("acme", "alice"), nil))
+	resp := keycloaktest.Decode(t, w, nil)
+	if w.Code != http.StatusBadRequest || !reflect.DeepEqual(resp.ErrCodes(), []string{wscutils.ErrcodeMissing}) {
+		t.Errorf("Search_global() = %d %s, want 400 %s", w.Code, w.Body, wscutils.ErrcodeMissing)
+	}
+}
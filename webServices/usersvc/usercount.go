@@ -0,0 +1,93 @@
+package usersvc
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/Nerzal/gocloak/v13"
+	"github.com/gin-gonic/gin"
+	"github.com/remiges-tech/alya/router"
+	"github.com/remiges-tech/alya/service"
+	"github.com/remiges-tech/alya/wscutils"
+	"github.com/remiges-tech/idshield/types"
+	"github.com/remiges-tech/idshield/utils"
+	"github.com/remiges-tech/logharbour/logharbour"
+)
+
+// User_count handles the GET /usercount request, it returns the number of users in the realm.
+// The optional enabledOnly and search query params narrow the count
+func User_count(c *gin.Context, s *service.Service) {
+	l := s.LogHarbour
+	l.Log("Starting execution of User_count()")
+	token, err := router.ExtractToken(c.GetHeader("Authorization"))
+	if err != nil {
+		l.Debug0().LogDebug("Missing or incorrect Authorization header format:", logharbour.DebugInfo{Variables: map[string]any{"error": err}})
+		wscutils.SendErrorResponse(c, wscutils.NewErrorResponse(utils.ErrTokenMissing))
+		return
+	}
+	r, err := utils.ExtractClaimFromJwt(token, "iss")
+	if err != nil {
+		l.Debug0().LogDebug("Missing or incorrect realm:", logharbour.DebugInfo{Variables: map[string]any{"error": err}})
+		wscutils.SendErrorResponse(c, wscutils.NewErrorResponse(utils.ErrRealmNotFound))
+		return
+	}
+	parts := strings.Split(r, "/realms/")
+	if len(parts) != 2 {
+		l.Debug0().LogDebug("Missing or incorrect realm:", logharbour.DebugInfo{Variables: map[string]any{"iss": r}})
+		wscutils.SendErrorResponse(c, wscutils.NewErrorResponse(utils.ErrRealmNotFound))
+		return
+	}
+	realm := parts[1]
+	username, err := utils.ExtractClaimFromJwt(token, "preferred_username")
+	if err != nil {
+		l.Debug0().LogDebug("Missing username:", logharbour.DebugInfo{Variables: map[string]any{"error": err}})
+		wscutils.SendErrorResponse(c, wscutils.NewErrorResponse(utils.ErrUserNotFound))
+		return
+	}
+
+	isCapable, _ := utils.Authz_check(types.OpReq{
+		User:      username,
+		CapNeeded: []string{utils.CapUserRead},
+	}, false)
+
+	if !isCapable {
+		l.Log("Unauthorized user:")
+		wscutils.SendErrorResponse(c, wscutils.NewErrorResponse(utils.ErrUnauthorized))
+		return
+	}
+
+	params := gocloak.GetUsersParams{}
+	if v := c.Query("enabledOnly"); v != "" {
+		enabledOnly, err := strconv.ParseBool(v)
+		if err != nil {
+			l.Debug0().LogDebug("Invalid enabledOnly param:", logharbour.DebugInfo{Variables: map[string]any{"error": err}})
+			wscutils.SendErrorResponse(c, wscutils.NewErrorResponse(utils.ErrInvalidParam))
+			return
+		}
+		// without the filter disabled users are counted too, so only true narrows the count
+		if enabledOnly {
+			params.Enabled = gocloak.BoolP(true)
+		}
+	}
+	if search := c.Query("search"); search != "" {
+		params.Search = &search
+	}
+
+	// Extracting the GoCloak client from the service dependencies
+	gcClient, ok := s.Dependencies["gocloak"].(*gocloak.GoCloak)
+	if !ok {
+		l.Log("Failed to load the dependency to *gocloak.GoCloak")
+		wscutils.SendErrorResponse(c, wscutils.NewErrorResponse(utils.ErrFailedToLoadDependence))
+		return
+	}
+
+	count, err := gcClient.GetUserCount(c, token, realm, params)
+	if err != nil {
+		utils.GocloakErrorHandler(c, l, err)
+		return
+	}
+
+	wscutils.SendSuccessResponse(c, wscutils.NewSuccessResponse(map[string]any{"count": count}))
+
+	l.Log("Finished execution of User_count()")
+}
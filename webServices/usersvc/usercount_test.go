@@ -0,0 +1,50 @@
+package usersvc
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/remiges-tech/idshield/internal/keycloaktest"
+	"github.com/remiges-tech/idshield/utils"
+)
+
+func TestUserCount(t *testing.T) {
+	kc := keycloaktest.NewServer(t)
+	realm := kc.Realm("acme")
+	realm.AddUser("alice", true)
+	realm.AddUser("alfred", false)
+	realm.AddUser("bob", true)
+	realm.AddUser("carol", false)
+	s, _ := keycloaktest.NewService()
+	s.WithDependency("gocloak", kc.Client())
+
+	tests := []struct {
+		name  string
+		query string
+		want  int
+	}{
+		{"all", "", 4},
+		{"enabled only", "?enabledOnly=true", 2},
+		{"enabled only false", "?enabledOnly=false", 4},
+		{"search", "?search=al", 2},
+		{"search enabled only", "?search=al&enabledOnly=true", 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := keycloaktest.Do(s, User_count, keycloaktest.NewRequest(http.MethodGet, "/usercount"+tt.query, keycloaktest.Token("acme", "alice"), nil))
+			var data struct {
+				Count int `json:"count"`
+			}
+			keycloaktest.Decode(t, w, &data)
+			if w.Code != http.StatusOK || data.Count != tt.want {
+				t.Errorf("User_count(%s) = %d %d, want %d", tt.query, w.Code, data.Count, tt.want)
+			}
+		})
+	}
+
+	w := keycloaktest.Do(s, User_count, keycloaktest.NewRequest(http.MethodGet, "/usercount?enabledOnly=maybe", keycloaktest.Token("acme", "alice"), nil))
+	if resp := keycloaktest.Decode(t, w, nil); w.Code != http.StatusBadRequest || !reflect.DeepEqual(resp.ErrCodes(), []string{utils.ErrInvalidParam}) {
+		t.Errorf("User_count(enabledOnly=maybe) = %d %s, want 400 %s", w.Code, w.Body, utils.ErrInvalidParam)
+	}
+}
@@ -0,0 +1,73 @@
+package usersvc
+
+import (
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/remiges-tech/alya/service"
+	"github.com/remiges-tech/alya/wscutils"
+	"github.com/remiges-tech/idshield/utils"
+	"github.com/remiges-tech/logharbour/logharbour"
+)
+
+// maxExistsBatch bounds how many usernames one User_existsBatch request may check
+const maxExistsBatch = 1000
+
+type existsBatchRequest struct {
+	Usernames []string `json:"usernames" validate:"required,min=1"`
+}
+
+type existsBatchResponse struct {
+	Existing []string `json:"existing"`
+	Missing  []string `json:"missing"`
+}
+
+// User_existsBatch handles the POST /userexistsbatch request, it reports which of the usernames exist so a
+// client can validate its whole list before a bulk group assignment
+func User_existsBatch(c *gin.Context, s *service.Service) {
+	utils.Handler("User_existsBatch", []string{utils.CapUserRead}, userExistsBatch)(c, s)
+}
+
+// userExistsBatch is the business logic of User_existsBatch, utils.Handler has done the token, realm and authz checks
+func userExistsBatch(ctx utils.HandlerContext) {
+	c, l := ctx.Gin, ctx.Logger
+
+	var req existsBatchRequest
+	if !utils.RequireJSON(c) {
+		l.Log("Unsupported content type")
+		return
+	}
+	if err := wscutils.BindJSON(c, &req); err != nil {
+		l.LogActivity("Error Unmarshalling JSON to struct:", logharbour.DebugInfo{Variables: map[string]any{"Error": err.Error()}})
+		return
+	}
+	if len(req.Usernames) == 0 {
+		l.Log("usernames missing")
+		wscutils.SendErrorResponse(c, wscutils.NewResponse(wscutils.ErrorStatus, nil, []wscutils.ErrorMessage{wscutils.BuildErrorMessage(wscutils.ErrcodeMissing, nil, "usernames")}))
+		return
+	}
+	if len(req.Usernames) > maxExistsBatch {
+		l.Log("too many usernames")
+		str := "usernames"
+		wscutils.SendErrorResponse(c, wscutils.NewResponse(wscutils.ErrorStatus, nil, []wscutils.ErrorMessage{wscutils.BuildErrorMessage(utils.ErrInvalidParam, &str, strconv.Itoa(maxExistsBatch))}))
+		return
+	}
+
+	ids, missing, err := utils.ResolveUserIDs(c, ctx.Client, ctx.Token, ctx.Realm, req.Usernames)
+	if err != nil {
+		utils.GocloakErrorHandler(c, l, err)
+		return
+	}
+
+	// every username is reported once, in the order it was asked for
+	resp := existsBatchResponse{Existing: []string{}, Missing: missing}
+	seen := make(map[string]bool)
+	for _, username := range req.Usernames {
+		if _, ok := ids[username]; ok && !seen[username] {
+			resp.Existing = append(resp.Existing, username)
+			seen[username] = true
+		}
+	}
+
+	wscutils.SendSuccessResponse(c, wscutils.NewSuccessResponse(resp))
+}
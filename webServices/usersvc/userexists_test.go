@@ -0,0 +1,67 @@
+package usersvc
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/remiges-tech/alya/wscutils"
+	"github.com/remiges-tech/idshield/internal/keycloaktest"
+	"github.com/remiges-tech/idshield/utils"
+)
+
+func TestUserExistsBatch(t *testing.T) {
+	tests := []struct {
+		name      string
+		usernames []string
+		want      existsBatchResponse
+	}{
+		// a single username is searched for, several are resolved by listing the realm's few users
+		{"one existing", []string{"bob"}, existsBatchResponse{Existing: []string{"bob"}, Missing: []string{}}},
+		{"one missing", []string{"dave"}, existsBatchResponse{Existing: []string{}, Missing: []string{"dave"}}},
+		{"mixed", []string{"carol", "dave", "Alice", "erin", "carol"}, existsBatchResponse{Existing: []string{"carol", "Alice"}, Missing: []string{"dave", "erin"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kc := keycloaktest.NewServer(t)
+			realm := kc.Realm("acme")
+			realm.AddUser("alice", true)
+			realm.AddUser("bob", true)
+			realm.AddUser("carol", false)
+			s, _ := keycloaktest.NewService()
+			s.WithDependency("gocloak", kc.Client())
+
+			w := keycloaktest.Do(s, User_existsBatch, keycloaktest.NewRequest(http.MethodPost, "/userexistsbatch", keycloaktest.Token("acme", "alice"), keycloaktest.Data(existsBatchRequest{Usernames: tt.usernames})))
+			var data existsBatchResponse
+			keycloaktest.Decode(t, w, &data)
+			if w.Code != http.StatusOK || !reflect.DeepEqual(data, tt.want) {
+				t.Errorf("User_existsBatch() = %d %+v, want %+v", w.Code, data, tt.want)
+			}
+		})
+	}
+}
+
+func TestUserExistsBatchInvalid(t *testing.T) {
+	kc := keycloaktest.NewServer(t)
+	s, _ := keycloaktest.NewService()
+	s.WithDependency("gocloak", kc.Client())
+	tooMany := make([]string, maxExistsBatch+1)
+	for i := range tooMany {
+		tooMany[i] = "user"
+	}
+
+	for name, tt := range map[string]struct {
+		usernames []string
+		wantErr   string
+	}{
+		"empty":    {[]string{}, wscutils.ErrcodeMissing},
+		"too many": {tooMany, utils.ErrInvalidParam},
+	} {
+		t.Run(name, func(t *testing.T) {
+			w := keycloaktest.Do(s, User_existsBatch, keycloaktest.NewRequest(http.MethodPost, "/userexistsbatch", keycloaktest.Token("acme", "alice"), keycloaktest.Data(existsBatchRequest{Usernames: tt.usernames})))
+			if resp := keycloaktest.Decode(t, w, nil); w.Code != http.StatusBadRequest || !reflect.DeepEqual(resp.ErrCodes(), []string{tt.wantErr}) {
+				t.Errorf("User_existsBatch() = %d %s, want 400 %s", w.Code, w.Body, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,147 @@
+package usersvc
+
+import (
+	"strings"
+
+	"github.com/Nerzal/gocloak/v13"
+	"github.com/gin-gonic/gin"
+	"github.com/remiges-tech/alya/router"
+	"github.com/remiges-tech/alya/service"
+	"github.com/remiges-tech/alya/wscutils"
+	"github.com/remiges-tech/idshield/types"
+	"github.com/remiges-tech/idshield/utils"
+	"github.com/remiges-tech/logharbour/logharbour"
+)
+
+// per-group outcomes reported by User_addToGroups
+const (
+	groupStatusAdded         = "added"
+	groupStatusAlreadyMember = "already_member"
+	groupStatusNotFound      = "not_found"
+	groupStatusError         = "error"
+)
+
+type addToGroupsRequest struct {
+	Username string   `json:"username" validate:"required"`
+	Groups   []string `json:"groups" validate:"required,min=1"`
+}
+
+type addToGroupResult struct {
+	ShortName string `json:"shortName"`
+	Status    string `json:"status"`
+	Error     string `json:"error,omitempty"`
+}
+
+// User_addToGroups handles the POST /useraddtogroups request, it adds one user to several groups on a best-effort
+// basis and reports the outcome for each group
+func User_addToGroups(c *gin.Context, s *service.Service) {
+	l := s.LogHarbour
+	l.Log("Starting execution of User_addToGroups()")
+	token, err := router.ExtractToken(c.GetHeader("Authorization"))
+	if err != nil {
+		l.Debug0().LogDebug("Missing or incorrect Authorization header format:", logharbour.DebugInfo{Variables: map[string]any{"error": err}})
+		wscutils.SendErrorResponse(c, wscutils.NewErrorResponse(utils.ErrTokenMissing))
+		return
+	}
+	r, err := utils.ExtractClaimFromJwt(token, "iss")
+	if err != nil {
+		l.Debug0().LogDebug("Missing or incorrect realm:", logharbour.DebugInfo{Variables: map[string]any{"error": err}})
+		wscutils.SendErrorResponse(c, wscutils.NewErrorResponse(utils.ErrRealmNotFound))
+		return
+	}
+	parts := strings.Split(r, "/realms/")
+	if len(parts) != 2 {
+		l.Debug0().LogDebug("Missing or incorrect realm:", logharbour.DebugInfo{Variables: map[string]any{"iss": r}})
+		wscutils.SendErrorResponse(c, wscutils.NewErrorResponse(utils.ErrRealmNotFound))
+		return
+	}
+	realm := parts[1]
+	username, err := utils.ExtractClaimFromJwt(token, "preferred_username")
+	if err != nil {
+		l.Debug0().LogDebug("Missing username:", logharbour.DebugInfo{Variables: map[string]any{"error": err}})
+		wscutils.SendErrorResponse(c, wscutils.NewErrorResponse(utils.ErrUserNotFound))
+		return
+	}
+
+	isCapable, _ := utils.Authz_check(types.OpReq{
+		User:      username,
+		CapNeeded: []string{utils.CapGroupMemberAdd},
+	}, false)
+
+	if !isCapable {
+		l.Log("Unauthorized user:")
+		wscutils.SendErrorResponse(c, wscutils.NewErrorResponse(utils.ErrUnauthorized))
+		return
+	}
+
+	var req addToGroupsRequest
+	if !utils.RequireJSON(c) {
+		l.Log("Unsupported content type")
+		return
+	}
+	if err = wscutils.BindJSON(c, &req); err != nil {
+		l.LogActivity("Error Unmarshalling JSON to struct:", logharbour.DebugInfo{Variables: map[string]any{"Error": err.Error()}})
+		return
+	}
+	if req.Username == "" || len(req.Groups) == 0 {
+		l.Log("username or groups missing")
+		wscutils.SendErrorResponse(c, wscutils.NewResponse(wscutils.ErrorStatus, nil, []wscutils.ErrorMessage{wscutils.BuildErrorMessage(wscutils.ErrcodeMissing, nil, "username", "groups")}))
+		return
+	}
+
+	// Extracting the GoCloak client from the service dependencies
+	gcClient, ok := s.Dependencies["gocloak"].(*gocloak.GoCloak)
+	if !ok {
+		l.Log("Failed to load the dependency to *gocloak.GoCloak")
+		wscutils.SendErrorResponse(c, wscutils.NewErrorResponse(utils.ErrFailedToLoadDependence))
+		return
+	}
+
+	users, err := gcClient.GetUsers(c, token, realm, gocloak.GetUsersParams{
+		Username: &req.Username,
+		Exact:    gocloak.BoolP(true),
+	})
+	if err != nil {
+		utils.GocloakErrorHandler(c, l, err)
+		return
+	}
+	if len(users) == 0 {
+		l.Log("Error while gcClient.GetUsers user doesn't exist ")
+		str := "username"
+		wscutils.SendErrorResponse(c, wscutils.NewResponse("error", nil, []wscutils.ErrorMessage{wscutils.BuildErrorMessage(utils.ErrNotExist, &str)}))
+		return
+	}
+	userID := *users[0].ID
+
+	groupIDs, _, err := utils.ResolveGroupIDs(c, s, token, realm, req.Groups)
+	if err != nil {
+		utils.GocloakErrorHandler(c, l, err)
+		return
+	}
+
+	results := []addToGroupResult{}
+	for _, shortName := range req.Groups {
+		result := addToGroupResult{ShortName: shortName}
+		groupID, ok := groupIDs[shortName]
+		if !ok {
+			result.Status = groupStatusNotFound
+			results = append(results, result)
+			continue
+		}
+		added, err := utils.AddUserToGroupIfAbsent(c, gcClient, token, realm, userID, groupID)
+		switch {
+		case err != nil:
+			result.Status, result.Error = groupStatusError, err.Error()
+		case added:
+			result.Status = groupStatusAdded
+		default:
+			result.Status = groupStatusAlreadyMember
+		}
+		results = append(results, result)
+	}
+	l.LogActivity("User added to groups:", map[string]any{"username": req.Username, "results": results})
+
+	wscutils.SendSuccessResponse(c, utils.NewMutationResponse(map[string]any{"results": results}, username))
+
+	l.Log("Finished execution of User_addToGroups()")
+}
@@ -0,0 +1,54 @@
+package usersvc
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/remiges-tech/idshield/internal/keycloaktest"
+	"github.com/remiges-tech/idshield/utils"
+)
+
+func TestUserAddToGroups(t *testing.T) {
+	kc := keycloaktest.NewServer(t)
+	realm := kc.Realm("acme")
+	bob := realm.AddUser("bob", true)
+	sales := realm.AddGroup("/sales", nil)
+	// bob is already in support, which is reported rather than added again
+	support := realm.AddGroup("/support", nil).AddMembers(bob)
+	s, _ := keycloaktest.NewService()
+	s.WithDependency("gocloak", kc.Client()).WithDependency("keycloakURL", kc.URL)
+	body := addToGroupsRequest{Username: "bob", Groups: []string{"sales", "marketing", "support"}}
+
+	w := keycloaktest.Do(s, User_addToGroups, keycloaktest.NewRequest(http.MethodPost, "/useraddtogroups", keycloaktest.Token("acme", "alice"), keycloaktest.Data(body)))
+	var data struct {
+		Results []addToGroupResult `json:"results"`
+	}
+	keycloaktest.Decode(t, w, &utils.MutationResult{Result: &data})
+	want := []addToGroupResult{
+		{ShortName: "sales", Status: groupStatusAdded},
+		{ShortName: "marketing", Status: groupStatusNotFound},
+		{ShortName: "support", Status: groupStatusAlreadyMember},
+	}
+	if w.Code != http.StatusOK || !reflect.DeepEqual(data.Results, want) {
+		t.Errorf("User_addToGroups() = %d %+v, want %+v", w.Code, data.Results, want)
+	}
+	for _, grp := range []*keycloaktest.Group{sales, support} {
+		if len(grp.Members) != 1 || grp.Members[0] != bob {
+			t.Errorf("members of %s = %v, want bob", grp.Name, grp.Members)
+		}
+	}
+}
+
+func TestUserAddToGroupsUnknownUser(t *testing.T) {
+	kc := keycloaktest.NewServer(t)
+	kc.Realm("acme").AddGroup("/sales", nil)
+	s, _ := keycloaktest.NewService()
+	s.WithDependency("gocloak", kc.Client()).WithDependency("keycloakURL", kc.URL)
+	body := addToGroupsRequest{Username: "bob", Groups: []string{"sales"}}
+
+	w := keycloaktest.Do(s, User_addToGroups, keycloaktest.NewRequest(http.MethodPost, "/useraddtogroups", keycloaktest.Token("acme", "alice"), keycloaktest.Data(body)))
+	if resp := keycloaktest.Decode(t, w, nil); w.Code != http.StatusBadRequest || !reflect.DeepEqual(resp.ErrCodes(), []string{utils.ErrNotExist}) {
+		t.Errorf("User_addToGroups() = %d %s, want 400 %s", w.Code, w.Body, utils.ErrNotExist)
+	}
+}
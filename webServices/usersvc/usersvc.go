@@ -85,6 +85,11 @@ func User_new(c *gin.Context, s *service.Service) {
 		return
 	}
 	parts := strings.Split(r, "/realms/")
+	if len(parts) != 2 {
+		l.Debug0().LogDebug("Missing or incorrect realm:", logharbour.DebugInfo{Variables: map[string]any{"iss": r}})
+		wscutils.SendErrorResponse(c, wscutils.NewErrorResponse(utils.ErrRealmNotFound))
+		return
+	}
 	realm := parts[1]
 	username, err := utils.ExtractClaimFromJwt(token, "preferred_username")
 	if err != nil {
@@ -95,7 +100,7 @@ func User_new(c *gin.Context, s *service.Service) {
 
 	isCapable, _ := utils.Authz_check(types.OpReq{
 		User:      username,
-		CapNeeded: []string{"UserCreate"},
+		CapNeeded: []string{utils.CapUserCreate},
 	}, false)
 
 	if !isCapable {
@@ -106,6 +111,10 @@ func User_new(c *gin.Context, s *service.Service) {
 
 	var u user
 
+	if !utils.RequireJSON(c) {
+		l.Log("Unsupported content type")
+		return
+	}
 	// Unmarshal JSON request into user struct
 	if err = wscutils.BindJSON(c, &u); err != nil {
 		l.LogActivity("Error Unmarshalling JSON to struct:", logharbour.DebugInfo{Variables: map[string]any{"Error": err.Error()}})
@@ -149,7 +158,7 @@ func User_new(c *gin.Context, s *service.Service) {
 	}
 
 	// Send success response
-	wscutils.SendSuccessResponse(c, &wscutils.Response{Status: wscutils.SuccessStatus, Data: ID, Messages: []wscutils.ErrorMessage{}})
+	wscutils.SendSuccessResponse(c, utils.NewMutationResponse(ID, username))
 
 	l.Log("Finished execution of User_new()")
 }
@@ -196,7 +205,7 @@ func User_list(c *gin.Context, s *service.Service) {
 		return
 	}
 	// Authz_check():
-	isCapable, _ := utils.Authz_check(types.OpReq{User: reqUserName, CapNeeded: []string{"devloper", "admin"}}, false)
+	isCapable, _ := utils.Authz_check(types.OpReq{User: reqUserName, CapNeeded: []string{utils.CapDeveloper, utils.CapAdmin}}, false)
 	if !isCapable {
 		wscutils.SendErrorResponse(c, wscutils.NewResponse(wscutils.ErrorStatus, nil, []wscutils.ErrorMessage{wscutils.BuildErrorMessage(utils.ErrUnauthorized, nil)}))
 		lh.Debug0().Log(utils.ErrUnauthorized)
@@ -295,7 +304,7 @@ func User_get(c *gin.Context, s *service.Service) {
 	reqUserName, _ := utils.ExtractClaimFromJwt(token, "preferred_username")
 
 	// Authz_check():
-	isCapable, _ := utils.Authz_check(types.OpReq{User: reqUserName, CapNeeded: []string{"devloper", "admin"}}, false)
+	isCapable, _ := utils.Authz_check(types.OpReq{User: reqUserName, CapNeeded: []string{utils.CapDeveloper, utils.CapAdmin}}, false)
 	if !isCapable {
 		wscutils.SendErrorResponse(c, wscutils.NewResponse(wscutils.ErrorStatus, nil, []wscutils.ErrorMessage{wscutils.BuildErrorMessage(utils.ErrUserNotAuthorized, nil)}))
 		lh.Debug0().Log(utils.ErrUnauthorized)
@@ -368,6 +377,10 @@ func User_update(c *gin.Context, s *service.Service) {
 	var gcUser *gocloak.User
 	var users []*gocloak.User
 
+	if !utils.RequireJSON(c) {
+		lh.Log("Unsupported content type")
+		return
+	}
 	// step 1: bind request body to struct if not null
 	err := wscutils.BindJSON(c, &gcUser)
 	if err != nil {
@@ -398,7 +411,7 @@ func User_update(c *gin.Context, s *service.Service) {
 		return
 	}
 	// Authz_check():
-	isCapable, _ := utils.Authz_check(types.OpReq{User: reqUserName, CapNeeded: []string{"devloper", "admin"}}, false)
+	isCapable, _ := utils.Authz_check(types.OpReq{User: reqUserName, CapNeeded: []string{utils.CapDeveloper, utils.CapAdmin}}, false)
 	if !isCapable {
 		wscutils.SendErrorResponse(c, wscutils.NewResponse(wscutils.ErrorStatus, nil, []wscutils.ErrorMessage{wscutils.BuildErrorMessage(utils.ErrUserNotAuthorized, nil)}))
 		lh.Debug0().Log(utils.ErrUserNotAuthorized)
@@ -435,7 +448,7 @@ func User_update(c *gin.Context, s *service.Service) {
 	}
 
 	// step 5: if there are no errors, send success response
-	wscutils.SendSuccessResponse(c, wscutils.NewSuccessResponse([]string{}))
+	wscutils.SendSuccessResponse(c, utils.NewMutationResponse(nil, reqUserName))
 }
 
 // User_delete handles the DELETE /userdelete request
@@ -460,7 +473,7 @@ func User_delete(c *gin.Context, s *service.Service) {
 	reqUserName, _ := utils.ExtractClaimFromJwt(token, "preferred_username")
 
 	// Authz_check():
-	isCapable, _ := utils.Authz_check(types.OpReq{User: reqUserName, CapNeeded: []string{"devloper", "admin"}}, false)
+	isCapable, _ := utils.Authz_check(types.OpReq{User: reqUserName, CapNeeded: []string{utils.CapDeveloper, utils.CapAdmin}}, false)
 	if !isCapable {
 		wscutils.SendErrorResponse(c, wscutils.NewResponse(wscutils.ErrorStatus, nil, []wscutils.ErrorMessage{wscutils.BuildErrorMessage(utils.ErrUserNotAuthorized, nil)}))
 		lh.Debug0().Log(utils.ErrUserNotAuthorized)
@@ -525,7 +538,7 @@ func User_delete(c *gin.Context, s *service.Service) {
 
 	// step 5: if there are no errors, send success response
 	lh.Log(fmt.Sprintf("User found: %v", map[string]any{"response": "user deleted success"}))
-	wscutils.SendSuccessResponse(c, nil)
+	wscutils.SendSuccessResponse(c, utils.NewMutationResponse(nil, reqUserName))
 }
 
 // User_activate handles the DELETE /Useractivate request
@@ -545,6 +558,11 @@ func User_activate(c *gin.Context, s *service.Service) {
 		return
 	}
 	parts := strings.Split(r, "/realms/")
+	if len(parts) != 2 {
+		l.Debug0().LogDebug("Missing or incorrect realm:", logharbour.DebugInfo{Variables: map[string]any{"iss": r}})
+		wscutils.SendErrorResponse(c, wscutils.NewErrorResponse(utils.ErrRealmNotFound))
+		return
+	}
 	realm := parts[1]
 	username, err := utils.ExtractClaimFromJwt(token, "preferred_username")
 	if err != nil {
@@ -555,7 +573,7 @@ func User_activate(c *gin.Context, s *service.Service) {
 
 	isCapable, _ := utils.Authz_check(types.OpReq{
 		User:      username,
-		CapNeeded: []string{"UserActivate"},
+		CapNeeded: []string{utils.CapUserActivate},
 	}, false)
 
 	if !isCapable {
@@ -565,6 +583,10 @@ func User_activate(c *gin.Context, s *service.Service) {
 	}
 
 	var u userActivity
+	if !utils.RequireJSON(c) {
+		l.Log("Unsupported content type")
+		return
+	}
 	err = wscutils.BindJSON(c, &u)
 	if err != nil {
 		l.LogActivity("Error Unmarshalling JSON to struct:", logharbour.DebugInfo{Variables: map[string]any{"Error": err.Error()}})
@@ -621,7 +643,7 @@ func User_activate(c *gin.Context, s *service.Service) {
 	}
 
 	// Send success response
-	wscutils.SendSuccessResponse(c, &wscutils.Response{Status: wscutils.SuccessStatus})
+	wscutils.SendSuccessResponse(c, utils.NewMutationResponse(nil, username))
 
 	l.Log("Finished execution of User_activate()")
 }
@@ -643,6 +665,11 @@ func User_deactivate(c *gin.Context, s *service.Service) {
 		return
 	}
 	parts := strings.Split(r, "/realms/")
+	if len(parts) != 2 {
+		l.Debug0().LogDebug("Missing or incorrect realm:", logharbour.DebugInfo{Variables: map[string]any{"iss": r}})
+		wscutils.SendErrorResponse(c, wscutils.NewErrorResponse(utils.ErrRealmNotFound))
+		return
+	}
 	realm := parts[1]
 	username, err := utils.ExtractClaimFromJwt(token, "preferred_username")
 	if err != nil {
@@ -653,7 +680,7 @@ func User_deactivate(c *gin.Context, s *service.Service) {
 
 	isCapable, _ := utils.Authz_check(types.OpReq{
 		User:      username,
-		CapNeeded: []string{"UserDeactivate"},
+		CapNeeded: []string{utils.CapUserDeactivate},
 	}, false)
 
 	if !isCapable {
@@ -662,6 +689,10 @@ func User_deactivate(c *gin.Context, s *service.Service) {
 		return
 	}
 	var u userActivity
+	if !utils.RequireJSON(c) {
+		l.Log("Unsupported content type")
+		return
+	}
 	err = wscutils.BindJSON(c, &u)
 	if err != nil {
 		l.LogActivity("Error Unmarshalling JSON to struct:", logharbour.DebugInfo{Variables: map[string]any{"Error": err.Error()}})
@@ -680,6 +711,7 @@ func User_deactivate(c *gin.Context, s *service.Service) {
 	if !ok {
 		l.Log("Failed to convert the dependency to *gocloak.GoCloak")
 		wscutils.SendErrorResponse(c, wscutils.NewErrorResponse(utils.ErrFailedToLoadDependence))
+		return
 	}
 
 	var keycloakUser gocloak.User
@@ -717,7 +749,7 @@ func User_deactivate(c *gin.Context, s *service.Service) {
 	}
 
 	// Send success response
-	wscutils.SendSuccessResponse(c, &wscutils.Response{Status: wscutils.SuccessStatus})
+	wscutils.SendSuccessResponse(c, utils.NewMutationResponse(nil, username))
 
 	l.Log("Finished execution of User_activate()")
 }
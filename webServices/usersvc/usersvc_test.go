@@ -0,0 +1,21 @@
+package usersvc
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/remiges-tech/idshield/internal/keycloaktest"
+	"github.com/remiges-tech/idshield/utils"
+)
+
+func TestUserDeactivateMissingGocloak(t *testing.T) {
+	s, _ := keycloaktest.NewService()
+	body := keycloaktest.Data(map[string]any{"username": "bob"})
+
+	w := keycloaktest.Do(s, User_deactivate, keycloaktest.NewRequest(http.MethodPost, "/userdeactivate", keycloaktest.Token("acme", "alice"), body))
+	// a second response written after the first would make the body undecodable
+	if resp := keycloaktest.Decode(t, w, nil); w.Code != http.StatusBadRequest || !reflect.DeepEqual(resp.ErrCodes(), []string{utils.ErrFailedToLoadDependence}) {
+		t.Errorf("User_deactivate() = %d %s, want a single 400 %s", w.Code, w.Body, utils.ErrFailedToLoadDependence)
+	}
+}